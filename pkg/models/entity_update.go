@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+)
+
+// EntityUpdate changes the values of static properties on one component of an entity
+type EntityUpdate struct {
+	EntityId      string `json:"entityId"`
+	ComponentName string `json:"componentName"`
+	// The entity update time the changes were made against.  The update is rejected when the
+	// entity has changed since, so concurrent edits do not silently overwrite each other.
+	UpdateDateTime *time.Time                             `json:"updateDateTime"`
+	Properties     map[string]iottwinmakertypes.DataValue `json:"properties"`
+}
+
+// Validate checks the update has everything needed before the entity is loaded
+func (u *EntityUpdate) Validate() error {
+	e := &ValidationError{}
+	if u.EntityId == "" {
+		e.add("entityId", "is required")
+	}
+	if u.ComponentName == "" {
+		e.add("componentName", "is required")
+	}
+	if u.UpdateDateTime == nil {
+		e.add("updateDateTime", "is required")
+	}
+	if len(u.Properties) == 0 {
+		e.add("properties", "at least one property is required")
+	}
+	if _, ok := u.Properties[""]; ok {
+		e.add("properties", "property names must not be empty")
+	}
+	return e.err()
+}
+
+// EntityConflictError is returned when the entity changed after the update was prepared
+type EntityConflictError struct {
+	EntityId       string
+	UpdateDateTime *time.Time
+	State          string
+}
+
+func (e *EntityConflictError) Error() string {
+	if e.State != "" {
+		return fmt.Sprintf("entity %q can not be updated while it is %s", e.EntityId, e.State)
+	}
+	updated := "unknown"
+	if e.UpdateDateTime != nil {
+		updated = e.UpdateDateTime.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("entity %q was changed at %s, reload it and try again", e.EntityId, updated)
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MaxQueryExpansions limits how many requests a single multi-value query may fan out into
+const MaxQueryExpansions = 100
+
+// ExpansionFilterPrefix starts the labels of values expanded from property filters
+const ExpansionFilterPrefix = "filter."
+
+// SplitMultiValue splits a multi-value template variable into its values.
+// Grafana interpolates multi-value variables as `{a,b,c}` (glob format), and the same
+// syntax can be written by hand in alert rules where no frontend interpolation happens.
+// Any other string is returned as a single value.
+func SplitMultiValue(v string) []string {
+	if len(v) < 2 || !strings.HasPrefix(v, "{") || !strings.HasSuffix(v, "}") {
+		return []string{v}
+	}
+
+	values := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, s := range strings.Split(v[1:len(v)-1], ",") {
+		s = strings.TrimSpace(s)
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		values = append(values, s)
+	}
+	if len(values) == 0 {
+		return []string{v}
+	}
+	return values
+}
+
+// Expand returns one query per combination of multi-valued fields.  Multi-valued properties are
+// flattened into the selected properties of every query since a single request can select several.
+// Each expanded query records the chosen values in Expansion so the results can be labeled.
+func (q *TwinMakerQuery) Expand() ([]TwinMakerQuery, error) {
+	base := *q
+	base.Properties = make([]string, 0, len(q.Properties))
+	for _, p := range q.Properties {
+		for _, v := range SplitMultiValue(p) {
+			if !slices.Contains(base.Properties, v) {
+				base.Properties = append(base.Properties, v)
+			}
+		}
+	}
+
+	// list operators take every value of a multi-value variable in a single request
+	if len(base.PropertyFilter) > 0 {
+		base.PropertyFilter = make([]TwinMakerPropertyFilter, len(q.PropertyFilter))
+		copy(base.PropertyFilter, q.PropertyFilter)
+		for idx, f := range base.PropertyFilter {
+			op, err := f.Operator()
+			if err != nil || (op != FilterOpIn && op != FilterOpNotIn) || f.Value.StringValue == nil {
+				continue
+			}
+			list := make([]TwinMakerFilterValue, 0)
+			for _, v := range SplitMultiValue(*f.Value.StringValue) {
+				list = append(list, TwinMakerFilterValue{StringValue: &v})
+			}
+			base.PropertyFilter[idx].Value = TwinMakerFilterValue{ListValue: list}
+		}
+	}
+
+	queries := []TwinMakerQuery{base}
+	var err error
+
+	queries, err = expandField(queries, "entityId", q.EntityId, func(q *TwinMakerQuery, v string) {
+		q.EntityId = v
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	queries, err = expandField(queries, "componentName", q.ComponentName, func(q *TwinMakerQuery, v string) {
+		q.ComponentName = v
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	queries, err = expandField(queries, "componentTypeId", q.ComponentTypeId, func(q *TwinMakerQuery, v string) {
+		q.ComponentTypeId = v
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, f := range base.PropertyFilter {
+		if f.Value.StringValue == nil {
+			continue
+		}
+		// prefixed, so a filter on a property named like a label of the results can not replace it
+		queries, err = expandField(queries, ExpansionFilterPrefix+f.Name, *f.Value.StringValue, func(q *TwinMakerQuery, v string) {
+			// copy the filters so the expanded queries do not share the backing array
+			filter := make([]TwinMakerPropertyFilter, len(q.PropertyFilter))
+			copy(filter, q.PropertyFilter)
+			filter[idx].Value = TwinMakerFilterValue{StringValue: &v}
+			q.PropertyFilter = filter
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return queries, nil
+}
+
+func expandField(queries []TwinMakerQuery, label string, value string, set func(q *TwinMakerQuery, v string)) ([]TwinMakerQuery, error) {
+	values := SplitMultiValue(value)
+	if len(values) < 2 {
+		return queries, nil
+	}
+
+	if len(queries)*len(values) > MaxQueryExpansions {
+		return nil, fmt.Errorf("multi-value variables expand to more than %d requests", MaxQueryExpansions)
+	}
+
+	expanded := make([]TwinMakerQuery, 0, len(queries)*len(values))
+	for _, q := range queries {
+		for _, v := range values {
+			eq := q
+			set(&eq, v)
+			eq.Expansion = make(map[string]string, len(q.Expansion)+1)
+			for k, ev := range q.Expansion {
+				eq.Expansion[k] = ev
+			}
+			eq.Expansion[label] = v
+			expanded = append(expanded, eq)
+		}
+	}
+	return expanded, nil
+}
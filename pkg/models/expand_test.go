@@ -0,0 +1,57 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitMultiValue(t *testing.T) {
+	require.Equal(t, []string{"Mixer_1"}, SplitMultiValue("Mixer_1"))
+	require.Equal(t, []string{"Mixer_1", "Mixer_2"}, SplitMultiValue("{Mixer_1,Mixer_2}"))
+	require.Equal(t, []string{"Mixer_1", "Mixer_2"}, SplitMultiValue("{Mixer_1, Mixer_2,Mixer_1}"))
+	require.Equal(t, []string{"{}"}, SplitMultiValue("{}"))
+}
+
+func TestExpand(t *testing.T) {
+	t.Run("single values are not expanded", func(t *testing.T) {
+		q := TwinMakerQuery{EntityId: "Mixer_1", ComponentName: "AlarmComponent", Properties: []string{"alarm_status"}}
+		queries, err := q.Expand()
+		require.NoError(t, err)
+		require.Len(t, queries, 1)
+		require.Nil(t, queries[0].Expansion)
+	})
+
+	t.Run("multi-value fields fan out", func(t *testing.T) {
+		q := TwinMakerQuery{
+			EntityId:      "{Mixer_1,Mixer_2}",
+			ComponentName: "AlarmComponent",
+			Properties:    []string{"{alarm_status,alarm_key}"},
+			PropertyFilter: []TwinMakerPropertyFilter{
+				{Name: "alarm_status", Value: TwinMakerFilterValue{StringValue: aws.String("{ACTIVE,NORMAL}")}},
+			},
+		}
+		queries, err := q.Expand()
+		require.NoError(t, err)
+		require.Len(t, queries, 4)
+		for _, eq := range queries {
+			require.Equal(t, []string{"alarm_status", "alarm_key"}, eq.Properties)
+			require.Equal(t, eq.Expansion["entityId"], eq.EntityId)
+			require.Equal(t, eq.Expansion["filter.alarm_status"], *eq.PropertyFilter[0].Value.StringValue)
+		}
+		require.Equal(t, "Mixer_1", queries[0].EntityId)
+		require.Equal(t, "NORMAL", *queries[1].PropertyFilter[0].Value.StringValue)
+		require.Equal(t, "{ACTIVE,NORMAL}", *q.PropertyFilter[0].Value.StringValue)
+	})
+
+	t.Run("too many expansions", func(t *testing.T) {
+		values := "{"
+		for i := 0; i < MaxQueryExpansions+1; i++ {
+			values += string(rune('a'+i%26)) + string(rune('a'+i/26)) + ","
+		}
+		q := TwinMakerQuery{EntityId: values + "}"}
+		_, err := q.Expand()
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,280 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+)
+
+// Operators supported by TwinMaker property filters
+const (
+	FilterOpEqual        = "="
+	FilterOpNotEqual     = "!="
+	FilterOpLess         = "<"
+	FilterOpLessEqual    = "<="
+	FilterOpGreater      = ">"
+	FilterOpGreaterEqual = ">="
+	FilterOpIn           = "IN"
+	FilterOpNotIn        = "NOT IN"
+)
+
+// DefaultFilterOp matches the placeholder text in the frontend
+const DefaultFilterOp = FilterOpEqual
+
+var filterOps = []string{
+	FilterOpEqual, FilterOpNotEqual,
+	FilterOpLess, FilterOpLessEqual,
+	FilterOpGreater, FilterOpGreaterEqual,
+	FilterOpIn, FilterOpNotIn,
+}
+
+var filterOpAliases = map[string]string{
+	"==":     FilterOpEqual,
+	"<>":     FilterOpNotEqual,
+	"NOT_IN": FilterOpNotIn,
+}
+
+// TwinMakerFilterGroup is a set of filters that must all match.  Groups in a query are OR'ed
+// together, and a negated group matches when any of its filters does not match.  A group only
+// applies to the properties it has filters on.
+type TwinMakerFilterGroup struct {
+	Filter []TwinMakerPropertyFilter `json:"filter,omitempty"`
+	Negate bool                      `json:"negate,omitempty"`
+}
+
+// IsEmpty is true for filters left incomplete in the query editor, which are skipped like they
+// always have been so saved dashboards keep working
+func (f *TwinMakerPropertyFilter) IsEmpty() bool {
+	return f.Name == "" || f.Value.DataValueToString() == ""
+}
+
+// Operator returns the normalized operator, or an error when it is not supported
+func (f *TwinMakerPropertyFilter) Operator() (string, error) {
+	op := strings.ToUpper(strings.Join(strings.Fields(f.Op), " "))
+	if op == "" {
+		return DefaultFilterOp, nil
+	}
+	if alias, ok := filterOpAliases[op]; ok {
+		op = alias
+	}
+	for _, o := range filterOps {
+		if o == op {
+			return op, nil
+		}
+	}
+	return "", fmt.Errorf("invalid operator %q in filter on %q, expected one of: %s", f.Op, f.Name, strings.Join(filterOps, ", "))
+}
+
+// Validate checks the filter is complete and its value matches the operator
+func (f *TwinMakerPropertyFilter) Validate() error {
+	if f.Name == "" {
+		return fmt.Errorf("filter is missing a property name")
+	}
+	op, err := f.Operator()
+	if err != nil {
+		return err
+	}
+	isList := f.Value.ListValue != nil
+	switch {
+	case op == FilterOpIn || op == FilterOpNotIn:
+		if !isList || len(f.Value.ListValue) == 0 {
+			return fmt.Errorf("filter on %q with operator %s requires a list value", f.Name, op)
+		}
+	case isList:
+		return fmt.Errorf("filter on %q with operator %s does not accept a list value", f.Name, op)
+	case f.Value.DataValueToString() == "":
+		return fmt.Errorf("filter on %q is missing a value", f.Name)
+	case f.Value.BooleanValue != nil && op != FilterOpEqual && op != FilterOpNotEqual:
+		return fmt.Errorf("filter on %q with operator %s can not compare boolean values", f.Name, op)
+	}
+	return nil
+}
+
+// ToTwinMakerFilters validates and converts the filters, skipping the ones left blank in the editor
+func ToTwinMakerFilters(filters []TwinMakerPropertyFilter) ([]iottwinmakertypes.PropertyFilter, error) {
+	var result []iottwinmakertypes.PropertyFilter
+	for _, f := range filters {
+		if f.IsEmpty() {
+			continue
+		}
+		if err := f.Validate(); err != nil {
+			return nil, err
+		}
+		f.Op, _ = f.Operator()
+		result = append(result, f.ToTwinMakerFilter())
+	}
+	return result, nil
+}
+
+// ValidateFilterGroups checks every filter in the groups
+func ValidateFilterGroups(groups []TwinMakerFilterGroup) error {
+	for _, g := range groups {
+		for _, f := range g.Filter {
+			if f.IsEmpty() {
+				continue
+			}
+			if err := f.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MatchFilterGroups evaluates the groups with filters on the named property against its value.
+// Values of properties no group filters on are kept.
+func MatchFilterGroups(groups []TwinMakerFilterGroup, propertyName string, v *iottwinmakertypes.DataValue) bool {
+	applied := false
+	for _, g := range groups {
+		if !g.FiltersOn(propertyName) {
+			continue
+		}
+		if g.Matches(propertyName, v) {
+			return true
+		}
+		applied = true
+	}
+	return !applied
+}
+
+// FiltersOn is true when the group has a filter on the named property
+func (g *TwinMakerFilterGroup) FiltersOn(propertyName string) bool {
+	for _, f := range g.Filter {
+		if !f.IsEmpty() && f.Name == propertyName {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches is true when every filter on the named property matches the value (or any fails if negated)
+func (g *TwinMakerFilterGroup) Matches(propertyName string, v *iottwinmakertypes.DataValue) bool {
+	match := true
+	for _, f := range g.Filter {
+		if f.IsEmpty() || f.Name != propertyName {
+			continue
+		}
+		if !f.Matches(v) {
+			match = false
+			break
+		}
+	}
+	return match != g.Negate
+}
+
+// Matches evaluates the filter against a single value
+func (f *TwinMakerPropertyFilter) Matches(v *iottwinmakertypes.DataValue) bool {
+	if v == nil {
+		return false
+	}
+	op, err := f.Operator()
+	if err != nil {
+		return false
+	}
+
+	switch op {
+	case FilterOpIn, FilterOpNotIn:
+		found := false
+		for _, lv := range f.Value.ListValue {
+			if c, ok := compareDataValue(v, &lv); ok && c == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (op == FilterOpIn)
+	}
+
+	c, ok := compareDataValue(v, &f.Value)
+	if !ok {
+		return op == FilterOpNotEqual
+	}
+	switch op {
+	case FilterOpEqual:
+		return c == 0
+	case FilterOpNotEqual:
+		return c != 0
+	case FilterOpLess:
+		return c < 0
+	case FilterOpLessEqual:
+		return c <= 0
+	case FilterOpGreater:
+		return c > 0
+	case FilterOpGreaterEqual:
+		return c >= 0
+	}
+	return false
+}
+
+// compareDataValue compares a property value to a filter value.  Numbers are compared across
+// their types, and ok is false when the values can not be compared.
+func compareDataValue(v *iottwinmakertypes.DataValue, f *TwinMakerFilterValue) (int, bool) {
+	if a, ok := dataValueNumber(v); ok {
+		b, ok := filterValueNumber(f)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a < b:
+			return -1, true
+		case a > b:
+			return 1, true
+		}
+		return 0, true
+	}
+	if v.StringValue != nil && f.StringValue != nil {
+		return strings.Compare(*v.StringValue, *f.StringValue), true
+	}
+	if v.BooleanValue != nil && f.BooleanValue != nil {
+		if *v.BooleanValue == *f.BooleanValue {
+			return 0, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func dataValueNumber(v *iottwinmakertypes.DataValue) (float64, bool) {
+	switch {
+	case v.DoubleValue != nil:
+		return *v.DoubleValue, true
+	case v.IntegerValue != nil:
+		return float64(*v.IntegerValue), true
+	case v.LongValue != nil:
+		return float64(*v.LongValue), true
+	}
+	return 0, false
+}
+
+func filterValueNumber(v *TwinMakerFilterValue) (float64, bool) {
+	switch {
+	case v.DoubleValue != nil:
+		return *v.DoubleValue, true
+	case v.IntegerValue != nil:
+		return float64(*v.IntegerValue), true
+	case v.LongValue != nil:
+		return float64(*v.LongValue), true
+	}
+	return 0, false
+}
+
+// HistoryFilters returns the filters that can be sent to TwinMaker.  A single group that is not negated
+// is the same as AND'ed filters, so it is sent along with the query filters.
+func (q *TwinMakerQuery) HistoryFilters() ([]iottwinmakertypes.PropertyFilter, error) {
+	if err := ValidateFilterGroups(q.FilterGroups); err != nil {
+		return nil, err
+	}
+	filters := q.PropertyFilter
+	if len(q.FilterGroups) == 1 && !q.FilterGroups[0].Negate {
+		filters = append(append([]TwinMakerPropertyFilter{}, filters...), q.FilterGroups[0].Filter...)
+	}
+	return ToTwinMakerFilters(filters)
+}
+
+// ClientFilterGroups returns the groups TwinMaker can not express, which must be evaluated on the results
+func (q *TwinMakerQuery) ClientFilterGroups() []TwinMakerFilterGroup {
+	if len(q.FilterGroups) == 1 && !q.FilterGroups[0].Negate {
+		return nil
+	}
+	return q.FilterGroups
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPropertyFilterValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter TwinMakerPropertyFilter
+		err    string
+	}{
+		{"default operator", TwinMakerPropertyFilter{Name: "alarm_status", Value: TwinMakerFilterValue{StringValue: aws.String("ACTIVE")}}, ""},
+		{"lowercase list operator", TwinMakerPropertyFilter{Name: "alarm_status", Op: "not  in", Value: TwinMakerFilterValue{ListValue: []TwinMakerFilterValue{{StringValue: aws.String("ACTIVE")}}}}, ""},
+		{"unknown operator", TwinMakerPropertyFilter{Name: "alarm_status", Op: "~", Value: TwinMakerFilterValue{StringValue: aws.String("ACTIVE")}}, `invalid operator "~"`},
+		{"missing value", TwinMakerPropertyFilter{Name: "alarm_status", Op: "="}, "missing a value"},
+		{"list operator without list", TwinMakerPropertyFilter{Name: "alarm_status", Op: "IN", Value: TwinMakerFilterValue{StringValue: aws.String("ACTIVE")}}, "requires a list value"},
+		{"boolean comparison", TwinMakerPropertyFilter{Name: "enabled", Op: ">", Value: TwinMakerFilterValue{BooleanValue: aws.Bool(true)}}, "can not compare boolean"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filter.Validate()
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMatchFilterGroups(t *testing.T) {
+	groups := []TwinMakerFilterGroup{
+		{Filter: []TwinMakerPropertyFilter{{Name: "temperature", Op: ">", Value: TwinMakerFilterValue{IntegerValue: aws.Int32(90)}}}},
+		{Filter: []TwinMakerPropertyFilter{{Name: "temperature", Op: "<", Value: TwinMakerFilterValue{DoubleValue: aws.Float64(10)}}}},
+	}
+	require.True(t, MatchFilterGroups(groups, "temperature", &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(95.5)}))
+	require.True(t, MatchFilterGroups(groups, "temperature", &iottwinmakertypes.DataValue{LongValue: aws.Int64(5)}))
+	require.False(t, MatchFilterGroups(groups, "temperature", &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(50)}))
+
+	negated := []TwinMakerFilterGroup{
+		{Negate: true, Filter: []TwinMakerPropertyFilter{{Name: "alarm_status", Op: "IN", Value: TwinMakerFilterValue{ListValue: []TwinMakerFilterValue{
+			{StringValue: aws.String("NORMAL")},
+			{StringValue: aws.String("SNOOZE_DISABLED")},
+		}}}}},
+	}
+	require.True(t, MatchFilterGroups(negated, "alarm_status", &iottwinmakertypes.DataValue{StringValue: aws.String("ACTIVE")}))
+	require.False(t, MatchFilterGroups(negated, "alarm_status", &iottwinmakertypes.DataValue{StringValue: aws.String("NORMAL")}))
+	// the negated group does not filter on temperature, so it is kept
+	require.True(t, MatchFilterGroups(negated, "temperature", &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(50)}))
+
+	// OR across properties applies each group to its own property only
+	either := []TwinMakerFilterGroup{
+		{Filter: []TwinMakerPropertyFilter{{Name: "temperature", Op: ">", Value: TwinMakerFilterValue{IntegerValue: aws.Int32(90)}}}},
+		{Filter: []TwinMakerPropertyFilter{{Name: "alarm_status", Value: TwinMakerFilterValue{StringValue: aws.String("ACTIVE")}}}},
+	}
+	require.False(t, MatchFilterGroups(either, "temperature", &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(50)}))
+	require.True(t, MatchFilterGroups(either, "temperature", &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(95)}))
+	require.False(t, MatchFilterGroups(either, "alarm_status", &iottwinmakertypes.DataValue{StringValue: aws.String("NORMAL")}))
+	require.True(t, MatchFilterGroups(either, "flow", &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(1)}))
+}
+
+func TestIncompleteFiltersSkipped(t *testing.T) {
+	// saved dashboards may hold a filter with a name and no value, which was always ignored
+	q := TwinMakerQuery{
+		QueryType:      QueryTypeEntityHistory,
+		WorkspaceId:    "ws",
+		EntityId:       "pump-1",
+		ComponentName:  "pump",
+		Properties:     []string{"flow"},
+		PropertyFilter: []TwinMakerPropertyFilter{{Name: "alarm_status", Op: "="}},
+	}
+	require.NoError(t, q.Validate())
+	filters, err := q.HistoryFilters()
+	require.NoError(t, err)
+	require.Empty(t, filters)
+}
+
+func TestHistoryFilters(t *testing.T) {
+	q := TwinMakerQuery{
+		PropertyFilter: []TwinMakerPropertyFilter{{}},
+		FilterGroups: []TwinMakerFilterGroup{
+			{Filter: []TwinMakerPropertyFilter{{Name: "alarm_status", Op: "<>", Value: TwinMakerFilterValue{StringValue: aws.String("NORMAL")}}}},
+		},
+	}
+	filters, err := q.HistoryFilters()
+	require.NoError(t, err)
+	require.Len(t, filters, 1)
+	require.Equal(t, "!=", *filters[0].Operator)
+	require.Nil(t, q.ClientFilterGroups())
+
+	q.FilterGroups[0].Negate = true
+	filters, err = q.HistoryFilters()
+	require.NoError(t, err)
+	require.Empty(t, filters)
+	require.Len(t, q.ClientFilterGroups(), 1)
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// characters STS accepts in role session names and source identities
+var sessionNameInvalid = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// characters STS accepts in session tag values
+var sessionTagInvalid = regexp.MustCompile(`[^\p{L}\p{Z}\p{N}_.:/=+\-@]`)
+
+// TokenIdentity is the Grafana user a session token is vended for
+type TokenIdentity struct {
+	Login string
+	Email string
+	Role  string
+}
+
+// IdentityFromUser returns the identity of the requesting Grafana user, which is empty for backend requests
+func IdentityFromUser(user *backend.User) TokenIdentity {
+	if user == nil {
+		return TokenIdentity{}
+	}
+	return TokenIdentity{
+		Login: user.Login,
+		Email: user.Email,
+		Role:  user.Role,
+	}
+}
+
+// SessionName is the STS role session name, shown in CloudTrail for every call made with the token.
+// Logins are sanitized and truncated, so a hash of the login keeps different users apart.
+func (i TokenIdentity) SessionName() string {
+	if i.Login == "" {
+		return "grafana"
+	}
+	hash := sha256.Sum256([]byte(i.Login))
+	suffix := "-" + hex.EncodeToString(hash[:4])
+	return truncate("grafana-"+sessionNameInvalid.ReplaceAllString(i.Login, "_"), 64-len(suffix)) + suffix
+}
+
+// SourceIdentity is the login in the form STS accepts, or empty when there is no user
+func (i TokenIdentity) SourceIdentity() string {
+	id := truncate(sessionNameInvalid.ReplaceAllString(i.Login, "_"), 64)
+	if len(id) < 2 || strings.HasPrefix(strings.ToLower(id), "aws:") {
+		return ""
+	}
+	return id
+}
+
+// SessionTags are the STS session tags describing the user
+func (i TokenIdentity) SessionTags() map[string]string {
+	tags := map[string]string{}
+	if i.Login != "" {
+		tags["grafana-login"] = truncate(sessionTagInvalid.ReplaceAllString(i.Login, "_"), 256)
+	}
+	if i.Role != "" {
+		tags["grafana-role"] = truncate(sessionTagInvalid.ReplaceAllString(i.Role, "_"), 256)
+	}
+	return tags
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
+
+// PolicyRule selects a different session policy for some users.
+// Grafana does not send team membership to plugins, so rules match on login and organization role.
+type PolicyRule struct {
+	Logins          []string          `json:"logins,omitempty"`
+	Roles           []string          `json:"roles,omitempty"`
+	PolicyTemplate  string            `json:"policyTemplate,omitempty"`
+	PolicyVariables map[string]string `json:"policyVariables,omitempty"`
+}
+
+// Matches is true when the login or the role of the user is listed in the rule
+func (r PolicyRule) Matches(identity TokenIdentity) bool {
+	if identity.Login != "" && slices.Contains(r.Logins, identity.Login) {
+		return true
+	}
+	return identity.Role != "" && slices.Contains(r.Roles, identity.Role)
+}
+
+// Policy is the template of the rule, falling back to the datasource template and variables
+func (r PolicyRule) Policy(fallback PolicyTemplate) PolicyTemplate {
+	p := fallback
+	if r.PolicyTemplate != "" {
+		p.Template = r.PolicyTemplate
+	}
+	if len(r.PolicyVariables) > 0 {
+		vars := make(map[string]string, len(fallback.Variables)+len(r.PolicyVariables))
+		for k, v := range fallback.Variables {
+			vars[k] = v
+		}
+		for k, v := range r.PolicyVariables {
+			vars[k] = v
+		}
+		p.Variables = vars
+	}
+	return p
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenIdentity(t *testing.T) {
+	t.Run("backend requests", func(t *testing.T) {
+		identity := IdentityFromUser(nil)
+		require.Equal(t, "grafana", identity.SessionName())
+		require.Equal(t, "", identity.SourceIdentity())
+		require.Empty(t, identity.SessionTags())
+	})
+
+	t.Run("user requests", func(t *testing.T) {
+		identity := IdentityFromUser(&backend.User{Login: "jane doe#1", Email: "jane@example.com", Role: "Viewer"})
+		require.Equal(t, "grafana-jane_doe_1-", identity.SessionName()[:19])
+		require.Len(t, identity.SessionName(), 27)
+		require.Equal(t, "jane_doe_1", identity.SourceIdentity())
+		require.Equal(t, map[string]string{"grafana-login": "jane doe_1", "grafana-role": "Viewer"}, identity.SessionTags())
+	})
+
+	t.Run("long logins are truncated", func(t *testing.T) {
+		identity := TokenIdentity{Login: strings.Repeat("a", 100)}
+		require.Len(t, identity.SessionName(), 64)
+		require.Len(t, identity.SourceIdentity(), 64)
+	})
+
+	t.Run("logins that sanitize alike get different session names", func(t *testing.T) {
+		require.NotEqual(t, TokenIdentity{Login: "jane doe"}.SessionName(), TokenIdentity{Login: "jane#doe"}.SessionName())
+		long := strings.Repeat("a", 100)
+		require.NotEqual(t, TokenIdentity{Login: long + "b"}.SessionName(), TokenIdentity{Login: long + "c"}.SessionName())
+	})
+}
+
+func TestSessionPolicyFor(t *testing.T) {
+	settings := TwinMakerDataSourceSetting{
+		PolicyTemplate:  "default",
+		PolicyVariables: map[string]string{"Prefix": "all", "Stream": "*"},
+		PolicyRules: []PolicyRule{
+			{Logins: []string{"auditor"}, PolicyTemplate: "audit"},
+			{Roles: []string{"Viewer"}, PolicyVariables: map[string]string{"Prefix": "public"}},
+		},
+	}
+
+	require.Equal(t, "audit", settings.SessionPolicyFor(TokenIdentity{Login: "auditor", Role: "Viewer"}).Template)
+
+	viewer := settings.SessionPolicyFor(TokenIdentity{Login: "jane", Role: "Viewer"})
+	require.Equal(t, "default", viewer.Template)
+	require.Equal(t, map[string]string{"Prefix": "public", "Stream": "*"}, viewer.Variables)
+
+	require.Equal(t, settings.SessionPolicy(), settings.SessionPolicyFor(TokenIdentity{Login: "admin", Role: "Admin"}))
+}
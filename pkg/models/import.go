@@ -0,0 +1,225 @@
+package models
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImportFormat is the file format of a property value import
+type ImportFormat string
+
+const (
+	ImportFormatCSV    ImportFormat = "csv"
+	ImportFormatNDJSON ImportFormat = "ndjson"
+)
+
+// MaxImportRows is the largest number of rows accepted in one import
+const MaxImportRows = 50000
+
+// ImportFormatFor picks the format from the format parameter, falling back to the content type
+func ImportFormatFor(format string, contentType string) (ImportFormat, error) {
+	switch strings.ToLower(format) {
+	case "csv":
+		return ImportFormatCSV, nil
+	case "ndjson", "jsonl":
+		return ImportFormatNDJSON, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unsupported import format %q", format)
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return ImportFormatCSV, nil
+	case "application/x-ndjson", "application/jsonl", "application/json":
+		return ImportFormatNDJSON, nil
+	}
+	return "", fmt.Errorf("unsupported import content type %q, use text/csv or application/x-ndjson", contentType)
+}
+
+// ImportRow is a single historical value to write
+type ImportRow struct {
+	// 1-based row number in the uploaded file, not counting the CSV header
+	Row           int
+	EntityId      string
+	ComponentName string
+	PropertyName  string
+	Timestamp     time.Time
+	// The value as written in the file, converted once the property type is known
+	Value string
+}
+
+// ImportRowError reports why a row was not written
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Rows    int              `json:"rows"`
+	Written int              `json:"written"`
+	Errors  []ImportRowError `json:"errors,omitempty"`
+}
+
+// AddErrors adds row errors and keeps them ordered by row
+func (r *ImportResult) AddErrors(errs ...ImportRowError) {
+	r.Errors = append(r.Errors, errs...)
+	sort.SliceStable(r.Errors, func(i, j int) bool {
+		return r.Errors[i].Row < r.Errors[j].Row
+	})
+}
+
+// ParseImportRows reads every row of the file.  Rows that can not be parsed are reported as row
+// errors, the returned error is only set when the file itself can not be read.
+func ParseImportRows(r io.Reader, format ImportFormat) ([]ImportRow, []ImportRowError, error) {
+	switch format {
+	case ImportFormatCSV:
+		return parseCSVRows(r)
+	case ImportFormatNDJSON:
+		return parseNDJSONRows(r)
+	}
+	return nil, nil, fmt.Errorf("unsupported import format %q", format)
+}
+
+var importColumns = []string{"entityId", "componentName", "propertyName", "timestamp", "value"}
+
+func parseCSVRows(r io.Reader) ([]ImportRow, []ImportRowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("the file is empty")
+		}
+		return nil, nil, err
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	columns := make([]int, len(importColumns))
+	for i, name := range importColumns {
+		c, ok := index[strings.ToLower(name)]
+		if !ok {
+			return nil, nil, fmt.Errorf("missing column %q, the header must include %s", name, strings.Join(importColumns, ", "))
+		}
+		columns[i] = c
+	}
+
+	rows := []ImportRow{}
+	rowErrors := []ImportRowError{}
+	for n := 1; ; n++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowErrors = append(rowErrors, ImportRowError{Row: n, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, nil, err
+		}
+		if n > MaxImportRows {
+			return nil, nil, fmt.Errorf("at most %d rows can be imported at once", MaxImportRows)
+		}
+		field := func(i int) string {
+			if columns[i] < len(record) {
+				return strings.TrimSpace(record[columns[i]])
+			}
+			return ""
+		}
+		row, err := newImportRow(n, field(0), field(1), field(2), field(3), field(4))
+		if err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Row: n, Message: err.Error()})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, rowErrors, nil
+}
+
+func parseNDJSONRows(r io.Reader) ([]ImportRow, []ImportRowError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	rows := []ImportRow{}
+	rowErrors := []ImportRowError{}
+	for n := 0; scanner.Scan(); {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		n++
+		if n > MaxImportRows {
+			return nil, nil, fmt.Errorf("at most %d rows can be imported at once", MaxImportRows)
+		}
+		v := struct {
+			EntityId      string          `json:"entityId"`
+			ComponentName string          `json:"componentName"`
+			PropertyName  string          `json:"propertyName"`
+			Timestamp     json.RawMessage `json:"timestamp"`
+			Value         json.RawMessage `json:"value"`
+		}{}
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Row: n, Message: "invalid JSON: " + err.Error()})
+			continue
+		}
+		row, err := newImportRow(n, v.EntityId, v.ComponentName, v.PropertyName, jsonText(v.Timestamp), jsonText(v.Value))
+		if err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Row: n, Message: err.Error()})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return rows, rowErrors, nil
+}
+
+// jsonText returns JSON strings unquoted, and any other JSON value as written
+func jsonText(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+func newImportRow(n int, entityId, componentName, propertyName, timestamp, value string) (ImportRow, error) {
+	row := ImportRow{
+		Row:           n,
+		EntityId:      entityId,
+		ComponentName: componentName,
+		PropertyName:  propertyName,
+		Value:         value,
+	}
+	missing := []string{}
+	for i, v := range []string{entityId, componentName, propertyName, timestamp} {
+		if v == "" {
+			missing = append(missing, importColumns[i])
+		}
+	}
+	if len(missing) > 0 {
+		return row, fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+	ts, err := ParseTimestamp(timestamp)
+	if err != nil {
+		return row, err
+	}
+	row.Timestamp = ts
+	return row, nil
+}
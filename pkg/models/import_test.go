@@ -0,0 +1,63 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImportRows(t *testing.T) {
+	t.Run("csv", func(t *testing.T) {
+		file := "EntityId,componentName,propertyName,timestamp,value\n" +
+			"pump-1,pump,flow,2024-01-01T00:00:00Z,1.5\n" +
+			"pump-1,pump,flow,1704067260,2\n" +
+			"pump-1,pump,,1704067320000,3\n" +
+			"pump-1,pump,flow,yesterday,4\n" +
+			"pump-1,pump,flow,2024-01-01T00:02:00.5Z,5\n" +
+			"pump-1,pump,flow,2024-01-01 00:03:00,6\n"
+		rows, rowErrors, err := ParseImportRows(strings.NewReader(file), ImportFormatCSV)
+		require.NoError(t, err)
+		require.Len(t, rows, 4)
+		require.Equal(t, "1.5", rows[0].Value)
+		require.Equal(t, time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC), rows[1].Timestamp)
+		// the times written by exports, and the layouts read from history values
+		require.Equal(t, time.Date(2024, 1, 1, 0, 2, 0, 5e8, time.UTC), rows[2].Timestamp)
+		require.Equal(t, time.Date(2024, 1, 1, 0, 3, 0, 0, time.UTC), rows[3].Timestamp)
+		require.Equal(t, []ImportRowError{
+			{Row: 3, Message: "missing propertyName"},
+			{Row: 4, Message: `invalid timestamp "yesterday"`},
+		}, rowErrors)
+	})
+
+	t.Run("csv without the required columns", func(t *testing.T) {
+		_, _, err := ParseImportRows(strings.NewReader("entityId,value\npump-1,1\n"), ImportFormatCSV)
+		require.ErrorContains(t, err, `missing column "componentName"`)
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		file := `{"entityId":"pump-1","componentName":"pump","propertyName":"flow","timestamp":1704067320000,"value":2.5}` + "\n\n" +
+			`{"entityId":"pump-1","componentName":"pump","propertyName":"state","timestamp":"2024-01-01T00:00:00Z","value":"running"}` + "\n" +
+			`{"entityId":` + "\n"
+		rows, rowErrors, err := ParseImportRows(strings.NewReader(file), ImportFormatNDJSON)
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+		require.Equal(t, "2.5", rows[0].Value)
+		require.Equal(t, time.Date(2024, 1, 1, 0, 2, 0, 0, time.UTC), rows[0].Timestamp)
+		require.Equal(t, "running", rows[1].Value)
+		require.Len(t, rowErrors, 1)
+		require.Equal(t, 3, rowErrors[0].Row)
+	})
+
+	t.Run("format from the content type", func(t *testing.T) {
+		f, err := ImportFormatFor("", "text/csv; charset=utf-8")
+		require.NoError(t, err)
+		require.Equal(t, ImportFormatCSV, f)
+		f, err = ImportFormatFor("ndjson", "text/csv")
+		require.NoError(t, err)
+		require.Equal(t, ImportFormatNDJSON, f)
+		_, err = ImportFormatFor("", "application/octet-stream")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,32 @@
+package models
+
+// QueryLimits bound how much a full crawl of paged results may load.  Zero means no limit.
+type QueryLimits struct {
+	MaxPages int   `json:"maxPages,omitempty"`
+	MaxRows  int   `json:"maxRows,omitempty"`
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+}
+
+// Min returns the stricter of each limit, so a query can lower but never raise the datasource limits
+func (l QueryLimits) Min(other QueryLimits) QueryLimits {
+	return QueryLimits{
+		MaxPages: minLimit(l.MaxPages, other.MaxPages),
+		MaxRows:  minLimit(l.MaxRows, other.MaxRows),
+		MaxBytes: minLimit(l.MaxBytes, other.MaxBytes),
+	}
+}
+
+func minLimit[T int | int64](a, b T) T {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 || a < b {
+		return a
+	}
+	return b
+}
+
+// Reached is true when the loaded pages or rows hit the page or row limit
+func (l QueryLimits) Reached(pages int, rows int) bool {
+	return (l.MaxPages > 0 && pages >= l.MaxPages) || (l.MaxRows > 0 && rows >= l.MaxRows)
+}
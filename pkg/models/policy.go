@@ -0,0 +1,156 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// MaxSessionPolicySize is the STS limit for inline session policies
+const MaxSessionPolicySize = 2048
+
+// DefaultPolicyTemplate is the session policy used when the datasource does not configure one
+const DefaultPolicyTemplate = `{
+	"Version": "2012-10-17",
+	"Statement": [
+		{
+			"Action": [
+				"iottwinmaker:ListWorkspaces"
+			],
+			"Resource": [
+				"*"
+			],
+			"Effect": "Allow"
+		},
+		{
+			"Action": [
+				"iottwinmaker:Get*",
+				"iottwinmaker:List*",
+				"iottwinmaker:ExecuteQuery*"
+			],
+			"Resource": [
+				"{{.WorkspaceArn}}",
+				"{{.WorkspaceArn}}/*"
+			],
+			"Effect": "Allow"
+		},
+		{
+			"Effect": "Allow",
+			"Action": [
+			  "kinesisvideo:GetDataEndpoint",
+			  "kinesisvideo:GetHLSStreamingSessionURL"
+			],
+			"Resource": "*"
+		},
+		{
+			"Effect": "Allow",
+			"Action": [
+			  "iotsitewise:GetAssetPropertyValue",
+			  "iotsitewise:GetInterpolatedAssetPropertyValues"
+			],
+			"Resource": "*"
+		},
+		{
+			 "Effect": "Allow",
+			 "Action": [
+			  "iotsitewise:BatchPutAssetPropertyValue"
+			],
+			"Resource": "*",
+			"Condition": {
+			  "StringLike": {
+				"aws:ResourceTag/EdgeConnectorForKVS": "*{{.WorkspaceId}}*"
+			  }
+			}
+		},
+		{
+			"Effect": "Allow",
+			"Action": ["s3:GetObject"],
+			"Resource": [
+				"{{.S3BucketArn}}",
+				"{{.S3BucketArn}}/*"
+			]
+		}
+	]
+}`
+
+// variables set from the workspace, they can not be replaced by user-defined variables
+var builtinPolicyVariables = []string{"WorkspaceArn", "WorkspaceId", "S3BucketArn"}
+
+var policyVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// PolicyTemplate is a session policy with {{.WorkspaceArn}}, {{.WorkspaceId}}, {{.S3BucketArn}}
+// and user-defined {{.Name}} variables
+type PolicyTemplate struct {
+	Template  string
+	Variables map[string]string
+}
+
+// PolicyWorkspace holds the workspace values of the built-in variables
+type PolicyWorkspace struct {
+	WorkspaceArn string
+	WorkspaceId  string
+	S3BucketArn  string
+}
+
+// Render fills in the template and returns the compacted policy
+func (p PolicyTemplate) Render(workspace PolicyWorkspace) (string, error) {
+	text := p.Template
+	if strings.TrimSpace(text) == "" {
+		text = DefaultPolicyTemplate
+	}
+
+	t, err := template.New("policy").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid policy template: %w", err)
+	}
+
+	data := make(map[string]string, len(p.Variables)+len(builtinPolicyVariables))
+	for k, v := range p.Variables {
+		data[k] = v
+	}
+	data["WorkspaceArn"] = workspace.WorkspaceArn
+	data["WorkspaceId"] = workspace.WorkspaceId
+	data["S3BucketArn"] = workspace.S3BucketArn
+
+	rendered := &bytes.Buffer{}
+	if err := t.Execute(rendered, data); err != nil {
+		return "", fmt.Errorf("invalid policy template: %w", err)
+	}
+
+	policy := &bytes.Buffer{}
+	if err := json.Compact(policy, rendered.Bytes()); err != nil {
+		return "", fmt.Errorf("policy template is not valid JSON: %w", err)
+	}
+	if policy.Len() > MaxSessionPolicySize {
+		return "", fmt.Errorf("session policy is %d bytes, the limit is %d", policy.Len(), MaxSessionPolicySize)
+	}
+	return policy.String(), nil
+}
+
+// Validate renders the template for a workspace with the longest possible bucket name,
+// so policies that only fit for some workspaces are rejected
+func (p PolicyTemplate) Validate(region string, workspaceId string) error {
+	for name := range p.Variables {
+		if !policyVariableName.MatchString(name) {
+			return fmt.Errorf("invalid policy variable name %q", name)
+		}
+		for _, b := range builtinPolicyVariables {
+			if name == b {
+				return fmt.Errorf("policy variable %q is set from the workspace", name)
+			}
+		}
+	}
+
+	if workspaceId == "" {
+		workspaceId = strings.Repeat("w", 128)
+	}
+	_, err := p.Render(PolicyWorkspace{
+		WorkspaceArn: fmt.Sprintf("arn:aws:iottwinmaker:%s:123456789012:workspace/%s", region, workspaceId),
+		WorkspaceId:  workspaceId,
+		S3BucketArn:  "arn:aws:s3:::" + strings.Repeat("b", 63),
+	})
+	return err
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyTemplate(t *testing.T) {
+	workspace := PolicyWorkspace{
+		WorkspaceArn: "arn:aws:iottwinmaker:eu-west-1:123456789012:workspace/factory",
+		WorkspaceId:  "factory",
+		S3BucketArn:  "arn:aws:s3:::factory-bucket",
+	}
+
+	t.Run("default template", func(t *testing.T) {
+		policy, err := PolicyTemplate{}.Render(workspace)
+		require.NoError(t, err)
+		require.NotContains(t, policy, "\n")
+		require.Contains(t, policy, "arn:aws:s3:::factory-bucket/*")
+		require.NoError(t, PolicyTemplate{}.Validate("us-east-1", ""))
+	})
+
+	t.Run("custom template with variables", func(t *testing.T) {
+		p := PolicyTemplate{
+			Template:  `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": ["kinesisvideo:GetDataEndpoint"], "Resource": "arn:aws:kinesisvideo:*:*:stream/{{.StreamPrefix}}*"}, {"Effect": "Allow", "Action": ["iottwinmaker:Get*"], "Resource": "{{.WorkspaceArn}}/*"}]}`,
+			Variables: map[string]string{"StreamPrefix": "prod-"},
+		}
+		policy, err := p.Render(workspace)
+		require.NoError(t, err)
+		require.Contains(t, policy, `stream/prod-*`)
+		require.Contains(t, policy, `workspace/factory/*`)
+		require.NoError(t, p.Validate("eu-west-1", "factory"))
+	})
+
+	t.Run("missing variables are errors", func(t *testing.T) {
+		p := PolicyTemplate{Template: `{"Resource": "{{.Missing}}"}`}
+		require.Error(t, p.Validate("eu-west-1", "factory"))
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		p := PolicyTemplate{Template: `{"Version": "2012-10-17",}`}
+		require.ErrorContains(t, p.Validate("eu-west-1", "factory"), "not valid JSON")
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		p := PolicyTemplate{Template: `{"Sid": "` + strings.Repeat("x", MaxSessionPolicySize) + `"}`}
+		require.ErrorContains(t, p.Validate("eu-west-1", "factory"), "the limit is 2048")
+	})
+
+	t.Run("built-in variables can not be replaced", func(t *testing.T) {
+		p := PolicyTemplate{Variables: map[string]string{"WorkspaceArn": "*"}}
+		require.Error(t, p.Validate("eu-west-1", "factory"))
+		p = PolicyTemplate{Variables: map[string]string{"not-valid": "*"}}
+		require.Error(t, p.Validate("eu-west-1", "factory"))
+	})
+}
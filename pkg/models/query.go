@@ -5,6 +5,7 @@ import (
 	"fmt"
 	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -14,14 +15,16 @@ import (
 type TwinMakerQueryType = string
 
 const (
-	QueryTypeListWorkspace    TwinMakerQueryType = "ListWorkspace" // each datasource will have a default workspace
-	QueryTypeListScenes       TwinMakerQueryType = "ListScenes"    // required for scene viewer
-	QueryTypeListEntities     TwinMakerQueryType = "ListEntities"  //
-	QueryTypeGetEntity        TwinMakerQueryType = "GetEntity"     //
-	QueryTypeGetPropertyValue TwinMakerQueryType = "GetPropertyValue"
-	QueryTypeComponentHistory TwinMakerQueryType = "ComponentHistory"
-	QueryTypeEntityHistory    TwinMakerQueryType = "EntityHistory"
-	QueryTypeGetAlarms        TwinMakerQueryType = "GetAlarms"
+	QueryTypeListWorkspace     TwinMakerQueryType = "ListWorkspace" // each datasource will have a default workspace
+	QueryTypeListScenes        TwinMakerQueryType = "ListScenes"    // required for scene viewer
+	QueryTypeListEntities      TwinMakerQueryType = "ListEntities"  //
+	QueryTypeGetEntity         TwinMakerQueryType = "GetEntity"     //
+	QueryTypeGetPropertyValue  TwinMakerQueryType = "GetPropertyValue"
+	QueryTypeComponentHistory  TwinMakerQueryType = "ComponentHistory"
+	QueryTypeEntityHistory     TwinMakerQueryType = "EntityHistory"
+	QueryTypeGetAlarms         TwinMakerQueryType = "GetAlarms"
+	QueryTypeGetSceneBindings  TwinMakerQueryType = "GetSceneBindings"
+	QueryTypeVideoAvailability TwinMakerQueryType = "VideoAvailability"
 )
 
 type TwinMakerResultOrder = string
@@ -32,11 +35,12 @@ const (
 )
 
 type TwinMakerFilterValue struct {
-	BooleanValue *bool    `json:"booleanValue,omitempty"`
-	DoubleValue  *float64 `json:"doubleValue,omitempty"`
-	IntegerValue *int32   `json:"integerValue,omitempty"`
-	LongValue    *int64   `json:"longValue,omitempty"`
-	StringValue  *string  `json:"stringValue,omitempty"`
+	BooleanValue *bool                  `json:"booleanValue,omitempty"`
+	DoubleValue  *float64               `json:"doubleValue,omitempty"`
+	IntegerValue *int32                 `json:"integerValue,omitempty"`
+	LongValue    *int64                 `json:"longValue,omitempty"`
+	StringValue  *string                `json:"stringValue,omitempty"`
+	ListValue    []TwinMakerFilterValue `json:"listValue,omitempty"`
 }
 
 type TwinMakerPropertyFilter struct {
@@ -56,6 +60,12 @@ func (v *TwinMakerFilterValue) ToTwinMakerDataValue() *iottwinmakertypes.DataVal
 		return &iottwinmakertypes.DataValue{LongValue: v.LongValue}
 	} else if v.StringValue != nil {
 		return &iottwinmakertypes.DataValue{StringValue: v.StringValue}
+	} else if v.ListValue != nil {
+		list := make([]iottwinmakertypes.DataValue, 0, len(v.ListValue))
+		for _, lv := range v.ListValue {
+			list = append(list, *lv.ToTwinMakerDataValue())
+		}
+		return &iottwinmakertypes.DataValue{ListValue: list}
 	}
 	return &iottwinmakertypes.DataValue{}
 }
@@ -72,6 +82,12 @@ func (v *TwinMakerFilterValue) DataValueToString() string {
 		str = strconv.FormatInt(*v.LongValue, 10)
 	} else if v.StringValue != nil {
 		str = *v.StringValue
+	} else if v.ListValue != nil {
+		values := make([]string, 0, len(v.ListValue))
+		for _, lv := range v.ListValue {
+			values = append(values, lv.DataValueToString())
+		}
+		str = "[" + strings.Join(values, ",") + "]"
 	}
 	return str
 }
@@ -110,15 +126,15 @@ type TwinMakerTabularConditions struct {
 	PropertyFilter []TwinMakerPropertyFilter `json:"propertyFilter,omitempty"`
 }
 
-func (tabularConditions *TwinMakerTabularConditions) ToTwinMakerTabularConditions() *iottwinmakertypes.TabularConditions {
+func (tabularConditions *TwinMakerTabularConditions) ToTwinMakerTabularConditions() (*iottwinmakertypes.TabularConditions, error) {
 	var orders []iottwinmakertypes.OrderBy
 	for _, o := range tabularConditions.OrderBy {
 		orders = append(orders, o.ToTwinMakerOrderBy())
 	}
 
-	var filters []iottwinmakertypes.PropertyFilter
-	for _, pf := range tabularConditions.PropertyFilter {
-		filters = append(filters, pf.ToTwinMakerFilter())
+	filters, err := ToTwinMakerFilters(tabularConditions.PropertyFilter)
+	if err != nil {
+		return nil, err
 	}
 
 	tabularCondition := &iottwinmakertypes.TabularConditions{}
@@ -129,7 +145,7 @@ func (tabularConditions *TwinMakerTabularConditions) ToTwinMakerTabularCondition
 		tabularCondition.PropertyFilters = filters
 	}
 
-	return tabularCondition
+	return tabularCondition, nil
 }
 
 // TwinMakerQuery model
@@ -141,14 +157,27 @@ type TwinMakerQuery struct {
 	Properties         []string `json:"properties,omitempty"`
 	// Optional metadata saved with the query.  When this matches properties used in the results, it will
 	// replace the display name
-	PropertyDisplayNames map[string]string             `json:"propertyDisplayNames,omitempty"`
-	NextToken            string                        `json:"nextToken,omitempty"`
-	ComponentName        string                        `json:"componentName,omitempty"`
-	ComponentTypeId      string                        `json:"componentTypeId,omitempty"`
-	PropertyFilter       []TwinMakerPropertyFilter     `json:"filter,omitempty"`
-	ListEntitiesFilter   []TwinMakerListEntitiesFilter `json:"listEntitiesFilter,omitempty"`
-	Order                iottwinmakertypes.OrderByTime `json:"order,omitempty"`
-	MaxResults           int                           `json:"maxResults,omitempty"`
+	PropertyDisplayNames map[string]string `json:"propertyDisplayNames,omitempty"`
+	NextToken            string            `json:"nextToken,omitempty"`
+	ComponentName        string            `json:"componentName,omitempty"`
+	SceneId              string            `json:"sceneId,omitempty"`
+	// ListScenes also loads the settings and document of every scene
+	SceneDetails       bool                          `json:"sceneDetails,omitempty"`
+	ComponentTypeId    string                        `json:"componentTypeId,omitempty"`
+	PropertyFilter     []TwinMakerPropertyFilter     `json:"filter,omitempty"`
+	FilterGroups       []TwinMakerFilterGroup        `json:"filterGroups,omitempty"`
+	ListEntitiesFilter []TwinMakerListEntitiesFilter `json:"listEntitiesFilter,omitempty"`
+	Order              iottwinmakertypes.OrderByTime `json:"order,omitempty"`
+	MaxResults         int                           `json:"maxResults,omitempty"`
+	// Time budget in seconds for loading every page of the query, partial results are returned when exceeded
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// Limits for loading every page of the query, lowered to the datasource limits
+	QueryLimits
+	// History of SiteWise-connected components is read directly from IoT SiteWise when set
+	SiteWise *SiteWiseOptions `json:"sitewise,omitempty"`
+	// Levels of nested map values expanded into fields of their own, deeper values are shown as JSON.
+	// Defaults to DefaultFlattenDepth.
+	FlattenDepth int `json:"flattenDepth,omitempty"`
 
 	// Athena Data Connector parameters for iottwinmaker.GetPropertyValue
 	TabularConditions TwinMakerTabularConditions `json:"tabularConditions,omitempty"`
@@ -160,6 +189,30 @@ type TwinMakerQuery struct {
 	// Direct from the gRPC interfaces
 	QueryType TwinMakerQueryType `json:"-"`
 	TimeRange backend.TimeRange  `json:"-"`
+
+	// Values picked for multi-valued fields when the query was expanded
+	Expansion map[string]string `json:"-"`
+
+	// When set, no more pages are requested after this time
+	Deadline time.Time `json:"-"`
+}
+
+const (
+	DefaultFlattenDepth = 1
+	MaxFlattenDepth     = 5
+)
+
+// NestedDepth is the flatten depth asked for, or the default when not set
+func (q *TwinMakerQuery) NestedDepth() int {
+	if q.FlattenDepth <= 0 {
+		return DefaultFlattenDepth
+	}
+	return q.FlattenDepth
+}
+
+// DeadlineExceeded is true when the query has a deadline and it has passed
+func (q *TwinMakerQuery) DeadlineExceeded() bool {
+	return !q.Deadline.IsZero() && !time.Now().Before(q.Deadline)
 }
 
 func (q *TwinMakerQuery) CacheKey(prefix string) string {
@@ -167,7 +220,10 @@ func (q *TwinMakerQuery) CacheKey(prefix string) string {
 		return "" // not cacheable
 	}
 
-	key := prefix + "~" + q.WorkspaceId + "/" + q.EntityId + "/" + q.ComponentName + "/" + q.ComponentTypeId
+	key := prefix + "~" + q.WorkspaceId + "/" + q.EntityId + "/" + q.ComponentName + "/" + q.ComponentTypeId + "/" + q.SceneId
+	if q.SceneDetails {
+		key += "+details"
+	}
 
 	for _, p := range q.Properties {
 		key += "#" + p
@@ -176,12 +232,21 @@ func (q *TwinMakerQuery) CacheKey(prefix string) string {
 	for _, f := range q.PropertyFilter {
 		key += "!" + f.Name + f.Op + f.Value.DataValueToString()
 	}
+	for _, g := range q.FilterGroups {
+		key += "|" + strconv.FormatBool(g.Negate)
+		for _, f := range g.Filter {
+			key += "!" + f.Name + f.Op + f.Value.DataValueToString()
+		}
+	}
 	// TODO: does it break the filter?
 	for _, ef := range q.ListEntitiesFilter {
 		key += "&" + ef.ExternalId
 	}
 
 	key += "@" + string(q.Order)
+	if o := q.SiteWise; o != nil {
+		key += fmt.Sprintf("~sitewise:%s/%s/%s/%d", o.Aggregate, o.Resolution, o.Interpolation, o.IntervalSeconds)
+	}
 
 	return key
 }
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SceneDocument is the scene JSON the TwinMaker scene composer saves to the workspace bucket
+type SceneDocument struct {
+	SpecVersion     string      `json:"specVersion"`
+	Version         string      `json:"version"`
+	Unit            string      `json:"unit,omitempty"`
+	Nodes           []SceneNode `json:"nodes"`
+	RootNodeIndexes []int       `json:"rootNodeIndexes"`
+}
+
+// SceneNode is an object in the scene, placed under its parent node
+type SceneNode struct {
+	Name       string           `json:"name"`
+	Children   []int            `json:"children,omitempty"`
+	Components []SceneComponent `json:"components,omitempty"`
+
+	// Set when the document is parsed
+	Index  int    `json:"index"`
+	Parent *int   `json:"parent,omitempty"`
+	Path   string `json:"path"`
+}
+
+// SceneComponent is a tag, model, overlay or other component attached to a node
+type SceneComponent struct {
+	Type string `json:"type"`
+	// ModelRef components
+	URI       string `json:"uri,omitempty"`
+	ModelType string `json:"modelType,omitempty"`
+	// Tag components
+	Icon           string `json:"icon,omitempty"`
+	RuleBasedMapId string `json:"ruleBasedMapId,omitempty"`
+
+	// Every data binding found in the component
+	Bindings []SceneDataBinding `json:"bindings,omitempty"`
+}
+
+// SceneDataBinding binds a component to an entity property
+type SceneDataBinding struct {
+	// Location of the binding in the component, such as valueDataBinding or valueDataBindings.speed
+	Path           string `json:"path"`
+	EntityId       string `json:"entityId,omitempty"`
+	ComponentName  string `json:"componentName,omitempty"`
+	PropertyName   string `json:"propertyName,omitempty"`
+	EntityPath     string `json:"entityPath,omitempty"`
+	RuleBasedMapId string `json:"ruleBasedMapId,omitempty"`
+}
+
+const (
+	SceneComponentTag      = "Tag"
+	SceneComponentModelRef = "ModelRef"
+)
+
+func (c *SceneComponent) UnmarshalJSON(b []byte) error {
+	type plain SceneComponent
+	if err := json.Unmarshal(b, (*plain)(c)); err != nil {
+		return err
+	}
+	// every component type nests its bindings differently, so the whole component is searched
+	var raw interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	c.Bindings = findSceneBindings(raw, "")
+	return nil
+}
+
+// findSceneBindings walks the component and returns every object holding a dataBindingContext
+func findSceneBindings(v interface{}, path string) []SceneDataBinding {
+	bindings := []SceneDataBinding{}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if ctx, ok := v["dataBindingContext"].(map[string]interface{}); ok {
+			binding := SceneDataBinding{Path: path}
+			binding.EntityId, _ = ctx["entityId"].(string)
+			binding.ComponentName, _ = ctx["componentName"].(string)
+			binding.PropertyName, _ = ctx["propertyName"].(string)
+			binding.EntityPath, _ = ctx["entityPath"].(string)
+			return append(bindings, binding)
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			found := findSceneBindings(v[k], joinScenePath(path, k))
+			// rules are set next to the binding, not inside it
+			if id, ok := v["ruleBasedMapId"].(string); ok {
+				for i := range found {
+					if found[i].RuleBasedMapId == "" {
+						found[i].RuleBasedMapId = id
+					}
+				}
+			}
+			bindings = append(bindings, found...)
+		}
+	case []interface{}:
+		for i, item := range v {
+			bindings = append(bindings, findSceneBindings(item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return bindings
+}
+
+func joinScenePath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// ParseSceneDocument reads the scene JSON, and sets the parent and path of every node
+func ParseSceneDocument(b []byte) (*SceneDocument, error) {
+	doc := &SceneDocument{}
+	if err := json.Unmarshal(b, doc); err != nil {
+		return nil, fmt.Errorf("invalid scene document: %w", err)
+	}
+	for i := range doc.Nodes {
+		doc.Nodes[i].Index = i
+	}
+	for i, node := range doc.Nodes {
+		for _, child := range node.Children {
+			if child < 0 || child >= len(doc.Nodes) {
+				return nil, fmt.Errorf("invalid scene document: node %d has unknown child %d", i, child)
+			}
+			parent := i
+			doc.Nodes[child].Parent = &parent
+		}
+	}
+	for i := range doc.Nodes {
+		doc.Nodes[i].Path = doc.nodePath(i, 0)
+	}
+	return doc, nil
+}
+
+// nodePath joins the names of the node and its parents, guarding against cycles in broken documents
+func (d *SceneDocument) nodePath(i int, depth int) string {
+	node := d.Nodes[i]
+	if node.Parent == nil || depth > len(d.Nodes) {
+		return node.Name
+	}
+	return d.nodePath(*node.Parent, depth+1) + "/" + node.Name
+}
+
+// SplitS3URI returns the bucket and key of an s3://bucket/key location
+func SplitS3URI(uri string) (string, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "s3" || u.Host == "" || strings.TrimPrefix(u.Path, "/") == "" {
+		return "", "", fmt.Errorf("invalid S3 location %q", uri)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// S3Object describes an object in a bucket
+type S3Object struct {
+	URI          string    `json:"uri"`
+	Key          string    `json:"key"`
+	LastModified time.Time `json:"lastModified"`
+	Size         int64     `json:"size"`
+}
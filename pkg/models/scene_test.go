@@ -0,0 +1,50 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSceneDocument(t *testing.T) {
+	doc, err := ParseSceneDocument([]byte(`{
+		"specVersion": "1.0",
+		"nodes": [
+			{"name": "Plant", "children": [1]},
+			{"name": "Pump", "children": [2], "components": [
+				{"type": "ModelRef", "uri": "s3://bucket/pump.glb"},
+				{"type": "MotionIndicator", "valueDataBindings": {"speed": {
+					"ruleBasedMapId": "speedRule",
+					"valueDataBinding": {"dataBindingContext": {"entityId": "pump-1", "componentName": "motor", "propertyName": "speed"}}
+				}}}
+			]},
+			{"name": "Flow", "components": [{"type": "Tag"}]}
+		],
+		"rootNodeIndexes": [0]
+	}`))
+	require.NoError(t, err)
+	require.Equal(t, "Plant/Pump/Flow", doc.Nodes[2].Path)
+	require.Equal(t, 1, *doc.Nodes[2].Parent)
+	require.Nil(t, doc.Nodes[0].Parent)
+	require.Equal(t, []SceneDataBinding{{
+		Path:           "valueDataBindings.speed.valueDataBinding",
+		EntityId:       "pump-1",
+		ComponentName:  "motor",
+		PropertyName:   "speed",
+		RuleBasedMapId: "speedRule",
+	}}, doc.Nodes[1].Components[1].Bindings)
+	require.Empty(t, doc.Nodes[2].Components[0].Bindings)
+
+	_, err = ParseSceneDocument([]byte(`{"nodes": [{"name": "a", "children": [5]}]}`))
+	require.ErrorContains(t, err, "unknown child 5")
+}
+
+func TestSplitS3URI(t *testing.T) {
+	bucket, key, err := SplitS3URI("s3://twinmaker-bucket/scenes/factory.json")
+	require.NoError(t, err)
+	require.Equal(t, "twinmaker-bucket", bucket)
+	require.Equal(t, "scenes/factory.json", key)
+
+	_, _, err = SplitS3URI("https://example.com/factory.json")
+	require.Error(t, err)
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// same pattern and length TwinMaker accepts for scene ids
+var sceneIdPattern = regexp.MustCompile(`^[a-zA-Z_0-9][a-zA-Z_\-0-9]*[a-zA-Z0-9]+$`)
+
+const maxSceneIdLength = 128
+
+// SceneRequest creates a scene, or changes the document and settings of an existing one
+type SceneRequest struct {
+	SceneId       string            `json:"sceneId"`
+	Description   *string           `json:"description,omitempty"`
+	Capabilities  []string          `json:"capabilities,omitempty"`
+	SceneMetadata map[string]string `json:"sceneMetadata,omitempty"`
+	// Where the documents are kept when the scene is created, defaults to <sceneId>.json in the
+	// workspace bucket.  It has to be in the workspace bucket, every document is saved as a version next to it.
+	ContentLocation string `json:"contentLocation,omitempty"`
+	// The scene JSON.  Optional on updates that only change the settings.
+	Document json.RawMessage `json:"document,omitempty"`
+}
+
+// Validate checks the request before anything is written.  Documents are parsed so a broken
+// scene is never saved over a working one.
+func (s *SceneRequest) Validate(create bool) error {
+	e := &ValidationError{}
+	switch {
+	case s.SceneId == "":
+		e.add("sceneId", "is required")
+	case len(s.SceneId) > maxSceneIdLength || !sceneIdPattern.MatchString(s.SceneId):
+		e.add("sceneId", "may only contain letters, numbers, '_' and '-', and be at most 128 characters")
+	}
+	if create && len(s.Document) == 0 {
+		e.add("document", "is required")
+	}
+	if len(s.Document) > 0 {
+		if _, err := ParseSceneDocument(s.Document); err != nil {
+			e.add("document", "%s", err.Error())
+		}
+	}
+	if !create && s.ContentLocation != "" {
+		e.add("contentLocation", "can only be set when the scene is created")
+	}
+	if s.ContentLocation != "" {
+		if _, _, err := SplitS3URI(s.ContentLocation); err != nil {
+			e.add("contentLocation", "%s", err.Error())
+		}
+	}
+	for i, c := range s.Capabilities {
+		if strings.TrimSpace(c) == "" {
+			e.add("capabilities", "capability %d is empty", i)
+		}
+	}
+	return e.err()
+}
+
+// SceneVersion is a document saved for a scene, other than the one the scene uses
+type SceneVersion struct {
+	Version      string    `json:"version"`
+	Location     string    `json:"location"`
+	LastModified time.Time `json:"lastModified"`
+	Size         int64     `json:"size"`
+}
+
+// SceneVersionFormat names versions by the time they were saved, so they sort oldest first.  A random
+// suffix follows the time, so versions saved in the same millisecond do not replace each other.
+const SceneVersionFormat = "20060102T150405.000Z"
+
+// NewSceneVersion names a version saved at t
+func NewSceneVersion(t time.Time) string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return t.UTC().Format(SceneVersionFormat) + "-" + hex.EncodeToString(suffix)
+}
+
+// ParseSceneVersion returns the time the version was saved at, versions without a suffix are accepted too
+func ParseSceneVersion(version string) (time.Time, error) {
+	t, _, _ := strings.Cut(version, "-")
+	return time.Parse(SceneVersionFormat, t)
+}
+
+// SceneVersionsPrefix is the location holding the versions of the scene, for a content location
+// that is either the document the scene was created with or one of its versions
+func SceneVersionsPrefix(contentLocation string) string {
+	if i := strings.LastIndex(contentLocation, ".versions/"); i >= 0 {
+		return contentLocation[:i+len(".versions/")]
+	}
+	return strings.TrimSuffix(contentLocation, ".json") + ".versions/"
+}
+
+// SceneVersionLocation is the location of one version
+func SceneVersionLocation(contentLocation string, version string) string {
+	return SceneVersionsPrefix(contentLocation) + version + ".json"
+}
+
+// IsSceneVersionLocation is true when the content location is one of the versions of the scene
+func IsSceneVersionLocation(contentLocation string) bool {
+	return strings.HasPrefix(contentLocation, SceneVersionsPrefix(contentLocation))
+}
+
+// SceneRollback restores an earlier document of a scene
+type SceneRollback struct {
+	SceneId string `json:"sceneId"`
+	Version string `json:"version"`
+}
+
+// Validate checks the version is a name returned by the version list
+func (s *SceneRollback) Validate() error {
+	e := &ValidationError{}
+	if s.SceneId == "" {
+		e.add("sceneId", "is required")
+	}
+	if s.Version == "" {
+		e.add("version", "is required")
+	} else if _, err := ParseSceneVersion(s.Version); err != nil {
+		e.add("version", "unknown version %s", s.Version)
+	}
+	return e.err()
+}
@@ -3,18 +3,59 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/grafana/grafana-aws-sdk/pkg/awsds"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/proxy"
 )
 
+// STS AssumeRole accepts durations from 15 minutes up to the maximum session duration of the role, at most 12 hours
+const (
+	defaultTokenDurationSeconds = 3600
+	minTokenDurationSeconds     = 900
+	maxTokenDurationSeconds     = 43200
+)
+
+var defaultWriteRoles = []string{"Editor", "Admin"}
+
 type TwinMakerDataSourceSetting struct {
 	awsds.AWSDatasourceSettings
 	ProxyOptions        *proxy.Options
 	AssumeRoleARNWriter string `json:"assumeRoleArnWriter"`
 	WorkspaceID         string `json:"workspaceId"`
 	UID                 string `json:"uid"`
+	// Workspaces queries and resource requests may use besides the default workspace.
+	// When empty, only the default workspace can be used.
+	AllowedWorkspaces []string `json:"allowedWorkspaces,omitempty"`
+	// Workspaces in other regions and accounts, addressed by queries as region/account/workspace
+	WorkspaceTargets []WorkspaceTarget `json:"workspaceTargets,omitempty"`
+
+	// Session policy template for tokens vended to panels, defaults to models.DefaultPolicyTemplate
+	PolicyTemplate string `json:"policyTemplate,omitempty"`
+	// User-defined variables available in the policy template
+	PolicyVariables map[string]string `json:"policyVariables,omitempty"`
+
+	// Session policies for some users, the first matching rule is used
+	PolicyRules []PolicyRule `json:"policyRules,omitempty"`
+	// Set the user login as STS source identity, the role trust policy must allow sts:SetSourceIdentity
+	SetSourceIdentity bool `json:"setSourceIdentity,omitempty"`
+	// Tag sessions with the user login and role, the role trust policy must allow sts:TagSession
+	SessionTags bool `json:"sessionTags,omitempty"`
+
+	// Organization roles allowed to write property values, defaults to Editor and Admin
+	WriteRoles []string `json:"writeRoles,omitempty"`
+	// Users allowed to write property values whatever their role
+	WriteLogins []string `json:"writeLogins,omitempty"`
+
+	// Lifetime of the session tokens vended to panels, defaults to one hour
+	TokenDurationSeconds int `json:"tokenDurationSeconds,omitempty"`
+
+	// Default time budget in seconds for queries that do not set their own
+	QueryTimeoutSeconds int `json:"queryTimeoutSeconds,omitempty"`
+	// Limits applied to every query and resource request that loads all pages
+	QueryLimits
 }
 
 func (s *TwinMakerDataSourceSetting) Load(config backend.DataSourceInstanceSettings) error {
@@ -40,10 +81,123 @@ func (s *TwinMakerDataSourceSetting) Load(config backend.DataSourceInstanceSetti
 }
 
 func (s *TwinMakerDataSourceSetting) Validate() error {
-	// OK
+	if s.TokenDurationSeconds != 0 && (s.TokenDurationSeconds < minTokenDurationSeconds || s.TokenDurationSeconds > maxTokenDurationSeconds) {
+		return fmt.Errorf("token duration must be between %d and %d seconds", minTokenDurationSeconds, maxTokenDurationSeconds)
+	}
+	if err := s.SessionPolicy().Validate(s.Region, s.WorkspaceID); err != nil {
+		return err
+	}
+	for i, r := range s.PolicyRules {
+		if len(r.Logins) == 0 && len(r.Roles) == 0 {
+			return fmt.Errorf("policy rule %d does not match any login or role", i+1)
+		}
+		if err := r.Policy(s.SessionPolicy()).Validate(s.Region, s.WorkspaceID); err != nil {
+			return fmt.Errorf("policy rule %d: %w", i+1, err)
+		}
+	}
+	if s.QueryTimeoutSeconds < 0 {
+		return fmt.Errorf("query timeout must not be negative")
+	}
+	if s.MaxPages < 0 || s.MaxRows < 0 || s.MaxBytes < 0 {
+		return fmt.Errorf("query limits must not be negative")
+	}
+	for _, w := range s.AllowedWorkspaces {
+		if w == "" {
+			return fmt.Errorf("allowed workspaces must not be empty")
+		}
+	}
+	for _, t := range s.WorkspaceTargets {
+		if err := t.Validate(); err != nil {
+			return err
+		}
+		if err := s.SessionPolicy().Validate(t.Region, t.WorkspaceId); err != nil {
+			return fmt.Errorf("%s: %w", t.Ref(), err)
+		}
+	}
 	return nil
 }
 
+// SessionPolicy is the policy template for session tokens
+func (s *TwinMakerDataSourceSetting) SessionPolicy() PolicyTemplate {
+	return PolicyTemplate{
+		Template:  s.PolicyTemplate,
+		Variables: s.PolicyVariables,
+	}
+}
+
+// SessionPolicyFor is the policy template of the first rule matching the user, or the datasource template
+func (s *TwinMakerDataSourceSetting) SessionPolicyFor(identity TokenIdentity) PolicyTemplate {
+	for _, r := range s.PolicyRules {
+		if r.Matches(identity) {
+			return r.Policy(s.SessionPolicy())
+		}
+	}
+	return s.SessionPolicy()
+}
+
+// CanWrite is true when the user may write property values
+func (s *TwinMakerDataSourceSetting) CanWrite(identity TokenIdentity) bool {
+	if identity.Login != "" && slices.Contains(s.WriteLogins, identity.Login) {
+		return true
+	}
+	roles := s.WriteRoles
+	if len(roles) == 0 {
+		roles = defaultWriteRoles
+	}
+	return identity.Role != "" && slices.Contains(roles, identity.Role)
+}
+
+// TokenDuration is the lifetime of session tokens
+func (s *TwinMakerDataSourceSetting) TokenDuration() time.Duration {
+	if s.TokenDurationSeconds == 0 {
+		return defaultTokenDurationSeconds * time.Second
+	}
+	return time.Duration(s.TokenDurationSeconds) * time.Second
+}
+
+// WorkspaceNotAllowedError is returned for workspaces that are not in the datasource allow-list
+type WorkspaceNotAllowedError struct {
+	WorkspaceId string
+}
+
+func (e *WorkspaceNotAllowedError) Error() string {
+	return fmt.Sprintf("workspace %q is not allowed by the datasource configuration", e.WorkspaceId)
+}
+
+// ResolveWorkspace returns the workspace to use for a request, falling back to the default workspace
+func (s *TwinMakerDataSourceSetting) ResolveWorkspace(workspaceId string) (string, error) {
+	if workspaceId == "" || workspaceId == s.WorkspaceID {
+		return s.WorkspaceID, nil
+	}
+	if _, ok := s.Target(workspaceId); ok {
+		return workspaceId, nil
+	}
+	if !slices.Contains(s.AllowedWorkspaces, workspaceId) {
+		return "", &WorkspaceNotAllowedError{WorkspaceId: workspaceId}
+	}
+	return workspaceId, nil
+}
+
+// Workspaces returns every workspace the datasource may use, starting with the default workspace.
+// Workspaces of other regions and accounts are returned as region/account/workspace.
+func (s *TwinMakerDataSourceSetting) Workspaces() []string {
+	workspaces := make([]string, 0, len(s.AllowedWorkspaces)+len(s.WorkspaceTargets)+1)
+	if s.WorkspaceID != "" {
+		workspaces = append(workspaces, s.WorkspaceID)
+	}
+	for _, w := range s.AllowedWorkspaces {
+		if !slices.Contains(workspaces, w) {
+			workspaces = append(workspaces, w)
+		}
+	}
+	for _, t := range s.WorkspaceTargets {
+		if !slices.Contains(workspaces, t.Ref()) {
+			workspaces = append(workspaces, t.Ref())
+		}
+	}
+	return workspaces
+}
+
 func (s *TwinMakerDataSourceSetting) ToAWSDatasourceSettings() awsds.AWSDatasourceSettings {
 	cfg := awsds.AWSDatasourceSettings{
 		Profile:       s.Profile,
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveWorkspace(t *testing.T) {
+	settings := TwinMakerDataSourceSetting{
+		WorkspaceID:       "factory-1",
+		AllowedWorkspaces: []string{"factory-2", "factory-1", "factory-3"},
+	}
+
+	w, err := settings.ResolveWorkspace("")
+	require.NoError(t, err)
+	require.Equal(t, "factory-1", w)
+
+	w, err = settings.ResolveWorkspace("factory-3")
+	require.NoError(t, err)
+	require.Equal(t, "factory-3", w)
+
+	_, err = settings.ResolveWorkspace("other")
+	require.EqualError(t, err, `workspace "other" is not allowed by the datasource configuration`)
+
+	require.Equal(t, []string{"factory-1", "factory-2", "factory-3"}, settings.Workspaces())
+
+	t.Run("only the default workspace without an allow-list", func(t *testing.T) {
+		settings := TwinMakerDataSourceSetting{WorkspaceID: "factory-1"}
+		_, err := settings.ResolveWorkspace("factory-2")
+		require.Error(t, err)
+		require.Equal(t, []string{"factory-1"}, settings.Workspaces())
+	})
+}
+
+func TestCanWrite(t *testing.T) {
+	settings := TwinMakerDataSourceSetting{}
+	require.True(t, settings.CanWrite(TokenIdentity{Login: "jane", Role: "Editor"}))
+	require.False(t, settings.CanWrite(TokenIdentity{Login: "jane", Role: "Viewer"}))
+	require.False(t, settings.CanWrite(TokenIdentity{}))
+
+	settings = TwinMakerDataSourceSetting{WriteRoles: []string{"Admin"}, WriteLogins: []string{"operator"}}
+	require.False(t, settings.CanWrite(TokenIdentity{Login: "jane", Role: "Editor"}))
+	require.True(t, settings.CanWrite(TokenIdentity{Login: "jane", Role: "Admin"}))
+	require.True(t, settings.CanWrite(TokenIdentity{Login: "operator", Role: "Viewer"}))
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// SiteWiseAggregate is the aggregate IoT SiteWise computes for every bucket
+type SiteWiseAggregate string
+
+const (
+	SiteWiseAverage           SiteWiseAggregate = "AVERAGE"
+	SiteWiseCount             SiteWiseAggregate = "COUNT"
+	SiteWiseMaximum           SiteWiseAggregate = "MAXIMUM"
+	SiteWiseMinimum           SiteWiseAggregate = "MINIMUM"
+	SiteWiseSum               SiteWiseAggregate = "SUM"
+	SiteWiseStandardDeviation SiteWiseAggregate = "STANDARD_DEVIATION"
+)
+
+var siteWiseAggregates = []SiteWiseAggregate{SiteWiseAverage, SiteWiseCount, SiteWiseMaximum, SiteWiseMinimum, SiteWiseSum, SiteWiseStandardDeviation}
+
+// SiteWiseInterpolation is how IoT SiteWise fills in values between data points
+type SiteWiseInterpolation string
+
+const (
+	SiteWiseLinear SiteWiseInterpolation = "LINEAR_INTERPOLATION"
+	// last observation carried forward
+	SiteWiseLOCF SiteWiseInterpolation = "LOCF_INTERPOLATION"
+)
+
+type siteWiseResolution struct {
+	name     string
+	duration time.Duration
+}
+
+// bucket sizes IoT SiteWise accepts, from fine to coarse
+var siteWiseResolutions = []siteWiseResolution{
+	{"1m", time.Minute},
+	{"15m", 15 * time.Minute},
+	{"1h", time.Hour},
+	{"1d", 24 * time.Hour},
+}
+
+// about as many points as a graph panel shows, used to pick the resolution or interval when none is set
+const siteWiseDefaultPoints = 1000
+
+// IoT SiteWise limit for the interpolation interval
+const maxSiteWiseIntervalSeconds = 320000000
+
+// External ID properties of components backed by an IoT SiteWise asset property
+const (
+	SiteWiseAssetIdKey    = "assetId"
+	SiteWisePropertyIdKey = "propertyId"
+)
+
+// SiteWiseOptions reads SiteWise-connected components directly from IoT SiteWise, either as an
+// aggregate per bucket, or as values interpolated at a fixed interval
+type SiteWiseOptions struct {
+	Aggregate SiteWiseAggregate `json:"aggregate,omitempty"`
+	// Bucket size of aggregates, picked from the time range when empty
+	Resolution    string                `json:"resolution,omitempty"`
+	Interpolation SiteWiseInterpolation `json:"interpolation,omitempty"`
+	// Interval of interpolated values, picked from the time range when zero
+	IntervalSeconds int64 `json:"intervalSeconds,omitempty"`
+}
+
+func (o *SiteWiseOptions) validate(e *ValidationError) {
+	switch {
+	case o.Aggregate == "" && o.Interpolation == "":
+		e.add("sitewise", "set an aggregate or an interpolation")
+	case o.Aggregate != "" && o.Interpolation != "":
+		e.add("sitewise", "set either an aggregate or an interpolation, not both")
+	}
+	if o.Aggregate != "" && !slices.Contains(siteWiseAggregates, o.Aggregate) {
+		e.add("sitewise.aggregate", "unknown aggregate %s", o.Aggregate)
+	}
+	if o.Resolution != "" && !slices.ContainsFunc(siteWiseResolutions, func(r siteWiseResolution) bool { return r.name == o.Resolution }) {
+		e.add("sitewise.resolution", "must be 1m, 15m, 1h or 1d")
+	}
+	if o.Interpolation != "" && o.Interpolation != SiteWiseLinear && o.Interpolation != SiteWiseLOCF {
+		e.add("sitewise.interpolation", "must be LINEAR_INTERPOLATION or LOCF_INTERPOLATION")
+	}
+	if o.IntervalSeconds < 0 || o.IntervalSeconds > maxSiteWiseIntervalSeconds {
+		e.add("sitewise.intervalSeconds", "must be between 1 and %d", maxSiteWiseIntervalSeconds)
+	}
+}
+
+// Aggregated is true for bucketed queries, and false for aligned ones
+func (o *SiteWiseOptions) Aggregated() bool {
+	return o.Aggregate != ""
+}
+
+// ResolutionFor is the set resolution, or the finest one that keeps the range to about a thousand buckets
+func (o *SiteWiseOptions) ResolutionFor(span time.Duration) string {
+	if o.Resolution != "" {
+		return o.Resolution
+	}
+	for _, r := range siteWiseResolutions {
+		if span/r.duration <= siteWiseDefaultPoints {
+			return r.name
+		}
+	}
+	return siteWiseResolutions[len(siteWiseResolutions)-1].name
+}
+
+// IntervalFor is the set interval, or one that splits the range into about a thousand values
+func (o *SiteWiseOptions) IntervalFor(span time.Duration) int64 {
+	if o.IntervalSeconds > 0 {
+		return o.IntervalSeconds
+	}
+	return min(max(int64((span/siteWiseDefaultPoints).Seconds()), 1), maxSiteWiseIntervalSeconds)
+}
+
+// SiteWiseReference is the IoT SiteWise asset property behind a component property
+type SiteWiseReference struct {
+	AssetId    string
+	PropertyId string
+}
+
+// SiteWiseReferenceFromExternalId reads the asset property from the external ID properties of a component
+func SiteWiseReferenceFromExternalId(externalId map[string]string) (SiteWiseReference, bool) {
+	ref := SiteWiseReference{
+		AssetId:    externalId[SiteWiseAssetIdKey],
+		PropertyId: externalId[SiteWisePropertyIdKey],
+	}
+	return ref, ref.AssetId != "" && ref.PropertyId != ""
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSiteWiseOptions(t *testing.T) {
+	q := TwinMakerQuery{
+		QueryType:     QueryTypeEntityHistory,
+		WorkspaceId:   "ws",
+		EntityId:      "pump-1",
+		ComponentName: "sitewise",
+		Properties:    []string{"temperature"},
+		SiteWise:      &SiteWiseOptions{Aggregate: SiteWiseAverage, Resolution: "1h"},
+	}
+	require.NoError(t, q.Validate())
+
+	q.SiteWise = &SiteWiseOptions{Aggregate: "MEDIAN", Interpolation: SiteWiseLinear, Resolution: "5m"}
+	q.PropertyFilter = []TwinMakerPropertyFilter{{Name: "temperature", Op: ">", Value: TwinMakerFilterValue{DoubleValue: aws.Float64(1)}}}
+	err := q.Validate()
+	require.ErrorContains(t, err, "sitewise: set either an aggregate or an interpolation, not both")
+	require.ErrorContains(t, err, "sitewise.aggregate: unknown aggregate MEDIAN")
+	require.ErrorContains(t, err, "sitewise.resolution: must be 1m, 15m, 1h or 1d")
+	require.ErrorContains(t, err, "sitewise: can not be combined with filters")
+
+	options := SiteWiseOptions{Aggregate: SiteWiseMaximum}
+	require.Equal(t, "1m", options.ResolutionFor(6*time.Hour))
+	require.Equal(t, "15m", options.ResolutionFor(7*24*time.Hour))
+	require.Equal(t, "1d", options.ResolutionFor(10*365*24*time.Hour))
+
+	options = SiteWiseOptions{Interpolation: SiteWiseLOCF}
+	require.Equal(t, int64(1), options.IntervalFor(time.Minute))
+	require.Equal(t, int64(86), options.IntervalFor(24*time.Hour))
+}
+
+func TestSiteWiseReferenceFromExternalId(t *testing.T) {
+	ref, ok := SiteWiseReferenceFromExternalId(map[string]string{"assetId": "a", "propertyId": "p"})
+	require.True(t, ok)
+	require.Equal(t, SiteWiseReference{AssetId: "a", PropertyId: "p"}, ref)
+
+	_, ok = SiteWiseReferenceFromExternalId(map[string]string{"assetId": "a"})
+	require.False(t, ok)
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WorkspaceTarget is a workspace in another region or account, reached by assuming a role there
+type WorkspaceTarget struct {
+	Region        string `json:"region"`
+	AssumeRoleARN string `json:"assumeRoleArn"`
+	ExternalID    string `json:"externalId,omitempty"`
+	WorkspaceId   string `json:"workspaceId"`
+}
+
+// Account returns the AWS account of the target role
+func (t WorkspaceTarget) Account() string {
+	// arn:partition:iam::account:role/name
+	parts := strings.SplitN(t.AssumeRoleARN, ":", 6)
+	if len(parts) < 6 {
+		return ""
+	}
+	return parts[4]
+}
+
+// Ref is how queries address the target workspace: region/account/workspace
+func (t WorkspaceTarget) Ref() string {
+	return t.Region + "/" + t.Account() + "/" + t.WorkspaceId
+}
+
+// ClientKey identifies the AWS client shared by targets in the same region and account
+func (t WorkspaceTarget) ClientKey() string {
+	return t.Region + "/" + t.AssumeRoleARN + "/" + t.ExternalID
+}
+
+// Validate checks the target can be addressed by queries
+func (t WorkspaceTarget) Validate() error {
+	if t.Region == "" || t.WorkspaceId == "" {
+		return fmt.Errorf("workspace targets need a region and a workspace")
+	}
+	if t.Account() == "" {
+		return fmt.Errorf("invalid assume role ARN for workspace target %q: %q", t.WorkspaceId, t.AssumeRoleARN)
+	}
+	if strings.Contains(t.WorkspaceId, "/") {
+		return fmt.Errorf("invalid workspace id %q", t.WorkspaceId)
+	}
+	return nil
+}
+
+// IsWorkspaceRef is true for workspace ids written as region/account/workspace
+func IsWorkspaceRef(workspaceId string) bool {
+	return strings.Count(workspaceId, "/") == 2
+}
+
+// SplitWorkspaceRef returns the region prefix (region/account/) and the workspace of a workspace ref
+func SplitWorkspaceRef(workspaceId string) (prefix string, workspace string) {
+	if !IsWorkspaceRef(workspaceId) {
+		return "", workspaceId
+	}
+	idx := strings.LastIndex(workspaceId, "/")
+	return workspaceId[:idx+1], workspaceId[idx+1:]
+}
+
+// Target returns the configured target for a region/account/workspace ref
+func (s *TwinMakerDataSourceSetting) Target(ref string) (WorkspaceTarget, bool) {
+	for _, t := range s.WorkspaceTargets {
+		if t.Ref() == ref {
+			return t, true
+		}
+	}
+	return WorkspaceTarget{}, false
+}
+
+// TargetSettings returns the datasource settings used to connect to a target
+func (s *TwinMakerDataSourceSetting) TargetSettings(t WorkspaceTarget) TwinMakerDataSourceSetting {
+	settings := *s
+	settings.Region = t.Region
+	settings.AssumeRoleARN = t.AssumeRoleARN
+	settings.ExternalID = t.ExternalID
+	settings.WorkspaceID = t.WorkspaceId
+	settings.WorkspaceTargets = nil
+	settings.AllowedWorkspaces = nil
+	// the custom endpoint belongs to the default region
+	settings.Endpoint = ""
+	// writes go through the default account only
+	settings.AssumeRoleARNWriter = ""
+	return settings
+}
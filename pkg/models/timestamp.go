@@ -0,0 +1,52 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestamp layouts seen in history values, data connectors do not all follow RFC3339.  Layouts
+// without a zone are read as UTC.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+}
+
+// ParseTimestamp reads a timestamp of a history value or an imported row.  Besides the layouts above,
+// epoch seconds, milliseconds, microseconds and nanoseconds are accepted, told apart by their size.
+// Seconds may have a fraction.
+func ParseTimestamp(s string) (time.Time, error) {
+	value := strings.TrimSpace(s)
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		var t time.Time
+		switch abs := max(n, -n); {
+		case abs < 1e11:
+			t = time.Unix(n, 0)
+		case abs < 1e14:
+			t = time.UnixMilli(n)
+		case abs < 1e17:
+			t = time.UnixMicro(n)
+		default:
+			t = time.Unix(0, n)
+		}
+		return t.UTC(), nil
+	}
+	// fractional epoch seconds, a float64 only keeps them to the microsecond
+	if f, err := strconv.ParseFloat(value, 64); err == nil && math.Abs(f) < 1e11 {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e6))*1e3).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FieldError describes a problem with a single field of the query
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every problem found in a query so they can be reported at once
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		if fe.Path == "" {
+			msgs = append(msgs, fe.Message)
+		} else {
+			msgs = append(msgs, fe.Path+": "+fe.Message)
+		}
+	}
+	return "invalid query: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(path string, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *ValidationError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// MissingFieldError reports a required field that was not set
+func MissingFieldError(path string) error {
+	e := &ValidationError{}
+	e.add(path, "is required")
+	return e
+}
+
+// IsValidationError is true when the error was caused by an invalid query
+func IsValidationError(err error) bool {
+	var ve *ValidationError
+	return errors.As(err, &ve)
+}
+
+// Validate checks the query has everything needed for its query type
+func (q *TwinMakerQuery) Validate() error {
+	e := &ValidationError{}
+
+	requireWorkspace := func() {
+		if q.WorkspaceId == "" {
+			e.add("workspaceId", "is required")
+		}
+	}
+	requireEntity := func() {
+		if q.EntityId == "" {
+			e.add("entityId", "is required")
+		}
+	}
+	requireComponent := func() {
+		if q.ComponentName == "" {
+			e.add("componentName", "is required")
+		}
+	}
+	requireProperties := func() {
+		if len(q.Properties) == 0 {
+			e.add("properties", "at least one property is required")
+		}
+		for i, p := range q.Properties {
+			if p == "" {
+				e.add(fmt.Sprintf("properties[%d]", i), "must not be empty")
+			}
+		}
+	}
+
+	switch q.QueryType {
+	case QueryTypeListWorkspace:
+	case QueryTypeListScenes, QueryTypeListEntities:
+		requireWorkspace()
+	case QueryTypeGetEntity:
+		requireWorkspace()
+		requireEntity()
+	case QueryTypeGetPropertyValue:
+		requireWorkspace()
+		requireEntity()
+		requireComponent()
+		requireProperties()
+		validateFilters(e, "tabularConditions.propertyFilter", q.TabularConditions.PropertyFilter)
+		for i, o := range q.TabularConditions.OrderBy {
+			if o.PropertyName == "" {
+				e.add(fmt.Sprintf("tabularConditions.orderBy[%d].propertyName", i), "is required")
+			}
+		}
+	case QueryTypeEntityHistory:
+		requireWorkspace()
+		requireEntity()
+		requireComponent()
+		requireProperties()
+	case QueryTypeComponentHistory:
+		requireWorkspace()
+		if q.ComponentTypeId == "" {
+			e.add("componentTypeId", "is required")
+		}
+		requireProperties()
+	case QueryTypeGetAlarms:
+		requireWorkspace()
+	case QueryTypeGetSceneBindings:
+		requireWorkspace()
+		if q.SceneId == "" {
+			e.add("sceneId", "is required")
+		}
+	case QueryTypeVideoAvailability:
+		requireWorkspace()
+		requireEntity()
+	case "":
+		// nothing selected in the editor yet
+	default:
+		e.add("queryType", "unknown query type %q", q.QueryType)
+	}
+
+	switch q.QueryType {
+	case QueryTypeEntityHistory, QueryTypeComponentHistory, QueryTypeGetAlarms:
+		validateFilters(e, "filter", q.PropertyFilter)
+		for i, g := range q.FilterGroups {
+			validateFilters(e, fmt.Sprintf("filterGroups[%d].filter", i), g.Filter)
+		}
+	}
+
+	if q.SiteWise != nil && (q.QueryType == QueryTypeEntityHistory || q.QueryType == QueryTypeComponentHistory) {
+		q.SiteWise.validate(e)
+		// SiteWise has no value filters, and filtering aggregates would not mean the same thing
+		if len(q.PropertyFilter) > 0 || len(q.FilterGroups) > 0 {
+			e.add("sitewise", "can not be combined with filters")
+		}
+	}
+
+	if q.MaxResults < 0 {
+		e.add("maxResults", "must not be negative")
+	}
+	if q.FlattenDepth < 0 || q.FlattenDepth > MaxFlattenDepth {
+		e.add("flattenDepth", "must be between 0 and %d", MaxFlattenDepth)
+	}
+	if q.MaxPages < 0 {
+		e.add("maxPages", "must not be negative")
+	}
+	if q.MaxRows < 0 {
+		e.add("maxRows", "must not be negative")
+	}
+	if q.MaxBytes < 0 {
+		e.add("maxBytes", "must not be negative")
+	}
+
+	return e.err()
+}
+
+func validateFilters(e *ValidationError, path string, filters []TwinMakerPropertyFilter) {
+	for i, f := range filters {
+		if f.IsEmpty() {
+			continue
+		}
+		if err := f.Validate(); err != nil {
+			e.add(fmt.Sprintf("%s[%d]", path, i), "%s", err.Error())
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	t.Run("reports every missing field", func(t *testing.T) {
+		q := TwinMakerQuery{QueryType: QueryTypeEntityHistory, WorkspaceId: "AlarmWorkspace"}
+		err := q.Validate()
+		require.True(t, IsValidationError(err))
+		ve := err.(*ValidationError)
+		require.Equal(t, []FieldError{
+			{Path: "entityId", Message: "is required"},
+			{Path: "componentName", Message: "is required"},
+			{Path: "properties", Message: "at least one property is required"},
+		}, ve.Errors)
+	})
+
+	t.Run("reports filter paths", func(t *testing.T) {
+		q := TwinMakerQuery{
+			QueryType:       QueryTypeComponentHistory,
+			WorkspaceId:     "AlarmWorkspace",
+			ComponentTypeId: "com.example.cookiefactory.alarm",
+			Properties:      []string{"alarm_status"},
+			FilterGroups: []TwinMakerFilterGroup{
+				{Filter: []TwinMakerPropertyFilter{{Name: "alarm_status", Op: "LIKE", Value: TwinMakerFilterValue{StringValue: aws.String("ACT")}}}},
+			},
+		}
+		err := q.Validate()
+		require.ErrorContains(t, err, "filterGroups[0].filter[0]: invalid operator")
+	})
+
+	t.Run("unknown query type", func(t *testing.T) {
+		q := TwinMakerQuery{QueryType: "Unknown"}
+		require.ErrorContains(t, q.Validate(), `queryType: unknown query type "Unknown"`)
+	})
+
+	t.Run("flatten depth out of range", func(t *testing.T) {
+		q := TwinMakerQuery{QueryType: QueryTypeGetEntity, WorkspaceId: "AlarmWorkspace", EntityId: "Mixer_1", FlattenDepth: MaxFlattenDepth + 1}
+		require.ErrorContains(t, q.Validate(), "flattenDepth: must be between 0 and 5")
+	})
+
+	t.Run("valid query", func(t *testing.T) {
+		q := TwinMakerQuery{QueryType: QueryTypeGetEntity, WorkspaceId: "AlarmWorkspace", EntityId: "Mixer_1"}
+		require.NoError(t, q.Validate())
+	})
+}
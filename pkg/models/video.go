@@ -0,0 +1,200 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// VideoProtocol is the streaming protocol of a playback URL
+type VideoProtocol string
+
+const (
+	VideoProtocolHLS  VideoProtocol = "HLS"
+	VideoProtocolDASH VideoProtocol = "DASH"
+)
+
+// VideoPlaybackMode follows the Kinesis Video Streams playback modes
+type VideoPlaybackMode string
+
+const (
+	VideoPlaybackLive       VideoPlaybackMode = "LIVE"
+	VideoPlaybackLiveReplay VideoPlaybackMode = "LIVE_REPLAY"
+	VideoPlaybackOnDemand   VideoPlaybackMode = "ON_DEMAND"
+)
+
+// KVSStreamNameProperty is the property of video components holding the Kinesis video stream name
+const KVSStreamNameProperty = "kvsStreamName"
+
+const (
+	// how long playback URLs stay valid when no expiry is requested
+	DefaultVideoURLExpiry = time.Hour
+	// limits Kinesis Video Streams accepts for the session expiry
+	MinVideoURLExpiry = 5 * time.Minute
+	MaxVideoURLExpiry = 12 * time.Hour
+	// longest window an on demand session can play
+	MaxVideoWindow = 24 * time.Hour
+)
+
+// VideoStreamRequest asks for a playback URL of the stream of an entity video component.  Without a
+// start time the live stream is played, with only a start time the stream is replayed from then on,
+// and with both the window is played on demand.
+type VideoStreamRequest struct {
+	EntityId string `json:"entityId"`
+	// The video component, defaults to the first component with a kvsStreamName property
+	ComponentName string        `json:"componentName,omitempty"`
+	Protocol      VideoProtocol `json:"protocol,omitempty"`
+	Start         *time.Time    `json:"start,omitempty"`
+	End           *time.Time    `json:"end,omitempty"`
+	// How long the URL stays valid
+	ExpiresSeconds int `json:"expiresSeconds,omitempty"`
+
+	// Set once the component is resolved
+	StreamName string `json:"-"`
+}
+
+// Validate checks the request and fills in the defaults
+func (v *VideoStreamRequest) Validate() error {
+	e := &ValidationError{}
+	if v.EntityId == "" {
+		e.add("entityId", "is required")
+	}
+	switch v.Protocol {
+	case "":
+		v.Protocol = VideoProtocolHLS
+	case VideoProtocolHLS, VideoProtocolDASH:
+	default:
+		e.add("protocol", "must be HLS or DASH")
+	}
+	if v.Start == nil && v.End != nil {
+		e.add("start", "is required when end is set")
+	}
+	if v.Start != nil && v.End != nil {
+		switch {
+		case !v.End.After(*v.Start):
+			e.add("end", "must be after start")
+		case v.End.Sub(*v.Start) > MaxVideoWindow:
+			e.add("end", "the window can be at most %s", MaxVideoWindow)
+		}
+	}
+	expires := time.Duration(v.ExpiresSeconds) * time.Second
+	switch {
+	case v.ExpiresSeconds == 0:
+		v.ExpiresSeconds = int(DefaultVideoURLExpiry.Seconds())
+	case expires < MinVideoURLExpiry || expires > MaxVideoURLExpiry:
+		e.add("expiresSeconds", "must be between %d and %d", int(MinVideoURLExpiry.Seconds()), int(MaxVideoURLExpiry.Seconds()))
+	}
+	return e.err()
+}
+
+// PlaybackMode picks the playback mode from the requested window.  A window that has not ended
+// yet is replayed, so the video keeps following the dashboard range.
+func (v *VideoStreamRequest) PlaybackMode(now time.Time) VideoPlaybackMode {
+	switch {
+	case v.Start == nil:
+		return VideoPlaybackLive
+	case v.End == nil || v.End.After(now):
+		return VideoPlaybackLiveReplay
+	}
+	return VideoPlaybackOnDemand
+}
+
+// VideoStreamURL is a playback URL along with the time it stops working
+type VideoStreamURL struct {
+	StreamName   string            `json:"streamName"`
+	Protocol     VideoProtocol     `json:"protocol"`
+	PlaybackMode VideoPlaybackMode `json:"playbackMode"`
+	URL          string            `json:"url"`
+	Expiration   time.Time         `json:"expiration"`
+}
+
+// VideoRange is a span of recorded video
+type VideoRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// MergeVideoRanges sorts the ranges, and joins ranges that overlap or are less than the gap apart
+func MergeVideoRanges(ranges []VideoRange, gap time.Duration) []VideoRange {
+	sorted := slices.Clone(ranges)
+	slices.SortFunc(sorted, func(a, b VideoRange) int {
+		return a.Start.Compare(b.Start)
+	})
+	merged := []VideoRange{}
+	for _, r := range sorted {
+		last := len(merged) - 1
+		if last >= 0 && !r.Start.After(merged[last].End.Add(gap)) {
+			if r.End.After(merged[last].End) {
+				merged[last].End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// EdgeVideoRecordedProperty is the property the edge video connector updates with every span it
+// recorded, as a JSON object with start and end times.  Those spans stay on the device until an
+// upload is requested.
+const EdgeVideoRecordedProperty = "VideoRecordedTimeRange"
+
+// VideoAvailability is the state of video over a span of time
+type VideoAvailability string
+
+const (
+	// in Kinesis Video Streams, can be played
+	VideoAvailable VideoAvailability = "available"
+	// only recorded on the edge device
+	VideoOnEdge  VideoAvailability = "edge"
+	VideoMissing VideoAvailability = "none"
+)
+
+// ParseVideoRange reads a span written by the edge connector.  Times may be RFC3339 strings, or
+// epoch seconds or milliseconds, under start and end or the start-timestamp and end-timestamp keys
+// of upload requests.
+func ParseVideoRange(value string) (VideoRange, error) {
+	v := struct {
+		Start          json.RawMessage `json:"start"`
+		End            json.RawMessage `json:"end"`
+		StartTimestamp json.RawMessage `json:"start-timestamp"`
+		EndTimestamp   json.RawMessage `json:"end-timestamp"`
+	}{}
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return VideoRange{}, fmt.Errorf("invalid time range %q", value)
+	}
+	if v.Start == nil {
+		v.Start, v.End = v.StartTimestamp, v.EndTimestamp
+	}
+	start, err := parseVideoTime(v.Start)
+	if err != nil {
+		return VideoRange{}, fmt.Errorf("invalid start in %q", value)
+	}
+	end, err := parseVideoTime(v.End)
+	if err != nil || end.Before(start) {
+		return VideoRange{}, fmt.Errorf("invalid end in %q", value)
+	}
+	return VideoRange{Start: start, End: end}, nil
+}
+
+func parseVideoTime(raw json.RawMessage) (time.Time, error) {
+	var n float64
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t, nil
+		}
+		if n, err = strconv.ParseFloat(s, 64); err != nil {
+			return time.Time{}, err
+		}
+	} else if err := json.Unmarshal(raw, &n); err != nil {
+		return time.Time{}, err
+	}
+	// anything past 1e11 seconds is far in the future, so it must be milliseconds
+	if n > 1e11 {
+		return time.UnixMilli(int64(n)).UTC(), nil
+	}
+	return time.UnixMilli(int64(n * 1000)).UTC(), nil
+}
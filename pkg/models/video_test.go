@@ -0,0 +1,109 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVideoStreamRequest(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	hourAgo := now.Add(-time.Hour)
+	later := now.Add(time.Hour)
+
+	req := VideoStreamRequest{EntityId: "camera"}
+	require.NoError(t, req.Validate())
+	require.Equal(t, VideoProtocolHLS, req.Protocol)
+	require.Equal(t, 3600, req.ExpiresSeconds)
+	require.Equal(t, VideoPlaybackLive, req.PlaybackMode(now))
+
+	req = VideoStreamRequest{EntityId: "camera", Start: &hourAgo, End: &later}
+	require.NoError(t, req.Validate())
+	require.Equal(t, VideoPlaybackLiveReplay, req.PlaybackMode(now))
+
+	req = VideoStreamRequest{EntityId: "camera", Start: &hourAgo, End: &now}
+	require.Equal(t, VideoPlaybackOnDemand, req.PlaybackMode(now.Add(time.Second)))
+
+	twoDays := now.Add(-48 * time.Hour)
+	req = VideoStreamRequest{Protocol: "RTSP", Start: &twoDays, End: &now, ExpiresSeconds: 10}
+	err := req.Validate()
+	require.ErrorContains(t, err, "entityId: is required")
+	require.ErrorContains(t, err, "protocol: must be HLS or DASH")
+	require.ErrorContains(t, err, "end: the window can be at most 24h0m0s")
+	require.ErrorContains(t, err, "expiresSeconds: must be between 300 and 43200")
+}
+
+func TestMergeVideoRanges(t *testing.T) {
+	at := func(seconds int) time.Time { return time.Unix(int64(seconds), 0).UTC() }
+	merged := MergeVideoRanges([]VideoRange{
+		{Start: at(10), End: at(12)},
+		{Start: at(0), End: at(2)},
+		{Start: at(3), End: at(5)},
+		{Start: at(4), End: at(6)},
+	}, 2*time.Second)
+	require.Equal(t, []VideoRange{
+		{Start: at(0), End: at(6)},
+		{Start: at(10), End: at(12)},
+	}, merged)
+}
+
+func TestParseVideoRange(t *testing.T) {
+	expected := VideoRange{
+		Start: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2024, 1, 2, 0, 5, 0, 0, time.UTC),
+	}
+	for _, v := range []string{
+		`{"start":"2024-01-02T00:00:00Z","end":"2024-01-02T00:05:00Z"}`,
+		`{"start":1704153600,"end":1704153900}`,
+		`{"start":1704153600000,"end":1704153900000}`,
+	} {
+		r, err := ParseVideoRange(v)
+		require.NoError(t, err, v)
+		require.True(t, expected.Start.Equal(r.Start) && expected.End.Equal(r.End), v)
+	}
+
+	_, err := ParseVideoRange(`{"start":1704153900,"end":1704153600}`)
+	require.ErrorContains(t, err, "invalid end")
+	_, err = ParseVideoRange(`not json`)
+	require.Error(t, err)
+}
+
+func TestVideoUploadRequest(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	req := VideoUploadRequest{EntityId: "camera", Start: now.Add(-time.Hour), End: now}
+	require.NoError(t, req.Validate(now))
+
+	req = VideoUploadRequest{Start: now, End: now.Add(time.Minute)}
+	err := req.Validate(now)
+	require.ErrorContains(t, err, "entityId: is required")
+	require.ErrorContains(t, err, "end: can not be in the future")
+
+	req = VideoUploadRequest{EntityId: "camera", Start: now.Add(-48 * time.Hour), End: now}
+	require.ErrorContains(t, req.Validate(now), "end: the window can be at most 24h0m0s")
+}
+
+func TestVideoUploadState(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	before := now.Add(-time.Minute)
+	after := now.Add(time.Minute)
+	requested := &VideoRange{Start: now.Add(-time.Hour), End: now}
+
+	status := VideoUploadStatus{}
+	status.UpdateState()
+	require.Equal(t, VideoUploadNone, status.State)
+
+	// an upload that finished before the request is from an earlier one
+	status = VideoUploadStatus{Requested: requested, RequestedAt: &now, Uploaded: requested, UploadedAt: &before}
+	status.UpdateState()
+	require.Equal(t, VideoUploadPending, status.State)
+
+	status.Uploaded = &VideoRange{Start: requested.Start, End: now.Add(-time.Minute)}
+	status.UploadedAt = &after
+	status.UpdateState()
+	require.Equal(t, VideoUploadUploading, status.State)
+
+	status.Uploaded = requested
+	status.UpdateState()
+	require.Equal(t, VideoUploadCompleted, status.State)
+}
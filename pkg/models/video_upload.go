@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Properties of the video component and its edge connector asset in IoT SiteWise
+const (
+	// the SiteWise asset of the edge connector the video component was synced from
+	EdgeVideoAssetIdProperty = "sitewiseAssetId"
+	// written to ask the connector to upload recorded video
+	EdgeVideoUploadRequestProperty = "VideoUploadRequest"
+	// updated by the connector with the span it last uploaded
+	EdgeVideoUploadedProperty = "VideoUploadedTimeRange"
+)
+
+// VideoUploadRequest asks the edge connector of an entity video component to upload the video it
+// recorded between start and end to Kinesis Video Streams
+type VideoUploadRequest struct {
+	EntityId string `json:"entityId"`
+	// The video component, defaults to the first component with a kvsStreamName property
+	ComponentName string    `json:"componentName,omitempty"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+}
+
+// Validate checks the window can have been recorded already
+func (v *VideoUploadRequest) Validate(now time.Time) error {
+	e := &ValidationError{}
+	if v.EntityId == "" {
+		e.add("entityId", "is required")
+	}
+	if v.Start.IsZero() {
+		e.add("start", "is required")
+	}
+	switch {
+	case v.End.IsZero():
+		e.add("end", "is required")
+	case v.End.After(now):
+		e.add("end", "can not be in the future, video is uploaded once it is recorded")
+	case !v.Start.IsZero() && !v.End.After(v.Start):
+		e.add("end", "must be after start")
+	case !v.Start.IsZero() && v.End.Sub(v.Start) > MaxVideoWindow:
+		e.add("end", "the window can be at most %s", MaxVideoWindow)
+	}
+	return e.err()
+}
+
+// UploadRequestValue is the property value the edge connector reads the window from
+func (v *VideoUploadRequest) UploadRequestValue() string {
+	b, _ := json.Marshal(map[string]string{
+		"start-timestamp": strconv.FormatInt(v.Start.Unix(), 10),
+		"end-timestamp":   strconv.FormatInt(v.End.Unix(), 10),
+	})
+	return string(b)
+}
+
+// VideoUploadState is how far the connector got with the last upload request
+type VideoUploadState string
+
+const (
+	VideoUploadNone      VideoUploadState = "none"
+	VideoUploadPending   VideoUploadState = "pending"
+	VideoUploadUploading VideoUploadState = "uploading"
+	VideoUploadCompleted VideoUploadState = "completed"
+)
+
+// VideoUploadStatus is the last upload request of an edge connector, read back from its status properties
+type VideoUploadStatus struct {
+	EntityId      string           `json:"entityId"`
+	ComponentName string           `json:"componentName"`
+	AssetId       string           `json:"assetId"`
+	State         VideoUploadState `json:"state"`
+	Requested     *VideoRange      `json:"requested,omitempty"`
+	RequestedAt   *time.Time       `json:"requestedAt,omitempty"`
+	Uploaded      *VideoRange      `json:"uploaded,omitempty"`
+	UploadedAt    *time.Time       `json:"uploadedAt,omitempty"`
+	Recorded      *VideoRange      `json:"recorded,omitempty"`
+}
+
+// UpdateState works out the state from the requested and uploaded spans.  The connector reports the
+// span it uploaded last, so only updates after the request count.
+func (s *VideoUploadStatus) UpdateState() {
+	switch {
+	case s.Requested == nil:
+		s.State = VideoUploadNone
+	case s.Uploaded == nil || s.UploadedAt == nil || (s.RequestedAt != nil && s.UploadedAt.Before(*s.RequestedAt)):
+		s.State = VideoUploadPending
+	case !s.Uploaded.End.Before(s.Requested.End):
+		s.State = VideoUploadCompleted
+	default:
+		s.State = VideoUploadUploading
+	}
+}
@@ -67,6 +67,7 @@ func NewTwinMakerDatasource(ctx context.Context, settings models.TwinMakerDataSo
 		backend.Logger.Error("Error initializing TwinMakerTokenProvider", "err", err)
 		return nil
 	}
+	c = twinmaker.NewFederatedClient(c, settings)
 
 	// Caching the frame results -- not twinmaker raw results
 	// cached := twinmaker.NewCachingClient(c, 30*time.Minute)
@@ -88,14 +89,26 @@ func newTwinMakerDatasource(settings models.TwinMakerDataSourceSetting, c twinma
 
 		// Since the whole result is cached, this does not use the cached client
 		res: twinmaker.NewCachingResource(
-			twinmaker.NewTwinMakerResource(c, settings.WorkspaceID),
+			twinmaker.NewTwinMakerResource(c),
 			ttl),
 	}
 	r.HandleFunc("/token", ds.HandleGetToken)
 	r.HandleFunc("/entity-properties", ds.HandleBatchPutPropertyValues)
+	r.HandleFunc("/entity-update", ds.HandleUpdateEntity).Methods(http.MethodPost)
+	r.HandleFunc("/import", ds.HandleImportPropertyValues).Methods(http.MethodPost)
+	r.HandleFunc("/export", ds.HandleExport).Methods(http.MethodPost)
+	r.HandleFunc("/scene", ds.HandleGetScene).Methods(http.MethodGet)
+	r.HandleFunc("/scene-create", ds.HandleCreateScene).Methods(http.MethodPost)
+	r.HandleFunc("/scene-update", ds.HandleUpdateScene).Methods(http.MethodPost)
+	r.HandleFunc("/scene-rollback", ds.HandleRollbackScene).Methods(http.MethodPost)
+	r.HandleFunc("/scene-versions", ds.HandleListSceneVersions).Methods(http.MethodGet)
+	r.HandleFunc("/video-stream", ds.HandleGetVideoStreamURL).Methods(http.MethodGet)
+	r.HandleFunc("/video-upload", ds.HandleRequestVideoUpload).Methods(http.MethodPost)
+	r.HandleFunc("/video-upload-status", ds.HandleGetVideoUploadStatus).Methods(http.MethodGet)
 
 	// they are now cached depending on the res set in the ds above
 	r.HandleFunc("/entity", ds.HandleGetEntity)
+	r.HandleFunc("/scene-document", ds.HandleGetSceneDocument)
 	r.HandleFunc("/list/workspaces", ds.HandleListWorkspaces)
 	r.HandleFunc("/list/scenes", ds.HandleListScenes)
 	r.HandleFunc("/list/options", ds.HandleListOptions)
@@ -119,7 +132,9 @@ func (ds *TwinMakerDatasource) QueryData(ctx context.Context, req *backend.Query
 		query, err := models.ReadQuery(q)
 		if err != nil {
 			response.Responses[q.RefID] = backend.DataResponse{
-				Error: err,
+				Error:       err,
+				ErrorSource: backend.ErrorSourceDownstream,
+				Status:      backend.StatusBadRequest,
 			}
 			continue
 		}
@@ -183,7 +198,7 @@ func (ds *TwinMakerDatasource) CheckHealth(ctx context.Context, _ *backend.Check
 		}, nil
 	}
 
-	_, err := ds.handler.GetSessionToken(ctx, time.Second*3600, ds.settings.WorkspaceID)
+	_, err := ds.handler.GetSessionToken(ctx, ds.settings.TokenDuration(), ds.settings.WorkspaceID, models.TokenIdentity{})
 	if err != nil {
 		var smErr *smithy.OperationError
 		if errors.As(err, &smErr) {
@@ -223,7 +238,7 @@ func (ds *TwinMakerDatasource) CheckHealth(ctx context.Context, _ *backend.Check
 	}
 
 	if ds.settings.AssumeRoleARNWriter != "" {
-		_, err := ds.handler.GetWriteSessionToken(ctx, time.Second*3600, ds.settings.WorkspaceID)
+		_, err := ds.handler.GetWriteSessionToken(ctx, ds.settings.TokenDuration(), ds.settings.WorkspaceID, models.TokenIdentity{})
 		if err != nil {
 			var smErr smithy.APIError
 			if errors.As(err, &smErr) {
@@ -302,13 +317,54 @@ func (ds *TwinMakerDatasource) PublishStream(_ context.Context, _ *backend.Publi
 }
 
 func (ds *TwinMakerDatasource) DoQuery(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse {
-	response := backend.DataResponse{}
+	queries, err := ds.prepareQueries(ds.withQueryBounds(query))
+	if err != nil {
+		return twinmaker.WithErrorSource(backend.DataResponse{Error: err})
+	}
+
+	if len(queries) == 1 {
+		return twinmaker.WithErrorSource(ds.doSingleQuery(ctx, queries[0]))
+	}
+	return twinmaker.WithErrorSource(ds.doExpandedQueries(ctx, queries))
+}
+
+// withQueryBounds sets the deadline from the query or datasource timeout, and the limits of the query
+func (ds *TwinMakerDatasource) withQueryBounds(query models.TwinMakerQuery) models.TwinMakerQuery {
+	timeout := query.TimeoutSeconds
+	if timeout <= 0 {
+		timeout = ds.settings.QueryTimeoutSeconds
+	}
+	if timeout > 0 && query.Deadline.IsZero() {
+		query.Deadline = time.Now().Add(time.Duration(timeout) * time.Second)
+	}
+
+	// a query can lower the datasource limits, but never raise them
+	query.QueryLimits = ds.settings.QueryLimits.Min(query.QueryLimits)
+	return query
+}
 
+// prepareQueries sets the workspace, and expands the query into the validated requests to run
+func (ds *TwinMakerDatasource) prepareQueries(query models.TwinMakerQuery) ([]models.TwinMakerQuery, error) {
 	// set the default datasource WorkspaceId if missing in the query
-	if query.WorkspaceId == "" {
-		query.WorkspaceId = ds.settings.WorkspaceID
+	workspaceId, err := ds.settings.ResolveWorkspace(query.WorkspaceId)
+	if err != nil {
+		return nil, err
 	}
+	query.WorkspaceId = workspaceId
 
+	queries, err := query.Expand()
+	if err != nil {
+		return nil, &models.ValidationError{Errors: []models.FieldError{{Message: err.Error()}}}
+	}
+	for _, q := range queries {
+		if err := q.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return queries, nil
+}
+
+func (ds *TwinMakerDatasource) doSingleQuery(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse {
 	switch query.QueryType {
 	case models.QueryTypeListWorkspace:
 		return ds.handler.ListWorkspaces(ctx, query)
@@ -326,9 +382,18 @@ func (ds *TwinMakerDatasource) DoQuery(ctx context.Context, query models.TwinMak
 		return ds.handler.GetComponentHistory(ctx, query)
 	case models.QueryTypeGetAlarms:
 		return ds.handler.GetAlarms(ctx, query)
+	case models.QueryTypeGetSceneBindings:
+		return ds.handler.GetSceneBindings(ctx, query)
+	case models.QueryTypeVideoAvailability:
+		return ds.handler.GetVideoAvailability(ctx, query)
+	case "":
+		return backend.DataResponse{}
 	}
 
-	return response
+	return backend.DataResponse{
+		Error:       fmt.Errorf("unknown query type: %q", query.QueryType),
+		ErrorSource: backend.ErrorSourcePlugin,
+	}
 }
 
 func (ds *TwinMakerDatasource) RequestLoop(ctx context.Context, query models.TwinMakerQuery, resChannel chan *backend.DataResponse) {
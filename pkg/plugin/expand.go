@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// maximum number of expanded requests running at the same time
+const maxConcurrentExpansions = 8
+
+// doExpandedQueries runs every expansion of a multi-value query concurrently and merges the frames.
+// The continuation token can not describe several requests, so each expansion follows its own
+// pages before the results are merged.
+func (ds *TwinMakerDatasource) doExpandedQueries(ctx context.Context, queries []models.TwinMakerQuery) backend.DataResponse {
+	responses := make([]backend.DataResponse, len(queries))
+	sem := make(chan struct{}, maxConcurrentExpansions)
+	wg := sync.WaitGroup{}
+
+	for i, q := range queries {
+		wg.Add(1)
+		go func(i int, q models.TwinMakerQuery) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			responses[i] = ds.doAllPages(ctx, q)
+		}(i, q)
+	}
+	wg.Wait()
+
+	dr := backend.DataResponse{}
+	notices := []data.Notice{}
+	failed := 0
+	for i, res := range responses {
+		if res.Error != nil {
+			failed++
+			notices = append(notices, data.Notice{
+				Severity: data.NoticeSeverityWarning,
+				Text:     fmt.Sprintf("%s: %s", expansionName(queries[i].Expansion), res.Error.Error()),
+			})
+			continue
+		}
+		for _, frame := range res.Frames {
+			setExpansionLabels(frame, queries[i].Expansion)
+			dr.Frames = append(dr.Frames, frame)
+		}
+	}
+
+	if failed == len(responses) {
+		dr.Error = responses[0].Error
+		dr.ErrorSource = responses[0].ErrorSource
+		return dr
+	}
+
+	if len(notices) > 0 {
+		if len(dr.Frames) == 0 {
+			dr.Frames = append(dr.Frames, data.NewFrame(""))
+		}
+		dr.Frames[0].AppendNotices(notices...)
+	}
+	return dr
+}
+
+// doAllPages runs a single query and keeps requesting pages until no continuation token is returned.
+// When a limit, the time budget or a failed page stops it early, the token of the next page is kept
+// so the caller can continue from there.
+func (ds *TwinMakerDatasource) doAllPages(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse {
+	res := ds.doSingleQuery(ctx, query)
+	if res.Error != nil {
+		return res
+	}
+	meta := models.LoadMetaFromResponse(res)
+	pages := 1
+	nextToken := ""
+	for meta != nil && meta.NextToken != query.NextToken {
+		nextToken = meta.NextToken
+		if query.Reached(pages, frameRows(res.Frames)) {
+			if len(res.Frames) > 0 {
+				res.Frames[0].AppendNotices(data.Notice{
+					Severity: data.NoticeSeverityWarning,
+					Text:     "query limit reached, showing partial results",
+				})
+			}
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			res.Error = err
+			return res
+		}
+		if query.DeadlineExceeded() {
+			if len(res.Frames) > 0 {
+				res.Frames[0].AppendNotices(data.Notice{
+					Severity: data.NoticeSeverityWarning,
+					Text:     "query timeout exceeded, showing partial results",
+				})
+			}
+			break
+		}
+
+		query.NextToken = meta.NextToken
+		next := ds.doSingleQuery(ctx, query)
+		if next.Error != nil {
+			// keep the pages loaded so far
+			if len(res.Frames) > 0 {
+				res.Frames[0].AppendNotices(data.Notice{
+					Severity: data.NoticeSeverityWarning,
+					Text:     next.Error.Error() + ", showing partial results",
+				})
+			}
+			break
+		}
+		res.Frames = appendMatchingFrames(res.Frames, next.Frames)
+		pages++
+		// the merged frames keep the meta of the first page, so the token is read from the new page
+		meta = models.LoadMetaFromResponse(next)
+		nextToken = ""
+	}
+
+	// every merged frame carries the token to continue from, or none once all pages are loaded
+	for _, frame := range res.Frames {
+		if frame.Meta != nil {
+			frame.Meta.Custom = models.TwinMakerCustomMeta{NextToken: nextToken}
+		}
+	}
+	return res
+}
+
+// appendMatchingFrames appends rows to existing frames with the same structure, and adds the others
+func appendMatchingFrames(frames data.Frames, next data.Frames) data.Frames {
+	for _, frame := range next {
+		existing := findMatchingFrame(frames, frame)
+		if existing == nil {
+			frames = append(frames, frame)
+			continue
+		}
+		for i, field := range frame.Fields {
+			for row := 0; row < field.Len(); row++ {
+				existing.Fields[i].Append(field.At(row))
+			}
+		}
+		existing.AppendNotices(notices(frame)...)
+	}
+	return frames
+}
+
+func findMatchingFrame(frames data.Frames, frame *data.Frame) *data.Frame {
+	for _, f := range frames {
+		if f.Name != frame.Name || len(f.Fields) != len(frame.Fields) {
+			continue
+		}
+		match := true
+		for i, field := range f.Fields {
+			other := frame.Fields[i]
+			if field.Name != other.Name || field.Type() != other.Type() || !field.Labels.Equals(other.Labels) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return f
+		}
+	}
+	return nil
+}
+
+func frameRows(frames data.Frames) int {
+	rows := 0
+	for _, frame := range frames {
+		rows += frame.Rows()
+	}
+	return rows
+}
+
+func notices(frame *data.Frame) []data.Notice {
+	if frame.Meta == nil {
+		return nil
+	}
+	return frame.Meta.Notices
+}
+
+// setExpansionLabels adds the expanded values as labels to every value field in the frame
+func setExpansionLabels(frame *data.Frame, expansion map[string]string) {
+	for _, field := range frame.Fields {
+		if field.Type().Time() {
+			continue
+		}
+		if field.Labels == nil {
+			field.Labels = data.Labels{}
+		}
+		for k, v := range expansion {
+			if _, ok := field.Labels[k]; !ok {
+				field.Labels[k] = v
+			}
+		}
+	}
+}
+
+func expansionName(expansion map[string]string) string {
+	return data.Labels(expansion).String()
+}
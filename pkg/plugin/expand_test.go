@@ -0,0 +1,58 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/plugin/twinmaker"
+)
+
+// pagedHandler returns one row per page, and a token for the next page until the last
+type pagedHandler struct {
+	twinmaker.TwinMakerHandler
+	pages  int
+	tokens []string
+}
+
+func (h *pagedHandler) GetEntityHistory(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse {
+	h.tokens = append(h.tokens, query.NextToken)
+	page := len(h.tokens)
+	frame := data.NewFrame("", data.NewField("value", nil, []int64{int64(page)}))
+	meta := models.TwinMakerCustomMeta{}
+	if page < h.pages {
+		meta.NextToken = fmt.Sprintf("page-%d", page+1)
+	}
+	frame.SetMeta(&data.FrameMeta{Custom: meta})
+	return backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+func TestDoAllPages(t *testing.T) {
+	query := models.TwinMakerQuery{QueryType: models.QueryTypeEntityHistory}
+
+	t.Run("follows every page", func(t *testing.T) {
+		h := &pagedHandler{pages: 3}
+		ds := &TwinMakerDatasource{handler: h}
+		res := ds.doAllPages(context.Background(), query)
+		require.NoError(t, res.Error)
+		require.Equal(t, []string{"", "page-2", "page-3"}, h.tokens)
+		require.Equal(t, 3, res.Frames[0].Rows())
+		require.Nil(t, models.LoadMetaFromResponse(res))
+	})
+
+	t.Run("keeps the token when a limit stops it", func(t *testing.T) {
+		h := &pagedHandler{pages: 5}
+		ds := &TwinMakerDatasource{handler: h}
+		limited := query
+		limited.MaxPages = 2
+		res := ds.doAllPages(context.Background(), limited)
+		require.NoError(t, res.Error)
+		require.Equal(t, 2, res.Frames[0].Rows())
+		require.Equal(t, "page-3", models.LoadMetaFromResponse(res).NextToken)
+	})
+}
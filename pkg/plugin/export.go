@@ -0,0 +1,328 @@
+package plugin
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/plugin/twinmaker"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// exportRequest is a panel query along with the time range to export
+type exportRequest struct {
+	Query json.RawMessage `json:"query"`
+	From  time.Time       `json:"from"`
+	To    time.Time       `json:"to"`
+}
+
+// exportWriter streams frames in one of the export formats
+type exportWriter interface {
+	// WriteFrame writes every row of the frame
+	WriteFrame(frame *data.Frame) error
+	// WriteError reports a failure after rows were already sent
+	WriteError(err error) error
+	Flush() error
+	// Close ends the file, formats that need every frame first write it here
+	Close() error
+}
+
+// content types of the export formats
+var exportContentTypes = map[string]string{
+	"csv":     "text/csv",
+	"ndjson":  "application/x-ndjson",
+	"parquet": "application/vnd.apache.parquet",
+}
+
+// newExportWriter returns the writer for the format, along with the normalized format name
+func newExportWriter(w io.Writer, format string) (exportWriter, string, error) {
+	switch strings.ToLower(format) {
+	case "", "csv":
+		return &csvExportWriter{w: csv.NewWriter(w)}, "csv", nil
+	case "ndjson", "jsonl":
+		return &ndjsonExportWriter{enc: json.NewEncoder(w)}, "ndjson", nil
+	case "parquet":
+		return &parquetExportWriter{w: w}, "parquet", nil
+	}
+	return nil, "", backend.DownstreamErrorf("unsupported export format %q, use csv, ndjson or parquet", format)
+}
+
+// HandleExport runs a query without the panel limits, follows every page, and streams the rows as they are loaded.
+// The export as a whole stays within the datasource limits and timeout.
+func (ds *TwinMakerDatasource) HandleExport(w http.ResponseWriter, r *http.Request) {
+	req := exportRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWriteRequestBytes)).Decode(&req); err != nil {
+		log.DefaultLogger.Error("failed to decode request", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"message": "unable to parse request body"}`))
+		return
+	}
+	query, err := readExportQuery(req)
+	if err != nil {
+		writeJsonResponse(w, nil, err)
+		return
+	}
+	queries, err := ds.prepareQueries(ds.withQueryBounds(query))
+	if err != nil {
+		writeJsonResponse(w, nil, err)
+		return
+	}
+	out, format, err := newExportWriter(w, r.URL.Query().Get("format"))
+	if err != nil {
+		writeJsonResponse(w, nil, err)
+		return
+	}
+
+	started := false
+	flush := func() error {
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+	write := func(frames data.Frames) error {
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", exportContentTypes[format])
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "twinmaker-export."+format))
+			w.WriteHeader(http.StatusOK)
+		}
+		for _, frame := range frames {
+			if err := out.WriteFrame(frame); err != nil {
+				return err
+			}
+		}
+		// each page is sent as it arrives
+		return flush()
+	}
+
+	err = ds.exportQueries(r.Context(), queries, write)
+	switch {
+	case err == nil && !started:
+		// nothing matched, still send an empty file
+		_ = write(nil)
+	case err != nil && !started:
+		writeJsonResponse(w, nil, err)
+		return
+	case err != nil:
+		// the status was already sent, so the error is reported in the file
+		log.DefaultLogger.Error("export failed after streaming started", "error", err)
+		_ = out.WriteError(twinmaker.MapAWSError(err))
+	}
+	if err := out.Close(); err != nil {
+		log.DefaultLogger.Error("error ending export", "error", err)
+	}
+	_ = flush()
+}
+
+func readExportQuery(req exportRequest) (models.TwinMakerQuery, error) {
+	if len(req.Query) == 0 {
+		return models.TwinMakerQuery{}, models.MissingFieldError("query")
+	}
+	queryType := struct {
+		QueryType string `json:"queryType"`
+	}{}
+	if err := json.Unmarshal(req.Query, &queryType); err != nil {
+		return models.TwinMakerQuery{}, backend.DownstreamErrorf("could not read query: %w", err)
+	}
+	to := req.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	query, err := models.ReadQuery(backend.DataQuery{
+		JSON:      req.Query,
+		QueryType: queryType.QueryType,
+		TimeRange: backend.TimeRange{From: req.From, To: to},
+	})
+	if err != nil {
+		return query, backend.DownstreamError(err)
+	}
+	query.NextToken = ""
+	return query, nil
+}
+
+// exportQueries runs every expanded query page by page, handing each page to write before the next is requested.
+// The pages and rows of every query count towards the limits, and the export stops once one is reached.
+func (ds *TwinMakerDatasource) exportQueries(ctx context.Context, queries []models.TwinMakerQuery, write func(data.Frames) error) error {
+	pages, rows := 0, 0
+	for _, query := range queries {
+		for {
+			if query.DeadlineExceeded() {
+				return twinmaker.ErrQueryTimeout
+			}
+			if query.Reached(pages, rows) {
+				return fmt.Errorf("export limit reached after %d pages and %d rows, more results are available", pages, rows)
+			}
+			res := ds.doSingleQuery(ctx, query)
+			if res.Error != nil {
+				return res.Error
+			}
+			pages++
+			rows += frameRows(res.Frames)
+			if len(queries) > 1 {
+				for _, frame := range res.Frames {
+					setExpansionLabels(frame, query.Expansion)
+				}
+			}
+			if err := write(res.Frames); err != nil {
+				return err
+			}
+
+			meta := models.LoadMetaFromResponse(res)
+			if meta == nil || meta.NextToken == "" || meta.NextToken == query.NextToken {
+				break
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			query.NextToken = meta.NextToken
+		}
+	}
+	return nil
+}
+
+// exportFieldNames names the columns after the fields, with their labels when set
+func exportFieldNames(frame *data.Frame) []string {
+	names := make([]string, len(frame.Fields))
+	for i, field := range frame.Fields {
+		names[i] = field.Name
+		if len(field.Labels) > 0 {
+			names[i] += " {" + field.Labels.String() + "}"
+		}
+	}
+	return names
+}
+
+// exportValue returns the value of the field at the row, or nil when it is not set
+func exportValue(field *data.Field, row int) interface{} {
+	v, ok := field.ConcreteAt(row)
+	if !ok {
+		return nil
+	}
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return nil
+		}
+	}
+	return v
+}
+
+// csvExportWriter writes a header row for every frame structure, so frames with different fields
+// are separated by an empty line and a new header
+type csvExportWriter struct {
+	w      *csv.Writer
+	header []string
+}
+
+func (c *csvExportWriter) WriteFrame(frame *data.Frame) error {
+	if len(frame.Fields) == 0 {
+		return nil
+	}
+	names := exportFieldNames(frame)
+	if !slices.Equal(names, c.header) {
+		if c.header != nil {
+			if err := c.w.Write([]string{""}); err != nil {
+				return err
+			}
+		}
+		if err := c.w.Write(names); err != nil {
+			return err
+		}
+		c.header = names
+	}
+
+	record := make([]string, len(frame.Fields))
+	for row := 0; row < frame.Rows(); row++ {
+		for i, field := range frame.Fields {
+			record[i] = csvExportValue(exportValue(field, row))
+		}
+		if err := c.w.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func csvExportValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case json.RawMessage:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
+
+func (c *csvExportWriter) WriteError(err error) error {
+	return c.w.Write([]string{"error", err.Error()})
+}
+
+func (c *csvExportWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvExportWriter) Close() error {
+	return c.Flush()
+}
+
+// ndjsonExportLine is one row, the values are keyed by column name under their own key so
+// columns can have any name
+type ndjsonExportLine struct {
+	Frame string                 `json:"frame,omitempty"`
+	Row   map[string]interface{} `json:"row"`
+}
+
+// ndjsonExportWriter writes every row as a JSON object
+type ndjsonExportWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonExportWriter) WriteFrame(frame *data.Frame) error {
+	names := exportFieldNames(frame)
+	for row := 0; row < frame.Rows(); row++ {
+		line := ndjsonExportLine{
+			Frame: frame.Name,
+			Row:   make(map[string]interface{}, len(frame.Fields)),
+		}
+		for i, field := range frame.Fields {
+			line.Row[names[i]] = exportValue(field, row)
+		}
+		if err := n.enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *ndjsonExportWriter) WriteError(err error) error {
+	return n.enc.Encode(map[string]string{"error": err.Error()})
+}
+
+func (n *ndjsonExportWriter) Flush() error {
+	return nil
+}
+
+func (n *ndjsonExportWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,240 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// parquetExportWriter writes every frame into one parquet file, one row group per frame, so frames are
+// not kept once written.  Parquet needs the schema before the first row, so the columns are those of
+// the first frame, along with the frame name and an other column.  Fields of later frames that are not
+// in the schema, or hold a different type, are written to the other column as a JSON object.
+type parquetExportWriter struct {
+	w       io.Writer
+	fw      *pqarrow.FileWriter
+	schema  *arrow.Schema
+	columns map[string]int
+	frame   string
+	other   string
+}
+
+func (p *parquetExportWriter) WriteFrame(frame *data.Frame) error {
+	if len(frame.Fields) == 0 {
+		return nil
+	}
+	if p.fw == nil {
+		if err := p.open(frame); err != nil {
+			return err
+		}
+	}
+	return p.writeFrame(frame)
+}
+
+// WriteError writes the error to the file metadata under the "error" key
+func (p *parquetExportWriter) WriteError(err error) error {
+	if p.fw == nil {
+		if err := p.open(data.NewFrame("")); err != nil {
+			return err
+		}
+	}
+	return p.fw.AppendKeyValueMetadata("error", err.Error())
+}
+
+// Flush does nothing, each frame is written out as a row group when it is written
+func (p *parquetExportWriter) Flush() error {
+	return nil
+}
+
+func (p *parquetExportWriter) Close() error {
+	if p.fw == nil {
+		if err := p.open(data.NewFrame("")); err != nil {
+			return err
+		}
+	}
+	return p.fw.Close()
+}
+
+// open starts the file with the schema of the first frame
+func (p *parquetExportWriter) open(first *data.Frame) error {
+	p.schema, p.frame, p.other = parquetSchema(first)
+	p.columns = make(map[string]int, len(p.schema.Fields()))
+	for i, f := range p.schema.Fields() {
+		p.columns[f.Name] = i
+	}
+	props := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy))
+	fw, err := pqarrow.NewFileWriter(p.schema, p.w, props, pqarrow.DefaultWriterProps())
+	if err != nil {
+		return err
+	}
+	p.fw = fw
+	return nil
+}
+
+func (p *parquetExportWriter) writeFrame(frame *data.Frame) error {
+	b := array.NewRecordBuilder(memory.DefaultAllocator, p.schema)
+	defer b.Release()
+
+	rows := frame.Rows()
+	set := make([]bool, len(p.schema.Fields()))
+	others := make([]map[string]interface{}, rows)
+	for i, name := range exportFieldNames(frame) {
+		field := frame.Fields[i]
+		col, ok := p.columns[name]
+		if ok && !set[col] && name != p.frame && name != p.other && parquetColumnFits(p.schema.Field(col).Type, field.Type()) {
+			set[col] = true
+			for row := 0; row < rows; row++ {
+				appendParquetValue(b.Field(col), exportValue(field, row))
+			}
+			continue
+		}
+		for row := 0; row < rows; row++ {
+			if v := exportValue(field, row); v != nil {
+				if others[row] == nil {
+					others[row] = map[string]interface{}{}
+				}
+				others[row][name] = v
+			}
+		}
+	}
+
+	frameColumn := b.Field(p.columns[p.frame]).(*array.StringBuilder)
+	otherColumn := b.Field(p.columns[p.other]).(*array.StringBuilder)
+	set[p.columns[p.frame]], set[p.columns[p.other]] = true, true
+	for row := 0; row < rows; row++ {
+		frameColumn.Append(frame.Name)
+		if others[row] == nil {
+			otherColumn.AppendNull()
+			continue
+		}
+		bs, err := json.Marshal(others[row])
+		if err != nil {
+			return err
+		}
+		otherColumn.Append(string(bs))
+	}
+	// columns of other frames are empty
+	for col, ok := range set {
+		if !ok {
+			b.Field(col).AppendNulls(rows)
+		}
+	}
+
+	rec := b.NewRecordBatch()
+	defer rec.Release()
+	return p.fw.Write(rec)
+}
+
+// parquetSchema is the columns of the frame, after a column for the frame name and before the other
+// column.  Those two are named frame and other, or with as many leading underscores as it takes to
+// not clash with a field.
+func parquetSchema(frame *data.Frame) (*arrow.Schema, string, string) {
+	fields := []arrow.Field{}
+	index := map[string]bool{}
+	for i, name := range exportFieldNames(frame) {
+		if index[name] {
+			continue
+		}
+		index[name] = true
+		fields = append(fields, arrow.Field{Name: name, Type: parquetColumnType(frame.Fields[i].Type()), Nullable: true})
+	}
+
+	unique := func(name string) string {
+		for index[name] {
+			name = "_" + name
+		}
+		index[name] = true
+		return name
+	}
+	frameColumn, otherColumn := unique("frame"), unique("other")
+	fields = append([]arrow.Field{{Name: frameColumn, Type: arrow.BinaryTypes.String, Nullable: true}}, fields...)
+	fields = append(fields, arrow.Field{Name: otherColumn, Type: arrow.BinaryTypes.String, Nullable: true})
+	return arrow.NewSchema(fields, nil), frameColumn, otherColumn
+}
+
+// parquetColumnFits is true when the values of the field can be written to a column of the type,
+// anything fits in a string column
+func parquetColumnFits(column arrow.DataType, t data.FieldType) bool {
+	return arrow.TypeEqual(column, arrow.BinaryTypes.String) || arrow.TypeEqual(column, parquetColumnType(t))
+}
+
+func parquetColumnType(t data.FieldType) arrow.DataType {
+	switch t.NonNullableType() {
+	case data.FieldTypeTime:
+		return arrow.FixedWidthTypes.Timestamp_us
+	case data.FieldTypeFloat64, data.FieldTypeFloat32:
+		return arrow.PrimitiveTypes.Float64
+	case data.FieldTypeInt8, data.FieldTypeInt16, data.FieldTypeInt32, data.FieldTypeInt64,
+		data.FieldTypeUint8, data.FieldTypeUint16, data.FieldTypeUint32:
+		return arrow.PrimitiveTypes.Int64
+	case data.FieldTypeBool:
+		return arrow.FixedWidthTypes.Boolean
+	}
+	return arrow.BinaryTypes.String
+}
+
+// appendParquetValue appends a value returned by exportValue to the column builder
+func appendParquetValue(b array.Builder, v interface{}) {
+	if v == nil {
+		b.AppendNull()
+		return
+	}
+	switch b := b.(type) {
+	case *array.TimestampBuilder:
+		if t, ok := v.(time.Time); ok {
+			b.Append(arrow.Timestamp(t.UnixMicro()))
+			return
+		}
+	case *array.Float64Builder:
+		switch v := v.(type) {
+		case float64:
+			b.Append(v)
+			return
+		case float32:
+			b.Append(float64(v))
+			return
+		}
+	case *array.Int64Builder:
+		if n, ok := exportInt(v); ok {
+			b.Append(n)
+			return
+		}
+	case *array.BooleanBuilder:
+		if v, ok := v.(bool); ok {
+			b.Append(v)
+			return
+		}
+	case *array.StringBuilder:
+		b.Append(csvExportValue(v))
+		return
+	}
+	b.AppendNull()
+}
+
+func exportInt(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	}
+	return 0, false
+}
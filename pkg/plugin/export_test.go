@@ -0,0 +1,157 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/plugin/twinmaker"
+)
+
+func TestExportWriters(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	value := 1.5
+	history := data.NewFrame("flow",
+		data.NewField("time", nil, []time.Time{ts, ts.Add(time.Minute)}),
+		data.NewField("flow", data.Labels{"entity": "pump-1"}, []*float64{&value, nil}),
+	)
+	entities := data.NewFrame("",
+		data.NewField("name", nil, []string{"pump, main"}),
+	)
+
+	t.Run("csv", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, format, err := newExportWriter(buf, "")
+		require.NoError(t, err)
+		require.Equal(t, "csv", format)
+		require.NoError(t, w.WriteFrame(history))
+		require.NoError(t, w.WriteFrame(history))
+		require.NoError(t, w.WriteFrame(entities))
+		require.NoError(t, w.WriteError(fmt.Errorf("boom")))
+		require.NoError(t, w.Flush())
+		require.Equal(t, "time,flow {entity=pump-1}\n"+
+			"2024-01-01T00:00:00Z,1.5\n"+
+			"2024-01-01T00:01:00Z,\n"+
+			"2024-01-01T00:00:00Z,1.5\n"+
+			"2024-01-01T00:01:00Z,\n"+
+			"\n"+
+			"name\n"+
+			"\"pump, main\"\n"+
+			"error,boom\n", buf.String())
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, format, err := newExportWriter(buf, "ndjson")
+		require.NoError(t, err)
+		require.Equal(t, "ndjson", format)
+		require.NoError(t, w.WriteFrame(history))
+		require.NoError(t, w.Flush())
+		require.Equal(t, `{"frame":"flow","row":{"flow {entity=pump-1}":1.5,"time":"2024-01-01T00:00:00Z"}}`+"\n"+
+			`{"frame":"flow","row":{"flow {entity=pump-1}":null,"time":"2024-01-01T00:01:00Z"}}`+"\n", buf.String())
+	})
+
+	t.Run("ndjson keeps fields named frame", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, _, err := newExportWriter(buf, "ndjson")
+		require.NoError(t, err)
+		require.NoError(t, w.WriteFrame(data.NewFrame("alarms", data.NewField("frame", nil, []string{"f-1"}))))
+		require.Equal(t, `{"frame":"alarms","row":{"frame":"f-1"}}`+"\n", buf.String())
+	})
+
+	t.Run("parquet", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, format, err := newExportWriter(buf, "parquet")
+		require.NoError(t, err)
+		require.Equal(t, "parquet", format)
+		require.NoError(t, w.WriteFrame(history))
+		require.NoError(t, w.WriteFrame(entities))
+		// the first frame is written out before the file ends
+		require.NotEmpty(t, buf.Bytes())
+		require.NoError(t, w.WriteError(fmt.Errorf("boom")))
+		require.NoError(t, w.Close())
+
+		r, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		require.Equal(t, "boom", *r.MetaData().KeyValueMetadata().FindValue("error"))
+		require.Equal(t, 2, r.NumRowGroups())
+		require.NoError(t, r.Close())
+
+		table, err := pqarrow.ReadTable(context.Background(), bytes.NewReader(buf.Bytes()), nil, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+		require.NoError(t, err)
+		defer table.Release()
+		names := []string{}
+		for _, f := range table.Schema().Fields() {
+			names = append(names, f.Name)
+		}
+		require.Equal(t, []string{"frame", "time", "flow {entity=pump-1}", "other"}, names)
+		require.Equal(t, arrow.FLOAT64, table.Schema().Field(2).Type.ID())
+		require.Equal(t, int64(3), table.NumRows())
+
+		// fields that are not in the schema of the first frame are kept as JSON
+		other := table.Column(3).Data().Chunk(0).(*array.String)
+		require.True(t, other.IsNull(0))
+		require.Equal(t, `{"name":"pump, main"}`, other.Value(2))
+	})
+
+	t.Run("parquet without rows", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, _, err := newExportWriter(buf, "parquet")
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		require.NotEmpty(t, buf.Bytes())
+	})
+
+	t.Run("unsupported formats", func(t *testing.T) {
+		_, _, err := newExportWriter(&bytes.Buffer{}, "xlsx")
+		require.Error(t, err)
+	})
+}
+
+func TestExportQueries(t *testing.T) {
+	query := models.TwinMakerQuery{QueryType: models.QueryTypeEntityHistory}
+	rows := func(frames *[]*data.Frame) func(data.Frames) error {
+		return func(f data.Frames) error {
+			*frames = append(*frames, f...)
+			return nil
+		}
+	}
+
+	t.Run("follows every page", func(t *testing.T) {
+		h := &pagedHandler{pages: 3}
+		ds := &TwinMakerDatasource{handler: h}
+		written := []*data.Frame{}
+		require.NoError(t, ds.exportQueries(context.Background(), []models.TwinMakerQuery{ds.withQueryBounds(query)}, rows(&written)))
+		require.Len(t, written, 3)
+	})
+
+	t.Run("stops at the datasource limits", func(t *testing.T) {
+		h := &pagedHandler{pages: 5}
+		ds := &TwinMakerDatasource{handler: h, settings: models.TwinMakerDataSourceSetting{QueryLimits: models.QueryLimits{MaxRows: 2}}}
+		written := []*data.Frame{}
+		err := ds.exportQueries(context.Background(), []models.TwinMakerQuery{ds.withQueryBounds(query)}, rows(&written))
+		require.EqualError(t, err, "export limit reached after 2 pages and 2 rows, more results are available")
+		require.Len(t, written, 2)
+	})
+
+	t.Run("stops at the deadline", func(t *testing.T) {
+		h := &pagedHandler{pages: 5}
+		ds := &TwinMakerDatasource{handler: h}
+		expired := query
+		expired.Deadline = time.Now().Add(-time.Second)
+		err := ds.exportQueries(context.Background(), []models.TwinMakerQuery{expired}, rows(&[]*data.Frame{}))
+		require.ErrorIs(t, err, twinmaker.ErrQueryTimeout)
+		require.Empty(t, h.tokens)
+	})
+}
@@ -2,33 +2,121 @@ package plugin
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
 
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/plugin/twinmaker"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 )
 
+// maximum size of a write request body
+const maxWriteRequestBytes = 1 << 20
+
+// maximum size of an uploaded import file
+const maxImportRequestBytes = 32 << 20
+
+// maximum size of a scene request, large enough for the biggest document that is loaded back
+const maxSceneRequestBytes = 17 << 20
+
 func writeJsonResponse(w http.ResponseWriter, rsp interface{}, err error) {
 	w.Header().Add("Content-Type", "application/json")
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		_, _ = fmt.Fprintf(w, `{"message": "%s"}`, err.Error())
+		writeJsonError(w, err)
 	} else {
 		_ = json.NewEncoder(w).Encode(rsp)
 	}
 }
 
+// writeJsonError writes the error message, along with the invalid fields for validation errors
+func writeJsonError(w http.ResponseWriter, err error) {
+	body := struct {
+		Message string              `json:"message"`
+		Errors  []models.FieldError `json:"errors,omitempty"`
+		// what was written before a write failed
+		Written      *int                                           `json:"written,omitempty"`
+		ErrorEntries []iottwinmakertypes.BatchPutPropertyErrorEntry `json:"errorEntries,omitempty"`
+	}{}
+
+	err = twinmaker.MapAWSError(err)
+	body.Message = err.Error()
+
+	var partialErr *twinmaker.PartialWriteError
+	if errors.As(err, &partialErr) {
+		body.Message = partialErr.Error()
+		body.Written = &partialErr.Written
+		if partialErr.Output != nil {
+			body.ErrorEntries = partialErr.Output.ErrorEntries
+		}
+	}
+
+	var validationErr *models.ValidationError
+	var workspaceErr *models.WorkspaceNotAllowedError
+	var conflictErr *models.EntityConflictError
+	var awsErr *twinmaker.AWSError
+	var s3Err *twinmaker.S3Error
+	switch {
+	case errors.As(err, &validationErr):
+		body.Errors = validationErr.Errors
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.As(err, &workspaceErr):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.As(err, &conflictErr):
+		w.WriteHeader(http.StatusConflict)
+	case errors.As(err, &awsErr), errors.As(err, &s3Err):
+		w.WriteHeader(http.StatusBadGateway)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// workspace resolves the workspaceId request parameter, and writes an error response when it is not allowed
+func (ds *TwinMakerDatasource) workspace(w http.ResponseWriter, r *http.Request) (string, bool) {
+	workspaceId, err := ds.settings.ResolveWorkspace(r.URL.Query().Get("workspaceId"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeJsonError(w, err)
+		return "", false
+	}
+	return workspaceId, true
+}
+
+// writer returns the requesting user, and writes an error response when they may not write to TwinMaker
+func (ds *TwinMakerDatasource) writer(w http.ResponseWriter, r *http.Request, action string) (models.TokenIdentity, bool) {
+	identity := models.IdentityFromUser(backend.PluginConfigFromContext(r.Context()).User)
+	if !ds.settings.CanWrite(identity) {
+		log.DefaultLogger.Warn("audit: "+action+" denied", "user", identity.Login, "role", identity.Role)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message": "writing to TwinMaker is not allowed for this user"}`))
+		return identity, false
+	}
+	return identity, true
+}
+
 func (ds *TwinMakerDatasource) HandleGetToken(w http.ResponseWriter, r *http.Request) {
 	if ds.settings.AssumeRoleARN == "" {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte(`{"message": "Assume Role ARN is missing in datasource configuration"}`))
 		return
 	}
-	token, err := ds.handler.GetSessionToken(r.Context(), time.Second*3600, ds.settings.WorkspaceID)
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+	// the session policy is scoped to the requested workspace, and the session is named after the user
+	identity := models.IdentityFromUser(backend.PluginConfigFromContext(r.Context()).User)
+	token, err := ds.handler.GetSessionToken(r.Context(), ds.settings.TokenDuration(), workspaceId, identity)
 	writeJsonResponse(w, token, err)
 }
 
@@ -42,22 +130,59 @@ func (ds *TwinMakerDatasource) HandleGetEntity(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	rsp, err := ds.res.GetEntity(r.Context(), entityId)
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+
+	rsp, err := ds.res.GetEntity(r.Context(), workspaceId, entityId)
+	writeJsonResponse(w, rsp, err)
+}
+
+func (ds *TwinMakerDatasource) HandleGetSceneDocument(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	sceneId := r.URL.Query().Get("id")
+	if sceneId == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"message": "missing id (scene)"}`))
+		return
+	}
+
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+
+	rsp, err := ds.res.GetSceneDocument(r.Context(), workspaceId, sceneId)
 	writeJsonResponse(w, rsp, err)
 }
 
 func (ds *TwinMakerDatasource) HandleListWorkspaces(w http.ResponseWriter, r *http.Request) {
 	rsp, err := ds.res.ListWorkspaces(r.Context())
+	if err == nil && len(ds.settings.AllowedWorkspaces) > 0 {
+		allowed := ds.settings.Workspaces()
+		rsp = slices.DeleteFunc(slices.Clone(rsp), func(w models.SelectableString) bool {
+			return !slices.Contains(allowed, w.Value)
+		})
+	}
 	writeJsonResponse(w, rsp, err)
 }
 
 func (ds *TwinMakerDatasource) HandleListScenes(w http.ResponseWriter, r *http.Request) {
-	rsp, err := ds.res.ListScenes(r.Context())
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+	rsp, err := ds.res.ListScenes(r.Context(), workspaceId)
 	writeJsonResponse(w, rsp, err)
 }
 
 func (ds *TwinMakerDatasource) HandleListOptions(w http.ResponseWriter, r *http.Request) {
-	rsp, err := ds.res.ListOptions(r.Context())
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+	rsp, err := ds.res.ListOptions(r.Context(), workspaceId)
 	writeJsonResponse(w, rsp, err)
 }
 
@@ -70,25 +195,256 @@ func (ds *TwinMakerDatasource) HandleListEntityOptions(w http.ResponseWriter, r
 		return
 	}
 
-	rsp, err := ds.res.ListEntity(r.Context(), entityId)
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+
+	rsp, err := ds.res.ListEntity(r.Context(), workspaceId, entityId)
 	writeJsonResponse(w, rsp, err)
 }
 
 func (ds *TwinMakerDatasource) HandleBatchPutPropertyValues(w http.ResponseWriter, r *http.Request) {
+	identity, ok := ds.writer(w, r, "BatchPutPropertyValues")
+	if !ok {
+		return
+	}
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
 	req := struct {
 		Entries []*iottwinmakertypes.PropertyValueEntry `json:"entries"`
 	}{}
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWriteRequestBytes)).Decode(&req)
 	if err != nil {
 		log.DefaultLogger.Error("failed to decode request", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		_, _ = w.Write([]byte(`{"message": "unable to parse request body"}`))
 		return
 	}
-	entries := make([]iottwinmakertypes.PropertyValueEntry, len(req.Entries))
-	for i, entry := range req.Entries {
-		entries[i] = *entry
+	entries := make([]iottwinmakertypes.PropertyValueEntry, 0, len(req.Entries))
+	for _, entry := range req.Entries {
+		if entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+	rsp, err := ds.res.BatchPutPropertyValues(r.Context(), workspaceId, identity, entries)
+	writeJsonResponse(w, rsp, err)
+}
+
+func (ds *TwinMakerDatasource) HandleUpdateEntity(w http.ResponseWriter, r *http.Request) {
+	identity, ok := ds.writer(w, r, "UpdateEntity")
+	if !ok {
+		return
+	}
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+	update := models.EntityUpdate{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWriteRequestBytes)).Decode(&update)
+	if err != nil {
+		writeJsonResponse(w, nil, fmt.Errorf("unable to parse request body: %w", err))
+		return
+	}
+	rsp, err := ds.res.UpdateEntity(r.Context(), workspaceId, identity, update)
+	writeJsonResponse(w, rsp, err)
+}
+
+func (ds *TwinMakerDatasource) HandleGetScene(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	sceneId := r.URL.Query().Get("id")
+	if sceneId == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"message": "missing id (scene)"}`))
+		return
+	}
+
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+
+	rsp, err := ds.res.GetScene(r.Context(), workspaceId, sceneId)
+	writeJsonResponse(w, rsp, err)
+}
+
+func (ds *TwinMakerDatasource) HandleListSceneVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	sceneId := r.URL.Query().Get("id")
+	if sceneId == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"message": "missing id (scene)"}`))
+		return
+	}
+
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+
+	rsp, err := ds.res.ListSceneVersions(r.Context(), workspaceId, sceneId)
+	writeJsonResponse(w, rsp, err)
+}
+
+func (ds *TwinMakerDatasource) HandleCreateScene(w http.ResponseWriter, r *http.Request) {
+	identity, ok := ds.writer(w, r, "CreateScene")
+	if !ok {
+		return
+	}
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+	req := models.SceneRequest{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSceneRequestBytes)).Decode(&req)
+	if err != nil {
+		writeJsonResponse(w, nil, fmt.Errorf("unable to parse request body: %w", err))
+		return
+	}
+	rsp, err := ds.res.CreateScene(r.Context(), workspaceId, identity, req)
+	writeJsonResponse(w, rsp, err)
+}
+
+func (ds *TwinMakerDatasource) HandleUpdateScene(w http.ResponseWriter, r *http.Request) {
+	identity, ok := ds.writer(w, r, "UpdateScene")
+	if !ok {
+		return
+	}
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+	req := models.SceneRequest{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSceneRequestBytes)).Decode(&req)
+	if err != nil {
+		writeJsonResponse(w, nil, fmt.Errorf("unable to parse request body: %w", err))
+		return
+	}
+	rsp, err := ds.res.UpdateScene(r.Context(), workspaceId, identity, req)
+	writeJsonResponse(w, rsp, err)
+}
+
+func (ds *TwinMakerDatasource) HandleRollbackScene(w http.ResponseWriter, r *http.Request) {
+	identity, ok := ds.writer(w, r, "RollbackScene")
+	if !ok {
+		return
+	}
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+	req := models.SceneRollback{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWriteRequestBytes)).Decode(&req)
+	if err != nil {
+		writeJsonResponse(w, nil, fmt.Errorf("unable to parse request body: %w", err))
+		return
+	}
+	rsp, err := ds.res.RollbackScene(r.Context(), workspaceId, identity, req)
+	writeJsonResponse(w, rsp, err)
+}
+
+// HandleGetVideoStreamURL returns a playback URL for the video component of an entity.  from and to
+// are epoch milliseconds or RFC 3339 times, and select the window to play instead of the live stream.
+func (ds *TwinMakerDatasource) HandleGetVideoStreamURL(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	params := r.URL.Query()
+	req := models.VideoStreamRequest{
+		EntityId:      params.Get("entityId"),
+		ComponentName: params.Get("componentName"),
+		Protocol:      models.VideoProtocol(strings.ToUpper(params.Get("protocol"))),
+	}
+	var err error
+	if req.Start, err = videoTimeParam(params.Get("from")); err == nil {
+		req.End, err = videoTimeParam(params.Get("to"))
+	}
+	if err == nil && params.Get("expires") != "" {
+		req.ExpiresSeconds, err = strconv.Atoi(params.Get("expires"))
+	}
+	if err != nil {
+		writeJsonResponse(w, nil, &models.ValidationError{Errors: []models.FieldError{{Message: err.Error()}}})
+		return
+	}
+
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+	rsp, err := ds.res.GetVideoStreamURL(r.Context(), workspaceId, req)
+	writeJsonResponse(w, rsp, err)
+}
+
+// HandleRequestVideoUpload asks the edge connector of an entity video component to upload a recorded window
+func (ds *TwinMakerDatasource) HandleRequestVideoUpload(w http.ResponseWriter, r *http.Request) {
+	identity, ok := ds.writer(w, r, "RequestVideoUpload")
+	if !ok {
+		return
+	}
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+	req := models.VideoUploadRequest{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWriteRequestBytes)).Decode(&req)
+	if err != nil {
+		writeJsonResponse(w, nil, fmt.Errorf("unable to parse request body: %w", err))
+		return
+	}
+	rsp, err := ds.res.RequestVideoUpload(r.Context(), workspaceId, identity, req)
+	writeJsonResponse(w, rsp, err)
+}
+
+func (ds *TwinMakerDatasource) HandleGetVideoUploadStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	params := r.URL.Query()
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+	rsp, err := ds.res.GetVideoUploadStatus(r.Context(), workspaceId, params.Get("entityId"), params.Get("componentName"))
+	writeJsonResponse(w, rsp, err)
+}
+
+func videoTimeParam(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		t := time.UnixMilli(ms).UTC()
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q, use epoch milliseconds or RFC 3339", v)
+	}
+	return &t, nil
+}
+
+// HandleImportPropertyValues writes historical values from a CSV or NDJSON upload, and reports the rows that failed
+func (ds *TwinMakerDatasource) HandleImportPropertyValues(w http.ResponseWriter, r *http.Request) {
+	identity, ok := ds.writer(w, r, "ImportPropertyValues")
+	if !ok {
+		return
+	}
+	workspaceId, ok := ds.workspace(w, r)
+	if !ok {
+		return
+	}
+	format, err := models.ImportFormatFor(r.URL.Query().Get("format"), r.Header.Get("Content-Type"))
+	if err != nil {
+		writeJsonResponse(w, nil, err)
+		return
+	}
+	rows, rowErrors, err := models.ParseImportRows(http.MaxBytesReader(w, r.Body, maxImportRequestBytes), format)
+	if err != nil {
+		writeJsonResponse(w, nil, fmt.Errorf("unable to read import file: %w", err))
+		return
+	}
+	rsp, err := ds.res.ImportPropertyValues(r.Context(), workspaceId, identity, rows)
+	if rsp != nil {
+		rsp.Rows += len(rowErrors)
+		rsp.AddErrors(rowErrors...)
 	}
-	rsp, err := ds.res.BatchPutPropertyValues(r.Context(), entries)
 	writeJsonResponse(w, rsp, err)
 }
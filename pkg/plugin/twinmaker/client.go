@@ -15,12 +15,16 @@ import (
 	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
 	httplogger "github.com/grafana/grafana-plugin-sdk-go/experimental/http_logger"
+	"github.com/patrickmn/go-cache"
 )
 
+// how long a workspace is reused for session policies
+const workspaceCacheTTL = 30 * time.Minute
+
 // TwinMakerClient calls AWS services and returns the raw results
 type TwinMakerClient interface {
-	GetSessionToken(ctx context.Context, duration time.Duration, workspaceId string) (*ststypes.Credentials, error)
-	GetWriteSessionToken(ctx context.Context, duration time.Duration, workspaceId string) (*ststypes.Credentials, error)
+	GetSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (*ststypes.Credentials, error)
+	GetWriteSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (*ststypes.Credentials, error)
 	ListWorkspaces(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListWorkspacesOutput, error)
 	GetWorkspace(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetWorkspaceOutput, error)
 	ListScenes(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListScenesOutput, error)
@@ -28,8 +32,35 @@ type TwinMakerClient interface {
 	ListComponentTypes(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListComponentTypesOutput, error)
 	GetComponentType(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetComponentTypeOutput, error)
 	GetEntity(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetEntityOutput, error)
+	GetScene(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetSceneOutput, error)
+
+	// Reads the scene JSON from the content location of the scene
+	GetSceneDocument(ctx context.Context, query models.TwinMakerQuery) ([]byte, error)
 
 	BatchPutPropertyValues(ctx context.Context, req *iottwinmaker.BatchPutPropertyValuesInput) (*iottwinmaker.BatchPutPropertyValuesOutput, error)
+	UpdateEntity(ctx context.Context, req *iottwinmaker.UpdateEntityInput) (*iottwinmaker.UpdateEntityOutput, error)
+	CreateScene(ctx context.Context, req *iottwinmaker.CreateSceneInput) (*iottwinmaker.CreateSceneOutput, error)
+	UpdateScene(ctx context.Context, req *iottwinmaker.UpdateSceneInput) (*iottwinmaker.UpdateSceneOutput, error)
+
+	// Objects in the workspace bucket.  The workspace only picks the account and region to call,
+	// reads use the datasource role and writes use the writer role.
+	GetS3Object(ctx context.Context, workspaceId string, uri string) ([]byte, error)
+	ListS3Objects(ctx context.Context, workspaceId string, prefix string) ([]models.S3Object, error)
+	PutS3Object(ctx context.Context, workspaceId string, uri string, body []byte) error
+
+	// Playback URL for a Kinesis video stream, the workspace picks the account and region to call
+	GetVideoStreamURL(ctx context.Context, workspaceId string, req models.VideoStreamRequest) (*models.VideoStreamURL, error)
+
+	// Spans of the video stored for the stream in the query time range
+	ListVideoFragments(ctx context.Context, query models.TwinMakerQuery, streamName string) ([]models.VideoRange, error)
+
+	// Upload requests to edge video connectors, written with the writer role, and their status read
+	// with the datasource role
+	RequestVideoUpload(ctx context.Context, workspaceId string, assetId string, req models.VideoUploadRequest) error
+	GetVideoUploadStatus(ctx context.Context, workspaceId string, assetId string) (*models.VideoUploadStatus, error)
+
+	// History of a SiteWise-connected property read directly from IoT SiteWise, as set in query.SiteWise
+	GetSiteWiseHistory(ctx context.Context, query models.TwinMakerQuery, ref models.SiteWiseReference) ([]iottwinmakertypes.PropertyValue, error)
 
 	// NOTE: only works with non-timeseries data
 	GetPropertyValue(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetPropertyValueOutput, error)
@@ -41,10 +72,22 @@ type TwinMakerClient interface {
 type twinMakerClient struct {
 	tokenRole       string
 	tokenRoleWriter string
-
-	twinMakerService func() (*iottwinmaker.Client, error)
-	writerService    func() (*iottwinmaker.Client, error)
-	tokenService     func() (*sts.Client, error)
+	limits          models.QueryLimits
+
+	policyFor         func(models.TokenIdentity) models.PolicyTemplate
+	setSourceIdentity bool
+	sessionTags       bool
+	tokens            *tokenCache
+	workspaces        *cache.Cache
+
+	twinMakerService      func() (*iottwinmaker.Client, error)
+	writerService         func() (*iottwinmaker.Client, error)
+	tokenService          func() (*sts.Client, error)
+	s3Service             func() (*s3ObjectClient, error)
+	s3WriterService       func() (*s3ObjectClient, error)
+	kvsService            func() (*kvsClient, error)
+	siteWiseService       func() (*siteWiseClient, error)
+	siteWiseWriterService func() (*siteWiseClient, error)
 }
 
 // NewTwinMakerClient provides a twinMakerClient for the session and associated calls
@@ -61,8 +104,14 @@ func NewTwinMakerClient(ctx context.Context, settings models.TwinMakerDataSource
 	agent := "grafana-iot-twinmaker-app"
 
 	client := &twinMakerClient{
-		tokenRole:       settings.AssumeRoleARN,
-		tokenRoleWriter: settings.AssumeRoleARNWriter,
+		tokenRole:         settings.AssumeRoleARN,
+		tokenRoleWriter:   settings.AssumeRoleARNWriter,
+		limits:            settings.QueryLimits,
+		policyFor:         settings.SessionPolicyFor,
+		setSourceIdentity: settings.SetSourceIdentity,
+		sessionTags:       settings.SessionTags,
+		tokens:            newTokenCache(),
+		workspaces:        cache.New(workspaceCacheTTL, workspaceCacheTTL*2),
 	}
 
 	region := settings.Region
@@ -89,15 +138,26 @@ func NewTwinMakerClient(ctx context.Context, settings models.TwinMakerDataSource
 	}
 
 	client.twinMakerService = getClientService(ctx, noEndpointSettings, setEndpoint)
+	client.s3Service = getS3Service(ctx, noEndpointSettings)
+	client.kvsService = getKVSService(ctx, noEndpointSettings)
+	client.siteWiseService = getSiteWiseService(ctx, noEndpointSettings)
 
 	if settings.AssumeRoleARNWriter != "" {
 		writerSettings := noEndpointSettings
 		writerSettings.AssumeRoleARN = settings.AssumeRoleARNWriter
 		client.writerService = getClientService(ctx, writerSettings, setEndpoint)
+		client.s3WriterService = getS3Service(ctx, writerSettings)
+		client.siteWiseWriterService = getSiteWiseService(ctx, writerSettings)
 	} else {
 		client.writerService = func() (*iottwinmaker.Client, error) {
 			return nil, fmt.Errorf("writer role not configured")
 		}
+		client.s3WriterService = func() (*s3ObjectClient, error) {
+			return nil, fmt.Errorf("writer role not configured")
+		}
+		client.siteWiseWriterService = func() (*siteWiseClient, error) {
+			return nil, fmt.Errorf("writer role not configured")
+		}
 	}
 
 	// STS client can not use scoped down role to generate tokens
@@ -121,6 +181,50 @@ func getClientService(ctx context.Context, awsSettings awsauth.Settings, optFns
 	}
 }
 
+func getS3Service(ctx context.Context, awsSettings awsauth.Settings) func() (*s3ObjectClient, error) {
+	cfg, err := awsauth.NewConfigProvider().GetConfig(ctx, awsSettings)
+	if err != nil {
+		return func() (*s3ObjectClient, error) {
+			return nil, err
+		}
+	}
+	service := newS3ObjectClient(cfg)
+	return func() (*s3ObjectClient, error) {
+		return service, nil
+	}
+}
+
+func getKVSService(ctx context.Context, awsSettings awsauth.Settings) func() (*kvsClient, error) {
+	cfg, err := awsauth.NewConfigProvider().GetConfig(ctx, awsSettings)
+	if err != nil {
+		return func() (*kvsClient, error) {
+			return nil, err
+		}
+	}
+	service := newKVSClient(cfg)
+	return func() (*kvsClient, error) {
+		return service, nil
+	}
+}
+
+func getSiteWiseService(ctx context.Context, awsSettings awsauth.Settings) func() (*siteWiseClient, error) {
+	cfg, err := awsauth.NewConfigProvider().GetConfig(ctx, awsSettings)
+	if err != nil {
+		return func() (*siteWiseClient, error) {
+			return nil, err
+		}
+	}
+	service, err := newSiteWiseClient(ctx, cfg)
+	if err != nil {
+		return func() (*siteWiseClient, error) {
+			return nil, err
+		}
+	}
+	return func() (*siteWiseClient, error) {
+		return service, nil
+	}
+}
+
 func getTokenService(ctx context.Context, awsSettings awsauth.Settings, optFns ...func(*sts.Options)) func() (*sts.Client, error) {
 	tokenCfg, err := awsauth.NewConfigProvider().GetConfig(ctx, awsSettings)
 	if err != nil {
@@ -135,6 +239,19 @@ func getTokenService(ctx context.Context, awsSettings awsauth.Settings, optFns .
 	}
 }
 
+// newResultLimiter applies the query limits, lowered to the datasource limits
+func (c *twinMakerClient) newResultLimiter(query models.TwinMakerQuery) *resultLimiter {
+	return newResultLimiter(c.limits.Min(query.QueryLimits))
+}
+
+func countTabularRows(tables [][]map[string]iottwinmakertypes.DataValue) int {
+	rows := 0
+	for _, t := range tables {
+		rows += len(t)
+	}
+	return rows
+}
+
 func (c *twinMakerClient) ListWorkspaces(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListWorkspacesOutput, error) {
 	client, err := c.twinMakerService()
 	if err != nil {
@@ -146,22 +263,29 @@ func (c *twinMakerClient) ListWorkspaces(ctx context.Context, query models.TwinM
 		NextToken:  aws.String(query.NextToken),
 	}
 
+	limiter := c.newResultLimiter(query)
 	workspaces, err := client.ListWorkspaces(ctx, params)
 	if err != nil {
 		return nil, err
 	}
+	if err := limiter.add(len(workspaces.WorkspaceSummaries), workspaces.WorkspaceSummaries, workspaces.NextToken); err != nil {
+		return workspaces, err
+	}
 
 	cWorkspaces := workspaces
 	for cWorkspaces.NextToken != nil {
 		params.NextToken = cWorkspaces.NextToken
 
-		cWorkspaces, err := client.ListWorkspaces(ctx, params)
+		cWorkspaces, err = client.ListWorkspaces(ctx, params)
 		if err != nil {
 			return nil, err
 		}
 
 		workspaces.WorkspaceSummaries = append(workspaces.WorkspaceSummaries, cWorkspaces.WorkspaceSummaries...)
 		workspaces.NextToken = cWorkspaces.NextToken
+		if err := limiter.add(len(cWorkspaces.WorkspaceSummaries), cWorkspaces.WorkspaceSummaries, cWorkspaces.NextToken); err != nil {
+			return workspaces, err
+		}
 	}
 
 	return workspaces, nil
@@ -180,22 +304,29 @@ func (c *twinMakerClient) ListScenes(ctx context.Context, query models.TwinMaker
 		WorkspaceId: &query.WorkspaceId,
 	}
 
+	limiter := c.newResultLimiter(query)
 	scenes, err := client.ListScenes(ctx, params)
 	if err != nil {
 		return nil, err
 	}
+	if err := limiter.add(len(scenes.SceneSummaries), scenes.SceneSummaries, scenes.NextToken); err != nil {
+		return scenes, err
+	}
 
 	cScenes := scenes
 	for cScenes.NextToken != nil {
 		params.NextToken = cScenes.NextToken
 
-		cScenes, err := client.ListScenes(ctx, params)
+		cScenes, err = client.ListScenes(ctx, params)
 		if err != nil {
 			return nil, err
 		}
 
 		scenes.SceneSummaries = append(scenes.SceneSummaries, cScenes.SceneSummaries...)
 		scenes.NextToken = cScenes.NextToken
+		if err := limiter.add(len(cScenes.SceneSummaries), cScenes.SceneSummaries, cScenes.NextToken); err != nil {
+			return scenes, err
+		}
 	}
 
 	return scenes, nil
@@ -248,22 +379,29 @@ func (c *twinMakerClient) ListEntities(ctx context.Context, query models.TwinMak
 		}
 	}
 
+	limiter := c.newResultLimiter(query)
 	entities, err := client.ListEntities(ctx, params)
 	if err != nil {
 		return nil, err
 	}
+	if err := limiter.add(len(entities.EntitySummaries), entities.EntitySummaries, entities.NextToken); err != nil {
+		return entities, err
+	}
 
 	cEntities := entities
 	for cEntities.NextToken != nil {
 		params.NextToken = cEntities.NextToken
 
-		cEntities, err := client.ListEntities(ctx, params)
+		cEntities, err = client.ListEntities(ctx, params)
 		if err != nil {
 			return nil, err
 		}
 
 		entities.EntitySummaries = append(entities.EntitySummaries, cEntities.EntitySummaries...)
 		entities.NextToken = cEntities.NextToken
+		if err := limiter.add(len(cEntities.EntitySummaries), cEntities.EntitySummaries, cEntities.NextToken); err != nil {
+			return entities, err
+		}
 	}
 
 	return entities, nil
@@ -288,22 +426,29 @@ func (c *twinMakerClient) ListComponentTypes(ctx context.Context, query models.T
 		}
 	}
 
+	limiter := c.newResultLimiter(query)
 	componentTypes, err := client.ListComponentTypes(ctx, params)
 	if err != nil {
 		return nil, err
 	}
+	if err := limiter.add(len(componentTypes.ComponentTypeSummaries), componentTypes.ComponentTypeSummaries, componentTypes.NextToken); err != nil {
+		return componentTypes, err
+	}
 
 	cComponentTypes := componentTypes
 	for cComponentTypes.NextToken != nil {
 		params.NextToken = cComponentTypes.NextToken
 
-		cComponentTypes, err := client.ListComponentTypes(ctx, params)
+		cComponentTypes, err = client.ListComponentTypes(ctx, params)
 		if err != nil {
 			return nil, err
 		}
 
 		componentTypes.ComponentTypeSummaries = append(componentTypes.ComponentTypeSummaries, cComponentTypes.ComponentTypeSummaries...)
 		componentTypes.NextToken = cComponentTypes.NextToken
+		if err := limiter.add(len(cComponentTypes.ComponentTypeSummaries), cComponentTypes.ComponentTypeSummaries, cComponentTypes.NextToken); err != nil {
+			return componentTypes, err
+		}
 	}
 
 	return componentTypes, nil
@@ -316,7 +461,7 @@ func (c *twinMakerClient) GetComponentType(ctx context.Context, query models.Twi
 	}
 
 	if query.ComponentTypeId == "" {
-		return nil, fmt.Errorf("missing component type id")
+		return nil, models.MissingFieldError("componentTypeId")
 	}
 
 	params := &iottwinmaker.GetComponentTypeInput{
@@ -334,7 +479,7 @@ func (c *twinMakerClient) GetEntity(ctx context.Context, query models.TwinMakerQ
 	}
 
 	if query.EntityId == "" {
-		return nil, fmt.Errorf("missing entity id")
+		return nil, models.MissingFieldError("entityId")
 	}
 
 	params := &iottwinmaker.GetEntityInput{
@@ -345,6 +490,68 @@ func (c *twinMakerClient) GetEntity(ctx context.Context, query models.TwinMakerQ
 	return client.GetEntity(ctx, params)
 }
 
+func (c *twinMakerClient) GetScene(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetSceneOutput, error) {
+	client, err := c.twinMakerService()
+	if err != nil {
+		return nil, err
+	}
+
+	if query.SceneId == "" {
+		return nil, models.MissingFieldError("sceneId")
+	}
+
+	params := &iottwinmaker.GetSceneInput{
+		SceneId:     &query.SceneId,
+		WorkspaceId: &query.WorkspaceId,
+	}
+
+	return client.GetScene(ctx, params)
+}
+
+func (c *twinMakerClient) GetSceneDocument(ctx context.Context, query models.TwinMakerQuery) ([]byte, error) {
+	scene, err := c.GetScene(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetS3Object(ctx, query.WorkspaceId, aws.ToString(scene.ContentLocation))
+}
+
+func (c *twinMakerClient) GetS3Object(ctx context.Context, workspaceId string, uri string) ([]byte, error) {
+	bucket, key, err := models.SplitS3URI(uri)
+	if err != nil {
+		return nil, err
+	}
+	s3, err := c.s3Service()
+	if err != nil {
+		return nil, err
+	}
+	return s3.GetObject(ctx, bucket, key)
+}
+
+func (c *twinMakerClient) ListS3Objects(ctx context.Context, workspaceId string, prefix string) ([]models.S3Object, error) {
+	bucket, key, err := models.SplitS3URI(prefix)
+	if err != nil {
+		return nil, err
+	}
+	s3, err := c.s3Service()
+	if err != nil {
+		return nil, err
+	}
+	return s3.ListObjects(ctx, bucket, key)
+}
+
+func (c *twinMakerClient) PutS3Object(ctx context.Context, workspaceId string, uri string, body []byte) error {
+	bucket, key, err := models.SplitS3URI(uri)
+	if err != nil {
+		return err
+	}
+	s3, err := c.s3WriterService()
+	if err != nil {
+		return err
+	}
+	return s3.PutObject(ctx, bucket, key, body)
+}
+
 func (c *twinMakerClient) GetWorkspace(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetWorkspaceOutput, error) {
 	client, err := c.twinMakerService()
 	if err != nil {
@@ -365,13 +572,13 @@ func (c *twinMakerClient) GetPropertyValue(ctx context.Context, query models.Twi
 	}
 
 	if query.EntityId == "" {
-		return nil, fmt.Errorf("missing entity id")
+		return nil, models.MissingFieldError("entityId")
 	}
 	if query.ComponentName == "" {
-		return nil, fmt.Errorf("missing component name")
+		return nil, models.MissingFieldError("componentName")
 	}
 	if len(query.Properties) < 1 {
-		return nil, fmt.Errorf("missing property")
+		return nil, models.MissingFieldError("properties")
 	}
 
 	params := &iottwinmaker.GetPropertyValueInput{
@@ -381,33 +588,54 @@ func (c *twinMakerClient) GetPropertyValue(ctx context.Context, query models.Twi
 		WorkspaceId:        &query.WorkspaceId,
 		MaxResults:         aws.Int32(200),
 	}
+	if query.MaxResults > 0 {
+		params.MaxResults = aws.Int32(int32(min(query.MaxResults, maxTabularPageSize)))
+	}
+	if query.NextToken != "" {
+		params.NextToken = &query.NextToken
+	}
 
 	// Parse Athena Data Connector fields
 	if query.PropertyGroupName != "" {
 		params.PropertyGroupName = &query.PropertyGroupName
 	}
 
-	tabularConditions := query.TabularConditions.ToTwinMakerTabularConditions()
+	tabularConditions, err := query.TabularConditions.ToTwinMakerTabularConditions()
+	if err != nil {
+		return nil, err
+	}
 	if len(tabularConditions.OrderBy) > 0 || len(tabularConditions.PropertyFilters) > 0 {
 		params.TabularConditions = tabularConditions
 	}
 
+	limiter := c.newResultLimiter(query)
 	propertyValues, err := client.GetPropertyValue(ctx, params)
 	if err != nil {
 		return nil, err
 	}
+	if err := limiter.add(countTabularRows(propertyValues.TabularPropertyValues), propertyValues.TabularPropertyValues, propertyValues.NextToken); err != nil {
+		return propertyValues, err
+	}
+	// with a page size only one page is loaded and the streaming loop continues from the next token,
+	// without Grafana Live nothing would load the next pages, so they are all loaded here
+	if query.MaxResults > 0 && query.GrafanaLiveEnabled {
+		return propertyValues, nil
+	}
 
 	cPropertyValues := propertyValues
 	for cPropertyValues.NextToken != nil {
 		params.NextToken = cPropertyValues.NextToken
 
-		cPropertyValues, err := client.GetPropertyValue(ctx, params)
+		cPropertyValues, err = client.GetPropertyValue(ctx, params)
 		if err != nil {
 			return nil, err
 		}
 
 		propertyValues.TabularPropertyValues = append(propertyValues.TabularPropertyValues, cPropertyValues.TabularPropertyValues...)
 		propertyValues.NextToken = cPropertyValues.NextToken
+		if err := limiter.add(countTabularRows(cPropertyValues.TabularPropertyValues), cPropertyValues.TabularPropertyValues, cPropertyValues.NextToken); err != nil {
+			return propertyValues, err
+		}
 	}
 
 	return propertyValues, nil
@@ -420,7 +648,7 @@ func (c *twinMakerClient) GetPropertyValueHistory(ctx context.Context, query mod
 	}
 
 	if query.EntityId == "" && query.ComponentTypeId == "" {
-		return nil, fmt.Errorf("missing entity id & component type id - either one required")
+		return nil, models.MissingFieldError("entityId or componentTypeId")
 	}
 	maxR := int32(query.MaxResults)
 
@@ -445,109 +673,195 @@ func (c *twinMakerClient) GetPropertyValueHistory(ctx context.Context, query mod
 
 	if c := query.ComponentTypeId; c != "" {
 		if len(query.Properties) < 1 {
-			return nil, fmt.Errorf("missing property")
+			return nil, models.MissingFieldError("properties")
 		}
 		params.ComponentTypeId = &c
 	} else {
 		if query.ComponentName == "" {
-			return nil, fmt.Errorf("missing component name")
+			return nil, models.MissingFieldError("componentName")
 		}
 		if len(query.Properties) < 1 {
-			return nil, fmt.Errorf("missing property")
+			return nil, models.MissingFieldError("properties")
 		}
 		params.EntityId = &query.EntityId
 		params.ComponentName = &query.ComponentName
 	}
 
-	if len(query.PropertyFilter) > 0 {
-		var filter []iottwinmakertypes.PropertyFilter
-		for _, fq := range query.PropertyFilter {
-			if fq.Name != "" && fq.Value.DataValueToString() != "" {
-				if fq.Op == "" {
-					fq.Op = "=" // matches the placeholder text in the frontend
-				}
-				filter = append(filter, fq.ToTwinMakerFilter())
-			}
-		}
+	filter, err := query.HistoryFilters()
+	if err != nil {
+		return nil, err
+	}
+	if len(filter) > 0 {
 		params.PropertyFilters = filter
 	}
 
 	return client.GetPropertyValueHistory(ctx, params)
 }
 
-func (c *twinMakerClient) GetSessionToken(ctx context.Context, duration time.Duration, workspaceId string) (*ststypes.Credentials, error) {
-	client, err := c.twinMakerService()
-	if err != nil {
-		return nil, err
-	}
-
-	tokenService, err := c.tokenService()
-	if err != nil {
-		return nil, err
-	}
+// sessionPolicy returns the inline session policy of the user for the workspace.
+// Workspaces rarely change, so they are cached to skip GetWorkspace on every token request.
+func (c *twinMakerClient) sessionPolicy(ctx context.Context, workspaceId string, identity models.TokenIdentity) (string, error) {
+	workspace, ok := c.workspaces.Get(workspaceId)
+	if !ok {
+		client, err := c.twinMakerService()
+		if err != nil {
+			return "", err
+		}
 
-	// always call AssumeRole with an inline session policy if a role is provided
-	if c.tokenRole != "" {
 		params := &iottwinmaker.GetWorkspaceInput{
 			WorkspaceId: &workspaceId,
 		}
 
-		workspace, err := client.GetWorkspace(ctx, params)
+		workspace, err = client.GetWorkspace(ctx, params)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
+		c.workspaces.Set(workspaceId, workspace, 0)
+	}
 
-		policy, err := LoadPolicy(workspace)
-		if err != nil {
-			return nil, err
-		}
+	return LoadPolicy(workspace.(*iottwinmaker.GetWorkspaceOutput), c.policyFor(identity))
+}
 
-		input := &sts.AssumeRoleInput{
-			RoleArn:         &c.tokenRole,
-			DurationSeconds: aws.Int32(int32(duration.Seconds())),
-			RoleSessionName: aws.String("grafana"),
-			Policy:          aws.String(policy),
-		}
+// assumeRole gets a token for the role, with the session named after the user
+func (c *twinMakerClient) assumeRole(ctx context.Context, role string, duration time.Duration, policy string, identity models.TokenIdentity) (*ststypes.Credentials, error) {
+	tokenService, err := c.tokenService()
+	if err != nil {
+		return nil, err
+	}
 
-		out, err := tokenService.AssumeRole(ctx, input)
-		if err != nil {
-			return nil, err
+	input := &sts.AssumeRoleInput{
+		RoleArn:         &role,
+		DurationSeconds: aws.Int32(int32(duration.Seconds())),
+		RoleSessionName: aws.String(identity.SessionName()),
+	}
+	if policy != "" {
+		input.Policy = aws.String(policy)
+	}
+	if c.setSourceIdentity {
+		if id := identity.SourceIdentity(); id != "" {
+			input.SourceIdentity = aws.String(id)
 		}
+	}
+	if c.sessionTags {
+		for k, v := range identity.SessionTags() {
+			input.Tags = append(input.Tags, ststypes.Tag{Key: aws.String(k), Value: aws.String(v)})
+		}
+	}
 
-		return out.Credentials, err
-	} else {
+	out, err := tokenService.AssumeRole(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return out.Credentials, nil
+}
+
+func (c *twinMakerClient) GetSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (*ststypes.Credentials, error) {
+	// always call AssumeRole with an inline session policy if a role is provided
+	if c.tokenRole == "" {
 		return nil, fmt.Errorf("assume role ARN is missing in datasource configuration")
 	}
+
+	policy, err := c.sessionPolicy(ctx, workspaceId, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	key := tokenKey(c.tokenRole, workspaceId, policy, identity.SessionName())
+	return c.tokens.get(ctx, key, duration, func(ctx context.Context) (*ststypes.Credentials, error) {
+		return c.assumeRole(ctx, c.tokenRole, duration, policy, identity)
+	})
 }
 
-func (c *twinMakerClient) GetWriteSessionToken(ctx context.Context, duration time.Duration, workspaceId string) (*ststypes.Credentials, error) {
+func (c *twinMakerClient) GetWriteSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (*ststypes.Credentials, error) {
 	if c.tokenRoleWriter == "" {
 		return nil, fmt.Errorf("assume role ARN Write is missing in datasource configuration")
 	}
 
-	tokenService, err := c.tokenService()
+	key := tokenKey(c.tokenRoleWriter, "", "", identity.SessionName())
+	return c.tokens.get(ctx, key, duration, func(ctx context.Context) (*ststypes.Credentials, error) {
+		return c.assumeRole(ctx, c.tokenRoleWriter, duration, "", identity)
+	})
+}
+
+func (c *twinMakerClient) BatchPutPropertyValues(ctx context.Context, req *iottwinmaker.BatchPutPropertyValuesInput) (*iottwinmaker.BatchPutPropertyValuesOutput, error) {
+	client, err := c.writerService()
 	if err != nil {
 		return nil, err
 	}
 
-	input := &sts.AssumeRoleInput{
-		RoleArn:         &c.tokenRoleWriter,
-		DurationSeconds: aws.Int32(int32(duration.Seconds())),
-		RoleSessionName: aws.String("grafana"),
+	return client.BatchPutPropertyValues(ctx, req)
+}
+
+func (c *twinMakerClient) UpdateEntity(ctx context.Context, req *iottwinmaker.UpdateEntityInput) (*iottwinmaker.UpdateEntityOutput, error) {
+	client, err := c.writerService()
+	if err != nil {
+		return nil, err
 	}
 
-	out, err := tokenService.AssumeRole(ctx, input)
+	return client.UpdateEntity(ctx, req)
+}
+
+func (c *twinMakerClient) CreateScene(ctx context.Context, req *iottwinmaker.CreateSceneInput) (*iottwinmaker.CreateSceneOutput, error) {
+	client, err := c.writerService()
 	if err != nil {
 		return nil, err
 	}
-	return out.Credentials, err
+
+	return client.CreateScene(ctx, req)
 }
 
-func (c *twinMakerClient) BatchPutPropertyValues(ctx context.Context, req *iottwinmaker.BatchPutPropertyValuesInput) (*iottwinmaker.BatchPutPropertyValuesOutput, error) {
+func (c *twinMakerClient) UpdateScene(ctx context.Context, req *iottwinmaker.UpdateSceneInput) (*iottwinmaker.UpdateSceneOutput, error) {
 	client, err := c.writerService()
 	if err != nil {
 		return nil, err
 	}
 
-	return client.BatchPutPropertyValues(ctx, req)
+	return client.UpdateScene(ctx, req)
+}
+
+func (c *twinMakerClient) GetVideoStreamURL(ctx context.Context, workspaceId string, req models.VideoStreamRequest) (*models.VideoStreamURL, error) {
+	kvs, err := c.kvsService()
+	if err != nil {
+		return nil, err
+	}
+	return kvs.GetStreamingSessionURL(ctx, req)
+}
+
+func (c *twinMakerClient) ListVideoFragments(ctx context.Context, query models.TwinMakerQuery, streamName string) ([]models.VideoRange, error) {
+	kvs, err := c.kvsService()
+	if err != nil {
+		return nil, err
+	}
+	return kvs.ListFragments(ctx, streamName, query.TimeRange.From, query.TimeRange.To, c.newResultLimiter(query))
+}
+
+func (c *twinMakerClient) RequestVideoUpload(ctx context.Context, workspaceId string, assetId string, req models.VideoUploadRequest) error {
+	sitewise, err := c.siteWiseWriterService()
+	if err != nil {
+		return err
+	}
+	return sitewise.RequestVideoUpload(ctx, assetId, req)
+}
+
+func (c *twinMakerClient) GetVideoUploadStatus(ctx context.Context, workspaceId string, assetId string) (*models.VideoUploadStatus, error) {
+	sitewise, err := c.siteWiseService()
+	if err != nil {
+		return nil, err
+	}
+	return sitewise.GetVideoUploadStatus(ctx, assetId)
+}
+
+func (c *twinMakerClient) GetSiteWiseHistory(ctx context.Context, query models.TwinMakerQuery, ref models.SiteWiseReference) ([]iottwinmakertypes.PropertyValue, error) {
+	if query.SiteWise == nil {
+		return nil, models.MissingFieldError("sitewise")
+	}
+	sitewise, err := c.siteWiseService()
+	if err != nil {
+		return nil, err
+	}
+	limiter := c.newResultLimiter(query)
+	if query.SiteWise.Aggregated() {
+		return sitewise.GetPropertyAggregates(ctx, ref, *query.SiteWise, query.TimeRange.From, query.TimeRange.To, query.Order, limiter)
+	}
+	return sitewise.GetInterpolatedValues(ctx, ref, *query.SiteWise, query.TimeRange.From, query.TimeRange.To, query.Order, limiter)
 }
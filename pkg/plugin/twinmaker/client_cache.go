@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
 	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/patrickmn/go-cache"
@@ -36,7 +37,7 @@ func (c *cachingClient) getOrExecuteQuery(key string, runner func() (interface{}
 	if err == nil {
 		c.generalCache.Set(key, val, 0)
 	}
-	return val, nil
+	return val, err
 }
 
 func (c *cachingClient) ListWorkspaces(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListWorkspacesOutput, error) {
@@ -46,13 +47,9 @@ func (c *cachingClient) ListWorkspaces(ctx context.Context, query models.TwinMak
 			return c.client.ListWorkspaces(ctx, query)
 		},
 	)
-	if err == nil {
-		a, ok := val.(*iottwinmaker.ListWorkspacesOutput)
-		if ok {
-			return a, nil
-		}
-	}
-	return nil, err
+	// partial results are returned along with limit errors
+	a, _ := val.(*iottwinmaker.ListWorkspacesOutput)
+	return a, err
 }
 
 func (c *cachingClient) ListScenes(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListScenesOutput, error) {
@@ -62,13 +59,9 @@ func (c *cachingClient) ListScenes(ctx context.Context, query models.TwinMakerQu
 			return c.client.ListScenes(ctx, query)
 		},
 	)
-	if err == nil {
-		a, ok := val.(*iottwinmaker.ListScenesOutput)
-		if ok {
-			return a, nil
-		}
-	}
-	return nil, err
+	// partial results are returned along with limit errors
+	a, _ := val.(*iottwinmaker.ListScenesOutput)
+	return a, err
 }
 
 func (c *cachingClient) ListEntities(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListEntitiesOutput, error) {
@@ -78,13 +71,9 @@ func (c *cachingClient) ListEntities(ctx context.Context, query models.TwinMaker
 			return c.client.ListEntities(ctx, query)
 		},
 	)
-	if err == nil {
-		a, ok := val.(*iottwinmaker.ListEntitiesOutput)
-		if ok {
-			return a, nil
-		}
-	}
-	return nil, err
+	// partial results are returned along with limit errors
+	a, _ := val.(*iottwinmaker.ListEntitiesOutput)
+	return a, err
 }
 
 func (c *cachingClient) ListComponentTypes(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListComponentTypesOutput, error) {
@@ -94,13 +83,9 @@ func (c *cachingClient) ListComponentTypes(ctx context.Context, query models.Twi
 			return c.client.ListComponentTypes(ctx, query)
 		},
 	)
-	if err == nil {
-		a, ok := val.(*iottwinmaker.ListComponentTypesOutput)
-		if ok {
-			return a, nil
-		}
-	}
-	return nil, err
+	// partial results are returned along with limit errors
+	a, _ := val.(*iottwinmaker.ListComponentTypesOutput)
+	return a, err
 }
 
 func (c *cachingClient) GetComponentType(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetComponentTypeOutput, error) {
@@ -110,13 +95,8 @@ func (c *cachingClient) GetComponentType(ctx context.Context, query models.TwinM
 			return c.client.GetComponentType(ctx, query)
 		},
 	)
-	if err == nil {
-		a, ok := val.(*iottwinmaker.GetComponentTypeOutput)
-		if ok {
-			return a, nil
-		}
-	}
-	return nil, err
+	a, _ := val.(*iottwinmaker.GetComponentTypeOutput)
+	return a, err
 }
 
 func (c *cachingClient) GetEntity(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetEntityOutput, error) {
@@ -126,13 +106,18 @@ func (c *cachingClient) GetEntity(ctx context.Context, query models.TwinMakerQue
 			return c.client.GetEntity(ctx, query)
 		},
 	)
-	if err == nil {
-		a, ok := val.(*iottwinmaker.GetEntityOutput)
-		if ok {
-			return a, nil
-		}
-	}
-	return nil, err
+	a, _ := val.(*iottwinmaker.GetEntityOutput)
+	return a, err
+}
+
+func (c *cachingClient) GetScene(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetSceneOutput, error) {
+	// not cached, scenes can be edited from Grafana and every write points the scene at a new version
+	return c.client.GetScene(ctx, query)
+}
+
+func (c *cachingClient) GetSceneDocument(ctx context.Context, query models.TwinMakerQuery) ([]byte, error) {
+	// not cached, scenes can be edited from Grafana
+	return c.client.GetSceneDocument(ctx, query)
 }
 
 func (c *cachingClient) GetWorkspace(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetWorkspaceOutput, error) {
@@ -142,13 +127,8 @@ func (c *cachingClient) GetWorkspace(ctx context.Context, query models.TwinMaker
 			return c.client.GetWorkspace(ctx, query)
 		},
 	)
-	if err == nil {
-		a, ok := val.(*iottwinmaker.GetWorkspaceOutput)
-		if ok {
-			return a, nil
-		}
-	}
-	return nil, err
+	a, _ := val.(*iottwinmaker.GetWorkspaceOutput)
+	return a, err
 }
 
 func (c *cachingClient) GetPropertyValue(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetPropertyValueOutput, error) {
@@ -161,17 +141,81 @@ func (c *cachingClient) GetPropertyValueHistory(ctx context.Context, query model
 	return c.client.GetPropertyValueHistory(ctx, query)
 }
 
-func (c *cachingClient) GetSessionToken(ctx context.Context, duration time.Duration, workspaceId string) (*ststypes.Credentials, error) {
+func (c *cachingClient) GetSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (*ststypes.Credentials, error) {
 	// not cached
-	return c.client.GetSessionToken(ctx, duration, workspaceId)
+	return c.client.GetSessionToken(ctx, duration, workspaceId, identity)
 }
 
-func (c *cachingClient) GetWriteSessionToken(ctx context.Context, duration time.Duration, workspaceId string) (*ststypes.Credentials, error) {
+func (c *cachingClient) GetWriteSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (*ststypes.Credentials, error) {
 	// not cached
-	return c.client.GetWriteSessionToken(ctx, duration, workspaceId)
+	return c.client.GetWriteSessionToken(ctx, duration, workspaceId, identity)
 }
 
 func (c *cachingClient) BatchPutPropertyValues(ctx context.Context, request *iottwinmaker.BatchPutPropertyValuesInput) (*iottwinmaker.BatchPutPropertyValuesOutput, error) {
 	// not cached
 	return c.client.BatchPutPropertyValues(ctx, request)
 }
+
+func (c *cachingClient) UpdateEntity(ctx context.Context, request *iottwinmaker.UpdateEntityInput) (*iottwinmaker.UpdateEntityOutput, error) {
+	// not cached
+	return c.client.UpdateEntity(ctx, request)
+}
+
+func (c *cachingClient) CreateScene(ctx context.Context, request *iottwinmaker.CreateSceneInput) (*iottwinmaker.CreateSceneOutput, error) {
+	// not cached
+	return c.client.CreateScene(ctx, request)
+}
+
+func (c *cachingClient) UpdateScene(ctx context.Context, request *iottwinmaker.UpdateSceneInput) (*iottwinmaker.UpdateSceneOutput, error) {
+	// not cached
+	return c.client.UpdateScene(ctx, request)
+}
+
+func (c *cachingClient) GetS3Object(ctx context.Context, workspaceId string, uri string) ([]byte, error) {
+	// only scene versions are cached, they are never written again
+	if !models.IsSceneVersionLocation(uri) {
+		return c.client.GetS3Object(ctx, workspaceId, uri)
+	}
+	val, err := c.getOrExecuteQuery(
+		"GetS3Object~"+workspaceId+"/"+uri,
+		func() (interface{}, error) {
+			return c.client.GetS3Object(ctx, workspaceId, uri)
+		},
+	)
+	a, _ := val.([]byte)
+	return a, err
+}
+
+func (c *cachingClient) ListS3Objects(ctx context.Context, workspaceId string, prefix string) ([]models.S3Object, error) {
+	// not cached
+	return c.client.ListS3Objects(ctx, workspaceId, prefix)
+}
+
+func (c *cachingClient) PutS3Object(ctx context.Context, workspaceId string, uri string, body []byte) error {
+	// not cached
+	return c.client.PutS3Object(ctx, workspaceId, uri, body)
+}
+
+func (c *cachingClient) GetVideoStreamURL(ctx context.Context, workspaceId string, req models.VideoStreamRequest) (*models.VideoStreamURL, error) {
+	// not cached, the URLs expire
+	return c.client.GetVideoStreamURL(ctx, workspaceId, req)
+}
+
+func (c *cachingClient) ListVideoFragments(ctx context.Context, query models.TwinMakerQuery, streamName string) ([]models.VideoRange, error) {
+	// not cached, recent video is still arriving
+	return c.client.ListVideoFragments(ctx, query, streamName)
+}
+
+func (c *cachingClient) RequestVideoUpload(ctx context.Context, workspaceId string, assetId string, req models.VideoUploadRequest) error {
+	return c.client.RequestVideoUpload(ctx, workspaceId, assetId, req)
+}
+
+func (c *cachingClient) GetVideoUploadStatus(ctx context.Context, workspaceId string, assetId string) (*models.VideoUploadStatus, error) {
+	// not cached, the status is polled while the upload runs
+	return c.client.GetVideoUploadStatus(ctx, workspaceId, assetId)
+}
+
+func (c *cachingClient) GetSiteWiseHistory(ctx context.Context, query models.TwinMakerQuery, ref models.SiteWiseReference) ([]iottwinmakertypes.PropertyValue, error) {
+	// not cached, like the TwinMaker history
+	return c.client.GetSiteWiseHistory(ctx, query, ref)
+}
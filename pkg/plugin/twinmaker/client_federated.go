@@ -0,0 +1,317 @@
+package twinmaker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+type clientFactory = func(ctx context.Context, settings models.TwinMakerDataSourceSetting) (TwinMakerClient, error)
+
+// federatedClient routes requests for region/account/workspace refs to a client of that target,
+// and everything else to the client of the datasource region and account
+type federatedClient struct {
+	client    TwinMakerClient
+	settings  models.TwinMakerDataSourceSetting
+	newClient clientFactory
+
+	mu      sync.Mutex
+	clients map[string]TwinMakerClient
+}
+
+// NewFederatedClient wraps the default client with clients for the configured workspace targets.
+// Target clients are created on first use and shared by targets in the same region and account.
+func NewFederatedClient(client TwinMakerClient, settings models.TwinMakerDataSourceSetting) TwinMakerClient {
+	if len(settings.WorkspaceTargets) == 0 {
+		return client
+	}
+	return newFederatedClient(client, settings, NewTwinMakerClient)
+}
+
+func newFederatedClient(client TwinMakerClient, settings models.TwinMakerDataSourceSetting, newClient clientFactory) *federatedClient {
+	return &federatedClient{
+		client:    client,
+		settings:  settings,
+		newClient: newClient,
+		clients:   make(map[string]TwinMakerClient),
+	}
+}
+
+func (c *federatedClient) targetClient(ctx context.Context, t models.WorkspaceTarget) (TwinMakerClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := t.ClientKey()
+	if client, ok := c.clients[key]; ok {
+		return client, nil
+	}
+	client, err := c.newClient(ctx, c.settings.TargetSettings(t))
+	if err != nil {
+		return nil, fmt.Errorf("error creating client for %s: %w", t.Ref(), err)
+	}
+	c.clients[key] = client
+	return client, nil
+}
+
+// route returns the client for the workspace, and the workspace id to send to that client
+func (c *federatedClient) route(ctx context.Context, workspaceId string) (TwinMakerClient, string, error) {
+	if !models.IsWorkspaceRef(workspaceId) {
+		return c.client, workspaceId, nil
+	}
+	t, ok := c.settings.Target(workspaceId)
+	if !ok {
+		return nil, "", &models.WorkspaceNotAllowedError{WorkspaceId: workspaceId}
+	}
+	client, err := c.targetClient(ctx, t)
+	return client, t.WorkspaceId, err
+}
+
+func (c *federatedClient) routeQuery(ctx context.Context, query models.TwinMakerQuery) (TwinMakerClient, models.TwinMakerQuery, error) {
+	client, workspaceId, err := c.route(ctx, query.WorkspaceId)
+	query.WorkspaceId = workspaceId
+	return client, query, err
+}
+
+func (c *federatedClient) GetSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (*ststypes.Credentials, error) {
+	client, workspaceId, err := c.route(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetSessionToken(ctx, duration, workspaceId, identity)
+}
+
+func (c *federatedClient) GetWriteSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (*ststypes.Credentials, error) {
+	client, workspaceId, err := c.route(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetWriteSessionToken(ctx, duration, workspaceId, identity)
+}
+
+// ListWorkspaces lists the workspaces of the datasource account, followed by the workspace targets.
+// Target workspaces are listed with their region/account/workspace ref as id.
+func (c *federatedClient) ListWorkspaces(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListWorkspacesOutput, error) {
+	workspaces, err := c.client.ListWorkspaces(ctx, query)
+	if err != nil && !isLimitExceeded(err) {
+		return nil, err
+	}
+
+	for _, t := range c.settings.WorkspaceTargets {
+		client, err := c.targetClient(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		workspace, err := client.GetWorkspace(ctx, models.TwinMakerQuery{WorkspaceId: t.WorkspaceId})
+		if err != nil {
+			// one unreachable site should not hide the others
+			backend.Logger.Warn("error loading workspace target", "workspace", t.Ref(), "error", err)
+			continue
+		}
+		workspaces.WorkspaceSummaries = append(workspaces.WorkspaceSummaries, toWorkspaceSummary(t.Ref(), workspace))
+	}
+	return workspaces, err
+}
+
+func (c *federatedClient) GetWorkspace(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetWorkspaceOutput, error) {
+	client, query, err := c.routeQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetWorkspace(ctx, query)
+}
+
+func (c *federatedClient) ListScenes(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListScenesOutput, error) {
+	client, query, err := c.routeQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return client.ListScenes(ctx, query)
+}
+
+func (c *federatedClient) ListEntities(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListEntitiesOutput, error) {
+	client, query, err := c.routeQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return client.ListEntities(ctx, query)
+}
+
+func (c *federatedClient) ListComponentTypes(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListComponentTypesOutput, error) {
+	client, query, err := c.routeQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return client.ListComponentTypes(ctx, query)
+}
+
+func (c *federatedClient) GetComponentType(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetComponentTypeOutput, error) {
+	client, query, err := c.routeQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetComponentType(ctx, query)
+}
+
+func (c *federatedClient) GetEntity(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetEntityOutput, error) {
+	client, query, err := c.routeQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetEntity(ctx, query)
+}
+
+func (c *federatedClient) BatchPutPropertyValues(ctx context.Context, req *iottwinmaker.BatchPutPropertyValuesInput) (*iottwinmaker.BatchPutPropertyValuesOutput, error) {
+	client, workspaceId, err := c.route(ctx, aws.ToString(req.WorkspaceId))
+	if err != nil {
+		return nil, err
+	}
+	input := *req
+	input.WorkspaceId = aws.String(workspaceId)
+	return client.BatchPutPropertyValues(ctx, &input)
+}
+
+func (c *federatedClient) UpdateEntity(ctx context.Context, req *iottwinmaker.UpdateEntityInput) (*iottwinmaker.UpdateEntityOutput, error) {
+	client, workspaceId, err := c.route(ctx, aws.ToString(req.WorkspaceId))
+	if err != nil {
+		return nil, err
+	}
+	input := *req
+	input.WorkspaceId = aws.String(workspaceId)
+	return client.UpdateEntity(ctx, &input)
+}
+
+func (c *federatedClient) GetScene(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetSceneOutput, error) {
+	client, query, err := c.routeQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetScene(ctx, query)
+}
+
+func (c *federatedClient) GetSceneDocument(ctx context.Context, query models.TwinMakerQuery) ([]byte, error) {
+	client, query, err := c.routeQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetSceneDocument(ctx, query)
+}
+
+func (c *federatedClient) CreateScene(ctx context.Context, req *iottwinmaker.CreateSceneInput) (*iottwinmaker.CreateSceneOutput, error) {
+	client, workspaceId, err := c.route(ctx, aws.ToString(req.WorkspaceId))
+	if err != nil {
+		return nil, err
+	}
+	input := *req
+	input.WorkspaceId = aws.String(workspaceId)
+	return client.CreateScene(ctx, &input)
+}
+
+func (c *federatedClient) UpdateScene(ctx context.Context, req *iottwinmaker.UpdateSceneInput) (*iottwinmaker.UpdateSceneOutput, error) {
+	client, workspaceId, err := c.route(ctx, aws.ToString(req.WorkspaceId))
+	if err != nil {
+		return nil, err
+	}
+	input := *req
+	input.WorkspaceId = aws.String(workspaceId)
+	return client.UpdateScene(ctx, &input)
+}
+
+func (c *federatedClient) GetS3Object(ctx context.Context, workspaceId string, uri string) ([]byte, error) {
+	client, workspaceId, err := c.route(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetS3Object(ctx, workspaceId, uri)
+}
+
+func (c *federatedClient) ListS3Objects(ctx context.Context, workspaceId string, prefix string) ([]models.S3Object, error) {
+	client, workspaceId, err := c.route(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	return client.ListS3Objects(ctx, workspaceId, prefix)
+}
+
+func (c *federatedClient) PutS3Object(ctx context.Context, workspaceId string, uri string, body []byte) error {
+	client, workspaceId, err := c.route(ctx, workspaceId)
+	if err != nil {
+		return err
+	}
+	return client.PutS3Object(ctx, workspaceId, uri, body)
+}
+
+func (c *federatedClient) GetVideoStreamURL(ctx context.Context, workspaceId string, req models.VideoStreamRequest) (*models.VideoStreamURL, error) {
+	client, workspaceId, err := c.route(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetVideoStreamURL(ctx, workspaceId, req)
+}
+
+func (c *federatedClient) RequestVideoUpload(ctx context.Context, workspaceId string, assetId string, req models.VideoUploadRequest) error {
+	client, workspaceId, err := c.route(ctx, workspaceId)
+	if err != nil {
+		return err
+	}
+	return client.RequestVideoUpload(ctx, workspaceId, assetId, req)
+}
+
+func (c *federatedClient) GetVideoUploadStatus(ctx context.Context, workspaceId string, assetId string) (*models.VideoUploadStatus, error) {
+	client, workspaceId, err := c.route(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetVideoUploadStatus(ctx, workspaceId, assetId)
+}
+
+func (c *federatedClient) GetSiteWiseHistory(ctx context.Context, query models.TwinMakerQuery, ref models.SiteWiseReference) ([]iottwinmakertypes.PropertyValue, error) {
+	client, query, err := c.routeQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetSiteWiseHistory(ctx, query, ref)
+}
+
+func (c *federatedClient) ListVideoFragments(ctx context.Context, query models.TwinMakerQuery, streamName string) ([]models.VideoRange, error) {
+	client, query, err := c.routeQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return client.ListVideoFragments(ctx, query, streamName)
+}
+
+func (c *federatedClient) GetPropertyValue(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetPropertyValueOutput, error) {
+	client, query, err := c.routeQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetPropertyValue(ctx, query)
+}
+
+func (c *federatedClient) GetPropertyValueHistory(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetPropertyValueHistoryOutput, error) {
+	client, query, err := c.routeQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetPropertyValueHistory(ctx, query)
+}
+
+func toWorkspaceSummary(ref string, w *iottwinmaker.GetWorkspaceOutput) iottwinmakertypes.WorkspaceSummary {
+	return iottwinmakertypes.WorkspaceSummary{
+		Arn:              w.Arn,
+		CreationDateTime: w.CreationDateTime,
+		UpdateDateTime:   w.UpdateDateTime,
+		WorkspaceId:      aws.String(ref),
+		Description:      w.Description,
+		LinkedServices:   w.LinkedServices,
+	}
+}
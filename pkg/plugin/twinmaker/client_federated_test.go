@@ -0,0 +1,89 @@
+package twinmaker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+// siteClient answers every request with the name of the site and the workspace it was asked for
+type siteClient struct {
+	TwinMakerClient
+	site string
+}
+
+func (c *siteClient) GetEntity(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetEntityOutput, error) {
+	return &iottwinmaker.GetEntityOutput{
+		WorkspaceId: aws.String(query.WorkspaceId),
+		EntityName:  aws.String(c.site),
+	}, nil
+}
+
+func (c *siteClient) GetWorkspace(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetWorkspaceOutput, error) {
+	return &iottwinmaker.GetWorkspaceOutput{
+		WorkspaceId: aws.String(query.WorkspaceId),
+		Description: aws.String(c.site),
+	}, nil
+}
+
+func (c *siteClient) ListWorkspaces(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListWorkspacesOutput, error) {
+	return &iottwinmaker.ListWorkspacesOutput{
+		WorkspaceSummaries: []iottwinmakertypes.WorkspaceSummary{{WorkspaceId: aws.String("factory")}},
+	}, nil
+}
+
+func TestFederatedClient(t *testing.T) {
+	settings := models.TwinMakerDataSourceSetting{
+		WorkspaceID: "factory",
+		WorkspaceTargets: []models.WorkspaceTarget{
+			{Region: "eu-west-1", AssumeRoleARN: "arn:aws:iam::111111111111:role/twinmaker", WorkspaceId: "factory"},
+			{Region: "eu-west-1", AssumeRoleARN: "arn:aws:iam::111111111111:role/twinmaker", WorkspaceId: "warehouse"},
+			{Region: "us-east-1", AssumeRoleARN: "arn:aws:iam::222222222222:role/twinmaker", WorkspaceId: "factory"},
+		},
+	}
+	created := 0
+	c := newFederatedClient(&siteClient{site: "default"}, settings, func(ctx context.Context, s models.TwinMakerDataSourceSetting) (TwinMakerClient, error) {
+		created++
+		return &siteClient{site: s.Region}, nil
+	})
+	ctx := context.Background()
+
+	t.Run("routes refs to the target client", func(t *testing.T) {
+		e, err := c.GetEntity(ctx, models.TwinMakerQuery{WorkspaceId: "us-east-1/222222222222/factory"})
+		require.NoError(t, err)
+		require.Equal(t, "us-east-1", *e.EntityName)
+		require.Equal(t, "factory", *e.WorkspaceId)
+
+		e, err = c.GetEntity(ctx, models.TwinMakerQuery{WorkspaceId: "factory"})
+		require.NoError(t, err)
+		require.Equal(t, "default", *e.EntityName)
+	})
+
+	t.Run("unknown refs are not allowed", func(t *testing.T) {
+		_, err := c.GetEntity(ctx, models.TwinMakerQuery{WorkspaceId: "us-east-1/333333333333/factory"})
+		require.ErrorAs(t, err, new(*models.WorkspaceNotAllowedError))
+	})
+
+	t.Run("lists workspaces of every target", func(t *testing.T) {
+		rsp, err := c.ListWorkspaces(ctx, models.TwinMakerQuery{})
+		require.NoError(t, err)
+		ids := []string{}
+		for _, w := range rsp.WorkspaceSummaries {
+			ids = append(ids, *w.WorkspaceId)
+		}
+		require.Equal(t, []string{
+			"factory",
+			"eu-west-1/111111111111/factory",
+			"eu-west-1/111111111111/warehouse",
+			"us-east-1/222222222222/factory",
+		}, ids)
+	})
+
+	// targets in the same region and account share a client
+	require.Equal(t, 2, created)
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
 	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
 
 	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
@@ -87,20 +88,92 @@ func (c *twinMakerMockClient) GetPropertyValueHistory(ctx context.Context, query
 	return r, err
 }
 
-func (c *twinMakerMockClient) GetSessionToken(ctx context.Context, duration time.Duration, workspaceId string) (*ststypes.Credentials, error) {
+func (c *twinMakerMockClient) GetSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (*ststypes.Credentials, error) {
 	r := &ststypes.Credentials{}
 	_, err := c.loadSavedResponse(r)
 	return r, err
 }
 
-func (c *twinMakerMockClient) GetWriteSessionToken(ctx context.Context, duration time.Duration, workspaceId string) (*ststypes.Credentials, error) {
+func (c *twinMakerMockClient) GetWriteSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (*ststypes.Credentials, error) {
 	r := &ststypes.Credentials{}
 	_, err := c.loadSavedResponse(r)
 	return r, err
 }
 
+func (c *twinMakerMockClient) UpdateEntity(ctx context.Context, request *iottwinmaker.UpdateEntityInput) (*iottwinmaker.UpdateEntityOutput, error) {
+	r := &iottwinmaker.UpdateEntityOutput{}
+	_, err := c.loadSavedResponse(r)
+	return r, err
+}
+
+func (c *twinMakerMockClient) GetScene(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetSceneOutput, error) {
+	r := &iottwinmaker.GetSceneOutput{}
+	_, err := c.loadSavedResponse(r)
+	return r, err
+}
+
+// GetSceneDocument returns the saved scene JSON as is
+func (c *twinMakerMockClient) GetSceneDocument(ctx context.Context, query models.TwinMakerQuery) ([]byte, error) {
+	return os.ReadFile("./testdata/" + c.path + ".json")
+}
+
 func (c *twinMakerMockClient) BatchPutPropertyValues(ctx context.Context, request *iottwinmaker.BatchPutPropertyValuesInput) (*iottwinmaker.BatchPutPropertyValuesOutput, error) {
 	r := &iottwinmaker.BatchPutPropertyValuesOutput{}
 	_, err := c.loadSavedResponse(r)
 	return r, err
 }
+
+func (c *twinMakerMockClient) CreateScene(ctx context.Context, request *iottwinmaker.CreateSceneInput) (*iottwinmaker.CreateSceneOutput, error) {
+	r := &iottwinmaker.CreateSceneOutput{}
+	_, err := c.loadSavedResponse(r)
+	return r, err
+}
+
+func (c *twinMakerMockClient) UpdateScene(ctx context.Context, request *iottwinmaker.UpdateSceneInput) (*iottwinmaker.UpdateSceneOutput, error) {
+	r := &iottwinmaker.UpdateSceneOutput{}
+	_, err := c.loadSavedResponse(r)
+	return r, err
+}
+
+// GetS3Object returns the saved file as is
+func (c *twinMakerMockClient) GetS3Object(ctx context.Context, workspaceId string, uri string) ([]byte, error) {
+	return os.ReadFile("./testdata/" + c.path + ".json")
+}
+
+func (c *twinMakerMockClient) ListS3Objects(ctx context.Context, workspaceId string, prefix string) ([]models.S3Object, error) {
+	r := []models.S3Object{}
+	_, err := c.loadSavedResponse(&r)
+	return r, err
+}
+
+func (c *twinMakerMockClient) PutS3Object(ctx context.Context, workspaceId string, uri string, body []byte) error {
+	return nil
+}
+
+func (c *twinMakerMockClient) GetVideoStreamURL(ctx context.Context, workspaceId string, req models.VideoStreamRequest) (*models.VideoStreamURL, error) {
+	r := &models.VideoStreamURL{}
+	_, err := c.loadSavedResponse(r)
+	return r, err
+}
+
+func (c *twinMakerMockClient) ListVideoFragments(ctx context.Context, query models.TwinMakerQuery, streamName string) ([]models.VideoRange, error) {
+	r := []models.VideoRange{}
+	_, err := c.loadSavedResponse(&r)
+	return r, err
+}
+
+func (c *twinMakerMockClient) RequestVideoUpload(ctx context.Context, workspaceId string, assetId string, req models.VideoUploadRequest) error {
+	return nil
+}
+
+func (c *twinMakerMockClient) GetVideoUploadStatus(ctx context.Context, workspaceId string, assetId string) (*models.VideoUploadStatus, error) {
+	r := &models.VideoUploadStatus{}
+	_, err := c.loadSavedResponse(r)
+	return r, err
+}
+
+func (c *twinMakerMockClient) GetSiteWiseHistory(ctx context.Context, query models.TwinMakerQuery, ref models.SiteWiseReference) ([]iottwinmakertypes.PropertyValue, error) {
+	r := []iottwinmakertypes.PropertyValue{}
+	_, err := c.loadSavedResponse(&r)
+	return r, err
+}
@@ -1,14 +1,19 @@
 package twinmaker
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
 
 	"github.com/grafana/grafana-aws-sdk/pkg/awsds"
 	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
@@ -31,7 +36,7 @@ func TestFetchAWSData(t *testing.T) {
 		require.NoError(t, err)
 
 		WorkspaceId := "AlarmWorkspace"
-		token, err := c.GetSessionToken(context.Background(), time.Second*3600, WorkspaceId)
+		token, err := c.GetSessionToken(context.Background(), time.Second*3600, WorkspaceId, models.TokenIdentity{})
 		require.NoError(t, err)
 		require.NotEmpty(t, token)
 	})
@@ -50,7 +55,7 @@ func TestFetchAWSData(t *testing.T) {
 		require.NoError(t, err)
 
 		WorkspaceId := "GrafanaWorkspace"
-		_, err = c.GetSessionToken(context.Background(), time.Second*3600, WorkspaceId)
+		_, err = c.GetSessionToken(context.Background(), time.Second*3600, WorkspaceId, models.TokenIdentity{})
 		require.Error(t, err)
 	})
 
@@ -68,7 +73,7 @@ func TestFetchAWSData(t *testing.T) {
 		require.NoError(t, err)
 
 		WorkspaceId := "AlarmWorkspace"
-		token, err := c.GetSessionToken(context.Background(), time.Second*3600, WorkspaceId)
+		token, err := c.GetSessionToken(context.Background(), time.Second*3600, WorkspaceId, models.TokenIdentity{})
 		require.NoError(t, err)
 
 		writeTestData("get-token", token, t)
@@ -210,6 +215,76 @@ func TestFetchAWSData(t *testing.T) {
 	})
 }
 
+// pagedService serves three pages of summaries for every list call, and counts the calls by token
+type pagedService struct {
+	calls map[string]int
+}
+
+func (p *pagedService) Do(req *http.Request) (*http.Response, error) {
+	body := struct {
+		NextToken string `json:"nextToken"`
+	}{}
+	if req.Body != nil {
+		_ = json.NewDecoder(req.Body).Decode(&body)
+	}
+	page := map[string]interface{}{}
+	switch body.NextToken {
+	case "":
+		page["nextToken"] = "page-2"
+	case "page-2":
+		page["nextToken"] = "page-3"
+	}
+	key := fmt.Sprintf("%s:%s", req.URL.Path, body.NextToken)
+	p.calls[key]++
+
+	summary := map[string]string{"workspaceId": "ws", "sceneId": "scene", "entityId": "entity", "componentTypeId": "type"}
+	for _, list := range []string{"workspaceSummaries", "sceneSummaries", "entitySummaries", "componentTypeSummaries"} {
+		page[list] = []interface{}{summary}
+	}
+	bs, _ := json.Marshal(page)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(bs)),
+		Request:    req,
+	}, nil
+}
+
+func TestListPagination(t *testing.T) {
+	service := &pagedService{calls: map[string]int{}}
+	c := &twinMakerClient{
+		twinMakerService: func() (*iottwinmaker.Client, error) {
+			return iottwinmaker.New(iottwinmaker.Options{
+				Region:      "us-east-1",
+				Credentials: aws.AnonymousCredentials{},
+				HTTPClient:  service,
+			}), nil
+		},
+	}
+	ctx := context.Background()
+	query := models.TwinMakerQuery{WorkspaceId: "ws"}
+
+	workspaces, err := c.ListWorkspaces(ctx, query)
+	require.NoError(t, err)
+	require.Len(t, workspaces.WorkspaceSummaries, 3)
+	scenes, err := c.ListScenes(ctx, query)
+	require.NoError(t, err)
+	require.Len(t, scenes.SceneSummaries, 3)
+	entities, err := c.ListEntities(ctx, query)
+	require.NoError(t, err)
+	require.Len(t, entities.EntitySummaries, 3)
+	componentTypes, err := c.ListComponentTypes(ctx, query)
+	require.NoError(t, err)
+	require.Len(t, componentTypes.ComponentTypeSummaries, 3)
+
+	// every page of every list is loaded once
+	require.Len(t, service.calls, 12)
+	for key, n := range service.calls {
+		require.Equal(t, 1, n, key)
+		require.True(t, strings.HasSuffix(key, ":") || strings.HasSuffix(key, ":page-2") || strings.HasSuffix(key, ":page-3"), key)
+	}
+}
+
 // This will write the results to local json file
 //
 //nolint:golint,unused
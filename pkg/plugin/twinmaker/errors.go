@@ -0,0 +1,152 @@
+package twinmaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// hints shown with common AWS error codes so users know where to look
+var awsErrorHints = map[string]string{
+	"AccessDeniedException":         "check the permissions of the IAM role configured in the datasource",
+	"AccessDenied":                  "check the permissions of the IAM role configured in the datasource",
+	"UnrecognizedClientException":   "check the AWS credentials configured in the datasource",
+	"InvalidClientTokenId":          "check the AWS credentials configured in the datasource",
+	"ExpiredTokenException":         "the AWS credentials have expired",
+	"ExpiredToken":                  "the AWS credentials have expired",
+	"ResourceNotFoundException":     "check that the workspace, entity and component exist",
+	"ValidationException":           "TwinMaker rejected the query parameters",
+	"ThrottlingException":           "too many requests, try again later or reduce the dashboard refresh rate",
+	"ServiceQuotaExceededException": "a TwinMaker service quota was exceeded",
+	"ConnectorFailureException":     "the data connector of the component failed",
+	"ConnectorTimeoutException":     "the data connector of the component timed out",
+	"InternalServerException":       "TwinMaker had an internal error, try again later",
+}
+
+// ErrQueryTimeout is returned when the query deadline passed before all pages were loaded
+var ErrQueryTimeout = fmt.Errorf("query timeout exceeded: %w", context.DeadlineExceeded)
+
+// PartialResultError is returned along with the pages loaded before a later page failed
+type PartialResultError struct {
+	Pages int
+	Err   error
+}
+
+func (e *PartialResultError) Error() string {
+	return fmt.Sprintf("stopped after %d pages: %s", e.Pages, MapAWSError(e.Err).Error())
+}
+
+func (e *PartialResultError) Unwrap() error {
+	return e.Err
+}
+
+// PartialWriteError is returned when a chunk of a write failed after the earlier chunks were written
+type PartialWriteError struct {
+	Written int
+	Total   int
+	// the error entries TwinMaker reported for the chunks that were written
+	Output *iottwinmaker.BatchPutPropertyValuesOutput
+	Err    error
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("wrote %d of %d entries: %s", e.Written, e.Total, MapAWSError(e.Err).Error())
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+// AWSError is a user-facing description of an error returned by AWS
+type AWSError struct {
+	Code    string
+	Message string
+	Hint    string
+	Err     error
+}
+
+func (e *AWSError) Error() string {
+	msg := fmt.Sprintf("AWS returned %s", e.Code)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Hint != "" {
+		msg += " (" + e.Hint + ")"
+	}
+	return msg
+}
+
+func (e *AWSError) Unwrap() error {
+	return e.Err
+}
+
+// MapAWSError converts smithy API errors into user-facing errors, and returns other errors unchanged
+func MapAWSError(err error) error {
+	var apiErr smithy.APIError
+	if err == nil || !errors.As(err, &apiErr) {
+		return err
+	}
+	var awsErr *AWSError
+	if errors.As(err, &awsErr) {
+		return err
+	}
+	return &AWSError{
+		Code:    apiErr.ErrorCode(),
+		Message: apiErr.ErrorMessage(),
+		Hint:    awsErrorHints[apiErr.ErrorCode()],
+		Err:     err,
+	}
+}
+
+// WithErrorSource maps the response error to a user-facing message and sets who caused it:
+// invalid queries and AWS failures are downstream errors, anything else is a plugin error
+func WithErrorSource(dr backend.DataResponse) backend.DataResponse {
+	if dr.Error == nil || dr.ErrorSource != "" {
+		return dr
+	}
+
+	var respErr *smithyhttp.ResponseError
+	var workspaceErr *models.WorkspaceNotAllowedError
+	var s3Err *S3Error
+	switch {
+	case models.IsValidationError(dr.Error):
+		dr.ErrorSource = backend.ErrorSourceDownstream
+		dr.Status = backend.StatusValidationFailed
+	case errors.As(dr.Error, &workspaceErr):
+		dr.ErrorSource = backend.ErrorSourceDownstream
+		dr.Status = backend.StatusForbidden
+	case errors.As(dr.Error, &s3Err):
+		dr.ErrorSource = backend.ErrorSourceDownstream
+		dr.Status = backend.Status(s3Err.StatusCode)
+	case errors.As(dr.Error, &respErr):
+		dr.Error = MapAWSError(dr.Error)
+		dr.ErrorSource = backend.ErrorSourceDownstream
+		dr.Status = backend.Status(respErr.HTTPStatusCode())
+	case isAPIError(dr.Error):
+		dr.Error = MapAWSError(dr.Error)
+		dr.ErrorSource = backend.ErrorSourceDownstream
+	case errors.Is(dr.Error, context.DeadlineExceeded):
+		dr.ErrorSource = backend.ErrorSourceDownstream
+		dr.Status = backend.StatusTimeout
+	case backend.IsDownstreamError(dr.Error):
+		dr.ErrorSource = backend.ErrorSourceDownstream
+	default:
+		dr.ErrorSource = backend.ErrorSourcePlugin
+		if dr.Status == 0 {
+			dr.Status = backend.StatusInternal
+		}
+	}
+	return dr
+}
+
+func isAPIError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr)
+}
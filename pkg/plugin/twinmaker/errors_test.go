@@ -0,0 +1,33 @@
+package twinmaker
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithErrorSource(t *testing.T) {
+	t.Run("validation errors are downstream", func(t *testing.T) {
+		dr := WithErrorSource(backend.DataResponse{Error: models.MissingFieldError("entityId")})
+		require.Equal(t, backend.ErrorSourceDownstream, dr.ErrorSource)
+		require.Equal(t, backend.StatusValidationFailed, dr.Status)
+		require.EqualError(t, dr.Error, "invalid query: entityId: is required")
+	})
+
+	t.Run("aws errors are mapped", func(t *testing.T) {
+		apiErr := &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized"}
+		dr := WithErrorSource(backend.DataResponse{Error: fmt.Errorf("operation error: %w", apiErr)})
+		require.Equal(t, backend.ErrorSourceDownstream, dr.ErrorSource)
+		require.EqualError(t, dr.Error, "AWS returned AccessDeniedException: not authorized (check the permissions of the IAM role configured in the datasource)")
+		require.ErrorIs(t, dr.Error, apiErr)
+	})
+
+	t.Run("other errors are plugin errors", func(t *testing.T) {
+		dr := WithErrorSource(backend.DataResponse{Error: fmt.Errorf("error loading entities")})
+		require.Equal(t, backend.ErrorSourcePlugin, dr.ErrorSource)
+	})
+}
@@ -1,7 +1,8 @@
 package twinmaker
 
 import (
-	"fmt"
+	"strconv"
+
 	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
 
 	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
@@ -81,9 +82,10 @@ func newDataValueField(v *iottwinmakertypes.DataValue, count int) (*data.Field,
 		return f, c
 	}
 
-	f := data.NewFieldFromFieldType(data.FieldTypeString, count)
+	// lists, maps, relationships and expressions
+	f := data.NewFieldFromFieldType(data.FieldTypeNullableJSON, count)
 	c := func(v *iottwinmakertypes.DataValue) interface{} {
-		return fmt.Sprintf("%v", v)
+		return dataValueRawJSON(v)
 	}
 	return f, c
 }
@@ -93,6 +95,96 @@ func (r *twinMakerFrameBuilder) Value(v *iottwinmakertypes.DataValue) (*data.Fie
 	return r.add(f, data.TimeSeriesValueFieldName), c
 }
 
+// grafana units for the common units of measure, anything else is shown as a suffix
+var grafanaUnits = map[string]string{
+	"%":          "percent",
+	"percent":    "percent",
+	"°C":         "celsius",
+	"C":          "celsius",
+	"celsius":    "celsius",
+	"°F":         "fahrenheit",
+	"F":          "fahrenheit",
+	"fahrenheit": "fahrenheit",
+	"K":          "kelvin",
+	"rpm":        "rotrpm",
+	"Hz":         "hertz",
+	"W":          "watt",
+	"kW":         "kwatt",
+	"kWh":        "kwatth",
+	"V":          "volt",
+	"A":          "amp",
+	"bar":        "pressurebar",
+	"psi":        "pressurepsi",
+	"Pa":         "pressurepa",
+	"kPa":        "pressurekpa",
+	"m":          "lengthm",
+	"mm":         "lengthmm",
+	"kg":         "masskg",
+	"ms":         "ms",
+	"s":          "s",
+	"m/s":        "velocityms",
+	"km/h":       "velocitykmh",
+}
+
+func grafanaUnit(unit string) string {
+	if u, ok := grafanaUnits[unit]; ok {
+		return u
+	}
+	return "suffix:" + unit
+}
+
+// setPropertyConfig describes a value field with its property definition: the unit, and the min and
+// max from the definition configuration.  The display name is only set when the query does not
+// rename the property already.  Allowed values have no display names, so they are not mapped.
+func setPropertyConfig(f *data.Field, def *iottwinmakertypes.PropertyDefinitionResponse, displayName bool) {
+	if def == nil {
+		return
+	}
+	config := f.Config
+	if config == nil {
+		config = &data.FieldConfig{}
+	}
+	set := false
+	if displayName && def.DisplayName != nil && *def.DisplayName != "" {
+		config.DisplayNameFromDS = *def.DisplayName
+		set = true
+	}
+	if dt := def.DataType; dt != nil {
+		if dt.UnitOfMeasure != nil && *dt.UnitOfMeasure != "" {
+			config.Unit = grafanaUnit(*dt.UnitOfMeasure)
+			set = true
+		}
+	}
+	if v, err := strconv.ParseFloat(def.Configuration["min"], 64); err == nil {
+		config.SetMin(v)
+		set = true
+	}
+	if v, err := strconv.ParseFloat(def.Configuration["max"], 64); err == nil {
+		config.SetMax(v)
+		set = true
+	}
+	if set {
+		f.Config = config
+	}
+}
+
+// dataValueText is the value as text
+func dataValueText(v *iottwinmakertypes.DataValue) (string, bool) {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue, true
+	case v.BooleanValue != nil:
+		return strconv.FormatBool(*v.BooleanValue), true
+	case v.IntegerValue != nil:
+		return strconv.FormatInt(int64(*v.IntegerValue), 10), true
+	case v.LongValue != nil:
+		return strconv.FormatInt(*v.LongValue, 10), true
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(*v.DoubleValue, 'f', -1, 64), true
+	}
+	return "", false
+}
+
 func (r *twinMakerFrameBuilder) ARN() *data.Field {
 	f := data.NewFieldFromFieldType(data.FieldTypeNullableString, r.len)
 	return r.add(f, "arn")
@@ -103,6 +195,27 @@ func (r *twinMakerFrameBuilder) CreationDate() *data.Field {
 	return r.add(f, "created")
 }
 
+func (r *twinMakerFrameBuilder) UpdateDate() *data.Field {
+	f := data.NewFieldFromFieldType(data.FieldTypeNullableTime, r.len)
+	return r.add(f, "updated")
+}
+
+func (r *twinMakerFrameBuilder) ContentLocation() *data.Field {
+	f := data.NewFieldFromFieldType(data.FieldTypeNullableString, r.len)
+	return r.add(f, "contentLocation")
+}
+
+func (r *twinMakerFrameBuilder) Capabilities() *data.Field {
+	f := data.NewFieldFromFieldType(data.FieldTypeNullableString, r.len)
+	return r.add(f, "capabilities")
+}
+
+// Count adds a nullable count, null when it could not be loaded
+func (r *twinMakerFrameBuilder) Count(name string) *data.Field {
+	f := data.NewFieldFromFieldType(data.FieldTypeNullableInt64, r.len)
+	return r.add(f, name)
+}
+
 func (r *twinMakerFrameBuilder) Description() *data.Field {
 	f := data.NewFieldFromFieldType(data.FieldTypeNullableString, r.len)
 	return r.add(f, "description")
@@ -190,6 +303,21 @@ func (r *twinMakerFrameBuilder) AlarmStatus() *data.Field {
 	return r.add(f, "alarmStatus")
 }
 
+func (r *twinMakerFrameBuilder) VideoState() *data.Field {
+	f := data.NewFieldFromFieldType(data.FieldTypeString, r.len)
+	f.Config = &data.FieldConfig{
+		DisplayName: "Video",
+		Mappings: data.ValueMappings{
+			data.ValueMapper{
+				string(models.VideoAvailable): {Color: "green", Index: 0, Text: "Available"},
+				string(models.VideoOnEdge):    {Color: "orange", Index: 1, Text: "On edge device"},
+				string(models.VideoMissing):   {Color: "transparent", Index: 2, Text: "No video"},
+			},
+		},
+	}
+	return r.add(f, "state")
+}
+
 // // CreationDate is a required field
 // CreationDate *time.Time `locationName:"creationDate" type:"timestamp" required:"true"`
 
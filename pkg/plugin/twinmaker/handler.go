@@ -6,9 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/aws/smithy-go"
+	"slices"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
 	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
 	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
@@ -21,19 +25,21 @@ import (
 
 // TwinMakerHandler uses a client to create grafana response objects
 type TwinMakerHandler interface {
-	GetSessionToken(ctx context.Context, duration time.Duration, workspaceId string) (models.TokenInfo, error)
-	GetWriteSessionToken(ctx context.Context, duration time.Duration, workspaceId string) (models.TokenInfo, error)
+	GetSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (models.TokenInfo, error)
+	GetWriteSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (models.TokenInfo, error)
 	ListWorkspaces(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse
 	ListScenes(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse
 	ListEntities(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse
 	ListComponentTypes(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse
 	GetEntity(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse
 	GetPropertyValue(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse
+	GetSceneBindings(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse
 
 	// These APIs do not exist in TwinMaker, but are simple constructions
 	GetComponentHistory(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse
 	GetEntityHistory(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse
 	GetAlarms(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse
+	GetVideoAvailability(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse
 }
 
 type twinMakerHandler struct {
@@ -48,6 +54,7 @@ func NewTwinMakerHandler(client TwinMakerClient) TwinMakerHandler {
 
 func (s *twinMakerHandler) ListWorkspaces(ctx context.Context, query models.TwinMakerQuery) (dr backend.DataResponse) {
 	results, err := s.client.ListWorkspaces(ctx, query)
+	notices, err := limitNotice(err)
 	dr.Error = err
 	if err != nil {
 		return
@@ -73,12 +80,14 @@ func (s *twinMakerHandler) ListWorkspaces(ctx context.Context, query models.Twin
 	}
 
 	frame := fields.ToFrame("", results.NextToken)
+	frame.AppendNotices(notices...)
 	dr.Frames = data.Frames{frame}
 	return
 }
 
 func (s *twinMakerHandler) ListScenes(ctx context.Context, query models.TwinMakerQuery) (dr backend.DataResponse) {
 	results, err := s.client.ListScenes(ctx, query)
+	notices, err := limitNotice(err)
 	dr.Error = err
 	if err != nil {
 		return
@@ -95,21 +104,127 @@ func (s *twinMakerHandler) ListScenes(ctx context.Context, query models.TwinMake
 	created := fields.CreationDate()
 	description := fields.Description()
 	sceneId := fields.SceneId()
+	updated := fields.UpdateDate()
+	name := fields.Name()
+	contentLocation := fields.ContentLocation()
 
 	for i, summary := range results.SceneSummaries {
 		arn.Set(i, summary.Arn)
 		created.Set(i, *summary.CreationDateTime)
 		description.Set(i, summary.Description)
 		sceneId.Set(i, summary.SceneId)
+		updated.Set(i, summary.UpdateDateTime)
+		name.Set(i, summary.SceneId)
+		contentLocation.Set(i, summary.ContentLocation)
+	}
+
+	if query.SceneDetails {
+		capabilities := fields.Capabilities()
+		nodes := fields.Count("nodes")
+		boundEntities := fields.Count("boundEntities")
+
+		details, failed := s.loadSceneDetails(ctx, query, results.SceneSummaries)
+		for i, d := range details {
+			if d.scene != nil {
+				capabilities.Set(i, aws.String(strings.Join(d.scene.Capabilities, ",")))
+				if n, ok := d.scene.SceneMetadata[sceneNameMetadataKey]; ok && n != "" {
+					name.Set(i, aws.String(n))
+				}
+			}
+			if d.doc != nil {
+				nodes.Set(i, aws.Int64(int64(len(d.doc.Nodes))))
+				boundEntities.Set(i, aws.Int64(int64(countBoundEntities(d.doc))))
+			}
+		}
+		if failed != nil {
+			notices = append(notices, *failed)
+		}
 	}
 
 	frame := fields.ToFrame("", results.NextToken)
+	frame.AppendNotices(notices...)
 	dr.Frames = data.Frames{frame}
 	return
 }
 
+// scene metadata key shown as the scene name, scenes without it are named by their id
+const sceneNameMetadataKey = "name"
+
+// number of scenes loaded at once for ListScenes details
+const sceneDetailsConcurrency = 8
+
+type sceneDetails struct {
+	scene *iottwinmaker.GetSceneOutput
+	doc   *models.SceneDocument
+}
+
+// loadSceneDetails gets the settings and document of every scene, through the caching client so a
+// refresh does not load every scene again.  Scenes that fail to load keep empty details, and are
+// reported in a single notice.
+func (s *twinMakerHandler) loadSceneDetails(ctx context.Context, query models.TwinMakerQuery, summaries []iottwinmakertypes.SceneSummary) ([]sceneDetails, *data.Notice) {
+	details := make([]sceneDetails, len(summaries))
+	errs := make([]error, len(summaries))
+
+	wg := sync.WaitGroup{}
+	sem := make(chan struct{}, sceneDetailsConcurrency)
+	for i, summary := range summaries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			q := query
+			q.SceneId = aws.ToString(summary.SceneId)
+			scene, err := s.client.GetScene(ctx, q)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			details[i].scene = scene
+			b, err := s.client.GetS3Object(ctx, query.WorkspaceId, aws.ToString(scene.ContentLocation))
+			if err == nil {
+				details[i].doc, err = models.ParseSceneDocument(b)
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	failed := []string{}
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s)", aws.ToString(summaries[i].SceneId), MapAWSError(err).Error()))
+		}
+	}
+	if len(failed) == 0 {
+		return details, nil
+	}
+	return details, &data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     fmt.Sprintf("details could not be loaded for %d scenes: %s", len(failed), strings.Join(failed, "; ")),
+	}
+}
+
+// countBoundEntities counts the distinct entities bound anywhere in the scene
+func countBoundEntities(doc *models.SceneDocument) int {
+	entities := make(map[string]bool)
+	for _, node := range doc.Nodes {
+		for _, c := range node.Components {
+			for _, b := range c.Bindings {
+				if b.EntityId != "" {
+					entities[b.EntityId] = true
+				}
+			}
+		}
+	}
+	return len(entities)
+}
+
 func (s *twinMakerHandler) ListEntities(ctx context.Context, query models.TwinMakerQuery) (dr backend.DataResponse) {
 	results, err := s.client.ListEntities(ctx, query)
+	notices, err := limitNotice(err)
 	dr.Error = err
 	if err != nil {
 		return
@@ -137,12 +252,14 @@ func (s *twinMakerHandler) ListEntities(ctx context.Context, query models.TwinMa
 	}
 
 	frame := fields.ToFrame("", results.NextToken)
+	frame.AppendNotices(notices...)
 	dr.Frames = data.Frames{frame}
 	return
 }
 
 func (s *twinMakerHandler) ListComponentTypes(ctx context.Context, query models.TwinMakerQuery) (dr backend.DataResponse) {
 	results, err := s.client.ListComponentTypes(ctx, query)
+	notices, err := limitNotice(err)
 	dr.Error = err
 	if err != nil {
 		return
@@ -168,6 +285,7 @@ func (s *twinMakerHandler) ListComponentTypes(ctx context.Context, query models.
 	}
 
 	frame := fields.ToFrame("", results.NextToken)
+	frame.AppendNotices(notices...)
 	dr.Frames = data.Frames{frame}
 	return
 }
@@ -236,8 +354,76 @@ func (s *twinMakerHandler) GetEntity(ctx context.Context, query models.TwinMaker
 	return
 }
 
+// GetSceneBindings returns the nodes of the scene document, and every data binding along with the tags missing one
+func (s *twinMakerHandler) GetSceneBindings(ctx context.Context, query models.TwinMakerQuery) (dr backend.DataResponse) {
+	doc, err := s.client.GetSceneDocument(ctx, query)
+	dr.Error = err
+	if err != nil {
+		return
+	}
+	scene, err := models.ParseSceneDocument(doc)
+	if err != nil {
+		dr.Error = backend.DownstreamError(err)
+		return
+	}
+
+	nodeIndex := data.NewFieldFromFieldType(data.FieldTypeInt64, len(scene.Nodes))
+	nodeIndex.Name = "node"
+	nodeName := data.NewFieldFromFieldType(data.FieldTypeString, len(scene.Nodes))
+	nodeName.Name = "name"
+	nodePath := data.NewFieldFromFieldType(data.FieldTypeString, len(scene.Nodes))
+	nodePath.Name = "path"
+	nodeParent := data.NewFieldFromFieldType(data.FieldTypeNullableInt64, len(scene.Nodes))
+	nodeParent.Name = "parent"
+	nodeComponents := data.NewFieldFromFieldType(data.FieldTypeString, len(scene.Nodes))
+	nodeComponents.Name = "components"
+	nodeModel := data.NewFieldFromFieldType(data.FieldTypeNullableString, len(scene.Nodes))
+	nodeModel.Name = "modelUri"
+
+	bindings := data.NewFrame("bindings",
+		data.NewField("node", nil, []int64{}),
+		data.NewField("nodePath", nil, []string{}),
+		data.NewField("componentType", nil, []string{}),
+		data.NewField("binding", nil, []string{}),
+		data.NewField("entityId", nil, []string{}),
+		data.NewField("componentName", nil, []string{}),
+		data.NewField("propertyName", nil, []string{}),
+		data.NewField("ruleBasedMapId", nil, []string{}),
+		data.NewField("bound", nil, []bool{}),
+	)
+
+	for i, node := range scene.Nodes {
+		nodeIndex.Set(i, int64(node.Index))
+		nodeName.Set(i, node.Name)
+		nodePath.Set(i, node.Path)
+		if node.Parent != nil {
+			nodeParent.Set(i, aws.Int64(int64(*node.Parent)))
+		}
+		types := make([]string, 0, len(node.Components))
+		for _, c := range node.Components {
+			types = append(types, c.Type)
+			if c.Type == models.SceneComponentModelRef && c.URI != "" {
+				nodeModel.Set(i, aws.String(c.URI))
+			}
+			for _, b := range c.Bindings {
+				bindings.AppendRow(int64(node.Index), node.Path, c.Type, b.Path, b.EntityId, b.ComponentName, b.PropertyName, b.RuleBasedMapId, b.PropertyName != "")
+			}
+			// tags without a binding show no live data, so they are listed too
+			if c.Type == models.SceneComponentTag && len(c.Bindings) == 0 {
+				bindings.AppendRow(int64(node.Index), node.Path, c.Type, "", "", "", "", c.RuleBasedMapId, false)
+			}
+		}
+		nodeComponents.Set(i, strings.Join(types, ","))
+	}
+
+	nodes := data.NewFrame("nodes", nodeIndex, nodeName, nodePath, nodeParent, nodeComponents, nodeModel)
+	dr.Frames = data.Frames{nodes, bindings}
+	return
+}
+
 func (s *twinMakerHandler) GetPropertyValue(ctx context.Context, query models.TwinMakerQuery) (dr backend.DataResponse) {
 	results, err := s.client.GetPropertyValue(ctx, query)
+	notices, err := limitNotice(err)
 	dr.Error = err
 	if err != nil {
 		return
@@ -249,6 +435,7 @@ func (s *twinMakerHandler) GetPropertyValue(ctx context.Context, query models.Tw
 	}
 
 	frame := data.NewFrame("")
+	defs := s.propertyDefinitions(ctx, query)
 
 	if len(results.PropertyValues) > 0 {
 		propValues := make([]string, 0, len(results.PropertyValues))
@@ -264,123 +451,158 @@ func (s *twinMakerHandler) GetPropertyValue(ctx context.Context, query models.Tw
 				continue
 			}
 			if v := prop.PropertyValue.ListValue; v != nil {
-				fr := s.processListValue(v, propVal)
+				fr := s.processListValue(v, propVal, query.NestedDepth())
 				frame.Fields = append(frame.Fields, fr.Fields...)
 				continue
 			}
 			if v := prop.PropertyValue.MapValue; v != nil {
-				fr := s.processMapValue(v)
+				fr := s.processMapValue(v, query.NestedDepth())
 				frame.Fields = append(frame.Fields, fr.Fields...)
 				continue
 			}
-			f, converter := newDataValueField(prop.PropertyValue, 1)
-			f.Set(0, converter(prop.PropertyValue))
-
-			if prop.PropertyReference.PropertyName != nil {
-				f.Name = *prop.PropertyReference.PropertyName
-				var name, ok = query.PropertyDisplayNames[*prop.PropertyReference.PropertyName]
-				if ok {
-					f.Name = name
+			// relationships and nested maps may be flattened into several fields
+			fields := flattenValues([]*iottwinmakertypes.DataValue{prop.PropertyValue}, query.NestedDepth())
+			for _, f := range fields {
+				if prop.PropertyReference.PropertyName != nil {
+					var name, ok = query.PropertyDisplayNames[*prop.PropertyReference.PropertyName]
+					if !ok {
+						name = *prop.PropertyReference.PropertyName
+					}
+					if def, found := defs[*prop.PropertyReference.PropertyName]; found && len(fields) == 1 {
+						setPropertyConfig(f, &def, !ok)
+					}
+					f.Name = nestedName(name, f.Name)
 				}
-			}
 
-			f.Labels = data.Labels{
-				"entityId":      *prop.PropertyReference.EntityId,
-				"componentName": *prop.PropertyReference.ComponentName,
-				"propertyName":  *prop.PropertyReference.PropertyName,
+				f.Labels = data.Labels{
+					"entityId":      *prop.PropertyReference.EntityId,
+					"componentName": *prop.PropertyReference.ComponentName,
+					"propertyName":  *prop.PropertyReference.PropertyName,
+				}
+				frame.Fields = append(frame.Fields, f)
 			}
-			frame.Fields = append(frame.Fields, f)
 		}
-	} else if len(results.TabularPropertyValues) > 0 && len(results.TabularPropertyValues[0]) > 0 {
-		tabularValuesList := results.TabularPropertyValues[0]
-		fieldsList := make([]*data.Field, 0, len(tabularValuesList[0]))
-		converterList := make([]func(v *iottwinmakertypes.DataValue) interface{}, 0, len(tabularValuesList[0]))
-
-		for valIdx, propList := range tabularValuesList {
-			keys := make([]string, 0, len(propList))
-			for k := range propList {
-				keys = append(keys, k)
+	} else if countTabularRows(results.TabularPropertyValues) > 0 {
+		var columns []string
+		if query.MaxResults > 0 && query.GrafanaLiveEnabled {
+			columns = s.propertyGroupColumns(ctx, query)
+		}
+		fields, notice := tabularFields(results.TabularPropertyValues, defs, columns)
+		if notice != nil {
+			notices = append(notices, *notice)
+		}
+		for _, f := range fields {
+			f.Labels = data.Labels{
+				"entityId":      query.EntityId,
+				"componentName": query.ComponentName,
+				"propertyName":  f.Name,
 			}
-			sort.Strings(keys)
-			for propIdx, propName := range keys {
-				propVal := propList[propName]
-				// First iteration initialize the fields
-				if valIdx == 0 {
-					f, converter := newDataValueField(&propVal, len(tabularValuesList))
-					f.Name = propName
-					f.Labels = data.Labels{
-						"entityId":      query.EntityId,
-						"componentName": query.ComponentName,
-						"propertyName":  propName,
-					}
-					fieldsList = append(fieldsList, f)
-					converterList = append(converterList, converter)
-					frame.Fields = append(frame.Fields, f)
-				}
-				// Save the property value in the respective field
-				fieldsList[propIdx].Set(valIdx, converterList[propIdx](&propVal))
+			if def, found := defs[f.Name]; found {
+				setPropertyConfig(f, &def, true)
 			}
+			frame.Fields = append(frame.Fields, f)
 		}
 	}
 
+	if results.NextToken != nil {
+		frame.SetMeta(&data.FrameMeta{Custom: models.TwinMakerCustomMeta{NextToken: *results.NextToken}})
+	}
+	if len(notices) > 0 {
+		frame.AppendNotices(notices...)
+	}
 	dr.Frames = append(dr.Frames, frame)
 	return
 }
 
-func (s *twinMakerHandler) processListValue(v []iottwinmakertypes.DataValue, propVal string) *data.Frame {
-	fields := newTwinMakerFrameBuilder(len(v))
-
-	valField, valConvertor := fields.Value(&v[0])
-	valField.Name = propVal
-
-	isUrl := false
-	for i, value := range v {
-		valField.Set(i, valConvertor(&value))
-		if !isUrl {
-			isUrl = checkForUrl(&value, valConvertor)
-		}
+func (s *twinMakerHandler) processListValue(v []iottwinmakertypes.DataValue, propVal string, depth int) *data.Frame {
+	values := make([]*iottwinmakertypes.DataValue, len(v))
+	for i := range v {
+		values[i] = &v[i]
 	}
 
-	if isUrl {
-		setUrlDatalink(valField)
+	fields := newTwinMakerFrameBuilder(len(v))
+	for _, f := range flattenValues(values, depth) {
+		fields.add(f, nestedName(propVal, f.Name))
+		if fieldHasUrl(f) {
+			setUrlDatalink(f)
+		}
 	}
 
 	frame := fields.ToFrame("", nil)
 	return frame
 }
 
-func (s *twinMakerHandler) processMapValue(v map[string]iottwinmakertypes.DataValue) *data.Frame {
+func (s *twinMakerHandler) processMapValue(v map[string]iottwinmakertypes.DataValue, depth int) *data.Frame {
 	keys := make([]string, 0, len(v))
 	for k := range v {
 		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
 	fields := newTwinMakerFrameBuilder(len(v))
 
 	keyField := fields.Name()
 	keyField.Name = "Key"
-	valField, valConvertor := fields.Value(Pointer(v[keys[0]]))
-	valField.Name = "Value"
-
-	isUrl := false
-	sort.Strings(keys)
+	values := make([]*iottwinmakertypes.DataValue, len(keys))
 	for i, k := range keys {
 		keyField.Set(i, &keys[i])
-		valField.Set(i, valConvertor(Pointer(v[k])))
-		if !isUrl {
-			isUrl = checkForUrl(Pointer(v[k]), valConvertor)
-		}
+		values[i] = Pointer(v[k])
 	}
 
-	if isUrl {
-		setUrlDatalink(valField)
+	for _, f := range flattenValues(values, depth) {
+		fields.add(f, nestedName("Value", f.Name))
+		if fieldHasUrl(f) {
+			setUrlDatalink(f)
+		}
 	}
 
 	frame := fields.ToFrame("", nil)
 	return frame
 }
 
-func (s *twinMakerHandler) processHistory(results *iottwinmaker.GetPropertyValueHistoryOutput, err error, failures []data.Notice, query models.TwinMakerQuery) (dr backend.DataResponse) {
+// propertyDefinitions loads the definitions of the queried properties, from the entity component when
+// one is queried, or else from the component type.  Values are still shown without them, so a failed
+// lookup only leaves the field config empty.
+func (s *twinMakerHandler) propertyDefinitions(ctx context.Context, query models.TwinMakerQuery) map[string]iottwinmakertypes.PropertyDefinitionResponse {
+	defs := map[string]iottwinmakertypes.PropertyDefinitionResponse{}
+	// only the ids are set, so the caching client shares the definitions between queries
+	switch {
+	case query.EntityId != "" && query.ComponentName != "":
+		entity, err := s.client.GetEntity(ctx, models.TwinMakerQuery{WorkspaceId: query.WorkspaceId, EntityId: query.EntityId})
+		if err != nil || entity == nil {
+			return defs
+		}
+		for name, p := range entity.Components[query.ComponentName].Properties {
+			if p.Definition != nil {
+				defs[name] = *p.Definition
+			}
+		}
+	case query.ComponentTypeId != "":
+		ct, err := s.client.GetComponentType(ctx, models.TwinMakerQuery{WorkspaceId: query.WorkspaceId, ComponentTypeId: query.ComponentTypeId})
+		if err == nil && ct != nil && ct.PropertyDefinitions != nil {
+			defs = ct.PropertyDefinitions
+		}
+	}
+	return defs
+}
+
+// propertyGroupColumns are the selected properties of the queried property group, in name order.  The
+// property group is read from the entity, and when it can not be found the selected properties are used.
+func (s *twinMakerHandler) propertyGroupColumns(ctx context.Context, query models.TwinMakerQuery) []string {
+	columns := slices.Clone(query.Properties)
+	entity, err := s.client.GetEntity(ctx, models.TwinMakerQuery{WorkspaceId: query.WorkspaceId, EntityId: query.EntityId})
+	if err == nil && entity != nil {
+		if group, ok := entity.Components[query.ComponentName].PropertyGroups[query.PropertyGroupName]; ok {
+			columns = slices.DeleteFunc(slices.Clone(group.PropertyNames), func(name string) bool {
+				return len(query.Properties) > 0 && !slices.Contains(query.Properties, name)
+			})
+		}
+	}
+	sort.Strings(columns)
+	return slices.Compact(columns)
+}
+
+func (s *twinMakerHandler) processHistory(results *iottwinmaker.GetPropertyValueHistoryOutput, err error, failures []data.Notice, query models.TwinMakerQuery, defs map[string]iottwinmakertypes.PropertyDefinitionResponse) (dr backend.DataResponse) {
 	dr.Error = err
 	if err != nil {
 		return
@@ -391,70 +613,137 @@ func (s *twinMakerHandler) processHistory(results *iottwinmaker.GetPropertyValue
 		return
 	}
 
+	groups := query.ClientFilterGroups()
+	// notices of the series without a single readable value
+	dropped := []data.Notice{}
 	for _, prop := range results.PropertyValues {
-		if len(prop.Values) == 0 {
+		values := prop.Values
+		if len(groups) > 0 && prop.EntityPropertyReference != nil && prop.EntityPropertyReference.PropertyName != nil {
+			values = filterHistoryValues(values, groups, *prop.EntityPropertyReference.PropertyName)
+		}
+		if len(values) == 0 {
 			continue
 		}
-		fields := newTwinMakerFrameBuilder(len(prop.Values))
-		// Must return value field first so its labels can be used for the Time field
-		v, conv := fields.Value(prop.Values[0].Value) // cspell:disable-line
-		t := fields.Time()
-		v.Name = "" // filled in with value below
-		for i, history := range prop.Values {
-			if timeValue, err := getTimeObjectFromStringTime(history.Time); err == nil {
-				t.Set(i, timeValue)
-				v.Set(i, conv(history.Value)) // cspell:disable-line
-			} else {
-				dr.Error = fmt.Errorf("error parsing timestamp while loading propertyValueHistory")
+		// Values with a timestamp that can not be read are dropped, so the rest can still be shown
+		times := make([]*time.Time, 0, len(values))
+		rows := make([]*iottwinmakertypes.DataValue, 0, len(values))
+		timeErrs := []string{}
+		skipped := 0
+		for _, history := range values {
+			timeValue, err := propertyValueTime(history)
+			if err != nil {
+				if !slices.Contains(timeErrs, err.Error()) {
+					timeErrs = append(timeErrs, err.Error())
+				}
+				skipped++
+				continue
 			}
+			times = append(times, timeValue)
+			rows = append(rows, history.Value)
 		}
 
 		ref := prop.EntityPropertyReference
-		v.Labels = data.Labels{}
+		labels := data.Labels{}
+		name, renamed := "", false
 		if ref.ComponentName != nil {
-			v.Labels["componentName"] = *ref.ComponentName
+			labels["componentName"] = *ref.ComponentName
 		}
 		if ref.EntityId != nil {
-			v.Labels["entityId"] = *ref.EntityId
+			labels["entityId"] = *ref.EntityId
 		}
 		if ref.PropertyName != nil {
-			v.Name = *ref.PropertyName
-			v.Labels["propertyName"] = *ref.PropertyName
-			if ref.PropertyName != nil {
-				v.Name = *ref.PropertyName
-				var name, ok = query.PropertyDisplayNames[*ref.PropertyName]
-				if ok {
-					v.Name = name
-				}
+			labels["propertyName"] = *ref.PropertyName
+			if name, renamed = query.PropertyDisplayNames[*ref.PropertyName]; !renamed {
+				name = *ref.PropertyName
 			}
 		}
 		if ref.ComponentName == nil || ref.EntityId == nil {
-			v.Labels["componentTypeId"] = query.ComponentTypeId
+			labels["componentTypeId"] = query.ComponentTypeId
 			for key, val := range ref.ExternalIdProperty {
 				if key == "propertyName" {
 					continue
 				}
-				v.Labels[key] = val
+				labels[key] = val
+			}
+		}
+
+		if len(rows) == 0 {
+			// no value could be read, so there is no value field to build the frame with
+			dropped = append(dropped, skippedValuesNotice(name, skipped, timeErrs))
+			continue
+		}
+
+		fields := newTwinMakerFrameBuilder(len(rows))
+		// Must add the value fields first so their labels can be used for the Time field
+		valueFields := flattenValues(rows, query.NestedDepth())
+		for _, v := range valueFields {
+			if def, found := defs[aws.ToString(ref.PropertyName)]; found && len(valueFields) == 1 {
+				setPropertyConfig(v, &def, !renamed)
 			}
+			fields.add(v, nestedName(name, v.Name))
+			v.Labels = labels.Copy()
+		}
+		t := fields.Time()
+		for i, timeValue := range times {
+			t.Set(i, timeValue)
 		}
 
 		frame := fields.ToFrame("", results.NextToken)
 		frame.AppendNotices(failures...)
+		if skipped > 0 {
+			frame.AppendNotices(skippedValuesNotice(name, skipped, timeErrs))
+		}
 		dr.Frames = append(dr.Frames, frame)
 	}
+	if len(dropped) > 0 {
+		if len(dr.Frames) == 0 {
+			frame := data.NewFrame("")
+			frame.AppendNotices(failures...)
+			dr.Frames = append(dr.Frames, frame)
+		}
+		dr.Frames[0].AppendNotices(dropped...)
+	}
 	return
 }
 
+// at most this many distinct errors are listed for the values skipped in a series
+const maxSkippedValueErrors = 3
+
+// skippedValuesNotice reports the values of the property whose time could not be read, with one
+// example of each distinct error
+func skippedValuesNotice(name string, skipped int, errs []string) data.Notice {
+	text := fmt.Sprintf("skipped %d values of %s: ", skipped, name)
+	if len(errs) > maxSkippedValueErrors {
+		text += strings.Join(errs[:maxSkippedValueErrors], "; ") + fmt.Sprintf(" and %d more errors", len(errs)-maxSkippedValueErrors)
+	} else {
+		text += strings.Join(errs, "; ")
+	}
+	return data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     text,
+	}
+}
+
 func (s *twinMakerHandler) GetComponentHistory(ctx context.Context, query models.TwinMakerQuery) (dr backend.DataResponse) {
 	if query.ComponentTypeId == "" {
 		return backend.DataResponse{
-			Error: fmt.Errorf("missing component parameter"),
+			Error: models.MissingFieldError("componentTypeId"),
+		}
+	}
+
+	failures := []data.Notice{}
+	if query.SiteWise != nil {
+		result, notices, err := s.siteWiseComponentHistory(ctx, query)
+		if result != nil || err != nil {
+			return s.processHistory(result, err, notices, query, s.propertyDefinitions(ctx, query))
 		}
+		failures = append(failures, notices...)
 	}
 
-	propertyReferences, failures, err := s.GetComponentHistoryWithLookup(ctx, query)
+	propertyReferences, notices, nextToken, err := s.GetComponentHistoryWithLookup(ctx, query)
+	failures = append(failures, notices...)
 	result := &iottwinmaker.GetPropertyValueHistoryOutput{
-		NextToken:      nil,
+		NextToken:      nextToken,
 		PropertyValues: []iottwinmakertypes.PropertyValueHistory{},
 	}
 
@@ -467,18 +756,25 @@ func (s *twinMakerHandler) GetComponentHistory(ctx context.Context, query models
 	}
 
 	// Return dataFrame with the history results and entityId and componentName
-	return s.processHistory(result, err, failures, query)
+	return s.processHistory(result, err, failures, query, s.propertyDefinitions(ctx, query))
 }
 
 func (s *twinMakerHandler) GetEntityHistory(ctx context.Context, query models.TwinMakerQuery) backend.DataResponse {
 	if query.EntityId == "" {
 		return backend.DataResponse{
-			Error: fmt.Errorf("missing entity parameter"),
+			Error: models.MissingFieldError("entityId"),
 		}
 	}
-	result, err := s.client.GetPropertyValueHistory(ctx, query)
 	failures := []data.Notice{}
-	return s.processHistory(result, err, failures, query)
+	if query.SiteWise != nil {
+		result, notices, err := s.siteWiseEntityHistory(ctx, query)
+		if result != nil || err != nil {
+			return s.processHistory(result, err, notices, query, s.propertyDefinitions(ctx, query))
+		}
+		failures = append(failures, notices...)
+	}
+	result, err := s.client.GetPropertyValueHistory(ctx, query)
+	return s.processHistory(result, err, failures, query, s.propertyDefinitions(ctx, query))
 }
 
 // Variation of GetComponentHistory for all alarm components that extend from the basic componentType
@@ -543,24 +839,42 @@ func (s *twinMakerHandler) GetAlarms(ctx context.Context, query models.TwinMaker
 
 	// Get the propertyValueHistory associated with all componentTypes from above
 	var pValues []PropertyReference
+	var nextToken *string
 
+	// a continued query starts again at the component type it stopped in
+	resumeType, resumeToken := splitAlarmToken(query.NextToken)
 	for _, componentTypeSummary := range componentTypeSummaryResults {
+		componentTypeId := *componentTypeSummary.ComponentTypeId
+		if resumeType != "" {
+			if componentTypeId != resumeType {
+				continue
+			}
+			resumeType = ""
+		}
+
 		// Set mapping of alarm component types for quick lookup later
 		query.EntityId = ""
 		query.Properties = []string{alarmProperty}
-		query.ComponentTypeId = *componentTypeSummary.ComponentTypeId
+		query.ComponentTypeId = componentTypeId
 		query.Order = iottwinmakertypes.OrderByTimeDescending
+		query.NextToken = resumeToken
+		resumeToken = ""
 		if isFiltered {
 			query.PropertyFilter = filter
 		}
 
-		propertyReferences, newFailures, err := s.GetLatestComponentHistoryWithLookup(ctx, query)
+		propertyReferences, newFailures, token, err := s.GetLatestComponentHistoryWithLookup(ctx, query)
 		dr.Error = err
 		if err != nil {
 			return
 		}
 		failures = append(failures, newFailures...)
 		pValues = append(pValues, propertyReferences...)
+		if token != nil {
+			// paging stopped at a limit, the next query continues from this component type
+			nextToken = aws.String(alarmToken(componentTypeId, *token))
+			break
+		}
 		if isLimited {
 			// update the queries' maxResults so we ask for less on the next iteration
 			query.MaxResults = maxNoOfAlarms - len(pValues)
@@ -614,10 +928,14 @@ func (s *twinMakerHandler) GetAlarms(ctx context.Context, query models.TwinMaker
 	for i, propertyReference := range pValues {
 		aValues := len(propertyReference.values)
 		if aValues > 0 {
-			if timeValue, err := getTimeObjectFromStringTime(propertyReference.values[0].Time); err == nil {
+			// an alarm with a timestamp that can not be read is still listed, without its time
+			if timeValue, err := propertyValueTime(propertyReference.values[0]); err == nil {
 				t.Set(i, timeValue)
 			} else {
-				dr.Error = fmt.Errorf("error parsing timestamp during GetAlarms query")
+				failures = append(failures, data.Notice{
+					Severity: data.NoticeSeverityWarning,
+					Text:     fmt.Sprintf("alarm %s has no time: %s", aws.ToString(propertyReference.entityPropertyReference.ComponentName), err.Error()),
+				})
 			}
 			status.Set(i, propertyReference.values[0].Value.StringValue)
 		}
@@ -627,25 +945,40 @@ func (s *twinMakerHandler) GetAlarms(ctx context.Context, query models.TwinMaker
 		eId.Set(i, propertyReference.entityPropertyReference.EntityId)
 		eName.Set(i, propertyReference.entityName)
 	}
-	frame := fields.ToFrame("", nil)
+	frame := fields.ToFrame("", nextToken)
 	frame.AppendNotices(failures...)
 	dr.Frames = append(dr.Frames, frame)
 
 	return
 }
 
-func (s *twinMakerHandler) GetSessionToken(ctx context.Context, duration time.Duration, workspaceId string) (models.TokenInfo, error) {
+// alarmToken keeps the component type a GetAlarms query stopped in along with its history token.
+// Component type ids have no spaces, so a space separates the two.
+func alarmToken(componentTypeId string, nextToken string) string {
+	return componentTypeId + " " + nextToken
+}
+
+// splitAlarmToken reads a token written by alarmToken, other tokens are ignored
+func splitAlarmToken(token string) (componentTypeId string, nextToken string) {
+	componentTypeId, nextToken, ok := strings.Cut(token, " ")
+	if !ok {
+		return "", ""
+	}
+	return componentTypeId, nextToken
+}
+
+func (s *twinMakerHandler) GetSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (models.TokenInfo, error) {
 	info := models.TokenInfo{}
-	credentials, err := s.client.GetSessionToken(ctx, duration, workspaceId)
+	credentials, err := s.client.GetSessionToken(ctx, duration, workspaceId, identity)
 	if err != nil {
 		return info, HandleGetTokenError(err)
 	}
 	return SetInfo(credentials, info), err
 }
 
-func (s *twinMakerHandler) GetWriteSessionToken(ctx context.Context, duration time.Duration, workspaceId string) (models.TokenInfo, error) {
+func (s *twinMakerHandler) GetWriteSessionToken(ctx context.Context, duration time.Duration, workspaceId string, identity models.TokenIdentity) (models.TokenInfo, error) {
 	info := models.TokenInfo{}
-	credentials, err := s.client.GetWriteSessionToken(ctx, duration, workspaceId)
+	credentials, err := s.client.GetWriteSessionToken(ctx, duration, workspaceId, identity)
 	if err != nil {
 		return info, HandleGetTokenError(err)
 	}
@@ -2,10 +2,13 @@ package twinmaker
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
 
 	"github.com/grafana/grafana-aws-sdk/pkg/awsds"
 	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
@@ -23,7 +26,7 @@ func TestHandleAWSData(t *testing.T) {
 	t.Run("manually get an sts token", func(t *testing.T) {
 		client.path = "get-token"
 		WorkspaceId := "AlarmWorkspace"
-		token, err := handler.GetSessionToken(context.Background(), time.Second*3600, WorkspaceId)
+		token, err := handler.GetSessionToken(context.Background(), time.Second*3600, WorkspaceId, models.TokenIdentity{})
 		require.NoError(t, err)
 		require.NotEmpty(t, token)
 	})
@@ -174,6 +177,12 @@ func TestHandleAWSData(t *testing.T) {
 		require.Equal(t, labels, dr.Frames[3].Fields[0].Labels)
 	})
 
+	t.Run("run GetSceneBindings handler", func(t *testing.T) {
+		client.path = "get-scene-document"
+		resp := handler.GetSceneBindings(context.Background(), models.TwinMakerQuery{SceneId: "factory"})
+		_ = runTest(t, client.path, &resp)
+	})
+
 	t.Run("run GetAlarms handler", func(t *testing.T) {
 		t.Skip()
 		// cannot use the mock client here since no real API call exists for this
@@ -213,3 +222,257 @@ func runTest(t *testing.T, name string, dr *backend.DataResponse) *backend.DataR
 
 	return dr
 }
+
+type failingPageClient struct {
+	*twinMakerMockClient
+	calls int
+}
+
+func (c *failingPageClient) GetPropertyValueHistory(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetPropertyValueHistoryOutput, error) {
+	c.calls++
+	if c.calls > 2 {
+		return nil, fmt.Errorf("connection reset")
+	}
+	r, err := c.twinMakerMockClient.GetPropertyValueHistory(ctx, query)
+	if err == nil {
+		r.NextToken = aws.String(fmt.Sprintf("page-%d", c.calls+1))
+	}
+	return r, err
+}
+
+// threePageClient returns the saved history once per page, for three pages
+type threePageClient struct {
+	*twinMakerMockClient
+	tokens []string
+}
+
+func (c *threePageClient) GetPropertyValueHistory(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetPropertyValueHistoryOutput, error) {
+	c.tokens = append(c.tokens, query.NextToken)
+	r, err := c.twinMakerMockClient.GetPropertyValueHistory(ctx, query)
+	if err == nil && len(c.tokens) < 3 {
+		r.NextToken = aws.String(fmt.Sprintf("page-%d", len(c.tokens)+1))
+	}
+	return r, err
+}
+
+func TestPropertyValueHistoryPages(t *testing.T) {
+	mock, err := NewTwinMakerMockClient("get-property-history-alarms")
+	require.NoError(t, err)
+	single, err := mock.GetPropertyValueHistory(context.Background(), models.TwinMakerQuery{})
+	require.NoError(t, err)
+
+	t.Run("every page is loaded once", func(t *testing.T) {
+		client := &threePageClient{twinMakerMockClient: mock}
+		handler := &twinMakerHandler{client: client}
+		res, err := handler.GetPropertyValueHistoryPaginated(context.Background(), models.TwinMakerQuery{}, nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"", "page-2", "page-3"}, client.tokens)
+		require.Nil(t, res.NextToken)
+		require.Equal(t, 3*countHistoryValues(single), countHistoryValues(res))
+	})
+
+	t.Run("page limit keeps the next token", func(t *testing.T) {
+		client := &threePageClient{twinMakerMockClient: mock}
+		handler := &twinMakerHandler{client: client}
+		res, err := handler.GetPropertyValueHistoryPaginated(context.Background(), models.TwinMakerQuery{
+			QueryLimits: models.QueryLimits{MaxPages: 2},
+		}, nil)
+		var partial *PartialResultError
+		require.ErrorAs(t, err, &partial)
+		require.True(t, isLimitExceeded(err))
+		require.Equal(t, []string{"", "page-2"}, client.tokens)
+		require.Equal(t, "page-3", *res.NextToken)
+	})
+}
+
+func TestPropertyValueHistoryPartialResults(t *testing.T) {
+	mock, err := NewTwinMakerMockClient("get-property-history-alarms")
+	require.NoError(t, err)
+
+	t.Run("later page fails", func(t *testing.T) {
+		handler := &twinMakerHandler{client: &failingPageClient{twinMakerMockClient: mock}}
+		res, err := handler.GetPropertyValueHistoryPaginated(context.Background(), models.TwinMakerQuery{}, nil)
+
+		var partial *PartialResultError
+		require.ErrorAs(t, err, &partial)
+		require.Equal(t, 2, partial.Pages)
+		require.NotNil(t, res)
+		require.Equal(t, "page-3", *res.NextToken)
+	})
+
+	t.Run("deadline exceeded", func(t *testing.T) {
+		handler := &twinMakerHandler{client: &failingPageClient{twinMakerMockClient: mock}}
+		_, err := handler.GetPropertyValueHistoryPaginated(context.Background(), models.TwinMakerQuery{
+			Deadline: time.Now().Add(-time.Second),
+		}, nil)
+		require.ErrorIs(t, err, ErrQueryTimeout)
+	})
+}
+
+// definitionClient returns one value for a property with a full definition
+type definitionClient struct {
+	TwinMakerClient
+}
+
+func (c *definitionClient) GetEntity(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetEntityOutput, error) {
+	return &iottwinmaker.GetEntityOutput{
+		Components: map[string]iottwinmakertypes.ComponentResponse{
+			"pump": {Properties: map[string]iottwinmakertypes.PropertyResponse{
+				"temperature": {Definition: &iottwinmakertypes.PropertyDefinitionResponse{
+					DisplayName:   aws.String("Temperature"),
+					Configuration: map[string]string{"min": "-20", "max": "120.5"},
+					DataType: &iottwinmakertypes.DataType{
+						Type:          iottwinmakertypes.TypeDouble,
+						UnitOfMeasure: aws.String("°C"),
+					},
+				}},
+				"mode": {Definition: &iottwinmakertypes.PropertyDefinitionResponse{
+					DataType: &iottwinmakertypes.DataType{
+						Type: iottwinmakertypes.TypeString,
+						AllowedValues: []iottwinmakertypes.DataValue{
+							{StringValue: aws.String("AUTO")},
+							{StringValue: aws.String("MANUAL")},
+						},
+						UnitOfMeasure: aws.String("widgets"),
+					},
+				}},
+			}},
+		},
+	}, nil
+}
+
+func (c *definitionClient) GetPropertyValue(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetPropertyValueOutput, error) {
+	ref := func(name string) *iottwinmakertypes.EntityPropertyReference {
+		return &iottwinmakertypes.EntityPropertyReference{
+			EntityId:      aws.String("pump-1"),
+			ComponentName: aws.String("pump"),
+			PropertyName:  aws.String(name),
+		}
+	}
+	return &iottwinmaker.GetPropertyValueOutput{
+		PropertyValues: map[string]iottwinmakertypes.PropertyLatestValue{
+			"temperature": {PropertyReference: ref("temperature"), PropertyValue: &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(42)}},
+			"mode":        {PropertyReference: ref("mode"), PropertyValue: &iottwinmakertypes.DataValue{StringValue: aws.String("AUTO")}},
+		},
+	}, nil
+}
+
+func TestPropertyFieldConfig(t *testing.T) {
+	handler := NewTwinMakerHandler(&definitionClient{})
+	query := models.TwinMakerQuery{
+		EntityId:             "pump-1",
+		ComponentName:        "pump",
+		PropertyDisplayNames: map[string]string{"mode": "Operating mode"},
+	}
+	dr := handler.GetPropertyValue(context.Background(), query)
+	require.NoError(t, dr.Error)
+	frame := dr.Frames[0]
+
+	temperature, _ := frame.FieldByName("temperature")
+	require.NotNil(t, temperature.Config)
+	require.Equal(t, "Temperature", temperature.Config.DisplayNameFromDS)
+	require.Equal(t, "celsius", temperature.Config.Unit)
+	require.Equal(t, data.ConfFloat64(-20), *temperature.Config.Min)
+	require.Equal(t, data.ConfFloat64(120.5), *temperature.Config.Max)
+
+	// renamed by the query, so the definition name is not used
+	mode, _ := frame.FieldByName("Operating mode")
+	require.NotNil(t, mode.Config)
+	require.Empty(t, mode.Config.DisplayNameFromDS)
+	require.Equal(t, "suffix:widgets", mode.Config.Unit)
+	require.Empty(t, mode.Config.Mappings)
+}
+
+// entityCountClient counts GetEntity calls
+type entityCountClient struct {
+	definitionClient
+	calls int
+}
+
+func (c *entityCountClient) GetEntity(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetEntityOutput, error) {
+	c.calls++
+	return c.definitionClient.GetEntity(ctx, query)
+}
+
+func TestPropertyDefinitionsCached(t *testing.T) {
+	client := &entityCountClient{}
+	handler := &twinMakerHandler{client: NewCachingClient(client, time.Minute)}
+	for _, props := range [][]string{{"temperature"}, {"mode"}} {
+		defs := handler.propertyDefinitions(context.Background(), models.TwinMakerQuery{
+			WorkspaceId:   "ws",
+			EntityId:      "pump-1",
+			ComponentName: "pump",
+			Properties:    props,
+			NextToken:     "page-2",
+		})
+		require.Len(t, defs, 2)
+	}
+	require.Equal(t, 1, client.calls)
+}
+
+func TestHistorySkipsInvalidTimes(t *testing.T) {
+	results := &iottwinmaker.GetPropertyValueHistoryOutput{
+		PropertyValues: []iottwinmakertypes.PropertyValueHistory{{
+			EntityPropertyReference: &iottwinmakertypes.EntityPropertyReference{
+				EntityId:      aws.String("pump-1"),
+				ComponentName: aws.String("pump"),
+				PropertyName:  aws.String("temperature"),
+			},
+			Values: []iottwinmakertypes.PropertyValue{
+				{Time: aws.String("1700000000000"), Value: &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(1)}},
+				{Time: aws.String("not a time"), Value: &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(2)}},
+				{Time: aws.String("2023-11-14T22:14Z"), Value: &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(3)}},
+			},
+		}},
+	}
+
+	dr := (&twinMakerHandler{}).processHistory(results, nil, nil, models.TwinMakerQuery{}, nil)
+	require.NoError(t, dr.Error)
+	frame := dr.Frames[0]
+	rows, err := frame.RowLen()
+	require.NoError(t, err)
+	require.Equal(t, 2, rows)
+	require.Equal(t, 3.0, *frame.Fields[0].At(1).(*float64))
+	require.Len(t, frame.Meta.Notices, 1)
+	require.Contains(t, frame.Meta.Notices[0].Text, `skipped 1 values of temperature: invalid timestamp "not a time"`)
+}
+
+func TestHistorySkipsSeriesWithoutTimes(t *testing.T) {
+	ref := func(name string) *iottwinmakertypes.EntityPropertyReference {
+		return &iottwinmakertypes.EntityPropertyReference{
+			EntityId:      aws.String("pump-1"),
+			ComponentName: aws.String("pump"),
+			PropertyName:  aws.String(name),
+		}
+	}
+	bad := []iottwinmakertypes.PropertyValue{}
+	for _, v := range []string{"a", "b", "c", "d", "e", "a"} {
+		bad = append(bad, iottwinmakertypes.PropertyValue{Time: aws.String(v), Value: &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(1)}})
+	}
+	results := &iottwinmaker.GetPropertyValueHistoryOutput{
+		PropertyValues: []iottwinmakertypes.PropertyValueHistory{
+			{EntityPropertyReference: ref("flow"), Values: bad},
+			{EntityPropertyReference: ref("temperature"), Values: []iottwinmakertypes.PropertyValue{
+				{Time: aws.String("1700000000000"), Value: &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(1)}},
+			}},
+		},
+	}
+
+	dr := (&twinMakerHandler{}).processHistory(results, nil, nil, models.TwinMakerQuery{}, nil)
+	require.NoError(t, dr.Error)
+	// the series without a readable time has no frame, only a notice
+	require.Len(t, dr.Frames, 1)
+	require.Equal(t, "temperature", dr.Frames[0].Fields[0].Name)
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	require.Equal(t, `skipped 6 values of flow: invalid timestamp "a"; invalid timestamp "b"; invalid timestamp "c" and 2 more errors`, dr.Frames[0].Meta.Notices[0].Text)
+}
+
+func TestAlarmToken(t *testing.T) {
+	componentTypeId, nextToken := splitAlarmToken(alarmToken("com.example.alarm", "abc def"))
+	require.Equal(t, "com.example.alarm", componentTypeId)
+	require.Equal(t, "abc def", nextToken)
+
+	componentTypeId, nextToken = splitAlarmToken("")
+	require.Empty(t, componentTypeId)
+	require.Empty(t, nextToken)
+}
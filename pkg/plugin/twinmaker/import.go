@@ -0,0 +1,319 @@
+package twinmaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// maximum number of values TwinMaker accepts in one property value entry
+const maxImportValuesPerEntry = 10
+
+// number of entity lookups and BatchPutPropertyValues calls running at once during an import
+const importConcurrency = 4
+
+// number of times a batch is sent before its rows are reported as failed
+const importAttempts = 3
+
+// delay before the first retry, doubled for every later retry
+var importRetryDelay = 500 * time.Millisecond
+
+// error codes worth sending the same batch again for
+var retryableImportErrors = map[string]bool{
+	"ThrottlingException":         true,
+	"InternalServerException":     true,
+	"ServiceUnavailableException": true,
+}
+
+// importEntry is a property value entry along with the import row of every value
+type importEntry struct {
+	entry iottwinmakertypes.PropertyValueEntry
+	rows  []int
+}
+
+type importBatch []importEntry
+
+func (r *twinMakerResource) ImportPropertyValues(ctx context.Context, workspaceId string, identity models.TokenIdentity, rows []models.ImportRow) (*models.ImportResult, error) {
+	result := &models.ImportResult{Rows: len(rows)}
+	if len(rows) == 0 {
+		return result, nil
+	}
+
+	entities, entityErrors := r.loadImportEntities(ctx, workspaceId, rows)
+	entries, rowErrors := importEntries(rows, entities, entityErrors)
+	result.AddErrors(rowErrors...)
+
+	batches := []importBatch{}
+	for start := 0; start < len(entries); start += maxBatchPutEntries {
+		batches = append(batches, entries[start:min(start+maxBatchPutEntries, len(entries))])
+	}
+
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	sem := make(chan struct{}, importConcurrency)
+	for _, batch := range batches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			written, errs := r.writeImportBatch(ctx, workspaceId, batch)
+			mu.Lock()
+			result.Written += written
+			result.AddErrors(errs...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	backend.Logger.Info("audit: ImportPropertyValues",
+		"user", identity.Login,
+		"email", identity.Email,
+		"role", identity.Role,
+		"workspace", workspaceId,
+		"rows", result.Rows,
+		"written", result.Written,
+		"failed", len(result.Errors),
+	)
+	return result, nil
+}
+
+// loadImportEntities gets every entity referenced by the rows.  Entities that fail to load
+// only fail their own rows.
+func (r *twinMakerResource) loadImportEntities(ctx context.Context, workspaceId string, rows []models.ImportRow) (map[string]*iottwinmaker.GetEntityOutput, map[string]error) {
+	entities := make(map[string]*iottwinmaker.GetEntityOutput)
+	entityErrors := make(map[string]error)
+
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	sem := make(chan struct{}, importConcurrency)
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		if seen[row.EntityId] {
+			continue
+		}
+		seen[row.EntityId] = true
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(entityId string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			entity, err := r.client.GetEntity(ctx, models.TwinMakerQuery{
+				WorkspaceId: workspaceId,
+				EntityId:    entityId,
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				entityErrors[entityId] = err
+				return
+			}
+			entities[entityId] = entity
+		}(row.EntityId)
+	}
+	wg.Wait()
+	return entities, entityErrors
+}
+
+// importEntries validates the rows against the property definitions, and groups the valid rows into entries
+func importEntries(rows []models.ImportRow, entities map[string]*iottwinmaker.GetEntityOutput, entityErrors map[string]error) ([]importEntry, []models.ImportRowError) {
+	rowErrors := []models.ImportRowError{}
+	fail := func(row models.ImportRow, format string, args ...interface{}) {
+		rowErrors = append(rowErrors, models.ImportRowError{Row: row.Row, Message: fmt.Sprintf(format, args...)})
+	}
+
+	entries := []importEntry{}
+	// index of the entry still accepting values for each property
+	open := make(map[string]int)
+	seen := make(map[string]int)
+	for _, row := range rows {
+		if err, ok := entityErrors[row.EntityId]; ok {
+			fail(row, "%s", MapAWSError(err).Error())
+			continue
+		}
+		definition, err := findPropertyDefinition(entities[row.EntityId], row.ComponentName, row.PropertyName)
+		if err != nil {
+			fail(row, "%s", err.Error())
+			continue
+		}
+		if !aws.ToBool(definition.IsTimeSeries) {
+			fail(row, "%q is not a time series property", row.PropertyName)
+			continue
+		}
+		var dataType iottwinmakertypes.Type
+		if definition.DataType != nil {
+			dataType = definition.DataType.Type
+		}
+		value, err := importDataValue(row.Value, dataType)
+		if err != nil {
+			fail(row, "%s", err.Error())
+			continue
+		}
+
+		ref := row.EntityId + "/" + row.ComponentName + "/" + row.PropertyName
+		t := row.Timestamp.UTC().Format(time.RFC3339Nano)
+		if first, ok := seen[ref+"@"+t]; ok {
+			fail(row, "duplicate value for %s at %s, see row %d", row.PropertyName, t, first)
+			continue
+		}
+		seen[ref+"@"+t] = row.Row
+
+		i, ok := open[ref]
+		if !ok || len(entries[i].rows) == maxImportValuesPerEntry {
+			i = len(entries)
+			open[ref] = i
+			entries = append(entries, importEntry{entry: iottwinmakertypes.PropertyValueEntry{
+				EntityPropertyReference: &iottwinmakertypes.EntityPropertyReference{
+					EntityId:      aws.String(row.EntityId),
+					ComponentName: aws.String(row.ComponentName),
+					PropertyName:  aws.String(row.PropertyName),
+				},
+			}})
+		}
+		entries[i].entry.PropertyValues = append(entries[i].entry.PropertyValues, iottwinmakertypes.PropertyValue{
+			Time:  aws.String(t),
+			Value: value,
+		})
+		entries[i].rows = append(entries[i].rows, row.Row)
+	}
+	return entries, rowErrors
+}
+
+// importDataValue converts a value from the file to the type of the property
+func importDataValue(s string, t iottwinmakertypes.Type) (*iottwinmakertypes.DataValue, error) {
+	if s == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+	switch t {
+	case iottwinmakertypes.TypeString:
+		return &iottwinmakertypes.DataValue{StringValue: aws.String(s)}, nil
+	case iottwinmakertypes.TypeDouble:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DOUBLE value %q", s)
+		}
+		return &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(v)}, nil
+	case iottwinmakertypes.TypeInteger:
+		v, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid INTEGER value %q", s)
+		}
+		return &iottwinmakertypes.DataValue{IntegerValue: aws.Int32(int32(v))}, nil
+	case iottwinmakertypes.TypeLong:
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LONG value %q", s)
+		}
+		return &iottwinmakertypes.DataValue{LongValue: aws.Int64(v)}, nil
+	case iottwinmakertypes.TypeBoolean:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BOOLEAN value %q", s)
+		}
+		return &iottwinmakertypes.DataValue{BooleanValue: aws.Bool(v)}, nil
+	}
+	return nil, fmt.Errorf("%s values can not be imported", t)
+}
+
+// writeImportBatch writes one batch, retrying throttled and failed calls, and returns the number of
+// rows written along with an error for every row that was not
+func (r *twinMakerResource) writeImportBatch(ctx context.Context, workspaceId string, batch importBatch) (int, []models.ImportRowError) {
+	input := &iottwinmaker.BatchPutPropertyValuesInput{
+		WorkspaceId: aws.String(workspaceId),
+		Entries:     make([]iottwinmakertypes.PropertyValueEntry, len(batch)),
+	}
+	rowCount := 0
+	for i, e := range batch {
+		input.Entries[i] = e.entry
+		rowCount += len(e.rows)
+	}
+
+	var rsp *iottwinmaker.BatchPutPropertyValuesOutput
+	var err error
+	for attempt := 1; ; attempt++ {
+		rsp, err = r.client.BatchPutPropertyValues(ctx, input)
+		if err == nil || attempt == importAttempts || !isRetryableImportError(err) {
+			break
+		}
+		select {
+		case <-time.After(importRetryDelay << (attempt - 1)):
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	rowErrors := []models.ImportRowError{}
+	if err != nil {
+		msg := MapAWSError(err).Error()
+		for _, e := range batch {
+			for _, row := range e.rows {
+				rowErrors = append(rowErrors, models.ImportRowError{Row: row, Message: msg})
+			}
+		}
+		return 0, rowErrors
+	}
+
+	// error entries echo the entry, so the failed values are found by property and time
+	rowsByValue := make(map[string]int, rowCount)
+	for _, e := range batch {
+		for i, v := range e.entry.PropertyValues {
+			rowsByValue[importValueKey(e.entry.EntityPropertyReference, v)] = e.rows[i]
+		}
+	}
+	// a row may be reported by more than one error, it is only counted once
+	failed := map[int]int{}
+	for _, errorEntry := range rsp.ErrorEntries {
+		for _, e := range errorEntry.Errors {
+			if e.Entry == nil {
+				continue
+			}
+			for _, v := range e.Entry.PropertyValues {
+				row, ok := rowsByValue[importValueKey(e.Entry.EntityPropertyReference, v)]
+				if !ok {
+					continue
+				}
+				msg := fmt.Sprintf("%s: %s", aws.ToString(e.ErrorCode), aws.ToString(e.ErrorMessage))
+				if i, ok := failed[row]; ok {
+					if !strings.Contains(rowErrors[i].Message, msg) {
+						rowErrors[i].Message += "; " + msg
+					}
+					continue
+				}
+				failed[row] = len(rowErrors)
+				rowErrors = append(rowErrors, models.ImportRowError{Row: row, Message: msg})
+			}
+		}
+	}
+	return rowCount - len(rowErrors), rowErrors
+}
+
+func importValueKey(ref *iottwinmakertypes.EntityPropertyReference, v iottwinmakertypes.PropertyValue) string {
+	if ref == nil {
+		return ""
+	}
+	return aws.ToString(ref.EntityId) + "/" + aws.ToString(ref.ComponentName) + "/" + aws.ToString(ref.PropertyName) + "@" + aws.ToString(v.Time)
+}
+
+func isRetryableImportError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && retryableImportErrors[apiErr.ErrorCode()]
+}
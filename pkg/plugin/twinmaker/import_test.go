@@ -0,0 +1,96 @@
+package twinmaker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+	"github.com/aws/smithy-go"
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportPropertyValues(t *testing.T) {
+	ctx := context.Background()
+	retryDelay := importRetryDelay
+	importRetryDelay = 0
+	t.Cleanup(func() { importRetryDelay = retryDelay })
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	row := func(n int, property string, value string) models.ImportRow {
+		return models.ImportRow{
+			Row:           n,
+			EntityId:      "pump-1",
+			ComponentName: "pump",
+			PropertyName:  property,
+			Timestamp:     start.Add(time.Duration(n) * time.Minute),
+			Value:         value,
+		}
+	}
+
+	t.Run("groups valid rows into batches and reports invalid rows", func(t *testing.T) {
+		client := &writeClient{}
+		rows := []models.ImportRow{}
+		for i := 1; i <= 250; i++ {
+			rows = append(rows, row(i, "flow", "1.5"))
+		}
+		rows = append(rows,
+			row(251, "flow", "high"),
+			row(252, "serial", "SN-1"),
+			row(1, "flow", "2"),
+		)
+		result, err := NewTwinMakerResource(client).ImportPropertyValues(ctx, "ws", models.TokenIdentity{Login: "jane"}, rows)
+		require.NoError(t, err)
+		require.Equal(t, 253, result.Rows)
+		require.Equal(t, 250, result.Written)
+		require.Equal(t, []models.ImportRowError{
+			{Row: 1, Message: "duplicate value for flow at 2024-01-01T00:01:00Z, see row 1"},
+			{Row: 251, Message: `invalid DOUBLE value "high"`},
+			{Row: 252, Message: `"serial" is not a time series property`},
+		}, result.Errors)
+		// 25 entries of 10 values, written 10 entries at a time
+		require.ElementsMatch(t, []int{10, 10, 5}, client.batches)
+	})
+
+	t.Run("retries throttled batches", func(t *testing.T) {
+		client := &writeClient{failures: []error{&smithy.GenericAPIError{Code: "ThrottlingException"}}}
+		result, err := NewTwinMakerResource(client).ImportPropertyValues(ctx, "ws", models.TokenIdentity{}, []models.ImportRow{row(1, "flow", "1")})
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Written)
+		require.Empty(t, result.Errors)
+	})
+
+	t.Run("reports the rows of failed batches", func(t *testing.T) {
+		client := &writeClient{failures: []error{&smithy.GenericAPIError{Code: "ValidationException", Message: "bad"}}}
+		result, err := NewTwinMakerResource(client).ImportPropertyValues(ctx, "ws", models.TokenIdentity{}, []models.ImportRow{row(1, "flow", "1")})
+		require.NoError(t, err)
+		require.Equal(t, 0, result.Written)
+		require.Len(t, result.Errors, 1)
+		require.Contains(t, result.Errors[0].Message, "AWS returned ValidationException: bad")
+	})
+
+	t.Run("counts a row reported by several errors once", func(t *testing.T) {
+		rows := []models.ImportRow{row(1, "flow", "1"), row(2, "flow", "2")}
+		failed := &iottwinmakertypes.PropertyValueEntry{
+			EntityPropertyReference: &iottwinmakertypes.EntityPropertyReference{
+				EntityId:      aws.String("pump-1"),
+				ComponentName: aws.String("pump"),
+				PropertyName:  aws.String("flow"),
+			},
+			PropertyValues: []iottwinmakertypes.PropertyValue{{Time: aws.String(rows[0].Timestamp.Format(time.RFC3339))}},
+		}
+		client := &writeClient{errorEntries: []iottwinmakertypes.BatchPutPropertyErrorEntry{{
+			Errors: []iottwinmakertypes.BatchPutPropertyError{
+				{Entry: failed, ErrorCode: aws.String("InvalidValue"), ErrorMessage: aws.String("out of range")},
+				{Entry: failed, ErrorCode: aws.String("InvalidTime"), ErrorMessage: aws.String("too old")},
+			},
+		}}}
+		result, err := NewTwinMakerResource(client).ImportPropertyValues(ctx, "ws", models.TokenIdentity{}, rows)
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Written)
+		require.Equal(t, []models.ImportRowError{
+			{Row: 1, Message: "InvalidValue: out of range; InvalidTime: too old"},
+		}, result.Errors)
+	})
+}
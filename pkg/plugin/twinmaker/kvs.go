@@ -0,0 +1,191 @@
+package twinmaker
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesisvideo"
+	kinesisvideotypes "github.com/aws/aws-sdk-go-v2/service/kinesisvideo/types"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+)
+
+// kvsClient gets playback URLs and fragment lists from Kinesis Video Streams.  The data endpoint of
+// the stream comes from the kinesisvideo client, the archived media calls are sent to that endpoint.
+type kvsClient struct {
+	client *kinesisvideo.Client
+	media  restClient
+	now    func() time.Time
+}
+
+func newKVSClient(cfg aws.Config, optFns ...func(*kinesisvideo.Options)) *kvsClient {
+	return &kvsClient{
+		client: kinesisvideo.NewFromConfig(cfg, optFns...),
+		media:  newRESTClient(cfg, "kinesisvideo"),
+		now:    time.Now,
+	}
+}
+
+type kvsTimestampRange struct {
+	StartTimestamp epochSeconds  `json:"StartTimestamp"`
+	EndTimestamp   *epochSeconds `json:"EndTimestamp,omitempty"`
+}
+
+type kvsFragmentSelector struct {
+	FragmentSelectorType string            `json:"FragmentSelectorType"`
+	TimestampRange       kvsTimestampRange `json:"TimestampRange"`
+}
+
+func serverTimestampSelector(start time.Time, end *time.Time) *kvsFragmentSelector {
+	selector := &kvsFragmentSelector{
+		FragmentSelectorType: "SERVER_TIMESTAMP",
+		TimestampRange:       kvsTimestampRange{StartTimestamp: epochSeconds(start)},
+	}
+	if end != nil {
+		endTimestamp := epochSeconds(*end)
+		selector.TimestampRange.EndTimestamp = &endTimestamp
+	}
+	return selector
+}
+
+type kvsSessionURLInput struct {
+	StreamName   string                   `json:"StreamName"`
+	PlaybackMode models.VideoPlaybackMode `json:"PlaybackMode"`
+	Expires      int64                    `json:"Expires"`
+	// shows the real time of every fragment, so the video lines up with the dashboard
+	DisplayFragmentTimestamp string               `json:"DisplayFragmentTimestamp"`
+	HLSFragmentSelector      *kvsFragmentSelector `json:"HLSFragmentSelector,omitempty"`
+	DASHFragmentSelector     *kvsFragmentSelector `json:"DASHFragmentSelector,omitempty"`
+}
+
+type kvsSessionURLOutput struct {
+	HLSStreamingSessionURL  string `json:"HLSStreamingSessionURL"`
+	DASHStreamingSessionURL string `json:"DASHStreamingSessionURL"`
+}
+
+// dataEndpoint returns the endpoint serving the API for the stream
+func (c *kvsClient) dataEndpoint(ctx context.Context, streamName string, api kinesisvideotypes.APIName) (string, error) {
+	out, err := c.client.GetDataEndpoint(ctx, &kinesisvideo.GetDataEndpointInput{
+		StreamName: aws.String(streamName),
+		APIName:    api,
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(aws.ToString(out.DataEndpoint), "/"), nil
+}
+
+// GetStreamingSessionURL returns a playback URL for the stream of the request
+func (c *kvsClient) GetStreamingSessionURL(ctx context.Context, req models.VideoStreamRequest) (*models.VideoStreamURL, error) {
+	api := kinesisvideotypes.APINameGetHlsStreamingSessionUrl
+	operation := "/getHLSStreamingSessionURL"
+	if req.Protocol == models.VideoProtocolDASH {
+		api = kinesisvideotypes.APINameGetDashStreamingSessionUrl
+		operation = "/getDASHStreamingSessionURL"
+	}
+	endpoint, err := c.dataEndpoint(ctx, req.StreamName, api)
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+	mode := req.PlaybackMode(now)
+	input := kvsSessionURLInput{
+		StreamName:               req.StreamName,
+		PlaybackMode:             mode,
+		Expires:                  int64(req.ExpiresSeconds),
+		DisplayFragmentTimestamp: "ALWAYS",
+	}
+	if mode != models.VideoPlaybackLive {
+		var end *time.Time
+		if mode == models.VideoPlaybackOnDemand {
+			end = req.End
+		}
+		selector := serverTimestampSelector(*req.Start, end)
+		if req.Protocol == models.VideoProtocolDASH {
+			input.DASHFragmentSelector = selector
+		} else {
+			input.HLSFragmentSelector = selector
+		}
+	}
+
+	out := kvsSessionURLOutput{}
+	if err := c.media.do(ctx, http.MethodPost, endpoint+operation, input, &out); err != nil {
+		return nil, err
+	}
+	url := out.HLSStreamingSessionURL
+	if req.Protocol == models.VideoProtocolDASH {
+		url = out.DASHStreamingSessionURL
+	}
+	return &models.VideoStreamURL{
+		StreamName:   req.StreamName,
+		Protocol:     req.Protocol,
+		PlaybackMode: mode,
+		URL:          url,
+		Expiration:   now.Add(time.Duration(req.ExpiresSeconds) * time.Second),
+	}, nil
+}
+
+// largest page ListFragments returns
+const maxKVSFragmentsPerPage = 1000
+
+type kvsFragment struct {
+	ServerTimestamp              epochSeconds `json:"ServerTimestamp"`
+	FragmentLengthInMilliseconds int64        `json:"FragmentLengthInMilliseconds"`
+}
+
+type kvsListFragmentsInput struct {
+	StreamName string  `json:"StreamName"`
+	MaxResults int64   `json:"MaxResults"`
+	NextToken  *string `json:"NextToken,omitempty"`
+	// the selector can not be sent along with a token
+	FragmentSelector *kvsFragmentSelector `json:"FragmentSelector,omitempty"`
+}
+
+type kvsListFragmentsOutput struct {
+	Fragments []kvsFragment `json:"Fragments"`
+	NextToken *string       `json:"NextToken"`
+}
+
+// ListFragments returns the span of every fragment stored for the stream in the window.  Pages are
+// loaded until the limiter stops the crawl, the ranges loaded so far are returned with the limit error.
+func (c *kvsClient) ListFragments(ctx context.Context, streamName string, start time.Time, end time.Time, limiter *resultLimiter) ([]models.VideoRange, error) {
+	endpoint, err := c.dataEndpoint(ctx, streamName, kinesisvideotypes.APINameListFragments)
+	if err != nil {
+		return nil, err
+	}
+
+	input := kvsListFragmentsInput{
+		StreamName:       streamName,
+		MaxResults:       maxKVSFragmentsPerPage,
+		FragmentSelector: serverTimestampSelector(start, &end),
+	}
+	ranges := []models.VideoRange{}
+	for {
+		out := kvsListFragmentsOutput{}
+		if err := c.media.do(ctx, http.MethodPost, endpoint+"/listFragments", input, &out); err != nil {
+			return ranges, err
+		}
+		for _, f := range out.Fragments {
+			t := time.Time(f.ServerTimestamp)
+			ranges = append(ranges, models.VideoRange{
+				Start: t,
+				End:   t.Add(time.Duration(f.FragmentLengthInMilliseconds) * time.Millisecond),
+			})
+		}
+		if aws.ToString(out.NextToken) == "" {
+			return ranges, nil
+		}
+		if err := limiter.add(len(out.Fragments), out.Fragments, out.NextToken); err != nil {
+			return ranges, err
+		}
+		if err := ctx.Err(); err != nil {
+			return ranges, err
+		}
+		input.NextToken = out.NextToken
+		input.FragmentSelector = nil
+	}
+}
@@ -0,0 +1,202 @@
+package twinmaker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVSClient(t *testing.T) {
+	bodies := map[string]map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies[r.URL.Path] = body
+		switch r.URL.Path {
+		case "/getDataEndpoint":
+			if body["StreamName"] == "missing" {
+				w.Header().Set("X-Amzn-ErrorType", "ResourceNotFoundException:http://internal.amazon.com/coral/")
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"Message":"stream not found"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"DataEndpoint":"https://b-1234.kinesisvideo.eu-west-1.amazonaws.com"}`))
+		case "/getHLSStreamingSessionURL":
+			_, _ = w.Write([]byte(`{"HLSStreamingSessionURL":"https://hls.example/master.m3u8"}`))
+		case "/getDASHStreamingSessionURL":
+			_, _ = w.Write([]byte(`{"DASHStreamingSessionURL":"https://dash.example/manifest.mpd"}`))
+		case "/listFragments":
+			if body["NextToken"] == nil {
+				_, _ = w.Write([]byte(`{"Fragments":[{"ServerTimestamp":1704153600.5,"FragmentLengthInMilliseconds":2000}],"NextToken":"page-2"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"Fragments":[{"ServerTimestamp":1704153610,"FragmentLengthInMilliseconds":1000}]}`))
+		}
+	}))
+	defer server.Close()
+
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	c := newKVSClient(aws.Config{
+		Region: "eu-west-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		}),
+		HTTPClient: &http.Client{Transport: rewriteTransport{target: server.URL}},
+	})
+	c.now = func() time.Time { return now }
+
+	t.Run("live HLS", func(t *testing.T) {
+		rsp, err := c.GetStreamingSessionURL(context.Background(), models.VideoStreamRequest{
+			StreamName:     "camera-1",
+			Protocol:       models.VideoProtocolHLS,
+			ExpiresSeconds: 600,
+		})
+		require.NoError(t, err)
+		require.Equal(t, "https://hls.example/master.m3u8", rsp.URL)
+		require.Equal(t, models.VideoPlaybackLive, rsp.PlaybackMode)
+		require.Equal(t, now.Add(10*time.Minute), rsp.Expiration)
+		require.Equal(t, "GET_HLS_STREAMING_SESSION_URL", bodies["/getDataEndpoint"]["APIName"])
+		require.NotContains(t, bodies["/getHLSStreamingSessionURL"], "HLSFragmentSelector")
+	})
+
+	t.Run("on demand DASH window", func(t *testing.T) {
+		start := now.Add(-2 * time.Hour)
+		end := now.Add(-time.Hour)
+		rsp, err := c.GetStreamingSessionURL(context.Background(), models.VideoStreamRequest{
+			StreamName:     "camera-1",
+			Protocol:       models.VideoProtocolDASH,
+			Start:          &start,
+			End:            &end,
+			ExpiresSeconds: 600,
+		})
+		require.NoError(t, err)
+		require.Equal(t, "https://dash.example/manifest.mpd", rsp.URL)
+		require.Equal(t, models.VideoPlaybackOnDemand, rsp.PlaybackMode)
+
+		selector := bodies["/getDASHStreamingSessionURL"]["DASHFragmentSelector"].(map[string]interface{})
+		timestamps := selector["TimestampRange"].(map[string]interface{})
+		require.Equal(t, float64(start.Unix()), timestamps["StartTimestamp"])
+		require.Equal(t, float64(end.Unix()), timestamps["EndTimestamp"])
+	})
+
+	t.Run("list fragments", func(t *testing.T) {
+		ranges, err := c.ListFragments(context.Background(), "camera-1", now.Add(-time.Hour), now, newResultLimiter(models.QueryLimits{}))
+		require.NoError(t, err)
+		require.Equal(t, []models.VideoRange{
+			{Start: now.Add(500 * time.Millisecond), End: now.Add(2500 * time.Millisecond)},
+			{Start: now.Add(10 * time.Second), End: now.Add(11 * time.Second)},
+		}, ranges)
+		require.Equal(t, "LIST_FRAGMENTS", bodies["/getDataEndpoint"]["APIName"])
+		require.NotContains(t, bodies["/listFragments"], "FragmentSelector")
+
+		ranges, err = c.ListFragments(context.Background(), "camera-1", now.Add(-time.Hour), now, newResultLimiter(models.QueryLimits{MaxPages: 1}))
+		require.True(t, isLimitExceeded(err))
+		require.Len(t, ranges, 1)
+	})
+
+	t.Run("errors are mapped like AWS errors", func(t *testing.T) {
+		_, err := c.GetStreamingSessionURL(context.Background(), models.VideoStreamRequest{StreamName: "missing", ExpiresSeconds: 600})
+		require.EqualError(t, MapAWSError(err), "AWS returned ResourceNotFoundException: stream not found (check that the workspace, entity and component exist)")
+	})
+}
+
+func TestVideoStreamName(t *testing.T) {
+	entity := &iottwinmaker.GetEntityOutput{
+		EntityId: aws.String("camera"),
+		Components: map[string]iottwinmakertypes.ComponentResponse{
+			"status": {Properties: map[string]iottwinmakertypes.PropertyResponse{}},
+			"video": {Properties: map[string]iottwinmakertypes.PropertyResponse{
+				models.KVSStreamNameProperty: {Value: &iottwinmakertypes.DataValue{StringValue: aws.String("camera-1")}},
+			}},
+		},
+	}
+
+	name, err := videoStreamName(entity, "")
+	require.NoError(t, err)
+	require.Equal(t, "camera-1", name)
+
+	_, err = videoStreamName(entity, "status")
+	require.True(t, models.IsValidationError(err))
+
+	_, err = videoStreamName(entity, "other")
+	require.ErrorContains(t, err, "has no component other")
+}
+
+func TestVideoTimeline(t *testing.T) {
+	from := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return from.Add(time.Duration(minutes) * time.Minute) }
+
+	timeline := videoTimeline(from, at(60),
+		[]models.VideoRange{{Start: at(10), End: at(20)}, {Start: at(50), End: at(70)}},
+		[]models.VideoRange{{Start: at(15), End: at(30)}, {Start: at(-10), End: at(5)}},
+	)
+	require.Equal(t, []videoStateChange{
+		{time: at(0), state: models.VideoOnEdge},
+		{time: at(5), state: models.VideoMissing},
+		{time: at(10), state: models.VideoAvailable},
+		{time: at(20), state: models.VideoOnEdge},
+		{time: at(30), state: models.VideoMissing},
+		{time: at(50), state: models.VideoAvailable},
+	}, timeline)
+}
+
+// videoClient serves one stream without fragments, and the recordings of its edge connector
+type videoClient struct {
+	TwinMakerClient
+	recordings []string
+}
+
+func (c *videoClient) GetEntity(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetEntityOutput, error) {
+	return &iottwinmaker.GetEntityOutput{
+		EntityId: aws.String("camera"),
+		Components: map[string]iottwinmakertypes.ComponentResponse{
+			"video": {Properties: map[string]iottwinmakertypes.PropertyResponse{
+				models.KVSStreamNameProperty:     {Value: &iottwinmakertypes.DataValue{StringValue: aws.String("camera-1")}},
+				models.EdgeVideoRecordedProperty: {},
+			}},
+		},
+	}, nil
+}
+
+func (c *videoClient) ListVideoFragments(ctx context.Context, query models.TwinMakerQuery, streamName string) ([]models.VideoRange, error) {
+	return nil, nil
+}
+
+func (c *videoClient) GetPropertyValueHistory(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetPropertyValueHistoryOutput, error) {
+	values := []iottwinmakertypes.PropertyValue{}
+	for _, r := range c.recordings {
+		values = append(values, iottwinmakertypes.PropertyValue{Value: &iottwinmakertypes.DataValue{StringValue: aws.String(r)}})
+	}
+	return &iottwinmaker.GetPropertyValueHistoryOutput{
+		PropertyValues: []iottwinmakertypes.PropertyValueHistory{{Values: values}},
+	}, nil
+}
+
+func TestVideoAvailabilitySkipsBadRecordings(t *testing.T) {
+	from := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	client := &videoClient{recordings: []string{
+		`{"start":"2024-01-02T00:10:00Z","end":"2024-01-02T00:20:00Z"}`,
+		`not json`,
+	}}
+	dr := NewTwinMakerHandler(client).GetVideoAvailability(context.Background(), models.TwinMakerQuery{
+		WorkspaceId: "ws",
+		EntityId:    "camera",
+		TimeRange:   backend.TimeRange{From: from, To: from.Add(time.Hour)},
+	})
+	require.NoError(t, dr.Error)
+	state, _ := dr.Frames[0].FieldByName("state")
+	require.Equal(t, 3, state.Len())
+	require.Equal(t, string(models.VideoOnEdge), state.At(1))
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	require.Contains(t, dr.Frames[0].Meta.Notices[0].Text, "1 edge recordings could not be read")
+}
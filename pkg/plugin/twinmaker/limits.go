@@ -0,0 +1,91 @@
+package twinmaker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// LimitExceededError is returned along with the results loaded before a page, row or byte limit was reached
+type LimitExceededError struct {
+	Limit     string
+	Max       int64
+	NextToken *string
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("%s limit of %d reached, more results are available", e.Limit, e.Max)
+}
+
+// resultLimiter keeps track of what a full crawl loaded so far.
+// Limits are checked after each page, so a crawl stops on the page that reached the limit.
+type resultLimiter struct {
+	limits models.QueryLimits
+	pages  int
+	rows   int
+	bytes  int64
+}
+
+func newResultLimiter(limits models.QueryLimits) *resultLimiter {
+	return &resultLimiter{limits: limits}
+}
+
+// add records a loaded page, and returns a LimitExceededError when there are more pages but a limit was reached.
+// The size of the page is its JSON encoding, only measured when there is a byte limit.
+func (l *resultLimiter) add(rows int, page interface{}, nextToken *string) error {
+	l.pages++
+	l.rows += rows
+	if l.limits.MaxBytes > 0 {
+		l.bytes += encodedSize(page)
+	}
+
+	if nextToken == nil {
+		return nil
+	}
+	switch {
+	case l.limits.MaxPages > 0 && l.pages >= l.limits.MaxPages:
+		return &LimitExceededError{Limit: "page", Max: int64(l.limits.MaxPages), NextToken: nextToken}
+	case l.limits.MaxRows > 0 && l.rows >= l.limits.MaxRows:
+		return &LimitExceededError{Limit: "row", Max: int64(l.limits.MaxRows), NextToken: nextToken}
+	case l.limits.MaxBytes > 0 && l.bytes >= l.limits.MaxBytes:
+		return &LimitExceededError{Limit: "byte", Max: l.limits.MaxBytes, NextToken: nextToken}
+	}
+	return nil
+}
+
+// byteCounter is a writer that only counts what is written
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// encodedSize is the length of the JSON encoding of v, without keeping the encoding
+func encodedSize(v interface{}) int64 {
+	var c byteCounter
+	if err := json.NewEncoder(&c).Encode(v); err != nil {
+		return 0
+	}
+	return int64(c)
+}
+
+// isLimitExceeded is true when the error only means the results were cut off at a limit
+func isLimitExceeded(err error) bool {
+	var limitErr *LimitExceededError
+	return errors.As(err, &limitErr)
+}
+
+// limitNotice turns a LimitExceededError into a warning notice, and returns any other error unchanged
+func limitNotice(err error) ([]data.Notice, error) {
+	if !isLimitExceeded(err) {
+		return nil, err
+	}
+	return []data.Notice{{
+		Severity: data.NoticeSeverityWarning,
+		Text:     err.Error() + ", use the continuation token to load the rest",
+	}}, nil
+}
@@ -0,0 +1,65 @@
+package twinmaker
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultLimiter(t *testing.T) {
+	t.Run("no limits", func(t *testing.T) {
+		l := newResultLimiter(models.QueryLimits{})
+		for i := 0; i < 100; i++ {
+			require.NoError(t, l.add(1000, nil, aws.String("next")))
+		}
+	})
+
+	t.Run("page limit", func(t *testing.T) {
+		l := newResultLimiter(models.QueryLimits{MaxPages: 2})
+		require.NoError(t, l.add(10, nil, aws.String("a")))
+		err := l.add(10, nil, aws.String("b"))
+		require.EqualError(t, err, "page limit of 2 reached, more results are available")
+		require.Equal(t, "b", *err.(*LimitExceededError).NextToken)
+	})
+
+	t.Run("row limit", func(t *testing.T) {
+		l := newResultLimiter(models.QueryLimits{MaxRows: 15})
+		require.NoError(t, l.add(10, nil, aws.String("a")))
+		require.EqualError(t, l.add(10, nil, aws.String("b")), "row limit of 15 reached, more results are available")
+	})
+
+	t.Run("byte limit", func(t *testing.T) {
+		// measured from the encoded page, so one wide row reaches the limit before many small ones
+		l := newResultLimiter(models.QueryLimits{MaxBytes: 100})
+		require.NoError(t, l.add(10, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, aws.String("a")))
+		wide := []map[string]string{{"description": strings.Repeat("x", 100)}}
+		require.EqualError(t, l.add(1, wide, aws.String("b")), "byte limit of 100 reached, more results are available")
+	})
+
+	t.Run("last page is never a limit hit", func(t *testing.T) {
+		l := newResultLimiter(models.QueryLimits{MaxPages: 1})
+		require.NoError(t, l.add(10, nil, nil))
+	})
+
+	t.Run("datasource limits can only be lowered", func(t *testing.T) {
+		limits := models.QueryLimits{MaxPages: 10, MaxRows: 1000}.Min(models.QueryLimits{MaxPages: 50, MaxRows: 100, MaxBytes: 1 << 20})
+		require.Equal(t, models.QueryLimits{MaxPages: 10, MaxRows: 100, MaxBytes: 1 << 20}, limits)
+	})
+}
+
+func TestLimitNotice(t *testing.T) {
+	notices, err := limitNotice(fmt.Errorf("wrapped: %w", &LimitExceededError{Limit: "row", Max: 5}))
+	require.NoError(t, err)
+	require.Len(t, notices, 1)
+	require.Equal(t, data.NoticeSeverityWarning, notices[0].Severity)
+
+	other := fmt.Errorf("boom")
+	notices, err = limitNotice(other)
+	require.Nil(t, notices)
+	require.Equal(t, other, err)
+}
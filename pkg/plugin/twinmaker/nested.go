@@ -0,0 +1,199 @@
+package twinmaker
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// flattenValues builds the fields for one value per row.  Maps are expanded into a field for every key
+// while depth allows, and relationships into their target entity and component.  Lists, and maps past
+// the depth, are kept as JSON.  Fields are named by the path of keys leading to them, so the value
+// itself has no name.  Rows without a value are left empty, and when the rows hold values of different
+// kinds they are all kept as JSON.
+func flattenValues(values []*iottwinmakertypes.DataValue, depth int) []*data.Field {
+	var first *iottwinmakertypes.DataValue
+	mixed := false
+	for _, v := range values {
+		switch {
+		case v == nil:
+		case first == nil:
+			first = v
+		case dataValueKind(v) != dataValueKind(first):
+			mixed = true
+		}
+	}
+
+	switch {
+	case first == nil:
+		return []*data.Field{data.NewFieldFromFieldType(data.FieldTypeNullableString, len(values))}
+	case mixed:
+		f := data.NewFieldFromFieldType(data.FieldTypeNullableJSON, len(values))
+		for i, v := range values {
+			if v != nil {
+				f.Set(i, dataValueRawJSON(v))
+			}
+		}
+		return []*data.Field{f}
+	case first.MapValue != nil && depth > 0:
+		if fields := flattenMaps(values, depth); len(fields) > 0 {
+			return fields
+		}
+	case first.RelationshipValue != nil:
+		entity := data.NewFieldFromFieldType(data.FieldTypeNullableString, len(values))
+		entity.Name = "targetEntityId"
+		component := data.NewFieldFromFieldType(data.FieldTypeNullableString, len(values))
+		component.Name = "targetComponentName"
+		for i, v := range values {
+			if v != nil && v.RelationshipValue != nil {
+				entity.Set(i, v.RelationshipValue.TargetEntityId)
+				component.Set(i, v.RelationshipValue.TargetComponentName)
+			}
+		}
+		return []*data.Field{entity, component}
+	}
+
+	f, converter := newDataValueField(first, len(values))
+	for i, v := range values {
+		if v != nil {
+			f.Set(i, converter(v))
+		}
+	}
+	return []*data.Field{f}
+}
+
+// flattenMaps expands map values into a field for every key found in any row
+func flattenMaps(values []*iottwinmakertypes.DataValue, depth int) []*data.Field {
+	found := map[string]bool{}
+	for _, v := range values {
+		if v != nil {
+			for k := range v.MapValue {
+				found[k] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(found))
+	for k := range found {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fields := []*data.Field{}
+	for _, k := range keys {
+		column := make([]*iottwinmakertypes.DataValue, len(values))
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+			if kv, ok := v.MapValue[k]; ok {
+				column[i] = &kv
+			}
+		}
+		for _, f := range flattenValues(column, depth-1) {
+			f.Name = nestedName(k, f.Name)
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// nestedName joins a field name to the name of the value it was flattened from
+func nestedName(prefix string, name string) string {
+	switch {
+	case prefix == "":
+		return name
+	case name == "":
+		return prefix
+	}
+	return prefix + "." + name
+}
+
+// dataValueKind names the member of the value that is set, values of one kind share a field layout
+func dataValueKind(v *iottwinmakertypes.DataValue) string {
+	switch {
+	case v.BooleanValue != nil:
+		return "boolean"
+	case v.DoubleValue != nil:
+		return "double"
+	case v.IntegerValue != nil:
+		return "integer"
+	case v.LongValue != nil:
+		return "long"
+	case v.StringValue != nil:
+		return "string"
+	case v.ListValue != nil:
+		return "list"
+	case v.MapValue != nil:
+		return "map"
+	case v.RelationshipValue != nil:
+		return "relationship"
+	case v.Expression != nil:
+		return "expression"
+	}
+	return ""
+}
+
+// dataValueJSON converts a value to plain JSON types, relationships become an object with their target
+func dataValueJSON(v *iottwinmakertypes.DataValue) interface{} {
+	switch {
+	case v == nil:
+		return nil
+	case v.BooleanValue != nil:
+		return *v.BooleanValue
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.IntegerValue != nil:
+		return *v.IntegerValue
+	case v.LongValue != nil:
+		return *v.LongValue
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.ListValue != nil:
+		list := make([]interface{}, len(v.ListValue))
+		for i := range v.ListValue {
+			list[i] = dataValueJSON(&v.ListValue[i])
+		}
+		return list
+	case v.MapValue != nil:
+		m := make(map[string]interface{}, len(v.MapValue))
+		for k, mv := range v.MapValue {
+			m[k] = dataValueJSON(&mv)
+		}
+		return m
+	case v.RelationshipValue != nil:
+		return map[string]string{
+			"targetEntityId":      aws.ToString(v.RelationshipValue.TargetEntityId),
+			"targetComponentName": aws.ToString(v.RelationshipValue.TargetComponentName),
+		}
+	case v.Expression != nil:
+		return *v.Expression
+	}
+	return nil
+}
+
+func dataValueRawJSON(v *iottwinmakertypes.DataValue) *json.RawMessage {
+	bs, err := json.Marshal(dataValueJSON(v))
+	if err != nil {
+		return nil
+	}
+	raw := json.RawMessage(bs)
+	return &raw
+}
+
+// fieldHasUrl is true when any string in the field looks like a URL
+func fieldHasUrl(f *data.Field) bool {
+	if f.Type() != data.FieldTypeNullableString {
+		return false
+	}
+	for i := 0; i < f.Len(); i++ {
+		if v, ok := f.ConcreteAt(i); ok && strings.Contains(v.(string), "://") {
+			return true
+		}
+	}
+	return false
+}
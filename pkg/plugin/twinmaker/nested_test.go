@@ -0,0 +1,122 @@
+package twinmaker
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+)
+
+func fieldNames(fields []*data.Field) []string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+func TestFlattenValues(t *testing.T) {
+	reading := &iottwinmakertypes.DataValue{MapValue: map[string]iottwinmakertypes.DataValue{
+		"rms": {DoubleValue: aws.Float64(0.4)},
+		"axis": {MapValue: map[string]iottwinmakertypes.DataValue{
+			"x": {DoubleValue: aws.Float64(1)},
+			"y": {DoubleValue: aws.Float64(2)},
+		}},
+	}}
+	partial := &iottwinmakertypes.DataValue{MapValue: map[string]iottwinmakertypes.DataValue{
+		"rms": {DoubleValue: aws.Float64(0.5)},
+	}}
+
+	t.Run("maps past the depth are JSON", func(t *testing.T) {
+		fields := flattenValues([]*iottwinmakertypes.DataValue{reading, partial}, 1)
+		require.Equal(t, []string{"axis", "rms"}, fieldNames(fields))
+		require.Equal(t, data.FieldTypeNullableJSON, fields[0].Type())
+		require.JSONEq(t, `{"x":1,"y":2}`, string(*fields[0].At(0).(*json.RawMessage)))
+		// keys missing from a row are left empty
+		require.Nil(t, fields[0].At(1))
+		require.Equal(t, 0.5, *fields[1].At(1).(*float64))
+	})
+
+	t.Run("deeper maps are flattened", func(t *testing.T) {
+		fields := flattenValues([]*iottwinmakertypes.DataValue{reading, partial}, 2)
+		require.Equal(t, []string{"axis.x", "axis.y", "rms"}, fieldNames(fields))
+		require.Equal(t, 2.0, *fields[1].At(0).(*float64))
+	})
+
+	t.Run("relationships", func(t *testing.T) {
+		fields := flattenValues([]*iottwinmakertypes.DataValue{{RelationshipValue: &iottwinmakertypes.RelationshipValue{
+			TargetEntityId:      aws.String("pump-1"),
+			TargetComponentName: aws.String("motor"),
+		}}}, 1)
+		require.Equal(t, []string{"targetEntityId", "targetComponentName"}, fieldNames(fields))
+		require.Equal(t, "pump-1", *fields[0].At(0).(*string))
+		require.Equal(t, "motor", *fields[1].At(0).(*string))
+	})
+}
+
+func TestFlattenMixedValues(t *testing.T) {
+	t.Run("rows of different kinds are JSON", func(t *testing.T) {
+		fields := flattenValues([]*iottwinmakertypes.DataValue{
+			{DoubleValue: aws.Float64(1.5)},
+			nil,
+			{StringValue: aws.String("offline")},
+			{MapValue: map[string]iottwinmakertypes.DataValue{"rms": {DoubleValue: aws.Float64(0.4)}}},
+		}, 2)
+		require.Len(t, fields, 1)
+		require.Equal(t, data.FieldTypeNullableJSON, fields[0].Type())
+		require.JSONEq(t, `1.5`, string(*fields[0].At(0).(*json.RawMessage)))
+		require.Nil(t, fields[0].At(1))
+		require.JSONEq(t, `"offline"`, string(*fields[0].At(2).(*json.RawMessage)))
+		require.JSONEq(t, `{"rms":0.4}`, string(*fields[0].At(3).(*json.RawMessage)))
+	})
+
+	t.Run("map keys of different kinds are JSON", func(t *testing.T) {
+		fields := flattenValues([]*iottwinmakertypes.DataValue{
+			{MapValue: map[string]iottwinmakertypes.DataValue{"rms": {DoubleValue: aws.Float64(0.4)}, "unit": {StringValue: aws.String("g")}}},
+			{MapValue: map[string]iottwinmakertypes.DataValue{"rms": {StringValue: aws.String("n/a")}, "unit": {StringValue: aws.String("g")}}},
+		}, 1)
+		require.Equal(t, []string{"rms", "unit"}, fieldNames(fields))
+		require.Equal(t, data.FieldTypeNullableJSON, fields[0].Type())
+		require.JSONEq(t, `0.4`, string(*fields[0].At(0).(*json.RawMessage)))
+		require.JSONEq(t, `"n/a"`, string(*fields[0].At(1).(*json.RawMessage)))
+		require.Equal(t, data.FieldTypeNullableString, fields[1].Type())
+	})
+}
+
+func TestNestedHistory(t *testing.T) {
+	spectrum := func(values ...float64) *iottwinmakertypes.DataValue {
+		list := make([]iottwinmakertypes.DataValue, len(values))
+		for i := range values {
+			list[i] = iottwinmakertypes.DataValue{DoubleValue: aws.Float64(values[i])}
+		}
+		return &iottwinmakertypes.DataValue{ListValue: list}
+	}
+	results := &iottwinmaker.GetPropertyValueHistoryOutput{
+		PropertyValues: []iottwinmakertypes.PropertyValueHistory{{
+			EntityPropertyReference: &iottwinmakertypes.EntityPropertyReference{
+				EntityId:      aws.String("pump-1"),
+				ComponentName: aws.String("vibration"),
+				PropertyName:  aws.String("spectrum"),
+			},
+			Values: []iottwinmakertypes.PropertyValue{
+				{Time: aws.String("2024-01-01T00:00:00Z"), Value: spectrum(0.1, 0.2)},
+				{Time: aws.String("2024-01-01T00:01:00Z"), Value: spectrum(0.3)},
+			},
+		}},
+	}
+
+	handler := &twinMakerHandler{}
+	dr := handler.processHistory(results, nil, nil, models.TwinMakerQuery{}, nil)
+	require.NoError(t, dr.Error)
+	frame := dr.Frames[0]
+	require.Equal(t, []string{"spectrum", data.TimeSeriesTimeFieldName}, fieldNames(frame.Fields))
+	require.Equal(t, "spectrum", frame.Fields[0].Labels["propertyName"])
+	require.JSONEq(t, `[0.1,0.2]`, string(*frame.Fields[0].At(0).(*json.RawMessage)))
+	require.JSONEq(t, `[0.3]`, string(*frame.Fields[0].At(1).(*json.RawMessage)))
+}
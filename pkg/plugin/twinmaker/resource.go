@@ -8,55 +8,92 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
 	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 )
 
 // Resource requests
 type TwinMakerResources interface {
 	// Original model
-	GetEntity(ctx context.Context, id string) (*iottwinmaker.GetEntityOutput, error)
+	GetEntity(ctx context.Context, workspaceId string, id string) (*iottwinmaker.GetEntityOutput, error)
 
-	BatchPutPropertyValues(context.Context, []iottwinmakertypes.PropertyValueEntry) (*iottwinmaker.BatchPutPropertyValuesOutput, error)
+	// Parsed scene JSON, with the data bindings of every node
+	GetSceneDocument(ctx context.Context, workspaceId string, sceneId string) (*models.SceneDocument, error)
+
+	// Validates the entries against the property definitions, and writes them in batches
+	BatchPutPropertyValues(ctx context.Context, workspaceId string, identity models.TokenIdentity, entries []iottwinmakertypes.PropertyValueEntry) (*iottwinmaker.BatchPutPropertyValuesOutput, error)
+
+	// Validates the rows against the property definitions, and writes the valid rows in concurrent batches
+	ImportPropertyValues(ctx context.Context, workspaceId string, identity models.TokenIdentity, rows []models.ImportRow) (*models.ImportResult, error)
+
+	// Scenes are written with the writer role.  Every document replaced by an update is kept as a version.
+	GetScene(ctx context.Context, workspaceId string, sceneId string) (*iottwinmaker.GetSceneOutput, error)
+	CreateScene(ctx context.Context, workspaceId string, identity models.TokenIdentity, req models.SceneRequest) (*iottwinmaker.CreateSceneOutput, error)
+	UpdateScene(ctx context.Context, workspaceId string, identity models.TokenIdentity, req models.SceneRequest) (*iottwinmaker.UpdateSceneOutput, error)
+	ListSceneVersions(ctx context.Context, workspaceId string, sceneId string) ([]models.SceneVersion, error)
+	RollbackScene(ctx context.Context, workspaceId string, identity models.TokenIdentity, rollback models.SceneRollback) (*iottwinmaker.UpdateSceneOutput, error)
+
+	// Playback URL for the video component of an entity
+	GetVideoStreamURL(ctx context.Context, workspaceId string, req models.VideoStreamRequest) (*models.VideoStreamURL, error)
+
+	// Asks the edge connector of the video component to upload recorded video, and tracks the request
+	RequestVideoUpload(ctx context.Context, workspaceId string, identity models.TokenIdentity, req models.VideoUploadRequest) (*models.VideoUploadStatus, error)
+	GetVideoUploadStatus(ctx context.Context, workspaceId string, entityId string, componentName string) (*models.VideoUploadStatus, error)
+
+	// Changes static property values of an entity component, if the entity has not changed since the update was prepared
+	UpdateEntity(ctx context.Context, workspaceId string, identity models.TokenIdentity, update models.EntityUpdate) (*iottwinmaker.UpdateEntityOutput, error)
 
 	// Selectable values
 	ListWorkspaces(ctx context.Context) ([]models.SelectableString, error)
-	ListScenes(ctx context.Context) ([]models.SelectableString, error)
-	ListOptions(ctx context.Context) (models.OptionsInfo, error)
-	ListEntity(ctx context.Context, id string) ([]models.SelectableProps, error)
+	ListScenes(ctx context.Context, workspaceId string) ([]models.SelectableString, error)
+	ListOptions(ctx context.Context, workspaceId string) (models.OptionsInfo, error)
+	ListEntity(ctx context.Context, workspaceId string, id string) ([]models.SelectableProps, error)
 }
 
 type twinMakerResource struct {
-	workspaceId string
-	client      TwinMakerClient
+	client TwinMakerClient
 }
 
-func NewTwinMakerResource(client TwinMakerClient, workspaceId string) TwinMakerResources {
+func NewTwinMakerResource(client TwinMakerClient) TwinMakerResources {
 	return &twinMakerResource{
-		client:      client,
-		workspaceId: workspaceId,
+		client: client,
 	}
 }
 
-func (r *twinMakerResource) GetEntity(ctx context.Context, entityId string) (*iottwinmaker.GetEntityOutput, error) {
+func (r *twinMakerResource) GetEntity(ctx context.Context, workspaceId string, entityId string) (*iottwinmaker.GetEntityOutput, error) {
 	if entityId == "" {
-		return nil, fmt.Errorf("missing entityid")
+		return nil, models.MissingFieldError("entityId")
 	}
 
 	query := models.TwinMakerQuery{
-		WorkspaceId: r.workspaceId,
+		WorkspaceId: workspaceId,
 		EntityId:    entityId,
 	}
 
 	return r.client.GetEntity(ctx, query)
 }
 
-func (r *twinMakerResource) ListWorkspaces(ctx context.Context) ([]models.SelectableString, error) {
-	query := models.TwinMakerQuery{
-		WorkspaceId: r.workspaceId,
+func (r *twinMakerResource) GetSceneDocument(ctx context.Context, workspaceId string, sceneId string) (*models.SceneDocument, error) {
+	if sceneId == "" {
+		return nil, models.MissingFieldError("sceneId")
+	}
+
+	doc, err := r.client.GetSceneDocument(ctx, models.TwinMakerQuery{
+		WorkspaceId: workspaceId,
+		SceneId:     sceneId,
+	})
+	if err != nil {
+		return nil, err
 	}
+	return models.ParseSceneDocument(doc)
+}
+
+func (r *twinMakerResource) ListWorkspaces(ctx context.Context) ([]models.SelectableString, error) {
+	query := models.TwinMakerQuery{}
 	results := make([]models.SelectableString, 0, 20)
 	for {
 		rsp, err := r.client.ListWorkspaces(ctx, query)
-		if err != nil {
+		limited := isLimitExceeded(err)
+		if err != nil && !limited {
 			return results, err
 		}
 		for _, w := range rsp.WorkspaceSummaries {
@@ -71,6 +108,10 @@ func (r *twinMakerResource) ListWorkspaces(ctx context.Context) ([]models.Select
 			results = append(results, info)
 		}
 
+		if limited {
+			backend.Logger.Warn("stopped listing at the configured limit", "error", err)
+			return results, nil
+		}
 		if rsp.NextToken != nil {
 			query.NextToken = *rsp.NextToken
 		} else {
@@ -79,15 +120,16 @@ func (r *twinMakerResource) ListWorkspaces(ctx context.Context) ([]models.Select
 	}
 }
 
-func (r *twinMakerResource) ListScenes(ctx context.Context) ([]models.SelectableString, error) {
+func (r *twinMakerResource) ListScenes(ctx context.Context, workspaceId string) ([]models.SelectableString, error) {
 	query := models.TwinMakerQuery{
-		WorkspaceId: r.workspaceId,
+		WorkspaceId: workspaceId,
 	}
 	results := make([]models.SelectableString, 0, 100)
 
 	for {
 		rsp, err := r.client.ListScenes(ctx, query)
-		if err != nil {
+		limited := isLimitExceeded(err)
+		if err != nil && !limited {
 			return results, err
 		}
 		for _, w := range rsp.SceneSummaries {
@@ -102,6 +144,10 @@ func (r *twinMakerResource) ListScenes(ctx context.Context) ([]models.Selectable
 			results = append(results, info)
 		}
 
+		if limited {
+			backend.Logger.Warn("stopped listing at the configured limit", "error", err)
+			return results, nil
+		}
 		if rsp.NextToken != nil {
 			query.NextToken = *rsp.NextToken
 		} else {
@@ -110,9 +156,9 @@ func (r *twinMakerResource) ListScenes(ctx context.Context) ([]models.Selectable
 	}
 }
 
-func (r *twinMakerResource) ListOptions(ctx context.Context) (models.OptionsInfo, error) {
+func (r *twinMakerResource) ListOptions(ctx context.Context, workspaceId string) (models.OptionsInfo, error) {
 	query := models.TwinMakerQuery{
-		WorkspaceId: r.workspaceId,
+		WorkspaceId: workspaceId,
 	}
 
 	results := models.OptionsInfo{
@@ -123,7 +169,8 @@ func (r *twinMakerResource) ListOptions(ctx context.Context) (models.OptionsInfo
 	// Loop through all entities
 	for {
 		rsp, err := r.client.ListEntities(ctx, query)
-		if err != nil {
+		limited := isLimitExceeded(err)
+		if err != nil && !limited {
 			return results, err
 		}
 
@@ -143,6 +190,10 @@ func (r *twinMakerResource) ListOptions(ctx context.Context) (models.OptionsInfo
 			results.Entities = append(results.Entities, info)
 		}
 
+		if limited {
+			backend.Logger.Warn("stopped listing at the configured limit", "error", err)
+			break
+		}
 		if rsp.NextToken != nil {
 			query.NextToken = *rsp.NextToken
 		} else {
@@ -155,7 +206,8 @@ func (r *twinMakerResource) ListOptions(ctx context.Context) (models.OptionsInfo
 
 	for {
 		rsp, err := r.client.ListComponentTypes(ctx, query)
-		if err != nil {
+		limited := isLimitExceeded(err)
+		if err != nil && !limited {
 			return results, err
 		}
 
@@ -197,6 +249,10 @@ func (r *twinMakerResource) ListOptions(ctx context.Context) (models.OptionsInfo
 			results.Components = append(results.Components, info)
 		}
 
+		if limited {
+			backend.Logger.Warn("stopped listing at the configured limit", "error", err)
+			break
+		}
 		if rsp.NextToken != nil {
 			query.NextToken = *rsp.NextToken
 		} else {
@@ -213,13 +269,16 @@ func (r *twinMakerResource) ListOptions(ctx context.Context) (models.OptionsInfo
 	return results, nil
 }
 
-func (r *twinMakerResource) ListEntity(ctx context.Context, entityId string) ([]models.SelectableProps, error) {
+func (r *twinMakerResource) ListEntity(ctx context.Context, workspaceId string, entityId string) ([]models.SelectableProps, error) {
 	query := models.TwinMakerQuery{
-		WorkspaceId: r.workspaceId,
+		WorkspaceId: workspaceId,
 		EntityId:    entityId,
 	}
 
 	rsp, err := r.client.GetEntity(ctx, query)
+	if err != nil {
+		return nil, err
+	}
 
 	results := make([]models.SelectableProps, 0)
 	for _, comp := range rsp.Components {
@@ -261,15 +320,7 @@ func (r *twinMakerResource) ListEntity(ctx context.Context, entityId string) ([]
 		results = append(results, info)
 	}
 
-	return results, err
-}
-
-func (r *twinMakerResource) BatchPutPropertyValues(ctx context.Context, entries []iottwinmakertypes.PropertyValueEntry) (*iottwinmaker.BatchPutPropertyValuesOutput, error) {
-	input := &iottwinmaker.BatchPutPropertyValuesInput{
-		WorkspaceId: &r.workspaceId,
-		Entries:     entries,
-	}
-	return r.client.BatchPutPropertyValues(ctx, input)
+	return results, nil
 }
 
 func toPropertiesSelectableValues(def map[string]iottwinmakertypes.PropertyDefinitionResponse, reg map[string]models.SelectableString) (timeseries []models.SelectableString, props []models.SelectableString) {
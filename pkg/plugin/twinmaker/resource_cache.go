@@ -2,6 +2,7 @@ package twinmaker
 
 import (
 	"context"
+	"fmt"
 	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
 	"time"
 
@@ -23,8 +24,8 @@ func NewCachingResource(res TwinMakerResources, ttl time.Duration) TwinMakerReso
 	}
 }
 
-func (s *cachingResource) GetEntity(ctx context.Context, id string) (*iottwinmaker.GetEntityOutput, error) {
-	key := "GetEntity/" + id
+func (s *cachingResource) GetEntity(ctx context.Context, workspaceId string, id string) (*iottwinmaker.GetEntityOutput, error) {
+	key := "GetEntity/" + workspaceId + "/" + id
 	val, ok := s.stash.Get(key)
 	if ok {
 		v, ok := val.(*iottwinmaker.GetEntityOutput)
@@ -33,13 +34,18 @@ func (s *cachingResource) GetEntity(ctx context.Context, id string) (*iottwinmak
 		}
 	}
 
-	v, err := s.res.GetEntity(ctx, id)
-	if err != nil {
+	v, err := s.res.GetEntity(ctx, workspaceId, id)
+	if err == nil {
 		s.stash.Set(key, v, 0)
 	}
 	return v, err
 }
 
+func (s *cachingResource) GetSceneDocument(ctx context.Context, workspaceId string, sceneId string) (*models.SceneDocument, error) {
+	// not cached, scenes can be edited from Grafana
+	return s.res.GetSceneDocument(ctx, workspaceId, sceneId)
+}
+
 func (s *cachingResource) ListWorkspaces(ctx context.Context) ([]models.SelectableString, error) {
 	key := "ListWorkspaces/"
 	val, ok := s.stash.Get(key)
@@ -51,14 +57,14 @@ func (s *cachingResource) ListWorkspaces(ctx context.Context) ([]models.Selectab
 	}
 
 	v, err := s.res.ListWorkspaces(ctx)
-	if err != nil {
+	if err == nil {
 		s.stash.Set(key, v, 0)
 	}
 	return v, err
 }
 
-func (s *cachingResource) ListScenes(ctx context.Context) ([]models.SelectableString, error) {
-	key := "ListScenes/"
+func (s *cachingResource) ListScenes(ctx context.Context, workspaceId string) ([]models.SelectableString, error) {
+	key := "ListScenes/" + workspaceId
 	val, ok := s.stash.Get(key)
 	if ok {
 		v, ok := val.([]models.SelectableString)
@@ -67,15 +73,15 @@ func (s *cachingResource) ListScenes(ctx context.Context) ([]models.SelectableSt
 		}
 	}
 
-	v, err := s.res.ListScenes(ctx)
-	if err != nil {
+	v, err := s.res.ListScenes(ctx, workspaceId)
+	if err == nil {
 		s.stash.Set(key, v, 0)
 	}
 	return v, err
 }
 
-func (s *cachingResource) ListOptions(ctx context.Context) (models.OptionsInfo, error) {
-	key := "ListOptions/"
+func (s *cachingResource) ListOptions(ctx context.Context, workspaceId string) (models.OptionsInfo, error) {
+	key := "ListOptions/" + workspaceId
 	val, ok := s.stash.Get(key)
 	if ok {
 		v, ok := val.(models.OptionsInfo)
@@ -84,15 +90,15 @@ func (s *cachingResource) ListOptions(ctx context.Context) (models.OptionsInfo,
 		}
 	}
 
-	v, err := s.res.ListOptions(ctx)
-	if err != nil {
+	v, err := s.res.ListOptions(ctx, workspaceId)
+	if err == nil {
 		s.stash.Set(key, v, 0)
 	}
 	return v, err
 }
 
-func (s *cachingResource) ListEntity(ctx context.Context, id string) ([]models.SelectableProps, error) {
-	key := "ListEntity/" + id
+func (s *cachingResource) ListEntity(ctx context.Context, workspaceId string, id string) ([]models.SelectableProps, error) {
+	key := "ListEntity/" + workspaceId + "/" + id
 	val, ok := s.stash.Get(key)
 	if ok {
 		v, ok := val.([]models.SelectableProps)
@@ -101,13 +107,103 @@ func (s *cachingResource) ListEntity(ctx context.Context, id string) ([]models.S
 		}
 	}
 
-	v, err := s.res.ListEntity(ctx, id)
-	if err != nil {
+	v, err := s.res.ListEntity(ctx, workspaceId, id)
+	if err == nil {
 		s.stash.Set(key, v, 0)
 	}
 	return v, err
 }
 
-func (s *cachingResource) BatchPutPropertyValues(ctx context.Context, entries []iottwinmakertypes.PropertyValueEntry) (*iottwinmaker.BatchPutPropertyValuesOutput, error) {
-	return s.res.BatchPutPropertyValues(ctx, entries)
+func (s *cachingResource) BatchPutPropertyValues(ctx context.Context, workspaceId string, identity models.TokenIdentity, entries []iottwinmakertypes.PropertyValueEntry) (*iottwinmaker.BatchPutPropertyValuesOutput, error) {
+	return s.res.BatchPutPropertyValues(ctx, workspaceId, identity, entries)
+}
+
+func (s *cachingResource) ImportPropertyValues(ctx context.Context, workspaceId string, identity models.TokenIdentity, rows []models.ImportRow) (*models.ImportResult, error) {
+	return s.res.ImportPropertyValues(ctx, workspaceId, identity, rows)
+}
+
+func (s *cachingResource) UpdateEntity(ctx context.Context, workspaceId string, identity models.TokenIdentity, update models.EntityUpdate) (*iottwinmaker.UpdateEntityOutput, error) {
+	v, err := s.res.UpdateEntity(ctx, workspaceId, identity, update)
+	if err == nil {
+		s.stash.Delete("GetEntity/" + workspaceId + "/" + update.EntityId)
+		s.stash.Delete("ListEntity/" + workspaceId + "/" + update.EntityId)
+		s.stash.Delete("ListOptions/" + workspaceId)
+	}
+	return v, err
+}
+
+func (s *cachingResource) GetScene(ctx context.Context, workspaceId string, sceneId string) (*iottwinmaker.GetSceneOutput, error) {
+	// not cached, scenes can be edited from Grafana
+	return s.res.GetScene(ctx, workspaceId, sceneId)
+}
+
+func (s *cachingResource) ListSceneVersions(ctx context.Context, workspaceId string, sceneId string) ([]models.SceneVersion, error) {
+	// not cached
+	return s.res.ListSceneVersions(ctx, workspaceId, sceneId)
+}
+
+func (s *cachingResource) CreateScene(ctx context.Context, workspaceId string, identity models.TokenIdentity, req models.SceneRequest) (*iottwinmaker.CreateSceneOutput, error) {
+	v, err := s.res.CreateScene(ctx, workspaceId, identity, req)
+	if err == nil {
+		s.stash.Delete("ListScenes/" + workspaceId)
+	}
+	return v, err
+}
+
+func (s *cachingResource) UpdateScene(ctx context.Context, workspaceId string, identity models.TokenIdentity, req models.SceneRequest) (*iottwinmaker.UpdateSceneOutput, error) {
+	v, err := s.res.UpdateScene(ctx, workspaceId, identity, req)
+	if err == nil {
+		s.stash.Delete("ListScenes/" + workspaceId)
+	}
+	return v, err
+}
+
+func (s *cachingResource) RollbackScene(ctx context.Context, workspaceId string, identity models.TokenIdentity, rollback models.SceneRollback) (*iottwinmaker.UpdateSceneOutput, error) {
+	v, err := s.res.RollbackScene(ctx, workspaceId, identity, rollback)
+	if err == nil {
+		s.stash.Delete("ListScenes/" + workspaceId)
+	}
+	return v, err
+}
+
+// video URLs are dropped from the cache this long before they expire, so players never get a dying URL
+const videoURLExpiryMargin = 2 * time.Minute
+
+func (s *cachingResource) GetVideoStreamURL(ctx context.Context, workspaceId string, req models.VideoStreamRequest) (*models.VideoStreamURL, error) {
+	// applies the default expiry first, so requests with and without it share the URL
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("GetVideoStreamURL/%s/%s/%s/%s/%d", workspaceId, req.EntityId, req.ComponentName, req.Protocol, req.ExpiresSeconds)
+	if req.Start != nil {
+		key += fmt.Sprintf("/%d", req.Start.Unix())
+	}
+	if req.End != nil {
+		key += fmt.Sprintf("/%d", req.End.Unix())
+	}
+	val, ok := s.stash.Get(key)
+	if ok {
+		v, ok := val.(*models.VideoStreamURL)
+		if ok {
+			return v, nil
+		}
+	}
+
+	v, err := s.res.GetVideoStreamURL(ctx, workspaceId, req)
+	if err == nil {
+		// cached until shortly before the URL expires, rather than for the resource ttl
+		if ttl := time.Until(v.Expiration) - videoURLExpiryMargin; ttl > 0 {
+			s.stash.Set(key, v, ttl)
+		}
+	}
+	return v, err
+}
+
+func (s *cachingResource) RequestVideoUpload(ctx context.Context, workspaceId string, identity models.TokenIdentity, req models.VideoUploadRequest) (*models.VideoUploadStatus, error) {
+	return s.res.RequestVideoUpload(ctx, workspaceId, identity, req)
+}
+
+func (s *cachingResource) GetVideoUploadStatus(ctx context.Context, workspaceId string, entityId string, componentName string) (*models.VideoUploadStatus, error) {
+	// not cached, the status is polled while the upload runs
+	return s.res.GetVideoUploadStatus(ctx, workspaceId, entityId, componentName)
 }
@@ -0,0 +1,96 @@
+package twinmaker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyResources fails the first call to ListWorkspaces
+type flakyResources struct {
+	TwinMakerResources
+	calls int
+}
+
+func (r *flakyResources) ListWorkspaces(ctx context.Context) ([]models.SelectableString, error) {
+	r.calls++
+	if r.calls == 1 {
+		return nil, fmt.Errorf("throttled")
+	}
+	return []models.SelectableString{{Value: "ws", Label: "ws"}}, nil
+}
+
+func TestCachingResourceSkipsErrors(t *testing.T) {
+	res := &flakyResources{}
+	cached := NewCachingResource(res, time.Minute)
+
+	_, err := cached.ListWorkspaces(context.Background())
+	require.Error(t, err)
+
+	// the failure is not cached, and the success is
+	for i := 0; i < 2; i++ {
+		v, err := cached.ListWorkspaces(context.Background())
+		require.NoError(t, err)
+		require.Len(t, v, 1)
+	}
+	require.Equal(t, 2, res.calls)
+}
+
+// entityResources counts ListOptions calls and accepts every update
+type entityResources struct {
+	TwinMakerResources
+	listCalls int
+}
+
+func (r *entityResources) ListOptions(ctx context.Context, workspaceId string) (models.OptionsInfo, error) {
+	r.listCalls++
+	return models.OptionsInfo{}, nil
+}
+
+func (r *entityResources) UpdateEntity(ctx context.Context, workspaceId string, identity models.TokenIdentity, update models.EntityUpdate) (*iottwinmaker.UpdateEntityOutput, error) {
+	return &iottwinmaker.UpdateEntityOutput{}, nil
+}
+
+func TestCachingResourceUpdateEntity(t *testing.T) {
+	res := &entityResources{}
+	cached := NewCachingResource(res, time.Minute)
+	ctx := context.Background()
+
+	_, err := cached.ListOptions(ctx, "ws")
+	require.NoError(t, err)
+	_, err = cached.UpdateEntity(ctx, "ws", models.TokenIdentity{}, models.EntityUpdate{EntityId: "pump-1"})
+	require.NoError(t, err)
+	_, err = cached.ListOptions(ctx, "ws")
+	require.NoError(t, err)
+	require.Equal(t, 2, res.listCalls)
+}
+
+// videoResources counts GetVideoStreamURL calls
+type videoResources struct {
+	TwinMakerResources
+	calls int
+}
+
+func (r *videoResources) GetVideoStreamURL(ctx context.Context, workspaceId string, req models.VideoStreamRequest) (*models.VideoStreamURL, error) {
+	r.calls++
+	return &models.VideoStreamURL{Expiration: time.Now().Add(time.Duration(req.ExpiresSeconds) * time.Second)}, nil
+}
+
+func TestCachingResourceVideoURLDefaultExpiry(t *testing.T) {
+	res := &videoResources{}
+	cached := NewCachingResource(res, time.Minute)
+	ctx := context.Background()
+
+	req := models.VideoStreamRequest{EntityId: "camera-1", ComponentName: "video", Protocol: models.VideoProtocolHLS}
+	_, err := cached.GetVideoStreamURL(ctx, "ws", req)
+	require.NoError(t, err)
+	req.ExpiresSeconds = int(models.DefaultVideoURLExpiry.Seconds())
+	_, err = cached.GetVideoStreamURL(ctx, "ws", req)
+	require.NoError(t, err)
+	require.Equal(t, 1, res.calls)
+}
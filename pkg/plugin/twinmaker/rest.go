@@ -0,0 +1,137 @@
+package twinmaker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go"
+)
+
+// rest responses are small JSON documents
+const maxRESTResponseBytes = 1 << 20
+
+// sha256 of an empty payload, sent with GET requests
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// restClient sends signed JSON requests to a service without a client module in this build.  Only a
+// few calls of each service are needed, callers resolve the endpoint and type the request and response.
+type restClient struct {
+	cfg     aws.Config
+	signer  *v4.Signer
+	now     func() time.Time
+	service string
+}
+
+// newRESTClient uses the region, credentials and HTTP client of cfg, service is the signing name
+func newRESTClient(cfg aws.Config, service string) restClient {
+	return restClient{
+		cfg:     cfg,
+		signer:  v4.NewSigner(),
+		now:     time.Now,
+		service: service,
+	}
+}
+
+// do sends a signed request with in as the JSON body, and decodes the JSON response into out.
+// A nil in sends no body.
+func (c *restClient) do(ctx context.Context, method string, u string, in interface{}, out interface{}) error {
+	var body []byte
+	payloadHash := emptyPayloadHash
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+		hash := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(hash[:])
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.cfg.Credentials == nil {
+		return fmt.Errorf("no AWS credentials for %s", c.service)
+	}
+	creds, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.signer.SignHTTP(ctx, creds, req, payloadHash, c.service, c.cfg.Region, c.now()); err != nil {
+		return err
+	}
+
+	var httpClient aws.HTTPClient = http.DefaultClient
+	if c.cfg.HTTPClient != nil {
+		httpClient = c.cfg.HTTPClient
+	}
+	rsp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rsp.Body.Close() }()
+
+	rspBody, err := io.ReadAll(io.LimitReader(rsp.Body, maxRESTResponseBytes))
+	if err != nil {
+		return err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return restError(rsp, rspBody)
+	}
+	if out == nil || len(rspBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(rspBody, out)
+}
+
+// restError reads the error code and message, so the error is mapped like any other AWS error
+func restError(rsp *http.Response, body []byte) error {
+	e := struct {
+		Message   string `json:"Message"`
+		LowerCase string `json:"message"`
+	}{}
+	_ = json.Unmarshal(body, &e)
+	code := rsp.Header.Get("X-Amzn-ErrorType")
+	if i := strings.IndexByte(code, ':'); i >= 0 {
+		code = code[:i]
+	}
+	if code == "" {
+		code = fmt.Sprintf("HTTP %d", rsp.StatusCode)
+	}
+	msg := e.Message
+	if msg == "" {
+		msg = e.LowerCase
+	}
+	return &smithy.GenericAPIError{Code: code, Message: msg}
+}
+
+// epochSeconds is a timestamp sent and read as seconds since the epoch, the JSON timestamp format of AWS
+type epochSeconds time.Time
+
+func (t epochSeconds) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatFloat(float64(time.Time(t).UnixMilli())/1000, 'f', -1, 64)), nil
+}
+
+func (t *epochSeconds) UnmarshalJSON(b []byte) error {
+	seconds, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return err
+	}
+	*t = epochSeconds(time.UnixMilli(int64(math.Round(seconds * 1000))).UTC())
+	return nil
+}
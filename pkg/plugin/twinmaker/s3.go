@@ -0,0 +1,131 @@
+package twinmaker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+)
+
+// scene documents larger than this are not loaded
+const maxS3ObjectBytes = 16 << 20
+
+// s3ObjectClient reads and writes scene documents in the workspace bucket
+type s3ObjectClient struct {
+	client *s3.Client
+}
+
+func newS3ObjectClient(cfg aws.Config, optFns ...func(*s3.Options)) *s3ObjectClient {
+	return &s3ObjectClient{client: s3.NewFromConfig(cfg, optFns...)}
+}
+
+// GetObject returns the content of the object
+func (c *s3ObjectClient) GetObject(ctx context.Context, bucket string, key string) ([]byte, error) {
+	out, err := c.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Error(http.MethodGet, bucket, key, err)
+	}
+	defer func() { _ = out.Body.Close() }()
+
+	if aws.ToInt64(out.ContentLength) > maxS3ObjectBytes {
+		return nil, fmt.Errorf("s3://%s/%s is larger than %d bytes", bucket, key, maxS3ObjectBytes)
+	}
+	body, err := io.ReadAll(io.LimitReader(out.Body, maxS3ObjectBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxS3ObjectBytes {
+		return nil, fmt.Errorf("s3://%s/%s is larger than %d bytes", bucket, key, maxS3ObjectBytes)
+	}
+	return body, nil
+}
+
+// PutObject replaces the content of the object with a JSON document
+func (c *s3ObjectClient) PutObject(ctx context.Context, bucket string, key string, body []byte) error {
+	if len(body) > maxS3ObjectBytes {
+		return fmt.Errorf("s3://%s/%s can not be larger than %d bytes", bucket, key, maxS3ObjectBytes)
+	}
+	_, err := c.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return s3Error(http.MethodPut, bucket, key, err)
+	}
+	return nil
+}
+
+// ListObjects returns every object under the prefix
+func (c *s3ObjectClient) ListObjects(ctx context.Context, bucket string, prefix string) ([]models.S3Object, error) {
+	objects := []models.S3Object{}
+	pages := s3.NewListObjectsV2Paginator(c.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, s3Error(http.MethodGet, bucket, prefix, err)
+		}
+		for _, o := range page.Contents {
+			key := aws.ToString(o.Key)
+			objects = append(objects, models.S3Object{
+				URI:          "s3://" + bucket + "/" + key,
+				Key:          key,
+				LastModified: aws.ToTime(o.LastModified),
+				Size:         aws.ToInt64(o.Size),
+			})
+		}
+	}
+	return objects, nil
+}
+
+// S3Error is returned when S3 rejects a request
+type S3Error struct {
+	Method     string
+	Bucket     string
+	Key        string
+	StatusCode int
+	Err        error
+}
+
+// s3Error keeps the status of a rejected request, any other error is returned unchanged
+func s3Error(method string, bucket string, key string, err error) error {
+	var respErr *smithyhttp.ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+	return &S3Error{Method: method, Bucket: bucket, Key: key, StatusCode: respErr.HTTPStatusCode(), Err: err}
+}
+
+func (e *S3Error) Error() string {
+	action := "reading"
+	if e.Method == http.MethodPut {
+		action = "writing"
+	}
+	msg := fmt.Sprintf("error %s s3://%s/%s: status %d", action, e.Bucket, e.Key, e.StatusCode)
+	switch e.StatusCode {
+	case http.StatusForbidden:
+		msg += " (check the datasource roles can access the workspace bucket)"
+	case http.StatusNotFound:
+		msg += " (the object does not exist)"
+	}
+	return msg
+}
+
+func (e *S3Error) Unwrap() error {
+	return e.Err
+}
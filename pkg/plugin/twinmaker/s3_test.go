@@ -0,0 +1,106 @@
+package twinmaker
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/require"
+)
+
+// rewriteTransport sends every request to the test server, with the host it was sent to
+type rewriteTransport struct {
+	target string
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+	req.URL.Scheme = "http"
+	req.URL.Host = strings.TrimPrefix(t.target, "http://")
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestS3ObjectClient(t *testing.T) {
+	requests := []*http.Request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if strings.HasSuffix(r.URL.Path, "missing.json") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"specVersion":"1.0"}`))
+	}))
+	defer server.Close()
+
+	c := newS3ObjectClient(aws.Config{
+		Region: "eu-west-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		}),
+		HTTPClient: &http.Client{Transport: rewriteTransport{target: server.URL}},
+	})
+
+	body, err := c.GetObject(context.Background(), "scene-bucket", "scenes/factory 1.json")
+	require.NoError(t, err)
+	require.Equal(t, `{"specVersion":"1.0"}`, string(body))
+	require.Equal(t, "scene-bucket.s3.eu-west-1.amazonaws.com", requests[0].Host)
+	require.Equal(t, "/scenes/factory 1.json", requests[0].URL.Path)
+	require.Contains(t, requests[0].Header.Get("Authorization"), "Credential=AKID/")
+	require.Contains(t, requests[0].Header.Get("Authorization"), "/eu-west-1/s3/aws4_request")
+
+	_, err = c.GetObject(context.Background(), "scene-bucket", "missing.json")
+	require.ErrorContains(t, err, "status 404 (the object does not exist)")
+}
+
+func TestS3ObjectClientWrite(t *testing.T) {
+	requests := []*http.Request{}
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		switch {
+		case r.Method == http.MethodPut:
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Query().Get("continuation-token") == "":
+			_, _ = w.Write([]byte(`<ListBucketResult>
+  <Contents><Key>scene.versions/20240101T000000.000Z.json</Key><LastModified>2024-01-01T00:00:00.000Z</LastModified><Size>12</Size></Contents>
+  <IsTruncated>true</IsTruncated>
+  <NextContinuationToken>page-2</NextContinuationToken>
+</ListBucketResult>`))
+		default:
+			_, _ = w.Write([]byte(`<ListBucketResult>
+  <Contents><Key>scene.versions/20240201T000000.000Z.json</Key><LastModified>2024-02-01T00:00:00.000Z</LastModified><Size>34</Size></Contents>
+  <IsTruncated>false</IsTruncated>
+</ListBucketResult>`))
+		}
+	}))
+	defer server.Close()
+
+	c := newS3ObjectClient(aws.Config{
+		Region: "eu-west-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		}),
+		HTTPClient: &http.Client{Transport: rewriteTransport{target: server.URL}},
+	})
+
+	err := c.PutObject(context.Background(), "scene-bucket", "scene.json", []byte(`{"specVersion":"1.0"}`))
+	require.NoError(t, err)
+	require.Equal(t, http.MethodPut, requests[0].Method)
+	require.Equal(t, `{"specVersion":"1.0"}`, bodies[0])
+
+	objects, err := c.ListObjects(context.Background(), "scene-bucket", "scene.versions/")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	require.Equal(t, "s3://scene-bucket/scene.versions/20240101T000000.000Z.json", objects[0].URI)
+	require.Equal(t, int64(34), objects[1].Size)
+	require.Equal(t, "scene.versions/", requests[1].URL.Query().Get("prefix"))
+	require.Equal(t, "page-2", requests[2].URL.Query().Get("continuation-token"))
+}
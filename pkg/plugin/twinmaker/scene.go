@@ -0,0 +1,218 @@
+package twinmaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func (r *twinMakerResource) GetScene(ctx context.Context, workspaceId string, sceneId string) (*iottwinmaker.GetSceneOutput, error) {
+	if sceneId == "" {
+		return nil, models.MissingFieldError("sceneId")
+	}
+	return r.client.GetScene(ctx, models.TwinMakerQuery{
+		WorkspaceId: workspaceId,
+		SceneId:     sceneId,
+	})
+}
+
+// CreateScene saves the document as the first version, then creates the scene pointing at it
+func (r *twinMakerResource) CreateScene(ctx context.Context, workspaceId string, identity models.TokenIdentity, req models.SceneRequest) (*iottwinmaker.CreateSceneOutput, error) {
+	if err := req.Validate(true); err != nil {
+		return nil, err
+	}
+
+	bucket, err := r.workspaceBucket(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	base := req.ContentLocation
+	if base == "" {
+		base = "s3://" + bucket + "/" + req.SceneId + ".json"
+	} else if b, _, _ := models.SplitS3URI(base); b != bucket {
+		return nil, &models.ValidationError{Errors: []models.FieldError{{Path: "contentLocation", Message: "must be in the workspace bucket " + bucket}}}
+	}
+
+	// a new object, so a failed create never replaces the document of another scene
+	location, version := newSceneVersion(base)
+	err = r.client.PutS3Object(ctx, workspaceId, location, req.Document)
+	var rsp *iottwinmaker.CreateSceneOutput
+	if err == nil {
+		rsp, err = r.client.CreateScene(ctx, &iottwinmaker.CreateSceneInput{
+			WorkspaceId:     aws.String(workspaceId),
+			SceneId:         aws.String(req.SceneId),
+			ContentLocation: aws.String(location),
+			Description:     req.Description,
+			Capabilities:    req.Capabilities,
+			SceneMetadata:   req.SceneMetadata,
+		})
+	}
+	auditSceneWrite("CreateScene", workspaceId, identity, req.SceneId, location, version, err)
+	return rsp, err
+}
+
+// UpdateScene saves the new document as a version, and switches the scene to it along with the
+// settings.  The current document is never written, so a failed update leaves the scene as it was,
+// and the unused version is listed like any other.
+func (r *twinMakerResource) UpdateScene(ctx context.Context, workspaceId string, identity models.TokenIdentity, req models.SceneRequest) (*iottwinmaker.UpdateSceneOutput, error) {
+	if err := req.Validate(false); err != nil {
+		return nil, err
+	}
+	scene, err := r.GetScene(ctx, workspaceId, req.SceneId)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &iottwinmaker.UpdateSceneInput{
+		WorkspaceId:   aws.String(workspaceId),
+		SceneId:       aws.String(req.SceneId),
+		Description:   req.Description,
+		Capabilities:  req.Capabilities,
+		SceneMetadata: req.SceneMetadata,
+	}
+	location := aws.ToString(scene.ContentLocation)
+	version := ""
+	if len(req.Document) > 0 {
+		if err := r.keepSceneDocument(ctx, workspaceId, location); err != nil {
+			return nil, err
+		}
+		location, version = newSceneVersion(location)
+		input.ContentLocation = aws.String(location)
+		err = r.client.PutS3Object(ctx, workspaceId, location, req.Document)
+	}
+	var rsp *iottwinmaker.UpdateSceneOutput
+	if err == nil {
+		// always sent, so the update time of the scene moves along with its document
+		rsp, err = r.client.UpdateScene(ctx, input)
+	}
+	auditSceneWrite("UpdateScene", workspaceId, identity, req.SceneId, location, version, err)
+	return rsp, err
+}
+
+// ListSceneVersions returns the documents saved for the scene other than the current one, newest first
+func (r *twinMakerResource) ListSceneVersions(ctx context.Context, workspaceId string, sceneId string) ([]models.SceneVersion, error) {
+	scene, err := r.GetScene(ctx, workspaceId, sceneId)
+	if err != nil {
+		return nil, err
+	}
+	prefix := models.SceneVersionsPrefix(aws.ToString(scene.ContentLocation))
+	objects, err := r.client.ListS3Objects(ctx, workspaceId, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]models.SceneVersion, 0, len(objects))
+	for _, o := range objects {
+		if o.URI == aws.ToString(scene.ContentLocation) {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(o.URI, prefix), ".json")
+		if _, err := models.ParseSceneVersion(name); err != nil {
+			continue
+		}
+		versions = append(versions, models.SceneVersion{
+			Version:      name,
+			Location:     o.URI,
+			LastModified: o.LastModified,
+			Size:         o.Size,
+		})
+	}
+	slices.SortFunc(versions, func(a, b models.SceneVersion) int {
+		return strings.Compare(b.Version, a.Version)
+	})
+	return versions, nil
+}
+
+// RollbackScene saves an earlier document as a new version and switches the scene to it.  The
+// replaced document stays a version too, so a rollback can itself be undone.
+func (r *twinMakerResource) RollbackScene(ctx context.Context, workspaceId string, identity models.TokenIdentity, rollback models.SceneRollback) (*iottwinmaker.UpdateSceneOutput, error) {
+	if err := rollback.Validate(); err != nil {
+		return nil, err
+	}
+	scene, err := r.GetScene(ctx, workspaceId, rollback.SceneId)
+	if err != nil {
+		return nil, err
+	}
+	location := aws.ToString(scene.ContentLocation)
+	doc, err := r.client.GetS3Object(ctx, workspaceId, models.SceneVersionLocation(location, rollback.Version))
+	if err != nil {
+		var s3Err *S3Error
+		if errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusNotFound {
+			return nil, &models.ValidationError{Errors: []models.FieldError{{Path: "version", Message: "unknown version " + rollback.Version}}}
+		}
+		return nil, err
+	}
+	return r.UpdateScene(ctx, workspaceId, identity, models.SceneRequest{
+		SceneId:  rollback.SceneId,
+		Document: doc,
+	})
+}
+
+// newSceneVersion names a new version, and returns its location next to the scene document
+func newSceneVersion(location string) (string, string) {
+	version := models.NewSceneVersion(time.Now())
+	return models.SceneVersionLocation(location, version), version
+}
+
+// keepSceneDocument copies a document that is not a version yet, like one the scene was created with
+// outside of Grafana, to a version so it can still be rolled back to
+func (r *twinMakerResource) keepSceneDocument(ctx context.Context, workspaceId string, location string) error {
+	if models.IsSceneVersionLocation(location) {
+		return nil
+	}
+	current, err := r.client.GetS3Object(ctx, workspaceId, location)
+	var s3Err *S3Error
+	switch {
+	case err == nil:
+		versionLocation, _ := newSceneVersion(location)
+		if err := r.client.PutS3Object(ctx, workspaceId, versionLocation, current); err != nil {
+			return fmt.Errorf("error saving the current scene document: %w", err)
+		}
+	case errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusNotFound:
+		// nothing to keep
+	default:
+		return err
+	}
+	return nil
+}
+
+// workspaceBucket returns the bucket name from the S3 location of the workspace
+func (r *twinMakerResource) workspaceBucket(ctx context.Context, workspaceId string) (string, error) {
+	ws, err := r.client.GetWorkspace(ctx, models.TwinMakerQuery{WorkspaceId: workspaceId})
+	if err != nil {
+		return "", err
+	}
+	location := aws.ToString(ws.S3Location)
+	if a, err := arn.Parse(location); err == nil && a.Service == "s3" && a.Resource != "" {
+		return a.Resource, nil
+	}
+	return "", fmt.Errorf("workspace %s has an invalid S3 location %q", workspaceId, location)
+}
+
+func auditSceneWrite(action string, workspaceId string, identity models.TokenIdentity, sceneId string, location string, version string, err error) {
+	status := "ok"
+	if err != nil {
+		status = "failed"
+	}
+	backend.Logger.Info("audit: "+action,
+		"user", identity.Login,
+		"email", identity.Email,
+		"role", identity.Role,
+		"workspace", workspaceId,
+		"sceneId", sceneId,
+		"contentLocation", location,
+		"savedVersion", version,
+		"status", status,
+	)
+}
@@ -0,0 +1,248 @@
+package twinmaker
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+// sceneClient keeps the objects of a workspace bucket in memory
+type sceneClient struct {
+	TwinMakerClient
+	objects map[string]string
+	scenes  map[string]string
+	updates []*iottwinmaker.UpdateSceneInput
+	// returned by UpdateScene
+	updateErr error
+	// GetScene and GetS3Object calls
+	sceneCalls  int
+	objectCalls int
+}
+
+func newSceneClient() *sceneClient {
+	return &sceneClient{
+		objects: map[string]string{},
+		scenes:  map[string]string{},
+	}
+}
+
+func (c *sceneClient) GetWorkspace(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetWorkspaceOutput, error) {
+	return &iottwinmaker.GetWorkspaceOutput{S3Location: aws.String("arn:aws:s3:::ws-bucket")}, nil
+}
+
+func (c *sceneClient) GetScene(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetSceneOutput, error) {
+	c.sceneCalls++
+	location, ok := c.scenes[query.SceneId]
+	if !ok {
+		return nil, &S3Error{StatusCode: http.StatusNotFound}
+	}
+	return &iottwinmaker.GetSceneOutput{SceneId: aws.String(query.SceneId), ContentLocation: aws.String(location)}, nil
+}
+
+func (c *sceneClient) CreateScene(ctx context.Context, req *iottwinmaker.CreateSceneInput) (*iottwinmaker.CreateSceneOutput, error) {
+	c.scenes[aws.ToString(req.SceneId)] = aws.ToString(req.ContentLocation)
+	return &iottwinmaker.CreateSceneOutput{}, nil
+}
+
+func (c *sceneClient) UpdateScene(ctx context.Context, req *iottwinmaker.UpdateSceneInput) (*iottwinmaker.UpdateSceneOutput, error) {
+	c.updates = append(c.updates, req)
+	if c.updateErr != nil {
+		return nil, c.updateErr
+	}
+	if req.ContentLocation != nil {
+		c.scenes[aws.ToString(req.SceneId)] = aws.ToString(req.ContentLocation)
+	}
+	return &iottwinmaker.UpdateSceneOutput{}, nil
+}
+
+func (c *sceneClient) GetS3Object(ctx context.Context, workspaceId string, uri string) ([]byte, error) {
+	c.objectCalls++
+	v, ok := c.objects[uri]
+	if !ok {
+		return nil, &S3Error{StatusCode: http.StatusNotFound}
+	}
+	return []byte(v), nil
+}
+
+func (c *sceneClient) PutS3Object(ctx context.Context, workspaceId string, uri string, body []byte) error {
+	c.objects[uri] = string(body)
+	return nil
+}
+
+func (c *sceneClient) ListS3Objects(ctx context.Context, workspaceId string, prefix string) ([]models.S3Object, error) {
+	objects := []models.S3Object{}
+	for uri := range c.objects {
+		if strings.HasPrefix(uri, prefix) {
+			objects = append(objects, models.S3Object{URI: uri, Size: int64(len(c.objects[uri]))})
+		}
+	}
+	return objects, nil
+}
+
+func (c *sceneClient) ListScenes(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListScenesOutput, error) {
+	ids := slices.Sorted(maps.Keys(c.scenes))
+	rsp := &iottwinmaker.ListScenesOutput{}
+	for _, id := range ids {
+		rsp.SceneSummaries = append(rsp.SceneSummaries, iottwinmakertypes.SceneSummary{
+			SceneId:          aws.String(id),
+			ContentLocation:  aws.String(c.scenes[id]),
+			CreationDateTime: aws.Time(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+		})
+	}
+	return rsp, nil
+}
+
+func TestListSceneDetails(t *testing.T) {
+	client := newSceneClient()
+	client.scenes["broken"] = "s3://ws-bucket/broken.json"
+	client.scenes["factory"] = "s3://ws-bucket/factory.json"
+	client.objects["s3://ws-bucket/factory.json"] = `{"nodes":[
+		{"name":"a","components":[{"type":"Tag","valueDataBinding":{"dataBindingContext":{"entityId":"pump-1"}}}]},
+		{"name":"b","components":[{"type":"Tag","valueDataBinding":{"dataBindingContext":{"entityId":"pump-1"}}}]},
+		{"name":"c","components":[{"type":"Tag","valueDataBinding":{"dataBindingContext":{"entityId":"pump-2"}}}]}
+	]}`
+
+	dr := NewTwinMakerHandler(client).ListScenes(context.Background(), models.TwinMakerQuery{WorkspaceId: "ws", SceneDetails: true})
+	require.NoError(t, dr.Error)
+	frame := dr.Frames[0]
+
+	nodes, _ := frame.FieldByName("nodes")
+	bound, _ := frame.FieldByName("boundEntities")
+	require.Nil(t, nodes.At(0))
+	require.Equal(t, int64(3), *nodes.At(1).(*int64))
+	require.Equal(t, int64(2), *bound.At(1).(*int64))
+
+	require.Len(t, frame.Meta.Notices, 1)
+	require.Contains(t, frame.Meta.Notices[0].Text, "details could not be loaded for 1 scenes: broken")
+}
+
+func TestListSceneDetailsCached(t *testing.T) {
+	client := newSceneClient()
+	client.scenes["factory"] = "s3://ws-bucket/factory.versions/20240101T000000.000Z-00000000.json"
+	client.objects["s3://ws-bucket/factory.versions/20240101T000000.000Z-00000000.json"] = `{"nodes":[{"name":"a"}]}`
+	handler := NewTwinMakerHandler(NewCachingClient(client, time.Minute))
+
+	for i := 0; i < 2; i++ {
+		dr := handler.ListScenes(context.Background(), models.TwinMakerQuery{WorkspaceId: "ws", SceneDetails: true})
+		require.NoError(t, dr.Error)
+		nodes, _ := dr.Frames[0].FieldByName("nodes")
+		require.Equal(t, int64(1), *nodes.At(0).(*int64))
+	}
+	require.Equal(t, 2, client.sceneCalls)
+	require.Equal(t, 1, client.objectCalls)
+
+	// a write points the scene at a new version, which is shown right away
+	client.scenes["factory"] = "s3://ws-bucket/factory.versions/20240102T000000.000Z-00000000.json"
+	client.objects["s3://ws-bucket/factory.versions/20240102T000000.000Z-00000000.json"] = `{"nodes":[{"name":"a"},{"name":"b"}]}`
+	dr := handler.ListScenes(context.Background(), models.TwinMakerQuery{WorkspaceId: "ws", SceneDetails: true})
+	require.NoError(t, dr.Error)
+	nodes, _ := dr.Frames[0].FieldByName("nodes")
+	require.Equal(t, int64(2), *nodes.At(0).(*int64))
+}
+
+func TestSceneVersions(t *testing.T) {
+	ctx := context.Background()
+	identity := models.TokenIdentity{Login: "jane"}
+	client := newSceneClient()
+	res := NewTwinMakerResource(client)
+
+	_, err := res.CreateScene(ctx, "ws", identity, models.SceneRequest{
+		SceneId:      "factory",
+		Capabilities: []string{"DYNAMIC_SCENE"},
+		Document:     []byte(`{"specVersion":"1.0","nodes":[{"name":"v1"}]}`),
+	})
+	require.NoError(t, err)
+	created := client.scenes["factory"]
+	require.True(t, strings.HasPrefix(created, "s3://ws-bucket/factory.versions/"))
+	require.Contains(t, client.objects[created], "v1")
+
+	_, err = res.UpdateScene(ctx, "ws", identity, models.SceneRequest{
+		SceneId:  "factory",
+		Document: []byte(`{"specVersion":"1.0","nodes":[{"name":"v2"}]}`),
+	})
+	require.NoError(t, err)
+	require.NotEqual(t, created, client.scenes["factory"])
+	require.Contains(t, client.objects[client.scenes["factory"]], "v2")
+	require.Contains(t, client.objects[created], "v1")
+	require.Len(t, client.updates, 1)
+
+	versions, err := res.ListSceneVersions(ctx, "ws", "factory")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	require.Equal(t, created, versions[0].Location)
+
+	_, err = res.RollbackScene(ctx, "ws", identity, models.SceneRollback{SceneId: "factory", Version: versions[0].Version})
+	require.NoError(t, err)
+	require.Contains(t, client.objects[client.scenes["factory"]], "v1")
+
+	// the rolled back document is kept too
+	versions, err = res.ListSceneVersions(ctx, "ws", "factory")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+
+	_, err = res.RollbackScene(ctx, "ws", identity, models.SceneRollback{SceneId: "factory", Version: "20000101T000000.000Z"})
+	require.True(t, models.IsValidationError(err))
+}
+
+func TestSceneUpdateFailureKeepsDocument(t *testing.T) {
+	ctx := context.Background()
+	client := newSceneClient()
+	client.scenes["factory"] = "s3://ws-bucket/factory.json"
+	client.objects["s3://ws-bucket/factory.json"] = `{"specVersion":"1.0","nodes":[{"name":"v1"}]}`
+	client.updateErr = fmt.Errorf("throttled")
+	res := NewTwinMakerResource(client)
+
+	_, err := res.UpdateScene(ctx, "ws", models.TokenIdentity{}, models.SceneRequest{
+		SceneId:  "factory",
+		Document: []byte(`{"specVersion":"1.0","nodes":[{"name":"v2"}]}`),
+	})
+	require.Error(t, err)
+	require.Equal(t, "s3://ws-bucket/factory.json", client.scenes["factory"])
+	require.Contains(t, client.objects["s3://ws-bucket/factory.json"], "v1")
+}
+
+func TestSceneVersionNames(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := models.NewSceneVersion(now)
+	b := models.NewSceneVersion(now)
+	require.NotEqual(t, a, b)
+	parsed, err := models.ParseSceneVersion(a)
+	require.NoError(t, err)
+	require.Equal(t, now, parsed)
+	require.Equal(t, "s3://ws-bucket/factory.versions/x.json", models.SceneVersionLocation("s3://ws-bucket/factory.versions/"+a+".json", "x"))
+}
+
+func TestSceneRequestValidation(t *testing.T) {
+	ctx := context.Background()
+	client := newSceneClient()
+	res := NewTwinMakerResource(client)
+
+	_, err := res.CreateScene(ctx, "ws", models.TokenIdentity{}, models.SceneRequest{
+		SceneId:  "bad id!",
+		Document: []byte(`{"nodes":[{"name":"a","children":[3]}]}`),
+	})
+	require.True(t, models.IsValidationError(err))
+	require.ErrorContains(t, err, "sceneId")
+	require.ErrorContains(t, err, "unknown child 3")
+	require.Empty(t, client.objects)
+
+	_, err = res.CreateScene(ctx, "ws", models.TokenIdentity{}, models.SceneRequest{
+		SceneId:         "factory",
+		ContentLocation: "s3://other-bucket/factory.json",
+		Document:        []byte(`{"nodes":[]}`),
+	})
+	require.True(t, models.IsValidationError(err))
+	require.ErrorContains(t, err, "must be in the workspace bucket ws-bucket")
+	require.Empty(t, client.objects)
+}
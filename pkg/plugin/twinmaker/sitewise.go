@@ -0,0 +1,440 @@
+package twinmaker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+)
+
+// siteWiseClient writes upload requests to edge video connectors, reads back their status, and reads
+// the history of SiteWise-connected properties.  The operations follow the IoT SiteWise API, with the
+// same names and shapes, over signed REST calls.
+type siteWiseClient struct {
+	restClient
+	endpoint url.URL
+}
+
+// newSiteWiseClient resolves the SiteWise endpoint with the endpoint rules of the TwinMaker client, so
+// the partition and FIPS settings of cfg apply.  Both services are named the same way in every partition.
+func newSiteWiseClient(ctx context.Context, cfg aws.Config, optFns ...func(*iottwinmaker.Options)) (*siteWiseClient, error) {
+	opts := iottwinmaker.NewFromConfig(cfg, optFns...).Options()
+	if opts.Region == "" {
+		return nil, fmt.Errorf("no IoT SiteWise endpoint, the datasource has no region")
+	}
+	endpoint, err := opts.EndpointResolverV2.ResolveEndpoint(ctx, iottwinmaker.EndpointParameters{
+		Region:       aws.String(opts.Region),
+		UseFIPS:      aws.Bool(opts.EndpointOptions.UseFIPSEndpoint == aws.FIPSEndpointStateEnabled),
+		UseDualStack: aws.Bool(opts.EndpointOptions.UseDualStackEndpoint == aws.DualStackEndpointStateEnabled),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("no IoT SiteWise endpoint for region %q: %w", opts.Region, err)
+	}
+	u := endpoint.URI
+	u.Host = strings.Replace(u.Host, "iottwinmaker", "iotsitewise", 1)
+	return &siteWiseClient{restClient: newRESTClient(cfg, "iotsitewise"), endpoint: u}, nil
+}
+
+// url of the operation, prefix is the host prefix of the API, "api." for assets and "data." for values
+func (c *siteWiseClient) url(prefix string, path string, query url.Values) string {
+	u := c.endpoint
+	u.Host = prefix + u.Host
+	u.Path = path
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+type siteWiseTimestamp struct {
+	TimeInSeconds int64 `json:"timeInSeconds"`
+	OffsetInNanos int64 `json:"offsetInNanos"`
+}
+
+func (t siteWiseTimestamp) Time() time.Time {
+	return time.Unix(t.TimeInSeconds, t.OffsetInNanos).UTC()
+}
+
+type siteWiseVariant struct {
+	DoubleValue  *float64 `json:"doubleValue,omitempty"`
+	IntegerValue *int32   `json:"integerValue,omitempty"`
+	BooleanValue *bool    `json:"booleanValue,omitempty"`
+	StringValue  *string  `json:"stringValue,omitempty"`
+}
+
+func (v siteWiseVariant) dataValue() *iottwinmakertypes.DataValue {
+	return &iottwinmakertypes.DataValue{
+		DoubleValue:  v.DoubleValue,
+		IntegerValue: v.IntegerValue,
+		BooleanValue: v.BooleanValue,
+		StringValue:  v.StringValue,
+	}
+}
+
+type siteWiseValue struct {
+	Value     siteWiseVariant   `json:"value"`
+	Timestamp siteWiseTimestamp `json:"timestamp"`
+	Quality   string            `json:"quality,omitempty"`
+}
+
+type siteWiseAssetProperty struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type describeAssetOutput struct {
+	AssetProperties []siteWiseAssetProperty `json:"assetProperties"`
+}
+
+func (c *siteWiseClient) describeAsset(ctx context.Context, assetId string) (*describeAssetOutput, error) {
+	out := &describeAssetOutput{}
+	if err := c.do(ctx, http.MethodGet, c.url("api.", "/assets/"+assetId, nil), nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type putAssetPropertyValueEntry struct {
+	EntryId        string          `json:"entryId"`
+	AssetId        string          `json:"assetId"`
+	PropertyId     string          `json:"propertyId"`
+	PropertyValues []siteWiseValue `json:"propertyValues"`
+}
+
+type batchPutAssetPropertyValueInput struct {
+	Entries []putAssetPropertyValueEntry `json:"entries"`
+}
+
+type batchPutAssetPropertyError struct {
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+type batchPutAssetPropertyValueOutput struct {
+	ErrorEntries []struct {
+		EntryId string                       `json:"entryId"`
+		Errors  []batchPutAssetPropertyError `json:"errors"`
+	} `json:"errorEntries"`
+}
+
+func (c *siteWiseClient) batchPutAssetPropertyValue(ctx context.Context, in batchPutAssetPropertyValueInput) (*batchPutAssetPropertyValueOutput, error) {
+	out := &batchPutAssetPropertyValueOutput{}
+	if err := c.do(ctx, http.MethodPost, c.url("data.", "/properties", nil), in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type getAssetPropertyValueOutput struct {
+	PropertyValue *siteWiseValue `json:"propertyValue"`
+}
+
+func (c *siteWiseClient) getAssetPropertyValue(ctx context.Context, assetId string, propertyId string) (*getAssetPropertyValueOutput, error) {
+	out := &getAssetPropertyValueOutput{}
+	u := c.url("data.", "/properties/latest", url.Values{
+		"assetId":    {assetId},
+		"propertyId": {propertyId},
+	})
+	if err := c.do(ctx, http.MethodGet, u, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type getAssetPropertyAggregatesInput struct {
+	AssetId        string
+	PropertyId     string
+	AggregateTypes []models.SiteWiseAggregate
+	Resolution     string
+	StartDate      time.Time
+	EndDate        time.Time
+	TimeOrdering   iottwinmakertypes.OrderByTime
+	MaxResults     int
+	NextToken      *string
+}
+
+func (in getAssetPropertyAggregatesInput) query() url.Values {
+	q := url.Values{
+		"assetId":      {in.AssetId},
+		"propertyId":   {in.PropertyId},
+		"resolution":   {in.Resolution},
+		"startDate":    {in.StartDate.UTC().Format(time.RFC3339)},
+		"endDate":      {in.EndDate.UTC().Format(time.RFC3339)},
+		"timeOrdering": {string(in.TimeOrdering)},
+		"maxResults":   {strconv.Itoa(in.MaxResults)},
+	}
+	for _, a := range in.AggregateTypes {
+		q.Add("aggregateTypes", string(a))
+	}
+	if in.NextToken != nil {
+		q.Set("nextToken", *in.NextToken)
+	}
+	return q
+}
+
+type siteWiseAggregates struct {
+	Average           *float64 `json:"average"`
+	Count             *float64 `json:"count"`
+	Maximum           *float64 `json:"maximum"`
+	Minimum           *float64 `json:"minimum"`
+	Sum               *float64 `json:"sum"`
+	StandardDeviation *float64 `json:"standardDeviation"`
+}
+
+func (a siteWiseAggregates) get(aggregate models.SiteWiseAggregate) *float64 {
+	switch aggregate {
+	case models.SiteWiseCount:
+		return a.Count
+	case models.SiteWiseMaximum:
+		return a.Maximum
+	case models.SiteWiseMinimum:
+		return a.Minimum
+	case models.SiteWiseSum:
+		return a.Sum
+	case models.SiteWiseStandardDeviation:
+		return a.StandardDeviation
+	}
+	return a.Average
+}
+
+type getAssetPropertyAggregatesOutput struct {
+	AggregatedValues []struct {
+		Timestamp epochSeconds       `json:"timestamp"`
+		Value     siteWiseAggregates `json:"value"`
+	} `json:"aggregatedValues"`
+	NextToken *string `json:"nextToken"`
+}
+
+func (c *siteWiseClient) getAssetPropertyAggregates(ctx context.Context, in getAssetPropertyAggregatesInput) (*getAssetPropertyAggregatesOutput, error) {
+	out := &getAssetPropertyAggregatesOutput{}
+	if err := c.do(ctx, http.MethodGet, c.url("data.", "/properties/aggregates", in.query()), nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type getInterpolatedAssetPropertyValuesInput struct {
+	AssetId            string
+	PropertyId         string
+	StartTimeInSeconds int64
+	EndTimeInSeconds   int64
+	Quality            string
+	IntervalInSeconds  int64
+	Type               models.SiteWiseInterpolation
+	MaxResults         int
+	NextToken          *string
+}
+
+func (in getInterpolatedAssetPropertyValuesInput) query() url.Values {
+	q := url.Values{
+		"assetId":            {in.AssetId},
+		"propertyId":         {in.PropertyId},
+		"startTimeInSeconds": {strconv.FormatInt(in.StartTimeInSeconds, 10)},
+		"endTimeInSeconds":   {strconv.FormatInt(in.EndTimeInSeconds, 10)},
+		"quality":            {in.Quality},
+		"intervalInSeconds":  {strconv.FormatInt(in.IntervalInSeconds, 10)},
+		"type":               {string(in.Type)},
+		"maxResults":         {strconv.Itoa(in.MaxResults)},
+	}
+	if in.NextToken != nil {
+		q.Set("nextToken", *in.NextToken)
+	}
+	return q
+}
+
+type getInterpolatedAssetPropertyValuesOutput struct {
+	InterpolatedAssetPropertyValues []struct {
+		Timestamp siteWiseTimestamp `json:"timestamp"`
+		Value     siteWiseVariant   `json:"value"`
+	} `json:"interpolatedAssetPropertyValues"`
+	NextToken *string `json:"nextToken"`
+}
+
+func (c *siteWiseClient) getInterpolatedAssetPropertyValues(ctx context.Context, in getInterpolatedAssetPropertyValuesInput) (*getInterpolatedAssetPropertyValuesOutput, error) {
+	out := &getInterpolatedAssetPropertyValuesOutput{}
+	if err := c.do(ctx, http.MethodGet, c.url("data.", "/properties/interpolated", in.query()), nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// propertyIds maps the property names of the asset to their ids
+func (c *siteWiseClient) propertyIds(ctx context.Context, assetId string) (map[string]string, error) {
+	out, err := c.describeAsset(ctx, assetId)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]string, len(out.AssetProperties))
+	for _, p := range out.AssetProperties {
+		ids[p.Name] = p.Id
+	}
+	return ids, nil
+}
+
+// RequestVideoUpload writes the window to the upload request property of the connector asset
+func (c *siteWiseClient) RequestVideoUpload(ctx context.Context, assetId string, req models.VideoUploadRequest) error {
+	ids, err := c.propertyIds(ctx, assetId)
+	if err != nil {
+		return err
+	}
+	propertyId, ok := ids[models.EdgeVideoUploadRequestProperty]
+	if !ok {
+		return fmt.Errorf("asset %s is not an edge video connector, it has no %s property", assetId, models.EdgeVideoUploadRequestProperty)
+	}
+
+	out, err := c.batchPutAssetPropertyValue(ctx, batchPutAssetPropertyValueInput{
+		Entries: []putAssetPropertyValueEntry{{
+			EntryId:    "upload",
+			AssetId:    assetId,
+			PropertyId: propertyId,
+			PropertyValues: []siteWiseValue{{
+				Value:     siteWiseVariant{StringValue: aws.String(req.UploadRequestValue())},
+				Timestamp: siteWiseTimestamp{TimeInSeconds: c.now().Unix()},
+				Quality:   "GOOD",
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range out.ErrorEntries {
+		if len(entry.Errors) > 0 {
+			return fmt.Errorf("the upload request was not written: %s %s", entry.Errors[0].ErrorCode, entry.Errors[0].ErrorMessage)
+		}
+	}
+	return nil
+}
+
+// GetVideoUploadStatus reads the latest request, uploaded and recorded spans of the connector asset
+func (c *siteWiseClient) GetVideoUploadStatus(ctx context.Context, assetId string) (*models.VideoUploadStatus, error) {
+	ids, err := c.propertyIds(ctx, assetId)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ids[models.EdgeVideoUploadRequestProperty]; !ok {
+		return nil, fmt.Errorf("asset %s is not an edge video connector, it has no %s property", assetId, models.EdgeVideoUploadRequestProperty)
+	}
+
+	status := &models.VideoUploadStatus{AssetId: assetId}
+	for _, p := range []struct {
+		name  string
+		span  **models.VideoRange
+		since **time.Time
+	}{
+		{models.EdgeVideoUploadRequestProperty, &status.Requested, &status.RequestedAt},
+		{models.EdgeVideoUploadedProperty, &status.Uploaded, &status.UploadedAt},
+		{models.EdgeVideoRecordedProperty, &status.Recorded, nil},
+	} {
+		propertyId, ok := ids[p.name]
+		if !ok {
+			continue
+		}
+		out, err := c.getAssetPropertyValue(ctx, assetId, propertyId)
+		if err != nil {
+			return nil, err
+		}
+		if out.PropertyValue == nil || out.PropertyValue.Value.StringValue == nil {
+			continue
+		}
+		span, err := models.ParseVideoRange(*out.PropertyValue.Value.StringValue)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.name, err)
+		}
+		*p.span = &span
+		if p.since != nil {
+			*p.since = aws.Time(out.PropertyValue.Timestamp.Time())
+		}
+	}
+	status.UpdateState()
+	return status, nil
+}
+
+// largest page of the history calls
+const siteWiseHistoryPageSize = 250
+
+// GetPropertyAggregates loads one aggregate of the asset property for every bucket of the range
+func (c *siteWiseClient) GetPropertyAggregates(ctx context.Context, ref models.SiteWiseReference, options models.SiteWiseOptions, from time.Time, to time.Time, order iottwinmakertypes.OrderByTime, limiter *resultLimiter) ([]iottwinmakertypes.PropertyValue, error) {
+	in := getAssetPropertyAggregatesInput{
+		AssetId:        ref.AssetId,
+		PropertyId:     ref.PropertyId,
+		AggregateTypes: []models.SiteWiseAggregate{options.Aggregate},
+		Resolution:     options.ResolutionFor(to.Sub(from)),
+		StartDate:      from,
+		EndDate:        to,
+		TimeOrdering:   iottwinmakertypes.OrderByTimeAscending,
+		MaxResults:     siteWiseHistoryPageSize,
+	}
+	if order == iottwinmakertypes.OrderByTimeDescending {
+		in.TimeOrdering = iottwinmakertypes.OrderByTimeDescending
+	}
+
+	values := []iottwinmakertypes.PropertyValue{}
+	for {
+		out, err := c.getAssetPropertyAggregates(ctx, in)
+		if err != nil {
+			return values, err
+		}
+		for _, v := range out.AggregatedValues {
+			values = append(values, iottwinmakertypes.PropertyValue{
+				Time:  getTimeStringFromTimeObject(aws.Time(time.Time(v.Timestamp))),
+				Value: &iottwinmakertypes.DataValue{DoubleValue: v.Value.get(options.Aggregate)},
+			})
+		}
+		if aws.ToString(out.NextToken) == "" {
+			return values, nil
+		}
+		if err := limiter.add(len(out.AggregatedValues), out.AggregatedValues, out.NextToken); err != nil {
+			return values, err
+		}
+		in.NextToken = out.NextToken
+	}
+}
+
+// GetInterpolatedValues loads the asset property interpolated at every interval of the range
+func (c *siteWiseClient) GetInterpolatedValues(ctx context.Context, ref models.SiteWiseReference, options models.SiteWiseOptions, from time.Time, to time.Time, order iottwinmakertypes.OrderByTime, limiter *resultLimiter) ([]iottwinmakertypes.PropertyValue, error) {
+	in := getInterpolatedAssetPropertyValuesInput{
+		AssetId:            ref.AssetId,
+		PropertyId:         ref.PropertyId,
+		StartTimeInSeconds: from.Unix(),
+		EndTimeInSeconds:   to.Unix(),
+		Quality:            "GOOD",
+		IntervalInSeconds:  options.IntervalFor(to.Sub(from)),
+		Type:               options.Interpolation,
+		MaxResults:         siteWiseHistoryPageSize,
+	}
+
+	values := []iottwinmakertypes.PropertyValue{}
+	var err error
+	for {
+		var out *getInterpolatedAssetPropertyValuesOutput
+		if out, err = c.getInterpolatedAssetPropertyValues(ctx, in); err != nil {
+			break
+		}
+		for _, v := range out.InterpolatedAssetPropertyValues {
+			values = append(values, iottwinmakertypes.PropertyValue{
+				Time:  getTimeStringFromTimeObject(aws.Time(v.Timestamp.Time())),
+				Value: v.Value.dataValue(),
+			})
+		}
+		if aws.ToString(out.NextToken) == "" {
+			break
+		}
+		if err = limiter.add(len(out.InterpolatedAssetPropertyValues), out.InterpolatedAssetPropertyValues, out.NextToken); err != nil {
+			break
+		}
+		in.NextToken = out.NextToken
+	}
+	// interpolated values are always ascending
+	if order == iottwinmakertypes.OrderByTimeDescending {
+		slices.Reverse(values)
+	}
+	return values, err
+}
@@ -0,0 +1,204 @@
+package twinmaker
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+)
+
+// how many SiteWise property histories are loaded at once
+const siteWiseHistoryConcurrency = 8
+
+// siteWiseEntityHistory reads the history of the entity component straight from IoT SiteWise.  No
+// history is returned when a property is not backed by SiteWise, so the query falls back to TwinMaker.
+func (s *twinMakerHandler) siteWiseEntityHistory(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetPropertyValueHistoryOutput, []data.Notice, error) {
+	entity, err := s.client.GetEntity(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	component, ok := entity.Components[query.ComponentName]
+	if !ok {
+		return nil, nil, &models.ValidationError{Errors: []models.FieldError{{
+			Path:    "componentName",
+			Message: fmt.Sprintf("entity %s has no component %s", query.EntityId, query.ComponentName),
+		}}}
+	}
+
+	externalId := componentExternalId(component)
+	refs := make([]models.SiteWiseReference, len(query.Properties))
+	for i, name := range query.Properties {
+		if refs[i], ok = siteWiseReference(externalId, component.Properties[name]); !ok {
+			return nil, []data.Notice{{
+				Severity: data.NoticeSeverityInfo,
+				Text:     fmt.Sprintf("property %s is not connected to IoT SiteWise, showing the TwinMaker history", name),
+			}}, nil
+		}
+	}
+
+	series, notices, err := s.loadSiteWiseHistory(ctx, query, refs)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := &iottwinmaker.GetPropertyValueHistoryOutput{}
+	for i, name := range query.Properties {
+		result.PropertyValues = append(result.PropertyValues, iottwinmakertypes.PropertyValueHistory{
+			EntityPropertyReference: &iottwinmakertypes.EntityPropertyReference{
+				EntityId:           aws.String(query.EntityId),
+				ComponentName:      aws.String(query.ComponentName),
+				PropertyName:       aws.String(name),
+				ExternalIdProperty: externalId,
+			},
+			Values: series[i],
+		})
+	}
+	return result, notices, nil
+}
+
+// siteWiseComponentHistory reads the history of every component of the component type straight from
+// IoT SiteWise.  The references are read from the entities, so no TwinMaker history is loaded, and
+// SiteWise series are loaded whole, so there is no TwinMaker token to continue from.  No history is
+// returned when a property is not backed by SiteWise, so the query falls back to TwinMaker.
+func (s *twinMakerHandler) siteWiseComponentHistory(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetPropertyValueHistoryOutput, []data.Notice, error) {
+	if len(query.Properties) == 0 {
+		return nil, nil, nil
+	}
+	q := query
+	q.EntityId = ""
+	q.ComponentName = ""
+	q.Properties = nil
+	q.PropertyFilter = nil
+	q.ListEntitiesFilter = nil
+	q.NextToken = ""
+	entities, err := s.client.ListEntities(ctx, q)
+	notices := []data.Notice{}
+	switch {
+	case isLimitExceeded(err):
+		notices = append(notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     err.Error() + ", showing the entities loaded so far",
+		})
+	case err != nil:
+		return nil, nil, err
+	}
+
+	refs := []models.SiteWiseReference{}
+	references := []*iottwinmakertypes.EntityPropertyReference{}
+	for _, summary := range entities.EntitySummaries {
+		q.EntityId = aws.ToString(summary.EntityId)
+		entity, err := s.client.GetEntity(ctx, q)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, componentName := range slices.Sorted(maps.Keys(entity.Components)) {
+			component := entity.Components[componentName]
+			if aws.ToString(component.ComponentTypeId) != query.ComponentTypeId {
+				continue
+			}
+			externalId := componentExternalId(component)
+			for _, name := range query.Properties {
+				ref, ok := siteWiseReference(externalId, component.Properties[name])
+				if !ok {
+					return nil, []data.Notice{{
+						Severity: data.NoticeSeverityInfo,
+						Text:     fmt.Sprintf("property %s of entity %s is not connected to IoT SiteWise, showing the TwinMaker history", name, q.EntityId),
+					}}, nil
+				}
+				refs = append(refs, ref)
+				references = append(references, &iottwinmakertypes.EntityPropertyReference{
+					EntityId:           aws.String(q.EntityId),
+					ComponentName:      aws.String(componentName),
+					PropertyName:       aws.String(name),
+					ExternalIdProperty: externalId,
+				})
+			}
+		}
+	}
+
+	series, historyNotices, err := s.loadSiteWiseHistory(ctx, query, refs)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := &iottwinmaker.GetPropertyValueHistoryOutput{
+		PropertyValues: []iottwinmakertypes.PropertyValueHistory{},
+	}
+	for i, ref := range references {
+		result.PropertyValues = append(result.PropertyValues, iottwinmakertypes.PropertyValueHistory{
+			EntityPropertyReference: ref,
+			Values:                  series[i],
+		})
+	}
+	return result, append(notices, historyNotices...), nil
+}
+
+// loadSiteWiseHistory loads every reference at once.  Limits only cut the history short, with a
+// notice, any other error fails the query.
+func (s *twinMakerHandler) loadSiteWiseHistory(ctx context.Context, query models.TwinMakerQuery, refs []models.SiteWiseReference) ([][]iottwinmakertypes.PropertyValue, []data.Notice, error) {
+	series := make([][]iottwinmakertypes.PropertyValue, len(refs))
+	errs := make([]error, len(refs))
+
+	wg := sync.WaitGroup{}
+	sem := make(chan struct{}, siteWiseHistoryConcurrency)
+	for i, ref := range refs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			series[i], errs[i] = s.client.GetSiteWiseHistory(ctx, query, ref)
+		}()
+	}
+	wg.Wait()
+
+	notices := []data.Notice{}
+	for _, err := range errs {
+		switch {
+		case err == nil:
+		case isLimitExceeded(err):
+			if len(notices) == 0 {
+				notices = append(notices, data.Notice{
+					Severity: data.NoticeSeverityWarning,
+					Text:     err.Error() + ", showing partial results",
+				})
+			}
+		default:
+			return nil, nil, err
+		}
+	}
+	return series, notices, nil
+}
+
+// componentExternalId collects the external ID properties of the component, as the history lookup reports them
+func componentExternalId(component iottwinmakertypes.ComponentResponse) map[string]string {
+	externalId := map[string]string{}
+	for name, p := range component.Properties {
+		if p.Definition != nil && aws.ToBool(p.Definition.IsExternalId) && p.Value != nil && p.Value.StringValue != nil {
+			externalId[name] = *p.Value.StringValue
+		}
+	}
+	return externalId
+}
+
+// siteWiseReference finds the asset property of a component property.  Components with several
+// SiteWise properties set the property id in the configuration of each property definition.
+func siteWiseReference(externalId map[string]string, property iottwinmakertypes.PropertyResponse) (models.SiteWiseReference, bool) {
+	if property.Definition != nil {
+		if propertyId := property.Definition.Configuration[models.SiteWisePropertyIdKey]; propertyId != "" {
+			return models.SiteWiseReferenceFromExternalId(map[string]string{
+				models.SiteWiseAssetIdKey:    externalId[models.SiteWiseAssetIdKey],
+				models.SiteWisePropertyIdKey: propertyId,
+			})
+		}
+	}
+	return models.SiteWiseReferenceFromExternalId(externalId)
+}
@@ -0,0 +1,254 @@
+package twinmaker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSiteWiseClient(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	var written map[string]interface{}
+	latest := map[string]string{
+		"p-request":  `{"propertyValue":{"value":{"stringValue":"{\"start-timestamp\":\"1704150000\",\"end-timestamp\":\"1704153600\"}"},"timestamp":{"timeInSeconds":1704153600}}}`,
+		"p-uploaded": `{"propertyValue":{"value":{"stringValue":"{\"start\":1704150000,\"end\":1704153000}"},"timestamp":{"timeInSeconds":1704153700}}}`,
+		"p-recorded": `{}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/assets/camera-asset":
+			_, _ = w.Write([]byte(`{"assetProperties":[
+				{"id":"p-request","name":"VideoUploadRequest"},
+				{"id":"p-uploaded","name":"VideoUploadedTimeRange"},
+				{"id":"p-recorded","name":"VideoRecordedTimeRange"}
+			]}`))
+		case "/assets/other-asset":
+			_, _ = w.Write([]byte(`{"assetProperties":[{"id":"p-temp","name":"Temperature"}]}`))
+		case "/properties":
+			_ = json.NewDecoder(r.Body).Decode(&written)
+			_, _ = w.Write([]byte(`{"errorEntries":[]}`))
+		case "/properties/aggregates":
+			q := r.URL.Query()
+			require.Equal(t, "AVERAGE", q.Get("aggregateTypes"))
+			require.Equal(t, "1m", q.Get("resolution"))
+			if q.Get("nextToken") == "" {
+				_, _ = w.Write([]byte(`{"aggregatedValues":[{"timestamp":1704150000,"value":{"average":1.5}}],"nextToken":"page-2"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"aggregatedValues":[{"timestamp":1704150060,"value":{"average":2.5}}]}`))
+		case "/properties/interpolated":
+			q := r.URL.Query()
+			require.Equal(t, "LOCF_INTERPOLATION", q.Get("type"))
+			require.Equal(t, "3", q.Get("intervalInSeconds"))
+			_, _ = w.Write([]byte(`{"interpolatedAssetPropertyValues":[
+				{"timestamp":{"timeInSeconds":1704150000},"value":{"doubleValue":1}},
+				{"timestamp":{"timeInSeconds":1704150003},"value":{"doubleValue":2}}
+			]}`))
+		case "/properties/latest":
+			require.Equal(t, "camera-asset", r.URL.Query().Get("assetId"))
+			_, _ = w.Write([]byte(latest[r.URL.Query().Get("propertyId")]))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c, err := newSiteWiseClient(context.Background(), aws.Config{
+		Region: "eu-west-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		}),
+		HTTPClient: &http.Client{Transport: rewriteTransport{target: server.URL}},
+	})
+	require.NoError(t, err)
+	c.now = func() time.Time { return now }
+
+	t.Run("request upload", func(t *testing.T) {
+		err := c.RequestVideoUpload(context.Background(), "camera-asset", models.VideoUploadRequest{
+			Start: now.Add(-time.Hour),
+			End:   now,
+		})
+		require.NoError(t, err)
+		entry := written["entries"].([]interface{})[0].(map[string]interface{})
+		require.Equal(t, "p-request", entry["propertyId"])
+		value := entry["propertyValues"].([]interface{})[0].(map[string]interface{})
+		require.Equal(t, `{"end-timestamp":"1704153600","start-timestamp":"1704150000"}`, value["value"].(map[string]interface{})["stringValue"])
+	})
+
+	t.Run("status", func(t *testing.T) {
+		status, err := c.GetVideoUploadStatus(context.Background(), "camera-asset")
+		require.NoError(t, err)
+		require.Equal(t, models.VideoUploadUploading, status.State)
+		require.Equal(t, now, status.Requested.End)
+		require.Equal(t, now, *status.RequestedAt)
+		require.Nil(t, status.Recorded)
+	})
+
+	t.Run("aggregates", func(t *testing.T) {
+		ref := models.SiteWiseReference{AssetId: "a", PropertyId: "p"}
+		values, err := c.GetPropertyAggregates(context.Background(), ref, models.SiteWiseOptions{Aggregate: models.SiteWiseAverage},
+			now.Add(-time.Hour), now, "", newResultLimiter(models.QueryLimits{}))
+		require.NoError(t, err)
+		require.Len(t, values, 2)
+		require.Equal(t, "2024-01-01T23:01:00Z", *values[1].Time)
+		require.Equal(t, 2.5, *values[1].Value.DoubleValue)
+
+		values, err = c.GetPropertyAggregates(context.Background(), ref, models.SiteWiseOptions{Aggregate: models.SiteWiseAverage},
+			now.Add(-time.Hour), now, "", newResultLimiter(models.QueryLimits{MaxPages: 1}))
+		require.True(t, isLimitExceeded(err))
+		require.Len(t, values, 1)
+	})
+
+	t.Run("interpolated values", func(t *testing.T) {
+		values, err := c.GetInterpolatedValues(context.Background(), models.SiteWiseReference{AssetId: "a", PropertyId: "p"},
+			models.SiteWiseOptions{Interpolation: models.SiteWiseLOCF}, now.Add(-time.Hour), now,
+			iottwinmakertypes.OrderByTimeDescending, newResultLimiter(models.QueryLimits{}))
+		require.NoError(t, err)
+		require.Len(t, values, 2)
+		require.Equal(t, 2.0, *values[0].Value.DoubleValue)
+	})
+
+	t.Run("assets without an upload request property", func(t *testing.T) {
+		err := c.RequestVideoUpload(context.Background(), "other-asset", models.VideoUploadRequest{})
+		require.ErrorContains(t, err, "asset other-asset is not an edge video connector")
+	})
+}
+
+func TestSiteWiseEndpoint(t *testing.T) {
+	tests := []struct {
+		region string
+		fips   bool
+		want   string
+	}{
+		{"eu-west-1", false, "https://data.iotsitewise.eu-west-1.amazonaws.com/properties"},
+		{"cn-north-1", false, "https://data.iotsitewise.cn-north-1.amazonaws.com.cn/properties"},
+		{"us-gov-west-1", true, "https://data.iotsitewise-fips.us-gov-west-1.amazonaws.com/properties"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.region, func(t *testing.T) {
+			c, err := newSiteWiseClient(context.Background(), aws.Config{Region: tt.region}, func(o *iottwinmaker.Options) {
+				if tt.fips {
+					o.EndpointOptions.UseFIPSEndpoint = aws.FIPSEndpointStateEnabled
+				}
+			})
+			require.NoError(t, err)
+			require.Equal(t, tt.want, c.url("data.", "/properties", nil))
+		})
+	}
+
+	_, err := newSiteWiseClient(context.Background(), aws.Config{})
+	require.ErrorContains(t, err, "no IoT SiteWise endpoint")
+}
+
+// siteWiseHistoryClient serves an entity with one SiteWise-connected component
+type siteWiseHistoryClient struct {
+	TwinMakerClient
+	mu   sync.Mutex
+	refs []models.SiteWiseReference
+	// TwinMaker history calls
+	historyCalls int
+}
+
+func (c *siteWiseHistoryClient) GetEntity(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetEntityOutput, error) {
+	externalId := &iottwinmakertypes.PropertyDefinitionResponse{IsExternalId: aws.Bool(true)}
+	return &iottwinmaker.GetEntityOutput{
+		EntityId: aws.String("pump-1"),
+		Components: map[string]iottwinmakertypes.ComponentResponse{
+			"sitewise": {ComponentTypeId: aws.String("com.example.pump"), Properties: map[string]iottwinmakertypes.PropertyResponse{
+				"assetId":     {Definition: externalId, Value: &iottwinmakertypes.DataValue{StringValue: aws.String("asset-1")}},
+				"propertyId":  {Definition: externalId, Value: &iottwinmakertypes.DataValue{StringValue: aws.String("temperature-id")}},
+				"temperature": {Definition: &iottwinmakertypes.PropertyDefinitionResponse{IsExternalId: aws.Bool(false)}},
+				"pressure": {Definition: &iottwinmakertypes.PropertyDefinitionResponse{
+					IsExternalId:  aws.Bool(false),
+					Configuration: map[string]string{"propertyId": "pressure-id"},
+				}},
+			}},
+			"local": {ComponentTypeId: aws.String("com.example.local"), Properties: map[string]iottwinmakertypes.PropertyResponse{}},
+		},
+	}, nil
+}
+
+func (c *siteWiseHistoryClient) GetSiteWiseHistory(ctx context.Context, query models.TwinMakerQuery, ref models.SiteWiseReference) ([]iottwinmakertypes.PropertyValue, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refs = append(c.refs, ref)
+	return []iottwinmakertypes.PropertyValue{
+		{Time: aws.String("2024-01-02T00:00:00Z"), Value: &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(21.5)}},
+	}, nil
+}
+
+func (c *siteWiseHistoryClient) ListEntities(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.ListEntitiesOutput, error) {
+	return &iottwinmaker.ListEntitiesOutput{EntitySummaries: []iottwinmakertypes.EntitySummary{{EntityId: aws.String("pump-1")}}}, nil
+}
+
+func (c *siteWiseHistoryClient) GetComponentType(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetComponentTypeOutput, error) {
+	return &iottwinmaker.GetComponentTypeOutput{}, nil
+}
+
+func (c *siteWiseHistoryClient) GetPropertyValueHistory(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetPropertyValueHistoryOutput, error) {
+	c.historyCalls++
+	return &iottwinmaker.GetPropertyValueHistoryOutput{}, nil
+}
+
+func TestSiteWiseEntityHistory(t *testing.T) {
+	client := &siteWiseHistoryClient{}
+	handler := NewTwinMakerHandler(client)
+	query := models.TwinMakerQuery{
+		WorkspaceId:   "ws",
+		EntityId:      "pump-1",
+		ComponentName: "sitewise",
+		Properties:    []string{"temperature", "pressure"},
+		SiteWise:      &models.SiteWiseOptions{Aggregate: models.SiteWiseAverage},
+	}
+
+	dr := handler.GetEntityHistory(context.Background(), query)
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames, 2)
+	require.ElementsMatch(t, []models.SiteWiseReference{
+		{AssetId: "asset-1", PropertyId: "temperature-id"},
+		{AssetId: "asset-1", PropertyId: "pressure-id"},
+	}, client.refs)
+	require.Equal(t, "pressure", dr.Frames[1].Fields[0].Name)
+	require.Equal(t, 21.5, *dr.Frames[1].Fields[0].At(0).(*float64))
+
+	// components without a SiteWise asset fall back to the TwinMaker history
+	query.ComponentName = "local"
+	dr = handler.GetEntityHistory(context.Background(), query)
+	require.NoError(t, dr.Error)
+	require.Empty(t, dr.Frames)
+	require.Len(t, client.refs, 2)
+}
+
+func TestSiteWiseComponentHistory(t *testing.T) {
+	client := &siteWiseHistoryClient{}
+	handler := NewTwinMakerHandler(client)
+	query := models.TwinMakerQuery{
+		WorkspaceId:     "ws",
+		ComponentTypeId: "com.example.pump",
+		Properties:      []string{"temperature", "pressure"},
+		SiteWise:        &models.SiteWiseOptions{Aggregate: models.SiteWiseAverage},
+	}
+
+	dr := handler.GetComponentHistory(context.Background(), query)
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames, 2)
+	require.Len(t, client.refs, 2)
+	require.Zero(t, client.historyCalls)
+	require.Nil(t, models.LoadMetaFromResponse(dr))
+
+	// components without a SiteWise asset fall back to the TwinMaker history
+	query.ComponentTypeId = "com.example.local"
+	dr = handler.GetComponentHistory(context.Background(), query)
+	require.NoError(t, dr.Error)
+	require.Equal(t, 1, client.historyCalls)
+}
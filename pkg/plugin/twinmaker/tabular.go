@@ -0,0 +1,170 @@
+package twinmaker
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// largest page TwinMaker returns for tabular property values
+const maxTabularPageSize = 250
+
+// tabularFields joins the rows of every table into one field per column.  Rows of data connectors may
+// each hold a different set of columns, so without a fixed set of columns they are the union of all
+// rows in name order.  Pages loaded one at a time are given the columns of the property group instead,
+// so every page has the same schema.  The cells a row does not have are left empty, and the cells that
+// do not fit the type of their column are dropped with a notice.
+func tabularFields(tables [][]map[string]iottwinmakertypes.DataValue, defs map[string]iottwinmakertypes.PropertyDefinitionResponse, columns []string) ([]*data.Field, *data.Notice) {
+	rows := countTabularRows(tables)
+	fixed := columns != nil
+	if !fixed {
+		found := map[string]bool{}
+		for _, table := range tables {
+			for _, row := range table {
+				for k := range row {
+					found[k] = true
+				}
+			}
+		}
+		columns = make([]string, 0, len(found))
+		for k := range found {
+			columns = append(columns, k)
+		}
+		sort.Strings(columns)
+	}
+
+	dropped := 0
+	droppedColumns := []string{}
+	fields := make([]*data.Field, 0, len(columns))
+	for _, column := range columns {
+		values := make([]*iottwinmakertypes.DataValue, 0, rows)
+		for _, table := range tables {
+			for _, row := range table {
+				if v, ok := row[column]; ok {
+					values = append(values, &v)
+				} else {
+					values = append(values, nil)
+				}
+			}
+		}
+
+		var def *iottwinmakertypes.PropertyDefinitionResponse
+		if d, ok := defs[column]; ok {
+			def = &d
+		}
+		fieldType := data.FieldTypeNullableString
+		if def != nil || !fixed {
+			fieldType = tabularFieldType(def, values)
+		}
+		f := data.NewFieldFromFieldType(fieldType, rows)
+		f.Name = column
+		skipped := 0
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+			if value, ok := tabularValue(fieldType, v); ok {
+				f.Set(i, value)
+			} else {
+				skipped++
+			}
+		}
+		if skipped > 0 {
+			dropped += skipped
+			droppedColumns = append(droppedColumns, column)
+		}
+		fields = append(fields, f)
+	}
+
+	if dropped == 0 {
+		return fields, nil
+	}
+	return fields, &data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     fmt.Sprintf("%d cells did not match the type of their column and are not shown: %s", dropped, strings.Join(droppedColumns, ", ")),
+	}
+}
+
+// tabularFieldType is the type of a column from its property definition, or else from the first
+// value found in the column
+func tabularFieldType(def *iottwinmakertypes.PropertyDefinitionResponse, values []*iottwinmakertypes.DataValue) data.FieldType {
+	if def != nil && def.DataType != nil {
+		switch def.DataType.Type {
+		case iottwinmakertypes.TypeBoolean:
+			return data.FieldTypeNullableBool
+		case iottwinmakertypes.TypeDouble:
+			return data.FieldTypeNullableFloat64
+		case iottwinmakertypes.TypeInteger:
+			return data.FieldTypeNullableInt32
+		case iottwinmakertypes.TypeLong:
+			return data.FieldTypeNullableInt64
+		case iottwinmakertypes.TypeString:
+			return data.FieldTypeNullableString
+		case iottwinmakertypes.TypeList, iottwinmakertypes.TypeMap, iottwinmakertypes.TypeRelationship:
+			return data.FieldTypeNullableJSON
+		}
+	}
+	for _, v := range values {
+		if v != nil {
+			f, _ := newDataValueField(v, 0)
+			return f.Type()
+		}
+	}
+	return data.FieldTypeNullableString
+}
+
+// tabularValue converts a cell to the column type.  Numbers are converted between number types when
+// no precision is lost, and written as text in string columns.  Anything else that does not match the
+// column is not converted.
+func tabularValue(fieldType data.FieldType, v *iottwinmakertypes.DataValue) (interface{}, bool) {
+	switch fieldType {
+	case data.FieldTypeNullableBool:
+		return v.BooleanValue, v.BooleanValue != nil
+	case data.FieldTypeNullableFloat64:
+		if n, ok := dataValueNumber(v); ok {
+			return &n, true
+		}
+	case data.FieldTypeNullableInt32:
+		if n, ok := dataValueNumber(v); ok && n == math.Trunc(n) && n >= math.MinInt32 && n <= math.MaxInt32 {
+			i := int32(n)
+			return &i, true
+		}
+	case data.FieldTypeNullableInt64:
+		if v.LongValue != nil {
+			return v.LongValue, true
+		}
+		if n, ok := dataValueNumber(v); ok && n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+			i := int64(n)
+			return &i, true
+		}
+	case data.FieldTypeNullableString:
+		if text, ok := dataValueText(v); ok {
+			return &text, true
+		}
+	default:
+		return dataValueRawJSON(v), true
+	}
+	return nil, false
+}
+
+// dataValueNumber reads any of the number values, or a string holding a number
+func dataValueNumber(v *iottwinmakertypes.DataValue) (float64, bool) {
+	switch {
+	case v.DoubleValue != nil:
+		return *v.DoubleValue, true
+	case v.LongValue != nil:
+		return float64(*v.LongValue), true
+	case v.IntegerValue != nil:
+		return float64(*v.IntegerValue), true
+	case v.StringValue != nil:
+		n, err := strconv.ParseFloat(*v.StringValue, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,76 @@
+package twinmaker
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTabularFields(t *testing.T) {
+	tables := [][]map[string]iottwinmakertypes.DataValue{
+		{
+			{"floc": {StringValue: aws.String("pump-1")}, "hours": {LongValue: aws.Int64(12)}},
+			{"floc": {StringValue: aws.String("pump-2")}, "crit": {StringValue: aws.String("A")}},
+		},
+		// the next page
+		{
+			{"hours": {DoubleValue: aws.Float64(3.5)}, "crit": {StringValue: aws.String("B")}},
+		},
+	}
+	defs := map[string]iottwinmakertypes.PropertyDefinitionResponse{
+		"hours": {DataType: &iottwinmakertypes.DataType{Type: iottwinmakertypes.TypeDouble}},
+	}
+
+	fields, notice := tabularFields(tables, defs, nil)
+	require.Nil(t, notice)
+	require.Equal(t, []string{"crit", "floc", "hours"}, fieldNames(fields))
+	for _, f := range fields {
+		require.Equal(t, 3, f.Len())
+	}
+
+	crit, floc, hours := fields[0], fields[1], fields[2]
+	require.Nil(t, crit.At(0))
+	require.Equal(t, "A", *crit.At(1).(*string))
+	require.Equal(t, "B", *crit.At(2).(*string))
+	require.Equal(t, "pump-2", *floc.At(1).(*string))
+	require.Nil(t, floc.At(2))
+
+	// typed by the definition, so longs and doubles share the column
+	require.Equal(t, data.FieldTypeNullableFloat64, hours.Type())
+	require.Equal(t, 12.0, *hours.At(0).(*float64))
+	require.Nil(t, hours.At(1))
+	require.Equal(t, 3.5, *hours.At(2).(*float64))
+}
+
+func TestTabularFieldsPaged(t *testing.T) {
+	// the page only holds some of the columns, and a cell that does not fit its column
+	tables := [][]map[string]iottwinmakertypes.DataValue{
+		{
+			{"hours": {DoubleValue: aws.Float64(3.5)}, "count": {DoubleValue: aws.Float64(2)}},
+			{"hours": {DoubleValue: aws.Float64(4)}, "count": {DoubleValue: aws.Float64(2.5)}},
+		},
+	}
+	defs := map[string]iottwinmakertypes.PropertyDefinitionResponse{
+		"count": {DataType: &iottwinmakertypes.DataType{Type: iottwinmakertypes.TypeInteger}},
+		"hours": {DataType: &iottwinmakertypes.DataType{Type: iottwinmakertypes.TypeDouble}},
+	}
+
+	fields, notice := tabularFields(tables, defs, []string{"count", "floc", "hours"})
+	require.Equal(t, []string{"count", "floc", "hours"}, fieldNames(fields))
+	count, floc, hours := fields[0], fields[1], fields[2]
+
+	// columns without a definition are strings, whatever the page holds
+	require.Equal(t, data.FieldTypeNullableString, floc.Type())
+	require.Nil(t, floc.At(0))
+	require.Equal(t, data.FieldTypeNullableFloat64, hours.Type())
+
+	// the double is not truncated into the integer column
+	require.Equal(t, data.FieldTypeNullableInt32, count.Type())
+	require.Equal(t, int32(2), *count.At(0).(*int32))
+	require.Nil(t, count.At(1))
+	require.NotNil(t, notice)
+	require.Equal(t, "1 cells did not match the type of their column and are not shown: count", notice.Text)
+}
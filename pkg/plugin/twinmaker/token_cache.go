@@ -0,0 +1,117 @@
+package twinmaker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// tokens with less time left are never handed out
+const minTokenValidity = time.Minute
+
+type tokenEntry struct {
+	credentials *ststypes.Credentials
+	refreshAt   time.Time
+}
+
+type tokenCall struct {
+	done        chan struct{}
+	credentials *ststypes.Credentials
+	err         error
+}
+
+// tokenCache shares session tokens between callers.  A token is refreshed once three quarters
+// of its lifetime have passed, and concurrent callers share a single AssumeRole call.
+type tokenCache struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]tokenEntry
+	calls  map[string]*tokenCall
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{
+		now:    time.Now,
+		tokens: make(map[string]tokenEntry),
+		calls:  make(map[string]*tokenCall),
+	}
+}
+
+// tokenKey identifies tokens that can be shared: same role, workspace, session policy and session name
+func tokenKey(role string, workspaceId string, policy string, sessionName string) string {
+	hash := sha256.Sum256([]byte(policy))
+	return role + "/" + workspaceId + "/" + hex.EncodeToString(hash[:8]) + "/" + sessionName
+}
+
+func (c *tokenCache) get(ctx context.Context, key string, duration time.Duration, fetch func(context.Context) (*ststypes.Credentials, error)) (*ststypes.Credentials, error) {
+	c.mu.Lock()
+	entry, ok := c.tokens[key]
+	c.mu.Unlock()
+
+	if ok && entry.credentials.Expiration != nil {
+		now := c.now()
+		if now.Before(entry.refreshAt) {
+			return entry.credentials, nil
+		}
+		if entry.credentials.Expiration.Sub(now) > minTokenValidity {
+			// still valid, so the caller does not wait for the new token
+			go func() {
+				if _, err := c.refresh(context.WithoutCancel(ctx), key, duration, fetch); err != nil {
+					backend.Logger.Warn("error refreshing session token", "error", err)
+				}
+			}()
+			return entry.credentials, nil
+		}
+	}
+	return c.refresh(ctx, key, duration, fetch)
+}
+
+func (c *tokenCache) refresh(ctx context.Context, key string, duration time.Duration, fetch func(context.Context) (*ststypes.Credentials, error)) (*ststypes.Credentials, error) {
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.credentials, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &tokenCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	// the call is shared, so it should not fail because the first caller went away
+	call.credentials, call.err = fetch(context.WithoutCancel(ctx))
+
+	c.mu.Lock()
+	if call.err == nil && call.credentials != nil {
+		c.evictExpired()
+		c.tokens[key] = tokenEntry{
+			credentials: call.credentials,
+			refreshAt:   c.now().Add(duration * 3 / 4),
+		}
+	}
+	delete(c.calls, key)
+	c.mu.Unlock()
+	close(call.done)
+
+	return call.credentials, call.err
+}
+
+// evictExpired forgets tokens that can no longer be handed out, since keys include the user
+// the map would otherwise keep every user that ever asked for a token.  Callers hold the lock.
+func (c *tokenCache) evictExpired() {
+	now := c.now()
+	for key, entry := range c.tokens {
+		if entry.credentials.Expiration == nil || entry.credentials.Expiration.Sub(now) <= minTokenValidity {
+			delete(c.tokens, key)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package twinmaker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newTokenCache()
+	c.now = func() time.Time { return now }
+
+	var calls atomic.Int32
+	fetch := func(ctx context.Context) (*ststypes.Credentials, error) {
+		n := calls.Add(1)
+		// slow enough for concurrent callers to overlap
+		time.Sleep(10 * time.Millisecond)
+		return &ststypes.Credentials{
+			SessionToken: aws.String(string(rune('a' + n - 1))),
+			Expiration:   aws.Time(now.Add(time.Hour)),
+		}, nil
+	}
+	ctx := context.Background()
+
+	t.Run("concurrent callers share one call", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				creds, err := c.get(ctx, "key", time.Hour, fetch)
+				require.NoError(t, err)
+				require.Equal(t, "a", *creds.SessionToken)
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("cached until the refresh time", func(t *testing.T) {
+		now = now.Add(30 * time.Minute)
+		creds, err := c.get(ctx, "key", time.Hour, fetch)
+		require.NoError(t, err)
+		require.Equal(t, "a", *creds.SessionToken)
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("refreshed in the background ahead of expiry", func(t *testing.T) {
+		now = now.Add(20 * time.Minute)
+		creds, err := c.get(ctx, "key", time.Hour, fetch)
+		require.NoError(t, err)
+		require.Equal(t, "a", *creds.SessionToken)
+		require.Eventually(t, func() bool {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return *c.tokens["key"].credentials.SessionToken == "b"
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("expired tokens are evicted", func(t *testing.T) {
+		now = now.Add(2 * time.Hour)
+		_, err := c.get(ctx, "other", time.Hour, fetch)
+		require.NoError(t, err)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		require.Len(t, c.tokens, 1)
+		require.Contains(t, c.tokens, "other")
+	})
+
+	t.Run("tokens are not shared between keys", func(t *testing.T) {
+		require.NotEqual(t, tokenKey("role", "a", "policy", "grafana"), tokenKey("role", "a", "other policy", "grafana"))
+		require.NotEqual(t, tokenKey("role", "a", "policy", "grafana"), tokenKey("role", "b", "policy", "grafana"))
+		require.NotEqual(t, tokenKey("role", "a", "policy", "grafana-alice"), tokenKey("role", "a", "policy", "grafana-bob"))
+	})
+}
@@ -1,14 +1,12 @@
 package twinmaker
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
-	"text/template"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
 	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
 
@@ -28,106 +26,13 @@ type IAMPolicy struct {
 	Statement []PolicyStatement `json:"Statement"`
 }
 
-func LoadPolicy(workspace *iottwinmaker.GetWorkspaceOutput) (string, error) {
-	data := map[string]interface{}{
-		"S3BucketArn":  workspace.S3Location,
-		"WorkspaceArn": workspace.Arn,
-		"WorkspaceId":  workspace.WorkspaceId,
-	}
-
-	policyTemplate := `{
-		"Version": "2012-10-17",
-		"Statement": [
-			{
-				"Action": [
-					"iottwinmaker:ListWorkspaces"
-				],
-				"Resource": [
-					"*"
-				],
-				"Effect": "Allow"
-			},
-			{
-				"Action": [
-					"iottwinmaker:Get*",
-					"iottwinmaker:List*",
-					"iottwinmaker:ExecuteQuery*"
-				],
-				"Resource": [
-					"{{.WorkspaceArn}}",
-					"{{.WorkspaceArn}}/*"
-				],
-				"Effect": "Allow"
-			},
-			{
-				"Effect": "Allow",
-				"Action": [
-				  "kinesisvideo:GetDataEndpoint",
-				  "kinesisvideo:GetHLSStreamingSessionURL"
-				],
-				"Resource": "*"
-			},
-			{
-				"Effect": "Allow",
-				"Action": [
-				  "iotsitewise:GetAssetPropertyValue",
-				  "iotsitewise:GetInterpolatedAssetPropertyValues"
-				],
-				"Resource": "*"
-			},
-			{
-				 "Effect": "Allow",
-				 "Action": [
-				  "iotsitewise:BatchPutAssetPropertyValue"
-				],
-				"Resource": "*",
-				"Condition": {
-				  "StringLike": {
-					"aws:ResourceTag/EdgeConnectorForKVS": "*{{.WorkspaceId}}*"
-				  } 
-				}
-			},
-			{
-				"Effect": "Allow",
-				"Action": ["s3:GetObject"],
-				"Resource": [
-					"{{.S3BucketArn}}", 
-					"{{.S3BucketArn}}/*"
-				]
-			}
-		]
-	}`
-
-	buffer := new(bytes.Buffer)
-	err := json.Compact(buffer, []byte(policyTemplate))
-	if err != nil {
-		return "", err
-	}
-	policyTemplate = buffer.String()
-
-	t := template.Must(template.New("policy").Parse(policyTemplate))
-	builder := &strings.Builder{}
-
-	err = t.Execute(builder, data)
-	if err != nil {
-		return "", err
-	}
-
-	return builder.String(), err
-}
-
-func checkForUrl(v *iottwinmakertypes.DataValue, convertor func(v *iottwinmakertypes.DataValue) interface{}) bool {
-	val := convertor(v)
-	switch val.(type) {
-	case *string:
-		val = *v.StringValue
-		if strings.Contains(val.(string), "://") {
-			return true
-		}
-	default:
-		break
-	}
-	return false
+// LoadPolicy renders the session policy template for the workspace
+func LoadPolicy(workspace *iottwinmaker.GetWorkspaceOutput, policyTemplate models.PolicyTemplate) (string, error) {
+	return policyTemplate.Render(models.PolicyWorkspace{
+		WorkspaceArn: aws.ToString(workspace.Arn),
+		WorkspaceId:  aws.ToString(workspace.WorkspaceId),
+		S3BucketArn:  aws.ToString(workspace.S3Location),
+	})
 }
 
 func setUrlDatalink(field *data.Field) {
@@ -181,10 +86,12 @@ func (s *twinMakerHandler) GetLatestPropertyValueHistoryPaginated(ctx context.Co
 		query.MaxResults = 0
 	}
 
-	propertyValueHistories, err := s.client.GetPropertyValueHistory(ctx, query)
+	propertyValueHistories, err := s.getHistoryPage(ctx, query)
 	if err != nil {
 		return nil, err
 	}
+	pages := 1
+	limiter := newResultLimiter(query.QueryLimits)
 
 	// Keep mapping of entityPropertyReferences to its index in the result's propertyValues
 	entityPropertyReferenceMapping := map[string]int{}
@@ -205,13 +112,19 @@ func (s *twinMakerHandler) GetLatestPropertyValueHistoryPaginated(ctx context.Co
 		}
 	}
 
-	cPropertyValuesHistories := propertyValueHistories
-	for cPropertyValuesHistories.NextToken != nil {
-		query.NextToken = *cPropertyValuesHistories.NextToken
-		cPropertyValuesHistories, err := s.client.GetPropertyValueHistory(ctx, query)
+	if err := limiter.add(countHistoryValues(propertyValueHistories), propertyValueHistories.PropertyValues, propertyValueHistories.NextToken); err != nil {
+		return propertyValueHistories, &PartialResultError{Pages: pages, Err: err}
+	}
+
+	var cPropertyValuesHistories *iottwinmaker.GetPropertyValueHistoryOutput
+	for propertyValueHistories.NextToken != nil {
+		query.NextToken = *propertyValueHistories.NextToken
+		cPropertyValuesHistories, err = s.getHistoryPage(ctx, query)
 		if err != nil {
-			return nil, err
+			// keep the pages loaded so far, NextToken still points at the page that failed
+			return propertyValueHistories, &PartialResultError{Pages: pages, Err: err}
 		}
+		pages++
 
 		for _, propertyValue := range cPropertyValuesHistories.PropertyValues {
 			refKey := GetEntityPropertyReferenceKey(propertyValue.EntityPropertyReference, propertyDefinitions)
@@ -231,16 +144,48 @@ func (s *twinMakerHandler) GetLatestPropertyValueHistoryPaginated(ctx context.Co
 		}
 
 		propertyValueHistories.NextToken = cPropertyValuesHistories.NextToken
+		if err := limiter.add(countHistoryValues(cPropertyValuesHistories), cPropertyValuesHistories.PropertyValues, cPropertyValuesHistories.NextToken); err != nil {
+			return propertyValueHistories, &PartialResultError{Pages: pages, Err: err}
+		}
 	}
 
 	return propertyValueHistories, nil
 }
 
+// countHistoryValues is the number of values on a history page, for the row limit
+func countHistoryValues(page *iottwinmaker.GetPropertyValueHistoryOutput) int {
+	rows := 0
+	for _, p := range page.PropertyValues {
+		rows += len(p.Values)
+	}
+	return rows
+}
+
+// getHistoryPage loads a single page of history, giving up once the query deadline has passed
+func (s *twinMakerHandler) getHistoryPage(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetPropertyValueHistoryOutput, error) {
+	if query.Deadline.IsZero() {
+		return s.client.GetPropertyValueHistory(ctx, query)
+	}
+	if !time.Now().Before(query.Deadline) {
+		return nil, ErrQueryTimeout
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, query.Deadline)
+	defer cancel()
+	res, err := s.client.GetPropertyValueHistory(ctx, query)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, ErrQueryTimeout
+	}
+	return res, err
+}
+
 func (s *twinMakerHandler) GetPropertyValueHistoryPaginated(ctx context.Context, query models.TwinMakerQuery, propertyDefinitions map[string]iottwinmakertypes.PropertyDefinitionResponse) (*iottwinmaker.GetPropertyValueHistoryOutput, error) {
-	propertyValueHistories, err := s.client.GetPropertyValueHistory(ctx, query)
+	propertyValueHistories, err := s.getHistoryPage(ctx, query)
 	if err != nil {
 		return nil, err
 	}
+	pages := 1
+	limiter := newResultLimiter(query.QueryLimits)
 
 	// Keep mapping of entityPropertyReferences to its index in the result's propertyValues
 	entityPropertyReferenceMapping := map[string]int{}
@@ -249,13 +194,19 @@ func (s *twinMakerHandler) GetPropertyValueHistoryPaginated(ctx context.Context,
 		entityPropertyReferenceMapping[refKey] = i
 	}
 
-	cPropertyValuesHistories := propertyValueHistories
-	for cPropertyValuesHistories.NextToken != nil {
-		query.NextToken = *cPropertyValuesHistories.NextToken
-		cPropertyValuesHistories, err := s.client.GetPropertyValueHistory(ctx, query)
+	if err := limiter.add(countHistoryValues(propertyValueHistories), propertyValueHistories.PropertyValues, propertyValueHistories.NextToken); err != nil {
+		return propertyValueHistories, &PartialResultError{Pages: pages, Err: err}
+	}
+
+	var cPropertyValuesHistories *iottwinmaker.GetPropertyValueHistoryOutput
+	for propertyValueHistories.NextToken != nil {
+		query.NextToken = *propertyValueHistories.NextToken
+		cPropertyValuesHistories, err = s.getHistoryPage(ctx, query)
 		if err != nil {
-			return nil, err
+			// keep the pages loaded so far, NextToken still points at the page that failed
+			return propertyValueHistories, &PartialResultError{Pages: pages, Err: err}
 		}
+		pages++
 
 		for _, propertyValue := range cPropertyValuesHistories.PropertyValues {
 			refKey := GetEntityPropertyReferenceKey(propertyValue.EntityPropertyReference, propertyDefinitions)
@@ -269,12 +220,17 @@ func (s *twinMakerHandler) GetPropertyValueHistoryPaginated(ctx context.Context,
 		}
 
 		propertyValueHistories.NextToken = cPropertyValuesHistories.NextToken
+		if err := limiter.add(countHistoryValues(cPropertyValuesHistories), cPropertyValuesHistories.PropertyValues, cPropertyValuesHistories.NextToken); err != nil {
+			return propertyValueHistories, &PartialResultError{Pages: pages, Err: err}
+		}
 	}
 
 	return propertyValueHistories, nil
 }
 
-func (s *twinMakerHandler) GetComponentHistoryWithLookupHelper(ctx context.Context, query models.TwinMakerQuery, historyFunction func(ctx context.Context, query models.TwinMakerQuery, propertyDefinitions map[string]iottwinmakertypes.PropertyDefinitionResponse) (*iottwinmaker.GetPropertyValueHistoryOutput, error)) (p []PropertyReference, n []data.Notice, err error) {
+// GetComponentHistoryWithLookupHelper resolves the entity of every value returned for a component type.
+// When only some of the history pages could be loaded, nextToken is set to continue from the first missing page.
+func (s *twinMakerHandler) GetComponentHistoryWithLookupHelper(ctx context.Context, query models.TwinMakerQuery, historyFunction func(ctx context.Context, query models.TwinMakerQuery, propertyDefinitions map[string]iottwinmakertypes.PropertyDefinitionResponse) (*iottwinmaker.GetPropertyValueHistoryOutput, error)) (p []PropertyReference, n []data.Notice, nextToken *string, err error) {
 	propertyReferences := []PropertyReference{}
 	failures := []data.Notice{}
 	componentTypeId := query.ComponentTypeId
@@ -282,15 +238,22 @@ func (s *twinMakerHandler) GetComponentHistoryWithLookupHelper(ctx context.Conte
 	// Step 1: Call GetComponentType to get the property list for externalId validation
 	ct, err := s.client.GetComponentType(ctx, query)
 	if err != nil {
-		return propertyReferences, failures, err
+		return propertyReferences, failures, nil, err
 	}
 
 	propertyDefinitions := ct.PropertyDefinitions
 
 	// Step 2: Call GetPropertyValueHistory and get the externalId from the response
 	result, err := historyFunction(ctx, query, propertyDefinitions)
-	if err != nil {
-		return propertyReferences, failures, err
+	var partial *PartialResultError
+	if errors.As(err, &partial) && result != nil {
+		failures = append(failures, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     partial.Error() + ", showing partial results",
+		})
+		nextToken = result.NextToken
+	} else if err != nil {
+		return propertyReferences, failures, nil, err
 	}
 
 	if len(result.PropertyValues) > 0 {
@@ -325,7 +288,7 @@ func (s *twinMakerHandler) GetComponentHistoryWithLookupHelper(ctx context.Conte
 				failures = append(failures, notice)
 			}
 			if le == nil {
-				return propertyReferences, failures, fmt.Errorf("error loading entities for GetAlarms query")
+				return propertyReferences, failures, nil, fmt.Errorf("error loading entities for GetAlarms query")
 			}
 
 			// Step 4: Call GetEntity to get the componentName of the externalId
@@ -341,7 +304,7 @@ func (s *twinMakerHandler) GetComponentHistoryWithLookupHelper(ctx context.Conte
 					}
 					failures = append(failures, notice)
 				} else if e == nil {
-					return propertyReferences, failures, fmt.Errorf("error loading entity for GetAlarms query")
+					return propertyReferences, failures, nil, fmt.Errorf("error loading entity for GetAlarms query")
 				}
 
 				componentName := ""
@@ -374,33 +337,46 @@ func (s *twinMakerHandler) GetComponentHistoryWithLookupHelper(ctx context.Conte
 		}
 	}
 
-	return propertyReferences, failures, nil
+	return propertyReferences, failures, nextToken, nil
 }
 
-func (s *twinMakerHandler) GetLatestComponentHistoryWithLookup(ctx context.Context, query models.TwinMakerQuery) (p []PropertyReference, n []data.Notice, err error) {
+func (s *twinMakerHandler) GetLatestComponentHistoryWithLookup(ctx context.Context, query models.TwinMakerQuery) (p []PropertyReference, n []data.Notice, nextToken *string, err error) {
 	return s.GetComponentHistoryWithLookupHelper(ctx, query, s.GetLatestPropertyValueHistoryPaginated)
 }
 
-func (s *twinMakerHandler) GetComponentHistoryWithLookup(ctx context.Context, query models.TwinMakerQuery) (p []PropertyReference, n []data.Notice, err error) {
+func (s *twinMakerHandler) GetComponentHistoryWithLookup(ctx context.Context, query models.TwinMakerQuery) (p []PropertyReference, n []data.Notice, nextToken *string, err error) {
 	return s.GetComponentHistoryWithLookupHelper(ctx, query, s.GetPropertyValueHistoryPaginated)
 }
 
+// filterHistoryValues keeps the values matching the filter groups TwinMaker could not evaluate
+func filterHistoryValues(values []iottwinmakertypes.PropertyValue, groups []models.TwinMakerFilterGroup, propertyName string) []iottwinmakertypes.PropertyValue {
+	filtered := make([]iottwinmakertypes.PropertyValue, 0, len(values))
+	for _, v := range values {
+		if models.MatchFilterGroups(groups, propertyName, v.Value) {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
+}
+
+// getTimeObjectFromStringTime reads a history timestamp with the layouts of models.ParseTimestamp
 func getTimeObjectFromStringTime(timeString *string) (*time.Time, error) {
 	if timeString == nil {
 		return nil, fmt.Errorf("no time string")
 	}
-	stringValue := *timeString
-	// Handle missing seconds value in the time string
-	index := 16 // Position for seconds
-	if string(stringValue[index]) != ":" {
-		stringValue = stringValue[:index] + ":00" + stringValue[index:]
-	}
-	// Convert to time object
-	t, err := time.Parse(time.RFC3339, stringValue)
+	t, err := models.ParseTimestamp(*timeString)
 	if err != nil {
-		fmt.Println(err.Error())
+		return nil, err
+	}
+	return &t, nil
+}
+
+// propertyValueTime is the time of a history value, from the deprecated timestamp when there is no time
+func propertyValueTime(v iottwinmakertypes.PropertyValue) (*time.Time, error) {
+	if v.Time == nil && v.Timestamp != nil {
+		return v.Timestamp, nil
 	}
-	return &t, err
+	return getTimeObjectFromStringTime(v.Time)
 }
 
 func getTimeStringFromTimeObject(timeObject *time.Time) *string {
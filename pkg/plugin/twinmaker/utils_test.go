@@ -6,7 +6,9 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
 
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
 	"github.com/stretchr/testify/require"
 )
 
@@ -17,9 +19,10 @@ func TestLoadPolicy(t *testing.T) {
 		WorkspaceId: aws.String("dummyWorkspaceId"),
 	}
 
-	policy, err := LoadPolicy(workspace)
+	policy, err := LoadPolicy(workspace, models.PolicyTemplate{})
 	require.NoError(t, err)
 	require.NotEmpty(t, policy)
+	require.Contains(t, policy, `"Resource":["dummyArn","dummyArn/*"]`)
 }
 
 func TestGetTimeObjectFromStringTime(t *testing.T) {
@@ -86,6 +89,50 @@ func TestGetTimeObjectFromStringTime(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, expectedResult, *actualResult)
 	})
+
+	t.Run("Convert connector timestamps to time objects", func(t *testing.T) {
+		expected := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+		for _, timeString := range []string{
+			"1700000000",
+			"1700000000000",
+			"1700000000000000",
+			"1700000000000000000",
+			"2023-11-14T22:13:20",
+			"2023-11-14 22:13:20",
+			"2023-11-14 22:13:20Z",
+			" 2023-11-14T22:13:20Z ",
+		} {
+			actualResult, err := getTimeObjectFromStringTime(&timeString)
+			require.NoError(t, err, timeString)
+			require.True(t, expected.Equal(*actualResult), timeString)
+		}
+
+		timeString := "1700000000.123"
+		actualResult, err := getTimeObjectFromStringTime(&timeString)
+		require.NoError(t, err)
+		require.Equal(t, expected.Add(123*time.Millisecond), *actualResult)
+	})
+
+	t.Run("Invalid time strings", func(t *testing.T) {
+		for _, timeString := range []string{"", "2022-04-27T17", "yesterday", "NaN"} {
+			_, err := getTimeObjectFromStringTime(&timeString)
+			require.Error(t, err, timeString)
+		}
+		_, err := getTimeObjectFromStringTime(nil)
+		require.Error(t, err)
+	})
+}
+
+func TestPropertyValueTime(t *testing.T) {
+	timestamp := time.Date(2022, 4, 27, 0, 0, 0, 0, time.UTC)
+	actualResult, err := propertyValueTime(iottwinmakertypes.PropertyValue{Timestamp: &timestamp})
+	require.NoError(t, err)
+	require.Equal(t, timestamp, *actualResult)
+
+	// the time takes precedence over the deprecated timestamp
+	actualResult, err = propertyValueTime(iottwinmakertypes.PropertyValue{Timestamp: &timestamp, Time: aws.String("2022-04-28T00:00:00Z")})
+	require.NoError(t, err)
+	require.Equal(t, timestamp.Add(24*time.Hour), *actualResult)
 }
 
 func TestGetTimeStringFromTimeObject(t *testing.T) {
@@ -0,0 +1,369 @@
+package twinmaker
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// GetVideoStreamURL resolves the video component of the entity to its stream, and returns a playback URL
+func (r *twinMakerResource) GetVideoStreamURL(ctx context.Context, workspaceId string, req models.VideoStreamRequest) (*models.VideoStreamURL, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	entity, err := r.client.GetEntity(ctx, models.TwinMakerQuery{
+		WorkspaceId: workspaceId,
+		EntityId:    req.EntityId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req.StreamName, err = videoStreamName(entity, req.ComponentName)
+	if err != nil {
+		return nil, err
+	}
+	return r.client.GetVideoStreamURL(ctx, workspaceId, req)
+}
+
+// RequestVideoUpload asks the edge connector of the video component to upload the recorded window.
+// The connector picks the request up on its own, so the returned status is pending.
+func (r *twinMakerResource) RequestVideoUpload(ctx context.Context, workspaceId string, identity models.TokenIdentity, req models.VideoUploadRequest) (*models.VideoUploadStatus, error) {
+	now := time.Now()
+	if err := req.Validate(now); err != nil {
+		return nil, err
+	}
+	componentName, assetId, err := r.edgeVideoAsset(ctx, workspaceId, req.EntityId, req.ComponentName)
+	if err != nil {
+		return nil, err
+	}
+	err = r.client.RequestVideoUpload(ctx, workspaceId, assetId, req)
+
+	status := "ok"
+	if err != nil {
+		status = "failed"
+	}
+	backend.Logger.Info("audit: RequestVideoUpload",
+		"user", identity.Login,
+		"email", identity.Email,
+		"role", identity.Role,
+		"workspace", workspaceId,
+		"entityId", req.EntityId,
+		"componentName", componentName,
+		"assetId", assetId,
+		"start", req.Start,
+		"end", req.End,
+		"status", status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &models.VideoUploadStatus{
+		EntityId:      req.EntityId,
+		ComponentName: componentName,
+		AssetId:       assetId,
+		State:         models.VideoUploadPending,
+		Requested:     &models.VideoRange{Start: req.Start, End: req.End},
+		RequestedAt:   &now,
+	}, nil
+}
+
+// GetVideoUploadStatus reads the last upload request of the edge connector of the video component
+func (r *twinMakerResource) GetVideoUploadStatus(ctx context.Context, workspaceId string, entityId string, componentName string) (*models.VideoUploadStatus, error) {
+	if entityId == "" {
+		return nil, models.MissingFieldError("entityId")
+	}
+	componentName, assetId, err := r.edgeVideoAsset(ctx, workspaceId, entityId, componentName)
+	if err != nil {
+		return nil, err
+	}
+	status, err := r.client.GetVideoUploadStatus(ctx, workspaceId, assetId)
+	if err != nil {
+		return nil, err
+	}
+	status.EntityId = entityId
+	status.ComponentName = componentName
+	return status, nil
+}
+
+// edgeVideoAsset resolves the video component of the entity to the SiteWise asset of its edge connector
+func (r *twinMakerResource) edgeVideoAsset(ctx context.Context, workspaceId string, entityId string, componentName string) (string, string, error) {
+	entity, err := r.client.GetEntity(ctx, models.TwinMakerQuery{
+		WorkspaceId: workspaceId,
+		EntityId:    entityId,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if componentName == "" {
+		if componentName = videoComponentName(entity); componentName == "" {
+			return "", "", &models.ValidationError{Errors: []models.FieldError{{
+				Path:    "entityId",
+				Message: fmt.Sprintf("entity %s has no video component", entityId),
+			}}}
+		}
+	}
+	component, ok := entity.Components[componentName]
+	if !ok {
+		return "", "", &models.ValidationError{Errors: []models.FieldError{{
+			Path:    "componentName",
+			Message: fmt.Sprintf("entity %s has no component %s", entityId, componentName),
+		}}}
+	}
+	property, ok := component.Properties[models.EdgeVideoAssetIdProperty]
+	if !ok || property.Value == nil || aws.ToString(property.Value.StringValue) == "" {
+		return "", "", &models.ValidationError{Errors: []models.FieldError{{
+			Path:    "componentName",
+			Message: fmt.Sprintf("component %s is not connected to an edge video connector, it has no %s value", componentName, models.EdgeVideoAssetIdProperty),
+		}}}
+	}
+	return componentName, aws.ToString(property.Value.StringValue), nil
+}
+
+// videoStreamName reads the stream name of the component, or of the first video component when no name is given
+func videoStreamName(entity *iottwinmaker.GetEntityOutput, componentName string) (string, error) {
+	names := []string{componentName}
+	if componentName == "" {
+		names = make([]string, 0, len(entity.Components))
+		for name := range entity.Components {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+	}
+	for _, name := range names {
+		component, ok := entity.Components[name]
+		if !ok {
+			return "", &models.ValidationError{Errors: []models.FieldError{{
+				Path:    "componentName",
+				Message: fmt.Sprintf("entity %s has no component %s", aws.ToString(entity.EntityId), name),
+			}}}
+		}
+		property, ok := component.Properties[models.KVSStreamNameProperty]
+		if !ok {
+			continue
+		}
+		if property.Value == nil || aws.ToString(property.Value.StringValue) == "" {
+			return "", fmt.Errorf("component %s has no %s value", name, models.KVSStreamNameProperty)
+		}
+		return aws.ToString(property.Value.StringValue), nil
+	}
+	if componentName != "" {
+		return "", &models.ValidationError{Errors: []models.FieldError{{
+			Path:    "componentName",
+			Message: fmt.Sprintf("component %s has no %s property", componentName, models.KVSStreamNameProperty),
+		}}}
+	}
+	return "", &models.ValidationError{Errors: []models.FieldError{{
+		Path:    "entityId",
+		Message: fmt.Sprintf("entity %s has no video component", aws.ToString(entity.EntityId)),
+	}}}
+}
+
+// fragments closer than this are shown as one span, the gaps between fragments are not missing video
+const videoFragmentGap = 2 * time.Second
+
+// GetVideoAvailability returns a state timeline of the video of the entity: spans that can be played,
+// spans only recorded on the edge device, and spans without video.
+func (s *twinMakerHandler) GetVideoAvailability(ctx context.Context, query models.TwinMakerQuery) (dr backend.DataResponse) {
+	entity, err := s.client.GetEntity(ctx, query)
+	if err != nil {
+		dr.Error = err
+		return
+	}
+	streamName, err := videoStreamName(entity, query.ComponentName)
+	if err != nil {
+		dr.Error = err
+		return
+	}
+
+	notices := []data.Notice{}
+	uploaded, err := s.client.ListVideoFragments(ctx, query, streamName)
+	if err != nil {
+		if !isLimitExceeded(err) {
+			dr.Error = err
+			return
+		}
+		notices = append(notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     err.Error() + ", the timeline only covers the fragments loaded so far",
+		})
+	}
+
+	recorded, skipped, err := s.edgeVideoRanges(ctx, query, entity)
+	switch {
+	case isLimitExceeded(err):
+		notices = append(notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     err.Error() + ", the timeline only covers the edge recordings loaded so far",
+		})
+	case err != nil:
+		notices = append(notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     "edge recordings could not be loaded: " + err.Error(),
+		})
+	}
+	if skipped != nil {
+		notices = append(notices, *skipped)
+	}
+
+	timeline := videoTimeline(query.TimeRange.From, query.TimeRange.To,
+		models.MergeVideoRanges(uploaded, videoFragmentGap),
+		models.MergeVideoRanges(recorded, videoFragmentGap))
+
+	fields := newTwinMakerFrameBuilder(len(timeline))
+	t := fields.Time()
+	state := fields.VideoState()
+	for i, change := range timeline {
+		t.Set(i, aws.Time(change.time))
+		state.Set(i, string(change.state))
+	}
+	frame := fields.ToFrame(streamName, nil)
+	frame.AppendNotices(notices...)
+	dr.Frames = append(dr.Frames, frame)
+	return
+}
+
+// edgeVideoRanges reads the spans the edge connector recorded, when the video component has them.
+// Spans that can not be read are left out, and reported in the returned notice.
+func (s *twinMakerHandler) edgeVideoRanges(ctx context.Context, query models.TwinMakerQuery, entity *iottwinmaker.GetEntityOutput) ([]models.VideoRange, *data.Notice, error) {
+	componentName := query.ComponentName
+	if componentName == "" {
+		componentName = videoComponentName(entity)
+	}
+	component, ok := entity.Components[componentName]
+	if !ok {
+		return nil, nil, nil
+	}
+	if _, ok := component.Properties[models.EdgeVideoRecordedProperty]; !ok {
+		return nil, nil, nil
+	}
+
+	// spans are written when a recording ends, so one that started before the range is still found
+	q := query
+	q.ComponentName = componentName
+	q.ComponentTypeId = ""
+	q.Properties = []string{models.EdgeVideoRecordedProperty}
+	q.PropertyFilter = nil
+	q.TimeRange.To = q.TimeRange.To.Add(models.MaxVideoWindow)
+
+	// the query limits already include the datasource limits
+	limiter := newResultLimiter(query.QueryLimits)
+	ranges := []models.VideoRange{}
+	skipped := 0
+	var lastErr error
+	notice := func() *data.Notice {
+		if skipped == 0 {
+			return nil
+		}
+		return &data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("%d edge recordings could not be read and are not shown: %s", skipped, lastErr.Error()),
+		}
+	}
+	for {
+		rsp, err := s.client.GetPropertyValueHistory(ctx, q)
+		if err != nil {
+			return ranges, notice(), err
+		}
+		for _, history := range rsp.PropertyValues {
+			for _, v := range history.Values {
+				if v.Value == nil || v.Value.StringValue == nil {
+					continue
+				}
+				r, err := models.ParseVideoRange(*v.Value.StringValue)
+				if err != nil {
+					skipped++
+					lastErr = err
+					continue
+				}
+				ranges = append(ranges, r)
+			}
+		}
+		if aws.ToString(rsp.NextToken) == "" {
+			return ranges, notice(), nil
+		}
+		if err := limiter.add(countHistoryValues(rsp), rsp.PropertyValues, rsp.NextToken); err != nil {
+			return ranges, notice(), err
+		}
+		q.NextToken = aws.ToString(rsp.NextToken)
+	}
+}
+
+// videoComponentName is the first component with a stream name, the same one videoStreamName picks
+func videoComponentName(entity *iottwinmaker.GetEntityOutput) string {
+	names := slices.Sorted(maps.Keys(entity.Components))
+	for _, name := range names {
+		if _, ok := entity.Components[name].Properties[models.KVSStreamNameProperty]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+type videoStateChange struct {
+	time  time.Time
+	state models.VideoAvailability
+}
+
+// videoTimeline lists the times the state of the video changes between from and to.  Video that
+// can be played wins over video on the edge device.  Ranges must not overlap within a list, as
+// returned by MergeVideoRanges, so both lists are walked once in time order.
+func videoTimeline(from time.Time, to time.Time, uploaded []models.VideoRange, recorded []models.VideoRange) []videoStateChange {
+	byStart := func(a, b models.VideoRange) int { return a.Start.Compare(b.Start) }
+	uploaded = slices.SortedFunc(slices.Values(uploaded), byStart)
+	recorded = slices.SortedFunc(slices.Values(recorded), byStart)
+
+	timeline := []videoStateChange{}
+	u, r := 0, 0
+	for t := from; t.Before(to); {
+		// ranges that ended are done with
+		for u < len(uploaded) && !uploaded[u].End.After(t) {
+			u++
+		}
+		for r < len(recorded) && !recorded[r].End.After(t) {
+			r++
+		}
+
+		state := models.VideoMissing
+		switch {
+		case u < len(uploaded) && !t.Before(uploaded[u].Start):
+			state = models.VideoAvailable
+		case r < len(recorded) && !t.Before(recorded[r].Start):
+			state = models.VideoOnEdge
+		}
+		if last := len(timeline) - 1; last < 0 || timeline[last].state != state {
+			timeline = append(timeline, videoStateChange{time: t, state: state})
+		}
+
+		// the next start or end of the current ranges
+		next := to
+		if u < len(uploaded) {
+			next = earliestAfter(t, next, uploaded[u])
+		}
+		if r < len(recorded) {
+			next = earliestAfter(t, next, recorded[r])
+		}
+		t = next
+	}
+	return timeline
+}
+
+// earliestAfter returns the start of the range when it is after t, or its end, when that is before next
+func earliestAfter(t time.Time, next time.Time, r models.VideoRange) time.Time {
+	edge := r.End
+	if r.Start.After(t) {
+		edge = r.Start
+	}
+	if edge.Before(next) {
+		return edge
+	}
+	return next
+}
@@ -0,0 +1,406 @@
+package twinmaker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// maximum number of entries TwinMaker accepts in one BatchPutPropertyValues call
+const maxBatchPutEntries = 10
+
+// maximum number of entries in one write request, each entry is validated and audited separately
+const maxWriteRequestEntries = 100
+
+func (r *twinMakerResource) BatchPutPropertyValues(ctx context.Context, workspaceId string, identity models.TokenIdentity, entries []iottwinmakertypes.PropertyValueEntry) (*iottwinmaker.BatchPutPropertyValuesOutput, error) {
+	if len(entries) == 0 {
+		return nil, models.MissingFieldError("entries")
+	}
+	if len(entries) > maxWriteRequestEntries {
+		return nil, &models.ValidationError{Errors: []models.FieldError{{
+			Path:    "entries",
+			Message: fmt.Sprintf("at most %d entries can be written at once", maxWriteRequestEntries),
+		}}}
+	}
+
+	entities, err := r.loadEntities(ctx, workspaceId, entries)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePropertyValueEntries(entries, entities); err != nil {
+		return nil, err
+	}
+
+	previous := r.previousValues(ctx, workspaceId, entries)
+
+	output := &iottwinmaker.BatchPutPropertyValuesOutput{}
+	for start := 0; start < len(entries); start += maxBatchPutEntries {
+		chunk := entries[start:min(start+maxBatchPutEntries, len(entries))]
+		input := &iottwinmaker.BatchPutPropertyValuesInput{
+			WorkspaceId: aws.String(workspaceId),
+			Entries:     chunk,
+		}
+		rsp, err := r.client.BatchPutPropertyValues(ctx, input)
+		for i, entry := range chunk {
+			auditPropertyValueEntry(workspaceId, identity, entry, previous[start+i], err)
+		}
+		if err != nil {
+			// the earlier chunks were written, so report how far the request got
+			return output, &PartialWriteError{Written: start, Total: len(entries), Output: output, Err: err}
+		}
+		output.ErrorEntries = append(output.ErrorEntries, rsp.ErrorEntries...)
+	}
+	return output, nil
+}
+
+// loadEntities gets every entity referenced by the entries, to check the property definitions
+func (r *twinMakerResource) loadEntities(ctx context.Context, workspaceId string, entries []iottwinmakertypes.PropertyValueEntry) (map[string]*iottwinmaker.GetEntityOutput, error) {
+	entities := make(map[string]*iottwinmaker.GetEntityOutput)
+	for _, entry := range entries {
+		if entry.EntityPropertyReference == nil || entry.EntityPropertyReference.EntityId == nil {
+			continue
+		}
+		entityId := *entry.EntityPropertyReference.EntityId
+		if _, ok := entities[entityId]; ok {
+			continue
+		}
+		entity, err := r.client.GetEntity(ctx, models.TwinMakerQuery{
+			WorkspaceId: workspaceId,
+			EntityId:    entityId,
+		})
+		if err != nil {
+			return nil, err
+		}
+		entities[entityId] = entity
+	}
+	return entities, nil
+}
+
+// validatePropertyValueEntries checks every entry writes values of the right type to an existing time series property
+func validatePropertyValueEntries(entries []iottwinmakertypes.PropertyValueEntry, entities map[string]*iottwinmaker.GetEntityOutput) error {
+	e := &models.ValidationError{}
+	fail := func(path string, format string, args ...interface{}) {
+		e.Errors = append(e.Errors, models.FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for i, entry := range entries {
+		path := fmt.Sprintf("entries[%d]", i)
+		ref := entry.EntityPropertyReference
+		if ref == nil {
+			fail(path+".entityPropertyReference", "is required")
+			continue
+		}
+		if aws.ToString(ref.EntityId) == "" {
+			fail(path+".entityPropertyReference.entityId", "is required")
+		}
+		if aws.ToString(ref.ComponentName) == "" {
+			fail(path+".entityPropertyReference.componentName", "is required")
+		}
+		if aws.ToString(ref.PropertyName) == "" {
+			fail(path+".entityPropertyReference.propertyName", "is required")
+		}
+		if len(entry.PropertyValues) == 0 {
+			fail(path+".propertyValues", "at least one value is required")
+		}
+
+		definition, err := findPropertyDefinition(entities[aws.ToString(ref.EntityId)], aws.ToString(ref.ComponentName), aws.ToString(ref.PropertyName))
+		if err != nil {
+			fail(path+".entityPropertyReference", "%s", err.Error())
+			continue
+		}
+		if definition == nil {
+			// missing reference fields were reported above
+			continue
+		}
+		if !aws.ToBool(definition.IsTimeSeries) {
+			fail(path+".entityPropertyReference.propertyName", "%q is not a time series property", aws.ToString(ref.PropertyName))
+		}
+
+		for j, v := range entry.PropertyValues {
+			vpath := fmt.Sprintf("%s.propertyValues[%d]", path, j)
+			if v.Time == nil && v.Timestamp == nil {
+				fail(vpath+".time", "is required")
+			}
+			if v.Value == nil {
+				fail(vpath+".value", "is required")
+				continue
+			}
+			if definition.DataType != nil && !dataValueHasType(v.Value, definition.DataType.Type) {
+				fail(vpath+".value", "must be a %s value", definition.DataType.Type)
+			}
+		}
+	}
+
+	if len(e.Errors) > 0 {
+		return e
+	}
+	return nil
+}
+
+func findPropertyDefinition(entity *iottwinmaker.GetEntityOutput, componentName string, propertyName string) (*iottwinmakertypes.PropertyDefinitionResponse, error) {
+	if entity == nil || componentName == "" || propertyName == "" {
+		return nil, nil
+	}
+	component, ok := entity.Components[componentName]
+	if !ok {
+		return nil, fmt.Errorf("component %q not found in entity %q", componentName, aws.ToString(entity.EntityId))
+	}
+	property, ok := component.Properties[propertyName]
+	if !ok || property.Definition == nil {
+		return nil, fmt.Errorf("property %q not found in component %q", propertyName, componentName)
+	}
+	return property.Definition, nil
+}
+
+func dataValueHasType(v *iottwinmakertypes.DataValue, t iottwinmakertypes.Type) bool {
+	switch t {
+	case iottwinmakertypes.TypeString:
+		return v.StringValue != nil
+	case iottwinmakertypes.TypeDouble:
+		return v.DoubleValue != nil
+	case iottwinmakertypes.TypeInteger:
+		return v.IntegerValue != nil
+	case iottwinmakertypes.TypeLong:
+		return v.LongValue != nil
+	case iottwinmakertypes.TypeBoolean:
+		return v.BooleanValue != nil
+	case iottwinmakertypes.TypeList:
+		return v.ListValue != nil
+	case iottwinmakertypes.TypeMap:
+		return v.MapValue != nil
+	case iottwinmakertypes.TypeRelationship:
+		return v.RelationshipValue != nil
+	}
+	return true
+}
+
+// previousValues loads the values each entry replaces for the audit log, the values already stored
+// at the written times.  Entries are grouped by component, so there is one history call per component,
+// and only its first page is read.  A missing previous value does not block the write.
+func (r *twinMakerResource) previousValues(ctx context.Context, workspaceId string, entries []iottwinmakertypes.PropertyValueEntry) [][]iottwinmakertypes.PropertyValue {
+	type component struct {
+		entityId      string
+		componentName string
+	}
+	groups := map[component][]int{}
+	components := []component{}
+	for i, entry := range entries {
+		ref := entry.EntityPropertyReference
+		key := component{aws.ToString(ref.EntityId), aws.ToString(ref.ComponentName)}
+		if _, ok := groups[key]; !ok {
+			components = append(components, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	previous := make([][]iottwinmakertypes.PropertyValue, len(entries))
+	for _, key := range components {
+		properties := []string{}
+		var from, to time.Time
+		for _, i := range groups[key] {
+			if name := aws.ToString(entries[i].EntityPropertyReference.PropertyName); !slices.Contains(properties, name) {
+				properties = append(properties, name)
+			}
+			for _, v := range entries[i].PropertyValues {
+				if t, err := propertyValueTime(v); err == nil {
+					if from.IsZero() || t.Before(from) {
+						from = *t
+					}
+					if t.After(to) {
+						to = *t
+					}
+				}
+			}
+		}
+		if from.IsZero() {
+			continue
+		}
+
+		rsp, err := r.client.GetPropertyValueHistory(ctx, models.TwinMakerQuery{
+			WorkspaceId:   workspaceId,
+			EntityId:      key.entityId,
+			ComponentName: key.componentName,
+			Properties:    properties,
+			TimeRange:     backend.TimeRange{From: from, To: to.Add(time.Millisecond)},
+		})
+		if err != nil {
+			backend.Logger.Debug("error loading previous values", "entityId", key.entityId, "componentName", key.componentName, "error", err)
+			continue
+		}
+		stored := map[string]iottwinmakertypes.PropertyValue{}
+		for _, history := range rsp.PropertyValues {
+			name := aws.ToString(history.EntityPropertyReference.PropertyName)
+			for _, v := range history.Values {
+				if t, err := propertyValueTime(v); err == nil {
+					stored[storedValueKey(name, *t)] = v
+				}
+			}
+		}
+		for _, i := range groups[key] {
+			name := aws.ToString(entries[i].EntityPropertyReference.PropertyName)
+			for _, v := range entries[i].PropertyValues {
+				if t, err := propertyValueTime(v); err == nil {
+					if prev, ok := stored[storedValueKey(name, *t)]; ok {
+						previous[i] = append(previous[i], prev)
+					}
+				}
+			}
+		}
+	}
+	return previous
+}
+
+func storedValueKey(propertyName string, t time.Time) string {
+	return propertyName + "/" + strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// auditPropertyValueEntry logs who wrote which values, and the value they replaced
+func auditPropertyValueEntry(workspaceId string, identity models.TokenIdentity, entry iottwinmakertypes.PropertyValueEntry, previous []iottwinmakertypes.PropertyValue, err error) {
+	ref := entry.EntityPropertyReference
+	values, _ := json.Marshal(entry.PropertyValues)
+	prev, _ := json.Marshal(previous)
+	status := "ok"
+	if err != nil {
+		status = "failed"
+	}
+	backend.Logger.Info("audit: BatchPutPropertyValues",
+		"user", identity.Login,
+		"email", identity.Email,
+		"role", identity.Role,
+		"workspace", workspaceId,
+		"entityId", aws.ToString(ref.EntityId),
+		"componentName", aws.ToString(ref.ComponentName),
+		"propertyName", aws.ToString(ref.PropertyName),
+		"values", string(values),
+		"previous", string(prev),
+		"status", status,
+	)
+}
+
+func (r *twinMakerResource) UpdateEntity(ctx context.Context, workspaceId string, identity models.TokenIdentity, update models.EntityUpdate) (*iottwinmaker.UpdateEntityOutput, error) {
+	if err := update.Validate(); err != nil {
+		return nil, err
+	}
+
+	// always load the current entity, the cached one may be stale
+	entity, err := r.client.GetEntity(ctx, models.TwinMakerQuery{
+		WorkspaceId: workspaceId,
+		EntityId:    update.EntityId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEntityUnchanged(entity, update); err != nil {
+		return nil, err
+	}
+	if err := validateEntityUpdate(entity, update); err != nil {
+		return nil, err
+	}
+
+	propertyUpdates := make(map[string]iottwinmakertypes.PropertyRequest, len(update.Properties))
+	for name, value := range update.Properties {
+		propertyUpdates[name] = iottwinmakertypes.PropertyRequest{
+			UpdateType: iottwinmakertypes.PropertyUpdateTypeUpdate,
+			Value:      &value,
+		}
+	}
+	rsp, err := r.client.UpdateEntity(ctx, &iottwinmaker.UpdateEntityInput{
+		WorkspaceId: aws.String(workspaceId),
+		EntityId:    aws.String(update.EntityId),
+		ComponentUpdates: map[string]iottwinmakertypes.ComponentUpdateRequest{
+			update.ComponentName: {
+				UpdateType:      iottwinmakertypes.ComponentUpdateTypeUpdate,
+				PropertyUpdates: propertyUpdates,
+			},
+		},
+	})
+
+	properties := entity.Components[update.ComponentName].Properties
+	for name, value := range update.Properties {
+		auditEntityPropertyUpdate(workspaceId, identity, update, name, value, properties[name].Value, err)
+	}
+	return rsp, err
+}
+
+// checkEntityUnchanged rejects updates prepared against an older version of the entity.
+// TwinMaker has no conditional updates, so a change between this check and the update is not detected.
+func checkEntityUnchanged(entity *iottwinmaker.GetEntityOutput, update models.EntityUpdate) error {
+	if entity.Status != nil && entity.Status.State != "" && entity.Status.State != iottwinmakertypes.StateActive {
+		return &models.EntityConflictError{EntityId: update.EntityId, State: string(entity.Status.State)}
+	}
+	if entity.UpdateDateTime == nil || !entity.UpdateDateTime.Equal(*update.UpdateDateTime) {
+		return &models.EntityConflictError{EntityId: update.EntityId, UpdateDateTime: entity.UpdateDateTime}
+	}
+	return nil
+}
+
+// validateEntityUpdate checks every property exists on the component, is not a time series, and gets a value of the right type
+func validateEntityUpdate(entity *iottwinmaker.GetEntityOutput, update models.EntityUpdate) error {
+	e := &models.ValidationError{}
+	fail := func(path string, format string, args ...interface{}) {
+		e.Errors = append(e.Errors, models.FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(update.Properties)) {
+		value := update.Properties[name]
+		path := fmt.Sprintf("properties.%s", name)
+		definition, err := findPropertyDefinition(entity, update.ComponentName, name)
+		if err != nil {
+			fail(path, "%s", err.Error())
+			continue
+		}
+		if definition == nil {
+			fail(path, "has no property definition")
+			continue
+		}
+		if aws.ToBool(definition.IsTimeSeries) {
+			fail(path, "is a time series property, use BatchPutPropertyValues")
+			continue
+		}
+		if aws.ToBool(definition.IsStoredExternally) {
+			fail(path, "is stored externally and can not be changed")
+			continue
+		}
+		if definition.DataType != nil && !dataValueHasType(&value, definition.DataType.Type) {
+			fail(path, "must be a %s value", definition.DataType.Type)
+		}
+	}
+
+	if len(e.Errors) > 0 {
+		return e
+	}
+	return nil
+}
+
+// auditEntityPropertyUpdate logs who changed which static property, and the value it replaced
+func auditEntityPropertyUpdate(workspaceId string, identity models.TokenIdentity, update models.EntityUpdate, propertyName string, value iottwinmakertypes.DataValue, previous *iottwinmakertypes.DataValue, err error) {
+	v, _ := json.Marshal(value)
+	prev, _ := json.Marshal(previous)
+	status := "ok"
+	if err != nil {
+		status = "failed"
+	}
+	backend.Logger.Info("audit: UpdateEntity",
+		"user", identity.Login,
+		"email", identity.Email,
+		"role", identity.Role,
+		"workspace", workspaceId,
+		"entityId", update.EntityId,
+		"componentName", update.ComponentName,
+		"propertyName", propertyName,
+		"value", string(v),
+		"previous", string(prev),
+		"status", status,
+	)
+}
@@ -0,0 +1,212 @@
+package twinmaker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iottwinmaker"
+	iottwinmakertypes "github.com/aws/aws-sdk-go-v2/service/iottwinmaker/types"
+	"github.com/grafana/grafana-iot-twinmaker-app/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+var entityUpdated = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// writeClient has a single entity with a double time series property and a static string property, and records the writes
+type writeClient struct {
+	TwinMakerClient
+	// errors returned by the next BatchPutPropertyValues calls, nil lets a call succeed
+	failures []error
+	// error entries reported by every BatchPutPropertyValues call
+	errorEntries []iottwinmakertypes.BatchPutPropertyErrorEntry
+
+	mu           sync.Mutex
+	batches      []int
+	historyCalls int
+	updates      []*iottwinmaker.UpdateEntityInput
+}
+
+func (c *writeClient) GetEntity(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetEntityOutput, error) {
+	return &iottwinmaker.GetEntityOutput{
+		EntityId:       aws.String(query.EntityId),
+		UpdateDateTime: aws.Time(entityUpdated),
+		Components: map[string]iottwinmakertypes.ComponentResponse{
+			"pump": {Properties: map[string]iottwinmakertypes.PropertyResponse{
+				"flow": {Definition: &iottwinmakertypes.PropertyDefinitionResponse{
+					DataType:     &iottwinmakertypes.DataType{Type: iottwinmakertypes.TypeDouble},
+					IsTimeSeries: aws.Bool(true),
+				}},
+				"serial": {Definition: &iottwinmakertypes.PropertyDefinitionResponse{
+					DataType: &iottwinmakertypes.DataType{Type: iottwinmakertypes.TypeString},
+				}},
+			}},
+		},
+	}, nil
+}
+
+// GetPropertyValueHistory has a stored flow value at the time flowEntry writes
+func (c *writeClient) GetPropertyValueHistory(ctx context.Context, query models.TwinMakerQuery) (*iottwinmaker.GetPropertyValueHistoryOutput, error) {
+	c.mu.Lock()
+	c.historyCalls++
+	c.mu.Unlock()
+	return &iottwinmaker.GetPropertyValueHistoryOutput{
+		PropertyValues: []iottwinmakertypes.PropertyValueHistory{{
+			EntityPropertyReference: &iottwinmakertypes.EntityPropertyReference{PropertyName: aws.String("flow")},
+			Values: []iottwinmakertypes.PropertyValue{{
+				Time:  aws.String("2024-01-01T00:00:00Z"),
+				Value: &iottwinmakertypes.DataValue{DoubleValue: aws.Float64(-1)},
+			}},
+		}},
+	}, nil
+}
+
+func (c *writeClient) BatchPutPropertyValues(ctx context.Context, req *iottwinmaker.BatchPutPropertyValuesInput) (*iottwinmaker.BatchPutPropertyValuesOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.failures) > 0 {
+		err := c.failures[0]
+		c.failures = c.failures[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.batches = append(c.batches, len(req.Entries))
+	return &iottwinmaker.BatchPutPropertyValuesOutput{ErrorEntries: c.errorEntries}, nil
+}
+
+func (c *writeClient) UpdateEntity(ctx context.Context, req *iottwinmaker.UpdateEntityInput) (*iottwinmaker.UpdateEntityOutput, error) {
+	c.updates = append(c.updates, req)
+	return &iottwinmaker.UpdateEntityOutput{State: iottwinmakertypes.StateUpdating}, nil
+}
+
+func flowEntry(property string, value iottwinmakertypes.DataValue) iottwinmakertypes.PropertyValueEntry {
+	return iottwinmakertypes.PropertyValueEntry{
+		EntityPropertyReference: &iottwinmakertypes.EntityPropertyReference{
+			EntityId:      aws.String("pump-1"),
+			ComponentName: aws.String("pump"),
+			PropertyName:  aws.String(property),
+		},
+		PropertyValues: []iottwinmakertypes.PropertyValue{{
+			Time:  aws.String("2024-01-01T00:00:00Z"),
+			Value: &value,
+		}},
+	}
+}
+
+func TestBatchPutPropertyValues(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("writes in batches of ten", func(t *testing.T) {
+		client := &writeClient{}
+		entries := []iottwinmakertypes.PropertyValueEntry{}
+		for i := 0; i < 25; i++ {
+			entries = append(entries, flowEntry("flow", iottwinmakertypes.DataValue{DoubleValue: aws.Float64(float64(i))}))
+		}
+		_, err := NewTwinMakerResource(client).BatchPutPropertyValues(ctx, "ws", models.TokenIdentity{Login: "jane"}, entries)
+		require.NoError(t, err)
+		require.Equal(t, []int{10, 10, 5}, client.batches)
+		// previous values are loaded once for the component
+		require.Equal(t, 1, client.historyCalls)
+	})
+
+	t.Run("finds the values a write replaces", func(t *testing.T) {
+		entries := []iottwinmakertypes.PropertyValueEntry{flowEntry("flow", iottwinmakertypes.DataValue{DoubleValue: aws.Float64(1)})}
+		previous := NewTwinMakerResource(&writeClient{}).(*twinMakerResource).previousValues(ctx, "ws", entries)
+		require.Len(t, previous, 1)
+		require.Len(t, previous[0], 1)
+		require.Equal(t, -1.0, *previous[0][0].Value.DoubleValue)
+	})
+
+	t.Run("reports what was written when a later chunk fails", func(t *testing.T) {
+		client := &writeClient{failures: []error{nil, fmt.Errorf("throttled")}}
+		entries := []iottwinmakertypes.PropertyValueEntry{}
+		for i := 0; i < 15; i++ {
+			entries = append(entries, flowEntry("flow", iottwinmakertypes.DataValue{DoubleValue: aws.Float64(float64(i))}))
+		}
+		rsp, err := NewTwinMakerResource(client).BatchPutPropertyValues(ctx, "ws", models.TokenIdentity{}, entries)
+		var partial *PartialWriteError
+		require.ErrorAs(t, err, &partial)
+		require.Equal(t, 10, partial.Written)
+		require.EqualError(t, err, "wrote 10 of 15 entries: throttled")
+		require.NotNil(t, rsp)
+	})
+
+	t.Run("validates entries against the property definitions", func(t *testing.T) {
+		client := &writeClient{}
+		entries := []iottwinmakertypes.PropertyValueEntry{
+			flowEntry("flow", iottwinmakertypes.DataValue{StringValue: aws.String("high")}),
+			flowEntry("serial", iottwinmakertypes.DataValue{StringValue: aws.String("abc")}),
+			flowEntry("missing", iottwinmakertypes.DataValue{DoubleValue: aws.Float64(1)}),
+		}
+		_, err := NewTwinMakerResource(client).BatchPutPropertyValues(ctx, "ws", models.TokenIdentity{}, entries)
+		require.EqualError(t, err, "invalid query: "+
+			"entries[0].propertyValues[0].value: must be a DOUBLE value; "+
+			"entries[1].entityPropertyReference.propertyName: \"serial\" is not a time series property; "+
+			"entries[2].entityPropertyReference: property \"missing\" not found in component \"pump\"")
+		require.Empty(t, client.batches)
+	})
+}
+
+func TestUpdateEntity(t *testing.T) {
+	ctx := context.Background()
+	update := func(updated time.Time, properties map[string]iottwinmakertypes.DataValue) models.EntityUpdate {
+		return models.EntityUpdate{
+			EntityId:       "pump-1",
+			ComponentName:  "pump",
+			UpdateDateTime: &updated,
+			Properties:     properties,
+		}
+	}
+
+	t.Run("updates static properties", func(t *testing.T) {
+		client := &writeClient{}
+		_, err := NewTwinMakerResource(client).UpdateEntity(ctx, "ws", models.TokenIdentity{Login: "jane"}, update(entityUpdated, map[string]iottwinmakertypes.DataValue{
+			"serial": {StringValue: aws.String("SN-42")},
+		}))
+		require.NoError(t, err)
+		require.Len(t, client.updates, 1)
+		property := client.updates[0].ComponentUpdates["pump"].PropertyUpdates["serial"]
+		require.Equal(t, "SN-42", *property.Value.StringValue)
+	})
+
+	t.Run("rejects updates to a changed entity", func(t *testing.T) {
+		client := &writeClient{}
+		_, err := NewTwinMakerResource(client).UpdateEntity(ctx, "ws", models.TokenIdentity{}, update(entityUpdated.Add(-time.Hour), map[string]iottwinmakertypes.DataValue{
+			"serial": {StringValue: aws.String("SN-42")},
+		}))
+		require.ErrorAs(t, err, new(*models.EntityConflictError))
+		require.Empty(t, client.updates)
+	})
+
+	t.Run("rejects time series and mistyped values", func(t *testing.T) {
+		client := &writeClient{}
+		_, err := NewTwinMakerResource(client).UpdateEntity(ctx, "ws", models.TokenIdentity{}, update(entityUpdated, map[string]iottwinmakertypes.DataValue{
+			"flow":   {DoubleValue: aws.Float64(1)},
+			"serial": {DoubleValue: aws.Float64(42)},
+		}))
+		require.True(t, models.IsValidationError(err))
+		require.ErrorContains(t, err, "properties.flow: is a time series property")
+		require.ErrorContains(t, err, "properties.serial: must be a STRING value")
+		require.Empty(t, client.updates)
+	})
+
+	t.Run("rejects empty property names", func(t *testing.T) {
+		client := &writeClient{}
+		_, err := NewTwinMakerResource(client).UpdateEntity(ctx, "ws", models.TokenIdentity{}, update(entityUpdated, map[string]iottwinmakertypes.DataValue{
+			"": {StringValue: aws.String("SN-42")},
+		}))
+		require.True(t, models.IsValidationError(err))
+		require.ErrorContains(t, err, "properties: property names must not be empty")
+		require.Empty(t, client.updates)
+
+		// without a definition the property is rejected, not read
+		err = validateEntityUpdate(nil, update(entityUpdated, map[string]iottwinmakertypes.DataValue{
+			"serial": {StringValue: aws.String("SN-42")},
+		}))
+		require.EqualError(t, err, "invalid query: properties.serial: has no property definition")
+	})
+}
@@ -17,33 +17,39 @@ export function getTwinMakerWorkspaceInfoSupplier(
         v.isHandled = true; // don't show an error popup
       });
     },
-    getWorkspaceInfo: () => req('list/options'),
-    getEntityInfo: (entityId: string) => {
-      return req('list/entity', { id: entityId }).catch((v) => {
+    getWorkspaceInfo: (workspaceId?: string) => req('list/options', withWorkspace({}, workspaceId)),
+    getEntityInfo: (entityId: string, workspaceId?: string) => {
+      return req('list/entity', withWorkspace({ id: entityId }, workspaceId)).catch((v) => {
         v.isHandled = true; // don't show an error popup
       });
     },
-    getEntity: (entityId: string) => {
-      return req('entity', { id: entityId }).catch((v) => {
+    getEntity: (entityId: string, workspaceId?: string) => {
+      return req('entity', withWorkspace({ id: entityId }, workspaceId)).catch((v) => {
         v.isHandled = true; // don't show an error popup
       });
     },
-    listScenes: () => req('list/scenes'),
+    listScenes: (workspaceId?: string) => req('list/scenes', withWorkspace({}, workspaceId)),
     getWorkspace: () => req('workspace'),
-    getToken: () => req('token'),
+    getToken: (workspaceId?: string) => req('token', withWorkspace({}, workspaceId)),
   };
 }
 
+function withWorkspace(params: Record<string, string>, workspaceId?: string) {
+  return workspaceId ? { ...params, workspaceId } : params;
+}
+
 export function getCachingWorkspaceInfoSupplier(supplier: TwinMakerWorkspaceInfoSupplier) {
-  let info: WorkspaceSelectionInfo | undefined = undefined;
+  const info = new Map<string, WorkspaceSelectionInfo>();
   return {
     ...supplier,
-    getWorkspaceInfo: () => {
-      if (info) {
-        return Promise.resolve(info);
+    getWorkspaceInfo: (workspaceId?: string) => {
+      const key = workspaceId ?? '';
+      const cached = info.get(key);
+      if (cached) {
+        return Promise.resolve(cached);
       }
-      return supplier.getWorkspaceInfo().then((v) => {
-        info = v;
+      return supplier.getWorkspaceInfo(workspaceId).then((v) => {
+        info.set(key, v);
         return v;
       });
     },
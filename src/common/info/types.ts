@@ -20,12 +20,13 @@ export interface WorkspaceSelectionInfo {
   properties: SelectableQueryResults;
 }
 
+// workspaceId defaults to the datasource workspace, other workspaces must be in the datasource allow-list
 export interface TwinMakerWorkspaceInfoSupplier {
   listWorkspaces: () => Promise<SelectableQueryResults>;
-  listScenes: () => Promise<SelectableQueryResults>;
-  getWorkspaceInfo: () => Promise<WorkspaceSelectionInfo>;
-  getEntityInfo: (entityId: string) => Promise<SelectableComponentInfo[]>;
-  getEntity: (entityId: string) => Promise<any>;
+  listScenes: (workspaceId?: string) => Promise<SelectableQueryResults>;
+  getWorkspaceInfo: (workspaceId?: string) => Promise<WorkspaceSelectionInfo>;
+  getEntityInfo: (entityId: string, workspaceId?: string) => Promise<SelectableComponentInfo[]>;
+  getEntity: (entityId: string, workspaceId?: string) => Promise<any>;
   getWorkspace: () => Promise<any>;
-  getToken: () => Promise<any>;
+  getToken: (workspaceId?: string) => Promise<any>;
 }
@@ -15,6 +15,8 @@ export enum TwinMakerQueryType {
   ComponentHistory = 'ComponentHistory',
   EntityHistory = 'EntityHistory',
   GetAlarms = 'GetAlarms',
+  GetSceneBindings = 'GetSceneBindings',
+  VideoAvailability = 'VideoAvailability',
 
   // Used for variable queries
   ListComponentTypes = 'ListComponentTypes',
@@ -39,6 +41,7 @@ export interface TwinMakerFilterValue {
   integerValue?: number;
   longValue?: number;
   stringValue?: string;
+  listValue?: TwinMakerFilterValue[];
 }
 
 export interface TwinMakerPropertyFilter {
@@ -47,11 +50,27 @@ export interface TwinMakerPropertyFilter {
   op: string;
 }
 
+/** Filters in a group must all match, groups are OR'ed together */
+export interface TwinMakerFilterGroup {
+  filter: TwinMakerPropertyFilter[];
+  negate?: boolean;
+}
+
 export interface TwinMakerTabularConditions {
   orderBy: TwinMakerOrderBy[];
   propertyFilter: TwinMakerPropertyFilter[];
 }
 
+/** Reads SiteWise-connected components straight from IoT SiteWise, as aggregates or interpolated values */
+export interface TwinMakerSiteWiseOptions {
+  aggregate?: 'AVERAGE' | 'COUNT' | 'MAXIMUM' | 'MINIMUM' | 'SUM' | 'STANDARD_DEVIATION';
+  /** Bucket size of aggregates, picked from the time range when empty */
+  resolution?: '1m' | '15m' | '1h' | '1d';
+  interpolation?: 'LINEAR_INTERPOLATION' | 'LOCF_INTERPOLATION';
+  /** Picked from the time range when empty */
+  intervalSeconds?: number;
+}
+
 export interface TwinMakerQuery extends DataQuery {
   queryType?: TwinMakerQueryType;
   nextToken?: string;
@@ -60,9 +79,21 @@ export interface TwinMakerQuery extends DataQuery {
   entityId?: string;
   componentName?: string;
   componentTypeId?: string;
+  sceneId?: string;
+  /** ListScenes also loads the capabilities, node count and bound entity count of every scene */
+  sceneDetails?: boolean;
   properties?: string[];
   filter?: TwinMakerPropertyFilter[];
+  filterGroups?: TwinMakerFilterGroup[];
   maxResults?: number;
+  /** Time budget in seconds, partial results are returned when exceeded */
+  timeoutSeconds?: number;
+  maxPages?: number;
+  maxRows?: number;
+  maxBytes?: number;
+  sitewise?: TwinMakerSiteWiseOptions;
+  /** Levels of nested map values expanded into fields, deeper values are shown as JSON.  Defaults to 1 */
+  flattenDepth?: number;
   order?: TwinMakerResultOrder;
   grafanaLiveEnabled: boolean;
   isStreaming?: boolean;
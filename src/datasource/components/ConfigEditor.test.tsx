@@ -94,4 +94,35 @@ describe('ConfigEditor', () => {
     rerender(<ConfigEditor options={{ ...rerenderOptions, version: 2 }} onOptionsChange={() => {}} />);
     waitFor(() => expect(error).not.toBeInTheDocument());
   });
+  it('should save workspace targets once they are valid JSON', async () => {
+    const onOptionsChange = jest.fn();
+    const user = userEvent.setup();
+    const options = {
+      ...datasourceOptions,
+      jsonData: {
+        defaultRegion: 'us-east-1',
+        workspaceTargets: [{ region: 'us-east-1', assumeRoleArn: 'arn', workspaceId: 'a' }],
+      },
+    };
+    render(<ConfigEditor options={options} onOptionsChange={onOptionsChange} />);
+    const input = screen.getByLabelText('Workspace targets');
+    const calls = onOptionsChange.mock.calls.length;
+
+    await user.clear(input);
+    await user.type(input, 'not json');
+    await user.tab();
+    expect(await screen.findByText('Invalid JSON')).toBeInTheDocument();
+    expect(onOptionsChange).toHaveBeenCalledTimes(calls);
+
+    await user.clear(input);
+    await user.paste('[{"region": "eu-west-1", "assumeRoleArn": "arn", "workspaceId": "b"}]');
+    await user.tab();
+    expect(onOptionsChange).toHaveBeenLastCalledWith(
+      expect.objectContaining({
+        jsonData: expect.objectContaining({
+          workspaceTargets: [{ region: 'eu-west-1', assumeRoleArn: 'arn', workspaceId: 'b' }],
+        }),
+      })
+    );
+  });
 });
@@ -7,7 +7,7 @@ import {
 } from '@grafana/data';
 import { config } from '@grafana/runtime';
 import { ConnectionConfig, ConnectionConfigProps, Divider } from '@grafana/aws-sdk';
-import { Select, Input, Alert, Field, SecureSocksProxySettings, Switch, useStyles2 } from '@grafana/ui';
+import { Select, Input, Alert, Field, SecureSocksProxySettings, Switch, TextArea, useStyles2 } from '@grafana/ui';
 import { standardRegions } from '../regions';
 import { TwinMakerDataSourceOptions, TwinMakerSecureJsonData } from '../types';
 import { getTwinMakerDatasource } from 'common/datasourceSrv';
@@ -93,6 +93,11 @@ export function ConfigEditor(props: Props) {
     }
   };
 
+  const onTokenDurationChange = (event: React.FormEvent<HTMLInputElement>) => {
+    const seconds = parseInt(event.currentTarget.value, 10);
+    updateDatasourcePluginJsonDataOption(props, 'tokenDurationSeconds', isNaN(seconds) ? undefined : seconds);
+  };
+
   const workspacesSelection = getSelectionInfo(props.options.jsonData.workspaceId, workspaces, undefined, true);
 
   const styles = useStyles2(getStyles);
@@ -161,10 +166,153 @@ export function ConfigEditor(props: Props) {
           </Field>
         )}
       </ConfigSection>
+      <Divider />
+      <ConfigSection
+        title="Federated workspaces"
+        description="Workspaces in other regions and accounts, queried as region/account/workspace"
+        isCollapsible={true}
+        isInitiallyOpen={!!props.options.jsonData.workspaceTargets?.length}
+      >
+        <JsonDataField
+          {...props}
+          id="workspaceTargets"
+          label="Workspace targets"
+          description="A list of targets with region, assumeRoleArn, workspaceId and an optional externalId"
+          placeholder='[{"region": "eu-west-1", "assumeRoleArn": "arn:aws:iam:*", "workspaceId": "site"}]'
+        />
+      </ConfigSection>
+      <Divider />
+      <ConfigSection
+        title="Session tokens"
+        description="Credentials vended to panels such as the scene viewer"
+        isCollapsible={true}
+        isInitiallyOpen={hasTokenSettings(props.options.jsonData)}
+      >
+        <Field
+          htmlFor="tokenDurationSeconds"
+          label="Token duration"
+          description="Lifetime of the session tokens in seconds, from 900 to 43200. Defaults to 3600"
+        >
+          <Input
+            id="tokenDurationSeconds"
+            type="number"
+            placeholder="3600"
+            min={900}
+            max={43200}
+            value={props.options.jsonData.tokenDurationSeconds ?? ''}
+            onChange={onTokenDurationChange}
+          />
+        </Field>
+        <Field
+          htmlFor="policyTemplate"
+          label="Session policy template"
+          description="IAM policy JSON using {{.WorkspaceArn}}, {{.WorkspaceId}}, {{.S3BucketArn}} and the policy variables. The default policy is used when empty"
+        >
+          <TextArea
+            id="policyTemplate"
+            rows={6}
+            value={props.options.jsonData.policyTemplate || ''}
+            onChange={onUpdateDatasourceJsonDataOption(props, 'policyTemplate')}
+          />
+        </Field>
+        <JsonDataField
+          {...props}
+          id="policyVariables"
+          label="Policy variables"
+          description="An object of extra variables for the policy template, used as {{.name}}"
+          placeholder='{"prefix": "site-a"}'
+        />
+        <JsonDataField
+          {...props}
+          id="policyRules"
+          label="Policy rules"
+          description="Session policies for some users. The first rule whose logins or organization roles match the user is used"
+          placeholder='[{"roles": ["Viewer"], "policyTemplate": "..."}]'
+        />
+        <Field
+          htmlFor="setSourceIdentity"
+          label="Set source identity"
+          description="Set the user login as STS source identity. The role trust policy must allow sts:SetSourceIdentity"
+        >
+          <Switch
+            id="setSourceIdentity"
+            value={!!props.options.jsonData.setSourceIdentity}
+            onChange={(e) => updateDatasourcePluginJsonDataOption(props, 'setSourceIdentity', e.currentTarget.checked)}
+          />
+        </Field>
+        <Field
+          htmlFor="sessionTags"
+          label="Session tags"
+          description="Tag sessions with the user login and role. The role trust policy must allow sts:TagSession"
+        >
+          <Switch
+            id="sessionTags"
+            value={!!props.options.jsonData.sessionTags}
+            onChange={(e) => updateDatasourcePluginJsonDataOption(props, 'sessionTags', e.currentTarget.checked)}
+          />
+        </Field>
+      </ConfigSection>
     </div>
   );
 }
 
+function hasTokenSettings(jsonData: TwinMakerDataSourceOptions): boolean {
+  return !!(
+    jsonData.tokenDurationSeconds ||
+    jsonData.policyTemplate ||
+    jsonData.policyVariables ||
+    jsonData.policyRules?.length ||
+    jsonData.setSourceIdentity ||
+    jsonData.sessionTags
+  );
+}
+
+type JsonDataKey = 'workspaceTargets' | 'policyVariables' | 'policyRules';
+
+type JsonDataFieldProps = Props & {
+  id: JsonDataKey;
+  label: string;
+  description: string;
+  placeholder: string;
+};
+
+/**
+ * Edits a structured setting as JSON text, the setting is only updated once the text parses
+ */
+function JsonDataField(props: JsonDataFieldProps) {
+  const { id, label, description, placeholder } = props;
+  const value = props.options.jsonData[id];
+  const [text, setText] = useState(value ? JSON.stringify(value, null, 2) : '');
+  const [error, setError] = useState('');
+
+  const onBlur = () => {
+    if (!text.trim()) {
+      setError('');
+      updateDatasourcePluginJsonDataOption(props, id, undefined);
+      return;
+    }
+    try {
+      updateDatasourcePluginJsonDataOption(props, id, JSON.parse(text));
+      setError('');
+    } catch (err) {
+      setError('Invalid JSON');
+    }
+  };
+
+  return (
+    <Field htmlFor={id} label={label} description={description} invalid={!!error} error={error}>
+      <TextArea
+        id={id}
+        rows={4}
+        placeholder={placeholder}
+        value={text}
+        onChange={(e) => setText(e.currentTarget.value)}
+        onBlur={onBlur}
+      />
+    </Field>
+  );
+}
+
 const getStyles = (theme: GrafanaTheme2) => ({
   formStyles: css({
     maxWidth: theme.spacing(50),
@@ -27,6 +27,7 @@ import {
   TwinMakerPropertyFilter,
   DEFAULT_PROPERTY_FILTER_OPERATOR,
   TwinMakerOrderBy,
+  TwinMakerSiteWiseOptions,
 } from 'common/manager';
 import { getTemplateSrv } from '@grafana/runtime';
 import { getVariableOptions } from 'common/variables';
@@ -46,6 +47,8 @@ interface State {
   workspaceLoading?: boolean;
   entity?: SelectableComponentInfo[];
   entityLoading?: boolean;
+  scenes?: SelectableQueryResults;
+  scenesLoading?: boolean;
   invalidInterval?: boolean;
   hasStreaming?: boolean;
 }
@@ -61,6 +64,7 @@ export class QueryEditor extends PureComponent<Props, State> {
   componentDidMount() {
     this.loadWorkspaceInfo();
     this.loadEntityInfo(this.props.query);
+    this.loadScenes(this.props.query);
     this.setState({ templateVars: getVariableOptions({ keepVarSyntax: true }) });
   }
 
@@ -91,10 +95,31 @@ export class QueryEditor extends PureComponent<Props, State> {
     }
   };
 
+  loadScenes = async (query: TwinMakerQuery) => {
+    const { datasource } = this.props;
+    if (datasource && query.queryType === TwinMakerQueryType.GetSceneBindings && !this.state.scenes) {
+      try {
+        this.setState({ scenesLoading: true });
+        const scenes = await datasource.info.listScenes();
+        this.setState({ scenes, scenesLoading: false });
+      } catch (ex) {
+        console.log('Error listing scenes', ex);
+        this.setState({ scenesLoading: false });
+      }
+    }
+  };
+
   onQueryTypeChange = (sel: SelectableValue<TwinMakerQueryType>) => {
     const { onChange, onRunQuery } = this.props;
     const query = changeQueryType(this.props.query, sel as QueryTypeInfo);
     onChange(query);
+    this.loadScenes(query);
+    onRunQuery();
+  };
+
+  onSceneIdChange = (event: SelectableValue<string>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, sceneId: event?.value });
     onRunQuery();
   };
 
@@ -131,6 +156,13 @@ export class QueryEditor extends PureComponent<Props, State> {
     }
   };
 
+  onPageSizeChange = (event: React.FormEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    const maxResults = event.currentTarget.valueAsNumber;
+    onChange({ ...query, maxResults: Number.isNaN(maxResults) || maxResults < 1 ? undefined : maxResults });
+    onRunQuery();
+  };
+
   onEntityIdChange = (event: SelectableValue<string>) => {
     this.onEntityIdTextChange(event?.value);
   };
@@ -235,6 +267,24 @@ export class QueryEditor extends PureComponent<Props, State> {
     onRunQuery();
   };
 
+  onSiteWiseChange = (sitewise?: TwinMakerSiteWiseOptions) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, sitewise });
+    onRunQuery();
+  };
+
+  onFlattenDepthChange = (flattenDepth?: number) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, flattenDepth });
+    onRunQuery();
+  };
+
+  onToggleSceneDetails = () => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, sceneDetails: !query.sceneDetails });
+    onRunQuery();
+  };
+
   onIntervalChange = (value?: string) => {
     const { onChange, query, onRunQuery } = this.props;
     // not sending input less than 5 secs
@@ -272,6 +322,27 @@ export class QueryEditor extends PureComponent<Props, State> {
     );
   }
 
+  renderSceneSelector(query: TwinMakerQuery) {
+    const scene = getSelectionInfo(query.sceneId, this.state.scenes, this.state.templateVars);
+    return (
+      <EditorField label="Scene" className={editorFieldStyles} width={30} htmlFor="scene">
+        <Select
+          id="scene"
+          aria-label="Scene"
+          width={30}
+          menuShouldPortal={true}
+          value={scene.current}
+          options={scene.options}
+          onChange={this.onSceneIdChange}
+          allowCustomValue={true}
+          onCreateOption={(sceneId) => this.onSceneIdChange({ value: sceneId })}
+          formatCreateLabel={(v) => `SceneID: ${v}`}
+          isLoading={this.state.scenesLoading}
+        />
+      </EditorField>
+    );
+  }
+
   renderComponentTypeSelector(
     query: TwinMakerQuery,
     compType: SelectionInfo<string>,
@@ -421,6 +492,27 @@ export class QueryEditor extends PureComponent<Props, State> {
     );
   }
 
+  renderPageSizeInput(query: TwinMakerQuery) {
+    return (
+      <EditorField
+        label="Page size"
+        tooltip="Rows loaded at a time, later pages are streamed when Grafana Live is enabled. Leave blank to load every row at once"
+        className={editorFieldStyles}
+        width={10}
+      >
+        <Input
+          className="width-10"
+          value={query.maxResults && query.maxResults > 0 ? query.maxResults : ''}
+          type="number"
+          onChange={this.onPageSizeChange}
+          placeholder="all"
+          min="1"
+          max="250"
+        />
+      </EditorField>
+    );
+  }
+
   getPropertiesMultiSelectionInfo(query: TwinMakerQuery, propOpts?: Array<SelectableValue<string>>) {
     if (!propOpts) {
       propOpts = [];
@@ -630,8 +722,21 @@ export class QueryEditor extends PureComponent<Props, State> {
     const { entity: entityInfo } = this.state;
     switch (query.queryType) {
       case TwinMakerQueryType.ListWorkspace:
-      case TwinMakerQueryType.ListScenes:
         return null; // nothing required
+      case TwinMakerQueryType.ListScenes:
+        return (
+          <EditorRow>
+            <EditorFieldGroup>
+              <EditorField
+                label="Scene details"
+                tooltip="Load the capabilities, node count and bound entity count of every scene"
+                width={15}
+              >
+                <Switch value={Boolean(query.sceneDetails)} onChange={this.onToggleSceneDetails} />
+              </EditorField>
+            </EditorFieldGroup>
+          </EditorRow>
+        );
       case TwinMakerQueryType.GetAlarms:
         return (
           <>
@@ -659,12 +764,30 @@ export class QueryEditor extends PureComponent<Props, State> {
           </EditorRow>
         );
 
+      case TwinMakerQueryType.GetSceneBindings:
+        return (
+          <EditorRow>
+            <EditorFieldGroup>{this.renderSceneSelector(query)}</EditorFieldGroup>
+          </EditorRow>
+        );
+
       case TwinMakerQueryType.GetEntity:
         return (
           <EditorRow>
             <EditorFieldGroup>{this.renderEntitySelector(query, false)}</EditorFieldGroup>
           </EditorRow>
         );
+      case TwinMakerQueryType.VideoAvailability: {
+        const compName = getSelectionInfo(query.componentName, entityInfo, this.state.templateVars);
+        return (
+          <EditorRow>
+            <EditorFieldGroup>
+              {this.renderEntitySelector(query, false)}
+              {this.renderComponentNameSelector(query, compName, true)}
+            </EditorFieldGroup>
+          </EditorRow>
+        );
+      }
       case TwinMakerQueryType.GetPropertyValue:
         if (query.entityId) {
           const compName = getSelectionInfo(query.componentName, entityInfo, this.state.templateVars);
@@ -693,7 +816,12 @@ export class QueryEditor extends PureComponent<Props, State> {
                 </EditorFieldGroup>
               </EditorRow>
               {propGroup && <EditorRow>{this.renderPropsFilterSelector(query, propOpts, isAthenaConnector)}</EditorRow>}
-              {propGroup && <EditorRow>{this.renderOrderBySelector(query, propOpts)}</EditorRow>}
+              {propGroup && (
+                <EditorRow>
+                  {this.renderOrderBySelector(query, propOpts)}
+                  {this.renderPageSizeInput(query)}
+                </EditorRow>
+              )}
             </>
           );
         }
@@ -716,6 +844,8 @@ export class QueryEditor extends PureComponent<Props, State> {
                 query={query}
                 grafanaLiveEnabled={this.props.datasource.grafanaLiveEnabled}
                 onOrderChange={this.onOrderChange}
+                onSiteWiseChange={this.onSiteWiseChange}
+                onFlattenDepthChange={this.onFlattenDepthChange}
                 renderStreamingInputs={() => this.renderStreamingInputs(query)}
               />
             </EditorRow>
@@ -736,6 +866,8 @@ export class QueryEditor extends PureComponent<Props, State> {
                 query={query}
                 grafanaLiveEnabled={this.props.datasource.grafanaLiveEnabled}
                 onOrderChange={this.onOrderChange}
+                onSiteWiseChange={this.onSiteWiseChange}
+                onFlattenDepthChange={this.onFlattenDepthChange}
                 renderStreamingInputs={() => this.renderStreamingInputs(query)}
               />
             </EditorRow>
@@ -1,9 +1,9 @@
 import { EditorField } from '@grafana/plugin-ui';
-import { CollapsableSection, Select } from '@grafana/ui';
-import { twinMakerOrderOptions } from 'datasource/queryInfo';
+import { CollapsableSection, Input, Select } from '@grafana/ui';
+import { twinMakerOrderOptions, twinMakerSiteWiseOptions, twinMakerSiteWiseResolutions } from 'datasource/queryInfo';
 import React from 'react';
 import { editorFieldStyles } from './QueryEditor';
-import { TwinMakerQueryType, TwinMakerQuery, TwinMakerResultOrder } from 'common/manager';
+import { TwinMakerQueryType, TwinMakerQuery, TwinMakerResultOrder, TwinMakerSiteWiseOptions } from 'common/manager';
 import { css } from '@emotion/css';
 import { SelectableValue } from '@grafana/data';
 
@@ -11,9 +11,18 @@ interface Props {
   query: TwinMakerQuery;
   grafanaLiveEnabled: boolean;
   onOrderChange: (value: SelectableValue<TwinMakerResultOrder>) => void;
+  onSiteWiseChange?: (value?: TwinMakerSiteWiseOptions) => void;
+  onFlattenDepthChange?: (value?: number) => void;
   renderStreamingInputs: () => React.JSX.Element | null;
 }
-export function QueryOptions({ query, onOrderChange, grafanaLiveEnabled, renderStreamingInputs }: Props) {
+export function QueryOptions({
+  query,
+  onOrderChange,
+  onSiteWiseChange,
+  onFlattenDepthChange,
+  grafanaLiveEnabled,
+  renderStreamingInputs,
+}: Props) {
   const sortable =
     query.queryType === TwinMakerQueryType.ComponentHistory || query.queryType === TwinMakerQueryType.EntityHistory;
   if (!grafanaLiveEnabled && !sortable) {
@@ -45,6 +54,67 @@ export function QueryOptions({ query, onOrderChange, grafanaLiveEnabled, renderS
               />
             </EditorField>
           )}
+          {sortable && onSiteWiseChange && (
+            <EditorField
+              htmlFor="sitewise"
+              label="IoT SiteWise"
+              tooltip="Read SiteWise-connected components directly from IoT SiteWise"
+              className={editorFieldStyles}
+              width={25}
+            >
+              <Select
+                id="sitewise"
+                aria-label="IoT SiteWise"
+                menuShouldPortal={true}
+                options={twinMakerSiteWiseOptions}
+                value={twinMakerSiteWiseOptions.find(
+                  (v) =>
+                    v.value?.aggregate === query.sitewise?.aggregate &&
+                    v.value?.interpolation === query.sitewise?.interpolation
+                )}
+                onChange={(v) => onSiteWiseChange(v?.value && { ...v.value })}
+                placeholder="through TwinMaker"
+                isClearable
+              />
+            </EditorField>
+          )}
+          {sortable && onSiteWiseChange && query.sitewise?.aggregate && (
+            <EditorField htmlFor="sitewise-resolution" label="Resolution" className={editorFieldStyles} width={15}>
+              <Select
+                id="sitewise-resolution"
+                aria-label="Resolution"
+                menuShouldPortal={true}
+                options={twinMakerSiteWiseResolutions}
+                value={twinMakerSiteWiseResolutions.find((v) => v.value === query.sitewise?.resolution)}
+                onChange={(v) => onSiteWiseChange({ ...query.sitewise, resolution: v?.value })}
+                placeholder="auto"
+                isClearable
+              />
+            </EditorField>
+          )}
+          {sortable && onFlattenDepthChange && (
+            <EditorField
+              htmlFor="flatten-depth"
+              label="Flatten depth"
+              tooltip="Levels of nested map values shown as fields of their own, deeper values are shown as JSON"
+              className={editorFieldStyles}
+              width={10}
+            >
+              <Input
+                id="flatten-depth"
+                aria-label="Flatten depth"
+                type="number"
+                min="0"
+                max="5"
+                value={query.flattenDepth ?? ''}
+                onChange={(e) => {
+                  const depth = e.currentTarget.valueAsNumber;
+                  onFlattenDepthChange(Number.isNaN(depth) ? undefined : depth);
+                }}
+                placeholder="1"
+              />
+            </EditorField>
+          )}
           {renderStreamingInputs()}
         </div>
       </CollapsableSection>
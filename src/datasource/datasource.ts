@@ -1,8 +1,24 @@
-import { Observable } from 'rxjs';
-import { DataFrame, DataQueryRequest, DataQueryResponse, DataSourceInstanceSettings, ScopedVars } from '@grafana/data';
-import { DataSourceWithBackend, getGrafanaLiveSrv, getTemplateSrv } from '@grafana/runtime';
+import { lastValueFrom, Observable } from 'rxjs';
+import {
+  DataFrame,
+  DataQueryRequest,
+  DataQueryResponse,
+  DataSourceInstanceSettings,
+  ScopedVars,
+  TimeRange,
+} from '@grafana/data';
+import { DataSourceWithBackend, getBackendSrv, getGrafanaLiveSrv, getTemplateSrv } from '@grafana/runtime';
 
-import { TwinMakerDataSourceOptions, AWSTokenInfo, TwinMakerCustomMeta } from './types';
+import {
+  TwinMakerDataSourceOptions,
+  AWSTokenInfo,
+  TwinMakerCustomMeta,
+  TwinMakerImportResult,
+  TwinMakerSceneRequest,
+  TwinMakerSceneVersion,
+  TwinMakerVideoStreamURL,
+  TwinMakerVideoUploadStatus,
+} from './types';
 import { Credentials } from 'aws-sdk/global';
 import { TwinMakerWorkspaceInfoSupplier } from 'common/info/types';
 import { getCachingWorkspaceInfoSupplier, getTwinMakerWorkspaceInfoSupplier } from 'common/info/info';
@@ -10,7 +26,15 @@ import { TwinMakerQueryType, TwinMakerQuery } from 'common/manager';
 import { Credentials as CredentialsV3 } from '@aws-sdk/types';
 import { getRequestLooper, MultiRequestTracker } from './requestLooper';
 import { appendMatchingFrames } from './appendFrames';
-import { BatchPutPropertyValuesResponse, Entries } from 'aws-sdk/clients/iottwinmaker';
+import {
+  BatchPutPropertyValuesResponse,
+  CreateSceneResponse,
+  DataValue,
+  Entries,
+  GetSceneResponse,
+  UpdateEntityResponse,
+  UpdateSceneResponse,
+} from 'aws-sdk/clients/iottwinmaker';
 
 export class TwinMakerDataSource extends DataSourceWithBackend<TwinMakerQuery, TwinMakerDataSourceOptions> {
   grafanaLiveEnabled: boolean;
@@ -70,7 +94,7 @@ export class TwinMakerDataSource extends DataSourceWithBackend<TwinMakerQuery, T
   }
 
   /**
-   * Supports template variables for entityId, componentName, selectedProperties, componentTypeId
+   * Supports template variables for entityId, componentName, selectedProperties, componentTypeId, sceneId
    */
   applyTemplateVariables(query: TwinMakerQuery, scopedVars: ScopedVars): TwinMakerQuery {
     const templateSrv = getTemplateSrv();
@@ -81,6 +105,7 @@ export class TwinMakerDataSource extends DataSourceWithBackend<TwinMakerQuery, T
       properties: query.properties?.map((p) => templateSrv.replace(p || '', scopedVars)) || [],
       propertyDisplayNames: query.propertyDisplayNames,
       componentTypeId: templateSrv.replace(query.componentTypeId || '', scopedVars),
+      sceneId: templateSrv.replace(query.sceneId || '', scopedVars),
     };
   }
 
@@ -147,6 +172,131 @@ export class TwinMakerDataSource extends DataSourceWithBackend<TwinMakerQuery, T
     return this.postResource('entity-properties', { entries });
   }
 
+  /**
+   * Parsed scene document, with the data bindings of every node
+   */
+  async getSceneDocument(sceneId: string): Promise<any> {
+    return this.getResource('scene-document', { id: sceneId });
+  }
+
+  /**
+   * Playback URL for the video component of an entity.  Without a range the live stream is played,
+   * otherwise the range is replayed, and keeps playing live when it has not ended yet.
+   */
+  async getVideoStreamURL(
+    entityId: string,
+    options: { componentName?: string; protocol?: 'HLS' | 'DASH'; range?: TimeRange; expiresSeconds?: number } = {}
+  ): Promise<TwinMakerVideoStreamURL> {
+    const params: Record<string, string | number> = { entityId };
+    if (options.componentName) {
+      params.componentName = options.componentName;
+    }
+    if (options.protocol) {
+      params.protocol = options.protocol;
+    }
+    if (options.range) {
+      params.from = options.range.from.valueOf();
+      params.to = options.range.to.valueOf();
+    }
+    if (options.expiresSeconds) {
+      params.expires = options.expiresSeconds;
+    }
+    return this.getResource('video-stream', params);
+  }
+
+  /**
+   * Ask the edge connector of the video component to upload the video recorded in the range
+   */
+  async requestVideoUpload(
+    entityId: string,
+    range: TimeRange,
+    componentName?: string
+  ): Promise<TwinMakerVideoUploadStatus> {
+    return this.postResource('video-upload', {
+      entityId,
+      componentName,
+      start: range.from.toISOString(),
+      end: range.to.toISOString(),
+    });
+  }
+
+  async getVideoUploadStatus(entityId: string, componentName?: string): Promise<TwinMakerVideoUploadStatus> {
+    const params: Record<string, string> = { entityId };
+    if (componentName) {
+      params.componentName = componentName;
+    }
+    return this.getResource('video-upload-status', params);
+  }
+
+  async getScene(sceneId: string): Promise<GetSceneResponse> {
+    return this.getResource('scene', { id: sceneId });
+  }
+
+  /**
+   * Save the scene document to the workspace bucket and create the scene
+   */
+  async createScene(scene: TwinMakerSceneRequest): Promise<CreateSceneResponse> {
+    return this.postResource('scene-create', scene);
+  }
+
+  /**
+   * Change the scene settings and document.  The replaced document is kept as a version.
+   */
+  async updateScene(scene: TwinMakerSceneRequest): Promise<UpdateSceneResponse> {
+    return this.postResource('scene-update', scene);
+  }
+
+  /**
+   * Earlier documents of the scene, newest first
+   */
+  async listSceneVersions(sceneId: string): Promise<TwinMakerSceneVersion[]> {
+    return this.getResource('scene-versions', { id: sceneId });
+  }
+
+  /**
+   * Make an earlier document the current one again
+   */
+  async rollbackScene(sceneId: string, version: string): Promise<UpdateSceneResponse> {
+    return this.postResource('scene-rollback', { sceneId, version });
+  }
+
+  /**
+   * Export every page of a query as a file, without the panel row limits
+   */
+  async exportQuery(query: TwinMakerQuery, range: TimeRange, format: 'csv' | 'ndjson' | 'parquet'): Promise<Blob> {
+    const rsp = await lastValueFrom(
+      getBackendSrv().fetch<Blob>({
+        url: `/api/datasources/uid/${this.uid}/resources/export?format=${format}`,
+        method: 'POST',
+        data: { query, from: range.from.toISOString(), to: range.to.toISOString() },
+        responseType: 'blob',
+      })
+    );
+    return rsp.data;
+  }
+
+  /**
+   * Import historical values from a CSV or NDJSON file with entityId, componentName, propertyName, timestamp and value
+   */
+  async importPropertyValues(file: Blob | string, format: 'csv' | 'ndjson'): Promise<TwinMakerImportResult> {
+    return this.postResource(`import?format=${format}`, file, {
+      headers: { 'Content-Type': format === 'csv' ? 'text/csv' : 'application/x-ndjson' },
+    });
+  }
+
+  /**
+   * Change static property values of an entity component.  `updateDateTime` is the entity update time
+   * the values were read at, the request fails with 409 when the entity has changed since.
+   */
+  async updateEntity(
+    entityId: string,
+    componentName: string,
+    updateDateTime: Date | string,
+    properties: Record<string, DataValue>
+  ): Promise<UpdateEntityResponse> {
+    return this.postResource('entity-update', { entityId, componentName, updateDateTime, properties });
+  }
+
   // Fetch temporary AWS tokens from the backend plugin and convert them into JS SDK Credentials
   async getTokens(): Promise<Credentials> {
     const tokenInfo = (await this.getResource('token')) as AWSTokenInfo;
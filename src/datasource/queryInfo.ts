@@ -1,5 +1,5 @@
 import { SelectableValue } from '@grafana/data';
-import { TwinMakerQueryType, TwinMakerQuery, TwinMakerResultOrder } from 'common/manager';
+import { TwinMakerQueryType, TwinMakerQuery, TwinMakerResultOrder, TwinMakerSiteWiseOptions } from 'common/manager';
 
 export interface QueryTypeInfo extends SelectableValue<TwinMakerQueryType> {
   value: TwinMakerQueryType; // not optional
@@ -44,6 +44,18 @@ export const twinMakerQueryTypes: QueryTypeInfo[] = [
     description: `Retrieves the list of scenes associated with a workspace.`,
     defaultQuery: {},
   },
+  {
+    label: 'Get Scene Bindings',
+    value: TwinMakerQueryType.GetSceneBindings,
+    description: `Lists the nodes of a scene, and which entity properties are bound to its tags and widgets.`,
+    defaultQuery: {},
+  },
+  {
+    label: 'Get Video Availability',
+    value: TwinMakerQueryType.VideoAvailability,
+    description: `Shows when video of an entity can be played, is only on the edge device, or is missing.`,
+    defaultQuery: {},
+  },
   {
     label: 'List Entities',
     value: TwinMakerQueryType.ListEntities,
@@ -104,3 +116,22 @@ export const twinMakerOrderOptions = [
     icon: 'arrow-down',
   },
 ];
+
+/** How history of SiteWise-connected components is read, empty reads it through TwinMaker */
+export const twinMakerSiteWiseOptions: Array<SelectableValue<TwinMakerSiteWiseOptions>> = [
+  { label: 'Average', value: { aggregate: 'AVERAGE' } },
+  { label: 'Minimum', value: { aggregate: 'MINIMUM' } },
+  { label: 'Maximum', value: { aggregate: 'MAXIMUM' } },
+  { label: 'Sum', value: { aggregate: 'SUM' } },
+  { label: 'Count', value: { aggregate: 'COUNT' } },
+  { label: 'Standard deviation', value: { aggregate: 'STANDARD_DEVIATION' } },
+  { label: 'Linear interpolation', value: { interpolation: 'LINEAR_INTERPOLATION' } },
+  { label: 'Last value interpolation', value: { interpolation: 'LOCF_INTERPOLATION' } },
+];
+
+export const twinMakerSiteWiseResolutions: Array<SelectableValue<TwinMakerSiteWiseOptions['resolution']>> = [
+  { label: '1 minute', value: '1m' },
+  { label: '15 minutes', value: '15m' },
+  { label: '1 hour', value: '1h' },
+  { label: '1 day', value: '1d' },
+];
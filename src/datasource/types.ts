@@ -18,13 +18,117 @@ export interface TwinMakerCustomMeta {
   nextToken?: string;
 }
 
+/**
+ * Outcome of a property value import, with the reason every failed row was not written
+ */
+export interface TwinMakerImportResult {
+  rows: number;
+  written: number;
+  errors?: Array<{ row: number; message: string }>;
+}
+
+/**
+ * Creates a scene, or changes the document and settings of an existing one
+ */
+export interface TwinMakerSceneRequest {
+  sceneId: string;
+  description?: string;
+  capabilities?: string[];
+  sceneMetadata?: Record<string, string>;
+  // Only used when the scene is created, must be in the workspace bucket and defaults to <sceneId>.json there.
+  // Every document is saved as a version next to it.
+  contentLocation?: string;
+  // The scene JSON, optional on updates that only change the settings
+  document?: object;
+}
+
+/**
+ * A document saved for a scene, other than the one the scene uses
+ */
+export interface TwinMakerSceneVersion {
+  version: string;
+  location: string;
+  lastModified: string;
+  size: number;
+}
+
+/**
+ * Playback URL for the video component of an entity, valid until the expiration
+ */
+export interface TwinMakerVideoStreamURL {
+  streamName: string;
+  protocol: 'HLS' | 'DASH';
+  playbackMode: 'LIVE' | 'LIVE_REPLAY' | 'ON_DEMAND';
+  url: string;
+  expiration: string;
+}
+
+export interface TwinMakerVideoRange {
+  start: string;
+  end: string;
+}
+
+export interface TwinMakerVideoUploadStatus {
+  entityId: string;
+  componentName: string;
+  assetId: string;
+  state: 'none' | 'pending' | 'uploading' | 'completed';
+  requested?: TwinMakerVideoRange;
+  requestedAt?: string;
+  uploaded?: TwinMakerVideoRange;
+  uploadedAt?: string;
+  recorded?: TwinMakerVideoRange;
+}
+
 /**
  * These are options configured for each DataSource instance
  */
 export interface TwinMakerDataSourceOptions extends AwsAuthDataSourceJsonData {
   workspaceId?: string;
+  /** Workspaces queries may use besides the default workspace */
+  allowedWorkspaces?: string[];
+  /** Workspaces in other regions and accounts, queried as region/account/workspace */
+  workspaceTargets?: TwinMakerWorkspaceTarget[];
   assumeRoleArnWriter?: string;
+  /** Organization roles allowed to write property values, Editor and Admin when empty */
+  writeRoles?: string[];
+  /** Logins allowed to write property values regardless of their role */
+  writeLogins?: string[];
+  /** Session policy template, with {{.WorkspaceArn}}, {{.WorkspaceId}}, {{.S3BucketArn}} and policyVariables */
+  policyTemplate?: string;
+  policyVariables?: Record<string, string>;
+  /** Session policies for some users, matched on login or organization role */
+  policyRules?: TwinMakerPolicyRule[];
+  /** Set the user login as STS source identity, requires sts:SetSourceIdentity in the role trust policy */
+  setSourceIdentity?: boolean;
+  /** Tag sessions with the user login and role, requires sts:TagSession in the role trust policy */
+  sessionTags?: boolean;
+  /** Lifetime of the session tokens vended to panels, 900 to 43200 seconds */
+  tokenDurationSeconds?: number;
+  /** Default time budget in seconds for loading every page of a query */
+  queryTimeoutSeconds?: number;
+  maxPages?: number;
+  maxRows?: number;
+  /** Estimated from the number of rows loaded */
+  maxBytes?: number;
+}
+
+/** A workspace in another region or account, addressed by queries as region/account/workspace */
+export interface TwinMakerWorkspaceTarget {
+  region: string;
+  assumeRoleArn: string;
+  externalId?: string;
+  workspaceId: string;
 }
+
+/** A session policy for the users matching any of the logins or organization roles */
+export interface TwinMakerPolicyRule {
+  logins?: string[];
+  roles?: string[];
+  policyTemplate?: string;
+  policyVariables?: Record<string, string>;
+}
+
 export interface TwinMakerSecureJsonData extends AwsAuthDataSourceSecureJsonData {
   // nothing for now
   anythingSecure?: string;